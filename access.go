@@ -0,0 +1,164 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	/* paths whose accesses are counted at once, further ones are dropped until reported */
+	access_pending_limit = 4096
+)
+
+// WithAccessEvents makes the "native" and "hybrid" Watchers report files opened or read, as FileOpen and FileAccess
+// notices, e.g. for audit trails of who touches sensitive files. Accesses of a file are coalesced: a notice is sent
+// at most once per window for every file and event, by the scan after the window passed, AccessInfo telling how
+// many it stands for. Only available on Linux, by inotify IN_OPEN and IN_ACCESS, so accesses within trees on SMB
+// shares aren't told, nor which process accessed a file, and those of the Watcher itself, e.g. checksumming or
+// WithLockWait probing files, are reported alike. Directories aren't reported.
+func WithAccessEvents(events Event, window time.Duration) Option {
+	return func(o *options) error {
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("Access events are only available on Linux")
+		}
+		if events == 0 || events&^(FileOpen|FileAccess) != 0 {
+			return fmt.Errorf("Access events must be FileOpen, FileAccess or both")
+		}
+		if window <= 0 {
+			return fmt.Errorf("Access window must be positive")
+		}
+		o.access, o.accessWin = events, window
+		return nil
+	}
+}
+
+// AccessInfo is the os.FileInfo of FileOpen and FileAccess notices, returned by Notice.More.
+type AccessInfo struct {
+	os.FileInfo
+	// Accesses the notice stands for, since the previous notice of the file and event
+	Count int
+	// When the first and last of them happened
+	First, Last time.Time
+}
+
+// accessLog counts accesses told by native events until reported, see WithAccessEvents.
+type accessLog struct {
+	events Event
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[accessKey]*accessEntry
+	/* accesses dropped as too many paths were pending */
+	dropped int
+}
+
+type accessKey struct {
+	path  string
+	event Event
+}
+
+type accessEntry struct {
+	count       int
+	first, last time.Time
+	/* the last notice of the path and event */
+	reported time.Time
+}
+
+// accessed is an entry due to be reported.
+type accessed struct {
+	accessKey
+	accessEntry
+}
+
+func newAccessLog(events Event, window time.Duration) *accessLog {
+	return &accessLog{events: events, window: window, entries: make(map[accessKey]*accessEntry)}
+}
+
+// add counts an access of path at at, unless its event isn't asked for.
+func (a *accessLog) add(path string, event Event, at time.Time) {
+	if a.events&event == 0 {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := accessKey{path, event}
+	e, ok := a.entries[key]
+	if !ok {
+		if len(a.entries) >= access_pending_limit {
+			a.dropped++
+			return
+		}
+		e = &accessEntry{}
+		a.entries[key] = e
+	}
+	if e.count == 0 {
+		e.first = at
+	}
+	e.count++
+	e.last = at
+}
+
+// due returns accesses not reported for a window as of now, resetting them, and the count of those dropped since
+// the previous call. Paths neither accessed nor reported for a window are forgotten.
+func (a *accessLog) due(now time.Time) ([]accessed, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var due []accessed
+	for key, e := range a.entries {
+		if now.Sub(e.reported) < a.window {
+			continue
+		}
+		if e.count == 0 {
+			delete(a.entries, key)
+			continue
+		}
+		due = append(due, accessed{key, *e})
+		*e = accessEntry{reported: now}
+	}
+	dropped := a.dropped
+	a.dropped = 0
+	return due, dropped
+}
+
+// accessed emits notices of accesses due, must be called from the Watch() goroutine. Paths are resolved ones,
+// accesses of files not matching or excluded are skipped.
+func (s *pathScanner) accessed(emit func(*fileSystemNotice)) {
+	due, dropped := s.access.due(time.Now())
+	if dropped > 0 {
+		s.logger.warn("Access events dropped, too many files accessed", "scan", s.scans, "dropped", dropped)
+	}
+	if len(due) == 0 {
+		return
+	}
+	resolved, err := s.resolve(s.address)
+	if err != nil {
+		return
+	}
+	for _, a := range due {
+		if !within(a.path, resolved) {
+			continue
+		}
+		file := s.address + a.path[len(resolved):]
+		if !s.matches(file) {
+			continue
+		}
+		if excluded, _ := s.excludedPath(file); excluded {
+			continue
+		}
+		info, ok := s.tracked(file)
+		if !ok {
+			if info, err = os.Lstat(a.path); err != nil {
+				continue
+			}
+		}
+		emit(&fileSystemNotice{
+			path:      file,
+			event:     a.event,
+			fileinfo:  &AccessInfo{FileInfo: info, Count: a.count, First: a.first, Last: a.last},
+			timestamp: time.Now(),
+		})
+	}
+}
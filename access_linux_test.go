@@ -0,0 +1,73 @@
+package fsmonitor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// TestAccessEvents reads a file repeatedly under the "native" Watcher, expecting accesses coalesced into one
+// FileOpen and one FileAccess notice.
+func TestAccessEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsmonitor-access-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "secret.txt")
+	if err := ioutil.WriteFile(file, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithPath(dir), fsmonitor.WithWatcher("native"),
+		fsmonitor.WithAccessEvents(fsmonitor.FileOpen|fsmonitor.FileAccess, time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileOpen|fsmonitor.FileAccess)
+	defer m.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().LastScan.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("No scan completed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := ioutil.ReadFile(file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	counts := make(map[fsmonitor.Event]int)
+	timeout := time.After(500 * time.Millisecond)
+	for len(counts) < 2 {
+		select {
+		case n := <-m.Notices():
+			info, ok := n.More().(*fsmonitor.AccessInfo)
+			if !ok || n.Name() != file {
+				t.Fatalf("Unexpected notice %v", n)
+			}
+			counts[n.Type()] += info.Count
+		case <-timeout:
+			t.Fatalf("Access notices not delivered, got %v", counts)
+		}
+	}
+	if counts[fsmonitor.FileOpen] != 3 {
+		t.Errorf("FileOpen stands for %d opens, expected 3", counts[fsmonitor.FileOpen])
+	}
+
+	/* further reads within the window are held back */
+	if _, err := ioutil.ReadFile(file); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case n := <-m.Notices():
+		t.Errorf("Notice %v sent within the window", n)
+	case <-time.After(300 * time.Millisecond):
+	}
+}
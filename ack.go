@@ -0,0 +1,254 @@
+package fsmonitor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AckNotice is implemented by notices delivered by Monitors given WithAcks, to be acknowledged once processed.
+type AckNotice interface {
+	Notice
+	// Ack acknowledges the notice as processed, it isn't redelivered afterwards
+	Ack()
+	// Nack asks for the notice to be redelivered right away, e.g. processing failed
+	Nack()
+}
+
+// AckJournal is implemented by Journals recording acknowledgments, so notices not acknowledged when a Monitor
+// stopped are redelivered by the next one given the same journal, see WithAcks. FileJournal implements it.
+type AckJournal interface {
+	Journal
+	// Ack records the notice appended at t as acknowledged
+	Ack(t time.Time, n Notice) error
+	// Unacked calls fn with the notices appended but not acknowledged and the time they were appended at, in order
+	Unacked(fn func(t time.Time, n Notice) error) error
+}
+
+// WithAcks delivers notices at least once: notices of Notices() implement AckNotice, those not acknowledged within
+// timeout of their delivery, or nacked, are delivered again until acknowledged. Given a Journal implementing
+// AckJournal by WithJournal, notices left unacknowledged by a Monitor are delivered first by the next one started,
+// see Monitor.Close for stopping without leaving notices behind. Batches and OverflowSpill don't carry acks.
+func WithAcks(timeout time.Duration) Option {
+	return func(o *options) error {
+		if timeout <= 0 {
+			return fmt.Errorf("Ack timeout must be positive")
+		}
+		o.ackWait = timeout
+		return nil
+	}
+}
+
+// ackNotice implements AckNotice by wrapping the delivered Notice.
+type ackNotice struct {
+	Notice
+	acks *acker
+	seq  uint64
+}
+
+func (a *ackNotice) Unwrap() Notice {
+	return a.Notice
+}
+
+func (a *ackNotice) Ack() {
+	a.acks.ack(a.seq)
+}
+
+func (a *ackNotice) Nack() {
+	a.acks.nack(a.seq)
+}
+
+// inflight is a notice delivered but not acknowledged yet.
+type inflight struct {
+	n *ackNotice
+	/* appended to the journal at */
+	at time.Time
+	/* redelivered once passed */
+	due time.Time
+}
+
+// acker keeps the notices in flight of a Monitor given WithAcks.
+type acker struct {
+	timeout time.Duration
+	journal AckJournal
+	logger  logSink
+
+	mu       sync.Mutex
+	seq      uint64
+	inflight map[uint64]*inflight
+	/* closed and replaced once a notice is acknowledged */
+	changed chan struct{}
+}
+
+func newAcker(timeout time.Duration, j Journal, logger logSink) *acker {
+	a := &acker{timeout: timeout, logger: logger, inflight: make(map[uint64]*inflight), changed: make(chan struct{})}
+	a.journal, _ = j.(AckJournal)
+	return a
+}
+
+// track wraps n delivered now, appended to the journal at, to be acknowledged.
+func (a *acker) track(n Notice, at time.Time) Notice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	an := &ackNotice{Notice: n, acks: a, seq: a.seq}
+	a.inflight[a.seq] = &inflight{n: an, at: at, due: time.Now().Add(a.timeout)}
+	return an
+}
+
+// restore returns the notices the journal has unacknowledged, tracked as delivered now.
+func (a *acker) restore() []Notice {
+	if a.journal == nil {
+		return nil
+	}
+	var notices []Notice
+	err := a.journal.Unacked(func(t time.Time, n Notice) error {
+		notices = append(notices, a.track(n, t))
+		return nil
+	})
+	if err != nil {
+		a.logger.error("Failed to read unacknowledged notices", "error", err)
+	}
+	if len(notices) > 0 {
+		a.logger.info("Redelivering unacknowledged notices", "notices", len(notices))
+	}
+	return notices
+}
+
+func (a *acker) ack(seq uint64) {
+	a.mu.Lock()
+	f, ok := a.inflight[seq]
+	if ok {
+		delete(a.inflight, seq)
+		close(a.changed)
+		a.changed = make(chan struct{})
+	}
+	a.mu.Unlock()
+
+	if ok && a.journal != nil {
+		if err := a.journal.Ack(f.at, f.n.Notice); err != nil {
+			a.logger.error("Failed to journal acknowledgment", "path", f.n.Name(), "event", f.n.Type(), "error", err)
+		}
+	}
+}
+
+func (a *acker) nack(seq uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if f, ok := a.inflight[seq]; ok {
+		f.due = time.Time{}
+	}
+}
+
+// due returns the notices to redeliver at now, due again a timeout later.
+func (a *acker) due(now time.Time) []Notice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var due []*ackNotice
+	for _, f := range a.inflight {
+		if now.Before(f.due) {
+			continue
+		}
+		f.due = now.Add(a.timeout)
+		due = append(due, f.n)
+	}
+	/* in order of delivery */
+	sort.Slice(due, func(i, j int) bool { return due[i].seq < due[j].seq })
+	notices := make([]Notice, len(due))
+	for i, n := range due {
+		notices[i] = n
+	}
+	return notices
+}
+
+// pending returns the number of notices in flight, and a channel closed once one is acknowledged.
+func (a *acker) pending() (int, <-chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.inflight), a.changed
+}
+
+// Close stops the Monitor as Stop does, delivering notices buffered, held back by WithDebounce or spilled to
+// consumers and sinks instead of dropping them, until ctx is done. Given WithAcks, it waits for the notices in flight
+// to be acknowledged too before closing Notices(), redelivering them as usual. Returns ctx.Err() if notices were left
+// undelivered, unacknowledged or unpublished by sinks, see StopAndDrain for a timeout.
+func (m *Monitor) Close(ctx context.Context) error {
+	m.mu.Lock()
+	m.drain = ctx
+	m.mu.Unlock()
+
+	/* consumers not keeping up must not hold closing up beyond ctx */
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			m.halting.Do(func() { close(m.halt) })
+		case <-stopped:
+		}
+	}()
+	if err := m.stop(); err != nil {
+		return err
+	}
+
+	published := make(chan struct{})
+	go func() {
+		m.sinks.Wait()
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-ctx.Done():
+		m.logger.warn("Closing with sinks publishing", "error", ctx.Err())
+		return ctx.Err()
+	}
+
+	m.mu.Lock()
+	undrained := m.undrained
+	m.mu.Unlock()
+	if undrained {
+		return ctx.Err()
+	}
+	if m.acks != nil {
+		if n, _ := m.acks.pending(); n > 0 {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// StopAndDrain stops the Monitor as Close does, giving up delivering what's left after timeout.
+func (m *Monitor) StopAndDrain(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return m.Close(ctx)
+}
+
+// acked waits for notices in flight to be acknowledged until ctx is done, redelivering them every tick by send.
+func (m *Monitor) acked(ctx context.Context, tick <-chan time.Time, send func(Notice)) {
+	for {
+		n, changed := m.acks.pending()
+		if n == 0 {
+			return
+		}
+		select {
+		case now := <-tick:
+			for _, n := range m.acks.due(now) {
+				send(n)
+			}
+		case <-changed:
+		case <-ctx.Done():
+			m.logger.warn("Closing with notices unacknowledged", "notices", n)
+			return
+		}
+	}
+}
+
+// draining returns the context of Close, nil unless closing.
+func (m *Monitor) draining() context.Context {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.drain
+}
@@ -0,0 +1,53 @@
+package fsmonitor_test
+
+import (
+	"encoding/json"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+func TestAcksKeepIDs(t *testing.T) {
+	w, err := fsmonitor.FSWatcher(fstest.MapFS{"a.txt": {Data: []byte("a")}}, nil, fsmonitor.WithInitialScan(fsmonitor.EmitExisting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w), fsmonitor.WithIDs(fsmonitor.ULID), fsmonitor.WithAcks(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileCreate)
+	defer m.Stop()
+
+	var n fsmonitor.Notice
+	select {
+	case n = <-m.Notices():
+	case <-time.After(5 * time.Second):
+		t.Fatal("No notice delivered")
+	}
+	var ack fsmonitor.AckNotice
+	if !fsmonitor.NoticeAs(n, &ack) {
+		t.Fatalf("Notice %v doesn't implement AckNotice", n)
+	}
+	defer ack.Ack()
+	var in fsmonitor.IdentifiedNotice
+	if !fsmonitor.NoticeAs(n, &in) || in.ID() == "" {
+		t.Fatalf("Notice %v has no ID", n)
+	}
+
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ID != in.ID() {
+		t.Errorf("Encoded ID %q, expected %q in %s", r.ID, in.ID(), data)
+	}
+}
@@ -0,0 +1,57 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	/* factors the interval shrinks by after a scan noticing changes, and grows by after a quiet one */
+	adaptive_shrink = 2
+	adaptive_grow   = 1.5
+)
+
+// adaptive bounds the interval between scans adapting to change activity, see WithAdaptiveInterval.
+type adaptive struct {
+	min, max time.Duration
+}
+
+// WithAdaptiveInterval makes the interval between scans follow change activity instead of the sleep given to
+// Start: it halves after every scan delivering notices, down to min, and grows by half after every quiet one,
+// up to max, e.g. seconds during business hours and minutes at night. Scanning starts at the sleep given to
+// Start within the range, Stats().Interval tells the current one. Failed scans pause by WithBackoff as before.
+func WithAdaptiveInterval(min, max time.Duration) Option {
+	return func(o *options) error {
+		if min <= 0 || max < min {
+			return fmt.Errorf("Adaptive interval must range from a positive minimum to a maximum not less")
+		}
+		o.adaptive = adaptive{min: min, max: max}
+		return nil
+	}
+}
+
+// enabled reports whether the interval adapts.
+func (a adaptive) enabled() bool {
+	return a.max > 0
+}
+
+// adapt returns the interval following one whose scan delivered changes, or was quiet.
+func (a adaptive) adapt(interval time.Duration, changes bool) time.Duration {
+	if changes {
+		interval = time.Duration(float64(interval) / adaptive_shrink)
+	} else {
+		interval = time.Duration(float64(interval) * adaptive_grow)
+	}
+	return a.clamp(interval)
+}
+
+// clamp returns interval within the range.
+func (a adaptive) clamp(interval time.Duration) time.Duration {
+	if interval < a.min {
+		return a.min
+	}
+	if interval > a.max {
+		return a.max
+	}
+	return interval
+}
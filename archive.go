@@ -0,0 +1,257 @@
+package fsmonitor
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveExtensions are the extensions of archives ArchiveWatcher indexes the members of.
+var ArchiveExtensions = []string{".zip", ".jar", ".tar", ".tar.gz", ".tgz"}
+
+// ArchiveEntry is a member of an archive as indexed by ArchiveWatcher.
+type ArchiveEntry struct {
+	// Slash-separated path within the archive, e.g. reports/report.csv
+	Name    string
+	Size    int64
+	ModTime time.Time
+	// Of the uncompressed content, as recorded by zip archives, computed reading tar archives
+	CRC32 uint32
+}
+
+// MemberNotice is implemented by notices of members of archives, see ArchiveWatcher.
+type MemberNotice interface {
+	Notice
+	// Path of the archive file
+	Archive() string
+	Entry() ArchiveEntry
+}
+
+// memberNotice implements MemberNotice, uses the member path under the archive as Notice.Name, itself as More.
+type memberNotice struct {
+	archive   string
+	entry     ArchiveEntry
+	event     Event
+	timestamp time.Time
+}
+
+func (m *memberNotice) String() string {
+	return fmt.Sprintf("{%v!/%v : %v}", m.archive, m.entry.Name, m.event)
+}
+
+func (m *memberNotice) Name() string {
+	/* members named ../ stay under the archive */
+	return filepath.Join(m.archive, filepath.FromSlash(path.Clean("/"+m.entry.Name)))
+}
+
+func (m *memberNotice) Type() Event {
+	return m.event
+}
+
+func (m *memberNotice) More() interface{} {
+	return m
+}
+
+func (m *memberNotice) Info() NoticeInfo {
+	return NoticeInfo{Size: m.entry.Size, ModTime: m.entry.ModTime}
+}
+
+func (m *memberNotice) Time() time.Time {
+	return m.timestamp
+}
+
+func (m *memberNotice) Archive() string {
+	return m.archive
+}
+
+func (m *memberNotice) Entry() ArchiveEntry {
+	return m.entry
+}
+
+// ArchiveWatcher wraps a Watcher, following every notice of a created, updated or removed archive having one of
+// ArchiveExtensions by FileCreate, FileUpdate and FileRemove notices of its members implementing MemberNotice,
+// named by the archive path joined with the member path, e.g. /ingest/batch-42.zip/report.csv. Members are told
+// apart by size and CRC-32 across versions of the archive. Archives under address are indexed beforehand, so the
+// first update of one is diffed too. Archives failing to read, e.g. half written, are noticed at file level only.
+func ArchiveWatcher(w Watcher, address string) (Watcher, error) {
+	a := &archiveWatcher{indexes: make(map[string]map[string]ArchiveEntry)}
+
+	err := filepath.Walk(canonicalAddress(address), func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !archiveFile(file) {
+			return err
+		}
+		if index, err := readArchive(file); err == nil {
+			a.indexes[file] = index
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoratedWatcher{
+		watcher:  w,
+		decorate: func(n Notice) Notice { return n },
+		derive:   a.derive,
+	}, nil
+}
+
+// archiveWatcher keeps the last index of archives to diff against.
+type archiveWatcher struct {
+	mu      sync.Mutex
+	indexes map[string]map[string]ArchiveEntry
+}
+
+// archiveFile reports whether file has one of ArchiveExtensions.
+func archiveFile(file string) bool {
+	lower := strings.ToLower(file)
+	for _, ext := range ArchiveExtensions {
+		if strings.HasSuffix(lower, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// readArchive indexes the members of the archive file by name, directories excluded.
+func readArchive(file string) (map[string]ArchiveEntry, error) {
+	lower := strings.ToLower(file)
+	if strings.HasSuffix(lower, ".zip") || strings.HasSuffix(lower, ".jar") {
+		return readZip(file)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return readTar(r)
+}
+
+func readZip(file string) (map[string]ArchiveEntry, error) {
+	z, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	index := make(map[string]ArchiveEntry, len(z.File))
+	for _, f := range z.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		index[f.Name] = ArchiveEntry{Name: f.Name, Size: int64(f.UncompressedSize64), ModTime: f.Modified, CRC32: f.CRC32}
+	}
+	return index, nil
+}
+
+func readTar(r io.Reader) (map[string]ArchiveEntry, error) {
+	index := make(map[string]ArchiveEntry)
+	t := tar.NewReader(r)
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !h.FileInfo().Mode().IsRegular() {
+			continue
+		}
+		/* tar records no checksum of content */
+		sum := crc32.NewIEEE()
+		if _, err := io.Copy(sum, t); err != nil {
+			return nil, err
+		}
+		name := strings.TrimPrefix(h.Name, "./")
+		index[name] = ArchiveEntry{Name: name, Size: h.Size, ModTime: h.ModTime, CRC32: sum.Sum32()}
+	}
+}
+
+// derive diffs the members of the noticed archive against its last index.
+func (a *archiveWatcher) derive(n Notice) []Notice {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove|FileRename) == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n.Type() == FileRename {
+		/* members move along without notices, as files within renamed directories */
+		if old := InfoOf(n).OldPath; old != "" {
+			if index, ok := a.indexes[old]; ok {
+				delete(a.indexes, old)
+				if archiveFile(n.Name()) {
+					a.indexes[n.Name()] = index
+				}
+			}
+		}
+		return nil
+	}
+	if !archiveFile(n.Name()) {
+		return nil
+	}
+
+	old := a.indexes[n.Name()]
+	var index map[string]ArchiveEntry
+	if n.Type() == FileRemove {
+		delete(a.indexes, n.Name())
+	} else {
+		var err error
+		if index, err = readArchive(n.Name()); err != nil {
+			logSink{}.warn("Failed to read archive", "path", n.Name(), "error", err)
+			return nil
+		}
+		a.indexes[n.Name()] = index
+	}
+
+	names := make([]string, 0, len(old)+len(index))
+	for name := range old {
+		names = append(names, name)
+	}
+	for name := range index {
+		if _, ok := old[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	/* in name order, so the same change always emits the same */
+	sort.Strings(names)
+
+	var notices []Notice
+	for _, name := range names {
+		before, inOld := old[name]
+		after, inNew := index[name]
+		event, entry := FileUpdate, after
+		switch {
+		case !inNew:
+			event, entry = FileRemove, before
+		case !inOld:
+			event = FileCreate
+		case before.Size == after.Size && before.CRC32 == after.CRC32:
+			continue
+		}
+		notices = append(notices, &memberNotice{archive: n.Name(), entry: entry, event: event, timestamp: time.Now()})
+	}
+	return notices
+}
@@ -0,0 +1,35 @@
+package fsmonitor
+
+import (
+	"os"
+)
+
+/* mode bits told by FileAttrib, changes of type are not */
+const attrib_mode = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// AttribInfo is the os.FileInfo of FileAttrib notices of the builtin "path" Watcher, returned by Notice.More.
+// Mode and ownership after the change are those of the FileInfo.
+type AttribInfo struct {
+	os.FileInfo
+	OldMode os.FileMode
+	// Owner before and after the change, -1 where the platform doesn't tell, e.g. on Windows
+	OldUID, OldGID int
+	UID, GID       int
+}
+
+// attribChanged returns info with the previous mode and owner if mode or owner differ between infos.
+// Owners are only compared if both infos tell them, i.e. not against states restored by WithSnapshots.
+func attribChanged(oldinfo, info os.FileInfo) *AttribInfo {
+	a := &AttribInfo{FileInfo: info, OldMode: oldinfo.Mode()}
+	a.OldUID, a.OldGID, _ = owner(oldinfo)
+	a.UID, a.GID, _ = owner(info)
+
+	changed := oldinfo.Mode()&attrib_mode != info.Mode()&attrib_mode
+	if a.OldUID != -1 && a.UID != -1 && (a.OldUID != a.UID || a.OldGID != a.GID) {
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return a
+}
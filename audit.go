@@ -0,0 +1,91 @@
+package fsmonitor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultAuditLog is where auditd writes records on most Linux distributions.
+const DefaultAuditLog = "/var/log/audit/audit.log"
+
+const (
+	/* bound memory when records of unrelated events never complete */
+	audit_pending_limit = 4096
+)
+
+// Actor identifies the process responsible for a change, as recorded by the Linux audit subsystem.
+type Actor struct {
+	UID  int
+	AUID int
+	PID  int
+	Exe  string
+	// Timestamp of the audit record
+	Time time.Time
+}
+
+func (a *Actor) String() string {
+	return fmt.Sprintf("uid=%d auid=%d pid=%d exe=%s", a.UID, a.AUID, a.PID, a.Exe)
+}
+
+// ActorNotice is implemented by notices attributed to the changing process, see AuditWatcher.
+type ActorNotice interface {
+	Notice
+	Actor() *Actor
+}
+
+// actorNotice implements ActorNotice by wrapping the discovered Notice.
+type actorNotice struct {
+	Notice
+	actor *Actor
+}
+
+func (a *actorNotice) Unwrap() Notice {
+	return a.Notice
+}
+
+func (a *actorNotice) Actor() *Actor {
+	return a.actor
+}
+
+func (a *actorNotice) String() string {
+	return fmt.Sprintf("%v by {%v}", a.Notice, a.actor)
+}
+
+// auditEvent collects records of a single audited syscall.
+type auditEvent struct {
+	actor *Actor
+	cwd   string
+}
+
+// auditEncoded lists the untrusted string fields auditd may hex encode.
+var auditEncoded = map[string]bool{"name": true, "exe": true, "cwd": true, "key": true, "comm": true}
+
+// auditFields splits a record into its key=value fields, decoding quoted and hex encoded values.
+func auditFields(record string) map[string]string {
+	/* drop interpreted fields of the enriched log format */
+	if i := strings.IndexByte(record, 0x1d); i >= 0 {
+		record = record[:i]
+	}
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(record) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		v := kv[1]
+		if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+			v = v[1 : len(v)-1]
+		} else if auditEncoded[kv[0]] {
+			/* values containing spaces or special characters are hex encoded without quotes */
+			if decoded, err := hex.DecodeString(v); err == nil {
+				v = string(decoded)
+			}
+		}
+		if _, ok := fields[kv[0]]; !ok {
+			fields[kv[0]] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,179 @@
+// +build linux
+
+package fsmonitor
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const (
+	audit_poll_interval = 200 * time.Millisecond
+	/* actors of paths no notice claimed are forgotten that long after recorded, or once that many are kept */
+	audit_actor_ttl   = 5 * time.Minute
+	audit_actor_limit = 10000
+)
+
+// AuditWatcher wraps a Watcher, attributing notices to the process found in audit records tagged with key.
+// Audit rules on the watched paths have to be installed beforehand, e.g. by AddAuditRule.
+// Notices with matching records implement ActorNotice, others are delivered unchanged. Records no notice claimed
+// within 5 minutes are forgotten, e.g. those of paths not watched.
+func AuditWatcher(w Watcher, logfile, key string) (Watcher, error) {
+	if logfile == "" {
+		logfile = DefaultAuditLog
+	}
+	f, err := os.Open(logfile)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+
+	a := &auditWatcher{
+		logfile: logfile,
+		key:     key,
+		actors:  make(map[string]*auditActor),
+		parser:  &auditParser{key: key, events: make(map[string]*auditEvent)},
+	}
+	a.decoratedWatcher = &decoratedWatcher{watcher: w, decorate: a.attribute}
+	return a, nil
+}
+
+// AddAuditRule installs an audit watch rule on path for writes and attribute changes, tagged with key.
+func AddAuditRule(path, key string) error {
+	return exec.Command("auditctl", "-w", path, "-p", "wa", "-k", key).Run()
+}
+
+// RemoveAuditRule removes the audit watch rule installed by AddAuditRule.
+func RemoveAuditRule(path, key string) error {
+	return exec.Command("auditctl", "-W", path, "-p", "wa", "-k", key).Run()
+}
+
+// auditWatcher implements Watcher, correlating audit records with decorated notices by path.
+type auditWatcher struct {
+	*decoratedWatcher
+
+	logfile string
+	key     string
+
+	mu     sync.Mutex
+	actors map[string]*auditActor
+	parser *auditParser
+}
+
+// auditActor is the latest actor recorded for a path, until a notice claims it.
+type auditActor struct {
+	*Actor
+	recorded time.Time
+}
+
+// Watch tails the audit log for as long as the wrapped Watcher runs.
+func (a *auditWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	quit := make(chan struct{})
+	go a.tail(quit)
+
+	ncc, errors := a.decoratedWatcher.Watch()
+
+	relayed := make(chan error)
+	go func() {
+		defer close(relayed)
+		defer close(quit)
+		for err := range errors {
+			relayed <- err
+		}
+	}()
+	return ncc, relayed
+}
+
+// attribute wraps the Notice with the latest actor recorded for its path, once per record.
+func (a *auditWatcher) attribute(n Notice) Notice {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if actor, ok := a.actors[n.Name()]; ok {
+		delete(a.actors, n.Name())
+		return &actorNotice{Notice: n, actor: actor.Actor}
+	}
+	return n
+}
+
+// tail follows the audit log from its end, reopening it after rotation.
+func (a *auditWatcher) tail(quit <-chan struct{}) {
+	f, err := os.Open(a.logfile)
+	if err != nil {
+		logSink{}.error("Failed to open audit log", "path", a.logfile, "error", err)
+		return
+	}
+	defer func() { f.Close() }()
+	f.Seek(0, io.SeekEnd)
+
+	r := bufio.NewReader(f)
+	var partial string
+	for {
+		line, err := r.ReadString('\n')
+		if err == nil {
+			a.parse(partial + line)
+			partial = ""
+			continue
+		}
+		partial += line
+
+		select {
+		case <-quit:
+			return
+		case <-time.After(audit_poll_interval):
+		}
+		a.expire(time.Now())
+
+		/* rotated, start over from the beginning of the new file */
+		if cur, err := f.Stat(); err == nil {
+			if info, err := os.Stat(a.logfile); err == nil && !os.SameFile(cur, info) {
+				if nf, err := os.Open(a.logfile); err == nil {
+					f.Close()
+					f, partial = nf, ""
+					r.Reset(f)
+				}
+			}
+		}
+	}
+}
+
+// parse handles one audit record, remembering the actor of every changed path.
+func (a *auditWatcher) parse(record string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n, ok := a.parser.parse(record).(ActorNotice); ok {
+		if _, ok := a.actors[n.Name()]; !ok && len(a.actors) >= audit_actor_limit {
+			a.evict()
+		}
+		a.actors[n.Name()] = &auditActor{Actor: n.Actor(), recorded: time.Now()}
+	}
+}
+
+// expire forgets actors recorded longer than audit_actor_ttl before now.
+func (a *auditWatcher) expire(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for path, actor := range a.actors {
+		if now.Sub(actor.recorded) > audit_actor_ttl {
+			delete(a.actors, path)
+		}
+	}
+}
+
+// evict forgets the actor recorded first, must be called with mu held.
+func (a *auditWatcher) evict() {
+	var oldest string
+	var at time.Time
+	for path, actor := range a.actors {
+		if at.IsZero() || actor.recorded.Before(at) {
+			oldest, at = path, actor.recorded
+		}
+	}
+	delete(a.actors, oldest)
+}
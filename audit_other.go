@@ -0,0 +1,20 @@
+// +build !linux
+
+package fsmonitor
+
+import "fmt"
+
+// AuditWatcher is only available on Linux.
+func AuditWatcher(w Watcher, logfile, key string) (Watcher, error) {
+	return nil, fmt.Errorf("Audit subsystem is only available on Linux")
+}
+
+// AddAuditRule is only available on Linux.
+func AddAuditRule(path, key string) error {
+	return fmt.Errorf("Audit subsystem is only available on Linux")
+}
+
+// RemoveAuditRule is only available on Linux.
+func RemoveAuditRule(path, key string) error {
+	return fmt.Errorf("Audit subsystem is only available on Linux")
+}
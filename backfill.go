@@ -0,0 +1,121 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Inventorier is implemented by Watchers able to list the files they know of.
+type Inventorier interface {
+	// Returns a FileExisting notice for every file under prefix as of the last check,
+	// found by a walk if there was none yet. Prefix is relative to the watched address unless absolute.
+	Inventory(prefix string) ([]Notice, error)
+}
+
+// Backfill passes a FileExisting notice for every file under prefix known to the Watcher to emit, in order of paths,
+// e.g. to bootstrap a new consumer with the full inventory before it follows Notices(). Notices are identified
+// as delivered ones are given WithIDs, and are not delivered through Notices(). Watcher must implement Inventorier.
+func (m *Monitor) Backfill(prefix string, emit func(Notice)) error {
+	inv, ok := m.watcher.(Inventorier)
+	if !ok {
+		return fmt.Errorf("Watcher %T doesn't support inventory", m.watcher)
+	}
+	notices, err := inv.Inventory(prefix)
+	if err != nil {
+		return err
+	}
+	for _, n := range notices {
+		if m.ids != nil {
+			n = &identifiedNotice{Notice: n, id: m.ids.ID(n)}
+		}
+		emit(n)
+	}
+	return nil
+}
+
+// Inventory lists the files of lastCheck under prefix, walking the watched address if not checked yet.
+func (s *pathScanner) Inventory(prefix string) (notices []Notice, err error) {
+	root := s.address
+	if prefix != "" {
+		if root = prefix; !filepath.IsAbs(root) {
+			root = filepath.Join(s.address, root)
+		}
+		root = canonicalAddress(root)
+	}
+	if within(s.address, root) {
+		/* prefix holds the watched address */
+		root = s.address
+	} else if !within(root, s.address) {
+		return nil, fmt.Errorf("Path %s is outside of watched address %s", prefix, s.address)
+	}
+
+	s.serialized(func() {
+		files := s.lastCheck
+		if files == nil {
+			/* without lastCheck nothing is emitted */
+			if files, err = s.walk(s.address, func(*fileSystemNotice) {}); files == nil {
+				return
+			}
+			defer files.close()
+		}
+		now := time.Now()
+		files.each(func(file string, info os.FileInfo) {
+			if info.IsDir() || !within(file, root) {
+				return
+			}
+			notices = append(notices, &fileSystemNotice{
+				path:      file,
+				fileinfo:  info,
+				timestamp: now,
+				event:     FileExisting,
+			})
+		})
+	})
+	sort.Slice(notices, func(i, j int) bool { return notices[i].Name() < notices[j].Name() })
+	return notices, err
+}
+
+// Inventory decorates the inventory of the wrapped Watcher.
+func (d *decoratedWatcher) Inventory(prefix string) ([]Notice, error) {
+	inv, ok := d.watcher.(Inventorier)
+	if !ok {
+		return nil, fmt.Errorf("Watcher %T doesn't support inventory", d.watcher)
+	}
+
+	notices, err := inv.Inventory(prefix)
+	decorated := notices[:0]
+	for _, n := range notices {
+		if n = d.decorate(n); n != nil {
+			decorated = append(decorated, n)
+		}
+	}
+	return decorated, err
+}
+
+// Inventory collects the inventories of the Watchers of all paths holding files under prefix,
+// which is relative to every path unless absolute.
+func (m *multiWatcher) Inventory(prefix string) ([]Notice, error) {
+	m.mu.Lock()
+	roots := append([]*watchedRoot(nil), m.roots...)
+	m.mu.Unlock()
+
+	var notices []Notice
+	for _, r := range roots {
+		if filepath.IsAbs(prefix) && !within(canonicalAddress(prefix), r.address) && !within(r.address, canonicalAddress(prefix)) {
+			continue
+		}
+		inv, ok := r.watcher.(Inventorier)
+		if !ok {
+			return nil, fmt.Errorf("Watcher %T doesn't support inventory", r.watcher)
+		}
+		listed, err := inv.Inventory(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", r.address, err)
+		}
+		notices = append(notices, listed...)
+	}
+	return notices, nil
+}
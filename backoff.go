@@ -0,0 +1,110 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+const (
+	/* pause after failed scans without WithBackoff, as before it */
+	backoff_initial = 100 * time.Second
+)
+
+// Backoff is how long scanning pauses after failed scans, see WithBackoff.
+type Backoff struct {
+	// Pause after the first failure
+	Initial time.Duration
+	// Factor the pause grows by with every further failure in a row, constant if 0 or 1
+	Multiplier float64
+	// Longest pause, unbounded if 0
+	Max time.Duration
+	// Fraction of every pause randomized, e.g. 0.2 for ±20%, so Monitors failing together don't retry together
+	Jitter float64
+}
+
+// Validate checks the backoff is consistent.
+func (b Backoff) Validate() error {
+	if b.Initial <= 0 {
+		return fmt.Errorf("Backoff must have a positive initial pause")
+	}
+	if b.Multiplier != 0 && b.Multiplier < 1 {
+		return fmt.Errorf("Backoff multiplier must be at least 1")
+	}
+	if b.Max < 0 || b.Max > 0 && b.Max < b.Initial {
+		return fmt.Errorf("Backoff max must not be less than the initial pause")
+	}
+	if b.Jitter < 0 || b.Jitter > 1 {
+		return fmt.Errorf("Backoff jitter must be between 0 and 1")
+	}
+	return nil
+}
+
+// pause returns the pause after failures in a row.
+func (b Backoff) pause(failures int) time.Duration {
+	d := float64(b.Initial)
+	if b.Multiplier > 1 {
+		d *= math.Pow(b.Multiplier, float64(failures-1))
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// WithBackoff sets how long scanning pauses after a failed scan instead of 100 seconds, e.g.
+// Backoff{Initial: time.Second, Multiplier: 2, Max: time.Minute, Jitter: 0.2}.
+// The Monitor is degraded from the first failure until a scan succeeds again, see DegradedNotice.
+func WithBackoff(b Backoff) Option {
+	return func(o *options) error {
+		if err := b.Validate(); err != nil {
+			return err
+		}
+		o.backoff = b
+		return nil
+	}
+}
+
+// DegradedNotice is delivered when the Monitor becomes degraded as scans fail, as MonitorDegraded,
+// and when a scan succeeds again, as MonitorRecovered, only when asked for in Start.
+type DegradedNotice struct {
+	Address string
+	// Failure of the scan, or the last one when recovered
+	Err error
+	// Failed scans in a row
+	Failures int
+	// Start of the degradation
+	Since time.Time
+
+	event     Event
+	timestamp time.Time
+}
+
+func (d *DegradedNotice) String() string {
+	if d.event == MonitorRecovered {
+		return fmt.Sprintf("{%v : %v : after %d failed scans in %v}", d.Address, d.event, d.Failures, d.timestamp.Sub(d.Since).Round(time.Millisecond))
+	}
+	return fmt.Sprintf("{%v : %v : %v}", d.Address, d.event, d.Err)
+}
+
+func (d *DegradedNotice) Name() string {
+	return d.Address
+}
+
+func (d *DegradedNotice) Type() Event {
+	return d.event
+}
+
+func (d *DegradedNotice) More() interface{} {
+	return d
+}
+
+func (d *DegradedNotice) Info() NoticeInfo {
+	return NoticeInfo{}
+}
+
+func (d *DegradedNotice) Time() time.Time {
+	return d.timestamp
+}
@@ -0,0 +1,33 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// NoticeBatch is the notices delivered for one scan at once, see Monitor.Batches.
+type NoticeBatch struct {
+	Notices []Notice
+	// Time the scan was kicked off, or the first notice arrived in between scans, e.g. of a rescan
+	Start time.Time
+	// Time the scan completed
+	End time.Time
+	// Error the scan failed with, also in Notices as ErrorNotice if FileError is given to Start
+	Err error
+}
+
+func (b *NoticeBatch) String() string {
+	return fmt.Sprintf("{%v - %v : %d notices}", b.Start.Format(time.RFC3339), b.End.Format(time.RFC3339), len(b.Notices))
+}
+
+// Batches makes the Monitor deliver the notices of every scan at once when it completes, e.g. to bulk sinks,
+// instead of one by one through Notices(), which delivers none then. Must be called before Start.
+// Scans without notices or error deliver no batch. The channel closes along with Notices().
+func (m *Monitor) Batches() <-chan *NoticeBatch {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.batches == nil {
+		m.batches = make(chan *NoticeBatch)
+	}
+	return m.batches
+}
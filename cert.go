@@ -0,0 +1,289 @@
+package fsmonitor
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CertificateExtensions are the extensions of files checked by CertificateWatcher.
+var CertificateExtensions = []string{".pem", ".crt", ".cer", ".der", ".key"}
+
+// Credential identifies a certificate or private key found in a file.
+type Credential struct {
+	// "certificate" or "key"
+	Kind    string
+	Subject string
+	Issuer  string
+	// Zero for keys
+	NotAfter time.Time
+	// Hex SHA-256 of the DER certificate, or of the DER public key of keys
+	Fingerprint string
+}
+
+func (c *Credential) String() string {
+	if c.Kind == "key" {
+		return fmt.Sprintf("key %s", c.Fingerprint)
+	}
+	return fmt.Sprintf("certificate %q expiring %v %s", c.Subject, c.NotAfter.Format(time.RFC3339), c.Fingerprint)
+}
+
+// CredentialNotice is implemented by notices of files holding certificates or keys, see CertificateWatcher.
+type CredentialNotice interface {
+	Notice
+	Credentials() []*Credential
+}
+
+// credentialNotice implements CredentialNotice by wrapping the discovered Notice.
+type credentialNotice struct {
+	Notice
+	credentials []*Credential
+}
+
+func (c *credentialNotice) Unwrap() Notice {
+	return c.Notice
+}
+
+func (c *credentialNotice) Credentials() []*Credential {
+	return c.credentials
+}
+
+func (c *credentialNotice) String() string {
+	return fmt.Sprintf("%v holding %v", c.Notice, c.credentials)
+}
+
+// expiringNotice implements CredentialNotice for a certificate about to expire,
+// uses file name as Notice.Name and the certificate as Notice.More.
+type expiringNotice struct {
+	path        string
+	certificate *Credential
+	timestamp   time.Time
+}
+
+func (e *expiringNotice) String() string {
+	return fmt.Sprintf("{%v : %v : %v}", e.path, CertificateExpiring, e.certificate)
+}
+
+func (e *expiringNotice) Name() string {
+	return e.path
+}
+
+func (e *expiringNotice) Type() Event {
+	return CertificateExpiring
+}
+
+func (e *expiringNotice) More() interface{} {
+	return e.certificate
+}
+
+func (e *expiringNotice) Info() NoticeInfo {
+	return NoticeInfo{}
+}
+
+func (e *expiringNotice) Time() time.Time {
+	return e.timestamp
+}
+
+func (e *expiringNotice) Credentials() []*Credential {
+	return []*Credential{e.certificate}
+}
+
+// CertificateWatcher wraps a Watcher, parsing PEM or DER certificates and keys of created and updated files
+// having one of CertificateExtensions. Their notices implement CredentialNotice, telling fingerprints and expiry.
+// After every scan, a CertificateExpiring notice is sent once for every certificate expiring within warn,
+// including those under address found beforehand.
+func CertificateWatcher(w Watcher, address string, warn time.Duration) (Watcher, error) {
+	c := &certificateWatcher{warn: warn, files: make(map[string]*credentialFile)}
+
+	err := filepath.Walk(canonicalAddress(address), func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !certificateFile(file) {
+			return err
+		}
+		if creds, err := readCredentials(file); err == nil && len(creds) > 0 {
+			c.files[file] = &credentialFile{credentials: creds, warned: make(map[string]bool)}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoratedWatcher{
+		watcher:  w,
+		decorate: c.decorate,
+		scanned:  c.expiring,
+	}, nil
+}
+
+// certificateWatcher keeps credentials of files to check their expiry.
+type certificateWatcher struct {
+	warn time.Duration
+
+	mu    sync.Mutex
+	files map[string]*credentialFile
+}
+
+// credentialFile holds credentials of a file, and fingerprints of certificates already warned about.
+type credentialFile struct {
+	credentials []*Credential
+	warned      map[string]bool
+}
+
+// decorate parses credentials of changed files.
+func (c *certificateWatcher) decorate(n Notice) Notice {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove) == 0 || !certificateFile(n.Name()) {
+		return n
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n.Type() == FileRemove {
+		delete(c.files, n.Name())
+		return n
+	}
+	creds, err := readCredentials(n.Name())
+	if err != nil {
+		logSink{}.warn("Failed to parse credentials", "path", n.Name(), "event", n.Type(), "error", err)
+		return n
+	}
+	if len(creds) == 0 {
+		delete(c.files, n.Name())
+		return n
+	}
+
+	/* keep warnings of certificates still in the file */
+	warned := make(map[string]bool)
+	if f, ok := c.files[n.Name()]; ok {
+		for _, cred := range creds {
+			if f.warned[cred.Fingerprint] {
+				warned[cred.Fingerprint] = true
+			}
+		}
+	}
+	c.files[n.Name()] = &credentialFile{credentials: creds, warned: warned}
+	return &credentialNotice{Notice: n, credentials: creds}
+}
+
+// expiring returns notices of certificates expiring within warn, not warned about yet.
+func (c *certificateWatcher) expiring() []Notice {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var notices []Notice
+	now := time.Now()
+	for path, f := range c.files {
+		for _, cred := range f.credentials {
+			if cred.Kind != "certificate" || f.warned[cred.Fingerprint] || cred.NotAfter.Sub(now) > c.warn {
+				continue
+			}
+			f.warned[cred.Fingerprint] = true
+			notices = append(notices, &expiringNotice{path: path, certificate: cred, timestamp: now})
+		}
+	}
+	return notices
+}
+
+// certificateFile reports whether file has one of CertificateExtensions.
+func certificateFile(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	for _, e := range CertificateExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// readCredentials parses every certificate and unencrypted private key of a PEM file, or certificates of a DER file.
+func readCredentials(file string) ([]*Credential, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, content_size_limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > content_size_limit {
+		return nil, fmt.Errorf("File is larger than %d bytes", content_size_limit)
+	}
+
+	var creds []*Credential
+	rest := data
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		switch {
+		case block.Type == "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			creds = append(creds, certificateCredential(cert))
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			if cred := keyCredential(block.Bytes); cred != nil {
+				creds = append(creds, cred)
+			}
+		}
+	}
+	if len(rest) == len(data) {
+		/* no PEM blocks, try DER */
+		certs, err := x509.ParseCertificates(data)
+		if err != nil {
+			return nil, nil
+		}
+		for _, cert := range certs {
+			creds = append(creds, certificateCredential(cert))
+		}
+	}
+	return creds, nil
+}
+
+func certificateCredential(cert *x509.Certificate) *Credential {
+	sum := sha256.Sum256(cert.Raw)
+	return &Credential{
+		Kind:        "certificate",
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		NotAfter:    cert.NotAfter,
+		Fingerprint: hex.EncodeToString(sum[:]),
+	}
+}
+
+// keyCredential fingerprints the public key of a PKCS#8, PKCS#1 or SEC 1 private key, nil if encrypted or unknown.
+func keyCredential(der []byte) *Credential {
+	var key interface{}
+	var err error
+	if key, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+		if key, err = x509.ParsePKCS1PrivateKey(der); err != nil {
+			if key, err = x509.ParseECPrivateKey(der); err != nil {
+				return nil
+			}
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(pub)
+	return &Credential{Kind: "key", Fingerprint: hex.EncodeToString(sum[:])}
+}
@@ -0,0 +1,92 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+// ChangeSet groups related notices into one logical change, e.g. a deployment or package upgrade.
+type ChangeSet struct {
+	// Unique within the process
+	ID string
+	// Parent directory, or actor when notices are attributed (see ActorNotice)
+	Key     string
+	Notices []Notice
+	// Time of first and last notice
+	Start time.Time
+	End   time.Time
+}
+
+func (c *ChangeSet) String() string {
+	return fmt.Sprintf("{%v : %v : %d notices}", c.ID, c.Key, len(c.Notices))
+}
+
+var changeSetSeq uint64
+
+// ChangeSets groups notices into change sets, consuming Notices() in place of the caller.
+// Notices under the same parent directory (or by the same actor) join one change set
+// until none arrived for window. The channel closes after Notices() closes.
+func (m *Monitor) ChangeSets(window time.Duration) <-chan *ChangeSet {
+	return GroupChangeSets(m.Notices(), window)
+}
+
+// GroupChangeSets groups any notice stream, see Monitor.ChangeSets.
+func GroupChangeSets(notices <-chan Notice, window time.Duration) <-chan *ChangeSet {
+	sets := make(chan *ChangeSet)
+
+	go func() {
+		defer close(sets)
+
+		open := make(map[string]*ChangeSet)
+		every := window / 4
+		if every < time.Millisecond {
+			every = time.Millisecond
+		}
+		tick := time.NewTicker(every)
+		defer tick.Stop()
+
+		for {
+			select {
+			case n, ok := <-notices:
+				if !ok {
+					for _, c := range open {
+						sets <- c
+					}
+					return
+				}
+				key := changeSetKey(n)
+				c, ok := open[key]
+				if !ok {
+					c = &ChangeSet{
+						ID:    fmt.Sprintf("%x-%x", time.Now().UnixNano(), atomic.AddUint64(&changeSetSeq, 1)),
+						Key:   key,
+						Start: time.Now(),
+					}
+					open[key] = c
+				}
+				c.Notices = append(c.Notices, n)
+				c.End = time.Now()
+			case now := <-tick.C:
+				for key, c := range open {
+					if now.Sub(c.End) >= window {
+						delete(open, key)
+						sets <- c
+					}
+				}
+			}
+		}
+	}()
+
+	return sets
+}
+
+// changeSetKey groups by actor when known, otherwise by parent directory.
+func changeSetKey(n Notice) string {
+	var a ActorNotice
+	if NoticeAs(n, &a) && a.Actor() != nil {
+		return fmt.Sprintf("pid %d %s", a.Actor().PID, a.Actor().Exe)
+	}
+	return filepath.Dir(n.Name())
+}
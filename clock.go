@@ -0,0 +1,42 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// Clock tells the time scans of a Monitor are scheduled by, see WithClock.
+type Clock interface {
+	Now() time.Time
+	// After sends the time on the returned channel once d passed
+	After(d time.Duration) <-chan time.Time
+}
+
+// WithClock makes the Monitor schedule scans by c instead of the system clock, e.g. the fake clock of fsmonitortest
+// advanced by tests, so scans run exactly when told. Intervals, schedules, pauses and backoff go by c, every scan is
+// due an interval after the previous one completed.
+func WithClock(c Clock) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("Clock must not be nil")
+		}
+		o.clock = c
+		return nil
+	}
+}
+
+// now returns the time of the Clock of the Monitor.
+func (m *Monitor) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// after returns the channel sent on once d passed by the Clock of the Monitor.
+func (m *Monitor) after(d time.Duration) <-chan time.Time {
+	if m.clock == nil {
+		return time.After(d)
+	}
+	return m.clock.After(d)
+}
@@ -0,0 +1,101 @@
+// Command fsmigrate rewrites line-delimited notice records of any known schema version
+// into the current fsmonitor.SchemaVersion.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+var (
+	input  = flag.String("in", "", "Records file to migrate, defaults to stdin")
+	output = flag.String("out", "", "Migrated records file, defaults to stdout")
+	skip   = flag.Bool("skip", false, "Skip undecodable records instead of failing")
+)
+
+var Logger = log.New(os.Stderr, "[Migrate] ", log.LstdFlags)
+
+const (
+	/* longest record read, records of long paths or many labels may exceed bufio.MaxScanTokenSize */
+	max_record_size = 16 << 20
+)
+
+func main() {
+
+	flag.Parse()
+
+	if err := migrate(); err != nil {
+		Logger.Fatalln(err)
+	}
+}
+
+// migrate rewrites the records of -in to -out, flushing those migrated before failing.
+func migrate() (err error) {
+	var in io.Reader = os.Stdin
+	if *input != "" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return fmt.Errorf("Failed to open records file! %v", err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("Failed to create migrated records file! %v", err)
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("Failed to write migrated records! %v", cerr)
+			}
+		}()
+		out = f
+	}
+
+	w := bufio.NewWriter(out)
+	defer func() {
+		if ferr := w.Flush(); err == nil && ferr != nil {
+			err = fmt.Errorf("Failed to write migrated records! %v", ferr)
+		}
+	}()
+
+	migrated, skipped := 0, 0
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), max_record_size)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		n, err := fsmonitor.UnmarshalNotice(scanner.Bytes())
+		if err != nil {
+			if !*skip {
+				return fmt.Errorf("Record %d failed decoding: %v", line, err)
+			}
+			Logger.Printf("Record %d skipped: %v", line, err)
+			skipped++
+			continue
+		}
+		data, err := fsmonitor.MarshalNotice(n)
+		if err != nil {
+			return fmt.Errorf("Record %d failed encoding: %v", line, err)
+		}
+		w.Write(data)
+		w.WriteByte('\n')
+		migrated++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read records! %v", err)
+	}
+
+	Logger.Printf("%d records migrated to schema version %d, %d skipped", migrated, fsmonitor.SchemaVersion, skipped)
+	return nil
+}
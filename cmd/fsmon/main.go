@@ -0,0 +1,514 @@
+// Command fsmon inspects fsmonitor configurations.
+//
+//	fsmon validate [flags]
+//	fsmon explain [flags] path...
+//	fsmon test-patterns [flags] [-rules file] [-events list] [path...]
+//	fsmon import [-format f] [-key k] [-in log] [-out records]
+//	fsmon analyze [flags] [-duration d] [-interval i]
+//	fsmon snapshot -from codec -to codec [-in file] [-out file]
+//	fsmon replay -journal path -from t -sink url [-rate n]
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+var Logger = log.New(os.Stderr, "[Fsmon] ", log.LstdFlags)
+
+// config holds the flags shared by subcommands, same as the example client.
+type config struct {
+	address *string
+	pattern *string
+	watcher *string
+	profile *string
+	workers *int
+}
+
+func flags(name string) (*flag.FlagSet, *config) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	return fs, &config{
+		address: fs.String("address", ".", "File system path to be monitored"),
+		pattern: fs.String("pattern", "", "File patterns of interest, as a comma separated list"),
+		watcher: fs.String("watch", "path", "monitor watching type"),
+		profile: fs.String("profile", "local", "Scan profile, local or nfs"),
+		workers: fs.Int("concurrency", 1, "Directories read concurrently by a scan"),
+	}
+}
+
+func (c *config) args() (string, []string, interface{}, []fsmonitor.Option) {
+	var pattern []string
+	if *c.pattern != "" {
+		pattern = strings.Split(*c.pattern, ",")
+	}
+	var opts []fsmonitor.Option
+	switch *c.profile {
+	case "local":
+	case "nfs":
+		opts = append(opts, fsmonitor.WithProfile(fsmonitor.NFS))
+	default:
+		Logger.Fatalf("Profile not recognized: %s", *c.profile)
+	}
+	if *c.workers > 1 {
+		opts = append(opts, fsmonitor.WithScanConcurrency(*c.workers))
+	}
+	return *c.address, pattern, *c.watcher, opts
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	switch os.Args[1] {
+	case "validate":
+		fs, c := flags("validate")
+		fs.Parse(os.Args[2:])
+
+		address, pattern, watcher, opts := c.args()
+		if err := fsmonitor.Validate(address, pattern, watcher, opts...); err != nil {
+			Logger.Fatalln("Invalid configuration!", err)
+		}
+		fmt.Println("Configuration is valid.")
+
+	case "explain":
+		fs, c := flags("explain")
+		fs.Parse(os.Args[2:])
+		if fs.NArg() == 0 {
+			usage()
+		}
+
+		address, pattern, watcher, opts := c.args()
+		if err := fsmonitor.Validate(address, pattern, watcher, opts...); err != nil {
+			Logger.Fatalln("Invalid configuration!", err)
+		}
+		monitor := fsmonitor.New(address, pattern, watcher, opts...)
+		for _, path := range fs.Args() {
+			e, err := monitor.Explain(path)
+			if err != nil {
+				Logger.Fatalln(err)
+			}
+			fmt.Println(e)
+		}
+
+	case "test-patterns":
+		fs, c := flags("test-patterns")
+		rules := fs.String("rules", "", "JSON file of rules applied to notices")
+		events := fs.String("events", "FileCreate,FileUpdate,FileRemove,FileRename", "Event types delivered, comma separated")
+		fs.Parse(os.Args[2:])
+
+		testPatterns(c, *rules, *events, fs.Args())
+
+	case "import":
+		fs := flag.NewFlagSet("import", flag.ExitOnError)
+		format := fs.String("format", "inotifywait", "Log format, inotifywait, inotifywait-csv or auditd")
+		key := fs.String("key", "", "Import only audit records tagged with key")
+		input := fs.String("in", "", "Log file to import, defaults to stdin")
+		output := fs.String("out", "", "Notice records file, defaults to stdout")
+		fields := fs.String("fields", "all", "Fields of records besides path, comma separated event, timestamp and metadata")
+		siem := fs.String("siem", "", "Write records of a SIEM format instead, cef or leef")
+		fs.Parse(os.Args[2:])
+
+		importLog(*format, *key, *input, *output, *fields, *siem)
+
+	case "analyze":
+		fs, c := flags("analyze")
+		duration := fs.Duration("duration", time.Minute, "Time to observe notices for")
+		interval := fs.Duration("interval", time.Second, "Interval between scans")
+		fs.Parse(os.Args[2:])
+
+		analyze(c, *duration, *interval)
+
+	case "snapshot":
+		fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+		from := fs.String("from", "json", "Codec of the snapshot read, json, cbor or proto")
+		to := fs.String("to", "cbor", "Codec of the snapshot written, json, cbor or proto")
+		input := fs.String("in", "", "Snapshot file to convert, defaults to stdin")
+		output := fs.String("out", "", "Converted snapshot file, defaults to stdout")
+		fs.Parse(os.Args[2:])
+
+		convertSnapshot(*from, *to, *input, *output)
+
+	case "replay":
+		fs := flag.NewFlagSet("replay", flag.ExitOnError)
+		journal := fs.String("journal", "", "Journal file written by FileJournal, or a directory of them replayed in name order")
+		from := fs.String("from", "", "Replay notices journaled since, an RFC 3339 time or a duration ago, e.g. 1h")
+		sink := fs.String("sink", "-", "Sink URL: http(s)://... for a webhook, splunk+https://token@host:8088, loki+http://host:3100, file:///path(.gz|.fsmz), - for stdout")
+		rate := fs.Float64("rate", 0, "Notices published per second at most, unlimited if 0")
+		fs.Parse(os.Args[2:])
+		if *journal == "" || *from == "" {
+			usage()
+		}
+
+		replay(*journal, *from, *sink, *rate)
+
+	default:
+		usage()
+	}
+}
+
+// testPatterns reports for paths, given or typed one per line, whether they are noticed and how notices of each
+// event type pass filters and rules of the Monitor configured by c. Directories test every file inside.
+func testPatterns(c *config, rulesFile, eventList string, paths []string) {
+	address, pattern, watcher, opts := c.args()
+	var events []fsmonitor.Event
+	var filters fsmonitor.FilterSet
+	for _, name := range strings.Split(eventList, ",") {
+		e, err := fsmonitor.ParseEvent("notice." + strings.TrimSpace(name))
+		if err != nil {
+			Logger.Fatalln(err)
+		}
+		events = append(events, e)
+		filters.Events |= e
+	}
+	opts = append(opts, fsmonitor.WithFilters(filters))
+	if rulesFile != "" {
+		data, err := ioutil.ReadFile(rulesFile)
+		if err != nil {
+			Logger.Fatalln("Failed to read rules!", err)
+		}
+		rules, err := fsmonitor.ParseRules(data)
+		if err != nil {
+			Logger.Fatalln(err)
+		}
+		opts = append(opts, fsmonitor.WithRules(rules...))
+	}
+	if err := fsmonitor.Validate(address, pattern, watcher, opts...); err != nil {
+		Logger.Fatalln("Invalid configuration!", err)
+	}
+	monitor := fsmonitor.New(address, pattern, watcher, opts...)
+
+	test := func(path string) {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					testPath(monitor, file, events)
+				}
+				return nil
+			})
+			return
+		}
+		testPath(monitor, path, events)
+	}
+	if len(paths) > 0 {
+		for _, path := range paths {
+			test(path)
+		}
+		return
+	}
+
+	/* prompt only when typed */
+	info, _ := os.Stdin.Stat()
+	interactive := info != nil && info.Mode()&os.ModeCharDevice != 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		if interactive {
+			fmt.Fprint(os.Stderr, "path> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		if path := strings.TrimSpace(scanner.Text()); path != "" {
+			test(path)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		Logger.Fatalln(err)
+	}
+}
+
+// testPath prints the explanation of path, then the trace of each event type if it's noticed.
+func testPath(monitor *fsmonitor.Monitor, path string, events []fsmonitor.Event) {
+	e, err := monitor.Explain(path)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	fmt.Println(e)
+	if !e.Noticed {
+		return
+	}
+	for _, event := range events {
+		fmt.Println(monitor.Trace(path, event))
+	}
+}
+
+// convertSnapshot re-encodes the snapshot file at input from one codec to another.
+func convertSnapshot(from, to, input, output string) {
+	decoder, err := fsmonitor.ParseSnapshotCodec(from)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	encoder, err := fsmonitor.ParseSnapshotCodec(to)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+
+	in := os.Stdin
+	if input != "" {
+		if in, err = os.Open(input); err != nil {
+			Logger.Fatalln("Failed to open snapshot file!", err)
+		}
+		defer in.Close()
+	}
+	files, err := decoder.Decode(in)
+	if err != nil {
+		Logger.Fatalln("Failed to read snapshot!", err)
+	}
+
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			Logger.Fatalln("Failed to create snapshot file!", err)
+		}
+	}
+	if err := encoder.Encode(out, files); err != nil {
+		Logger.Fatalln("Failed to write snapshot!", err)
+	}
+	if err := out.Close(); err != nil {
+		Logger.Fatalln("Failed to write snapshot!", err)
+	}
+	Logger.Printf("%d files converted from %s to %s", len(files), decoder, encoder)
+}
+
+// analyze watches the configuration given by c for duration, then prints the paths noticed the most
+// and exclude patterns suggested to silence them.
+func analyze(c *config, duration, interval time.Duration) {
+	address, pattern, watcher, opts := c.args()
+	if err := fsmonitor.Validate(address, pattern, watcher, opts...); err != nil {
+		Logger.Fatalln("Invalid configuration!", err)
+	}
+	monitor := fsmonitor.New(address, pattern, watcher, append(opts, fsmonitor.WithNoiseAnalysis())...)
+	go monitor.Start(interval, fsmonitor.FileCreate, fsmonitor.FileUpdate, fsmonitor.FileRemove, fsmonitor.FileRename)
+	Logger.Printf("Observing %s for %v", address, duration)
+
+	timeout := time.After(duration)
+	notices := monitor.Notices()
+	for notices != nil {
+		select {
+		case _, ok := <-notices:
+			if !ok {
+				notices = nil
+			}
+		case <-timeout:
+			/* notices are drained until closed by stopping */
+			go monitor.Stop()
+			timeout = nil
+		}
+	}
+
+	report, err := monitor.Noise(false)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	fmt.Printf("%d notices in %v\n", report.Notices, report.End.Sub(report.Start).Round(time.Second))
+	if len(report.Top) > 0 {
+		fmt.Println("\nNoticed the most:")
+		for _, p := range report.Top {
+			fmt.Printf("%8d  %s\n", p.Notices, p.Path)
+		}
+	}
+	if len(report.Suggestions) == 0 {
+		fmt.Println("\nNo excludes to suggest.")
+		return
+	}
+	fmt.Println("\nSuggested excludes:")
+	for _, s := range report.Suggestions {
+		fmt.Printf("%8d  %s  (%s)\n", s.Notices, s.Pattern, s.Reason)
+	}
+}
+
+// importLog backfills line-delimited notice records from a log of inotifywait or auditd, as CEF or LEEF records if siem is given.
+func importLog(format, key, input, output, fields, siem string) {
+	f, err := fsmonitor.ParseLogFormat(format)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	selected, err := fsmonitor.ParseFields(fields)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	var siemFormat fsmonitor.SIEMFormat
+	if siem != "" {
+		if siemFormat, err = fsmonitor.ParseSIEMFormat(siem); err != nil {
+			Logger.Fatalln(err)
+		}
+	}
+
+	in := os.Stdin
+	if input != "" {
+		if in, err = os.Open(input); err != nil {
+			Logger.Fatalln("Failed to open log file!", err)
+		}
+		defer in.Close()
+	}
+	out := os.Stdout
+	if output != "" {
+		if out, err = os.Create(output); err != nil {
+			Logger.Fatalln("Failed to create records file!", err)
+		}
+		defer out.Close()
+	}
+
+	w := bufio.NewWriter(out)
+	defer w.Flush()
+
+	imported := 0
+	err = fsmonitor.ImportLog(in, f, key, func(n fsmonitor.Notice) {
+		if siem != "" {
+			w.WriteString(fsmonitor.FormatNotice(n, siemFormat))
+			w.WriteByte('\n')
+			imported++
+			return
+		}
+		data, err := fsmonitor.MarshalNoticeFields(n, selected)
+		if err != nil {
+			Logger.Fatalf("Notice %v failed encoding: %v", n, err)
+		}
+		w.Write(data)
+		w.WriteByte('\n')
+		imported++
+	})
+	if err != nil {
+		Logger.Fatalln("Failed to read log!", err)
+	}
+	Logger.Printf("%d notices imported from %s log", imported, f)
+}
+
+// replay publishes the notices journaled since from to the sink of sinkURL, at most rate per second unless 0.
+func replay(journal, from, sinkURL string, rate float64) {
+	since, err := time.Parse(time.RFC3339, from)
+	if err != nil {
+		ago, derr := time.ParseDuration(from)
+		if derr != nil {
+			Logger.Fatalf("Replay start %q is neither a time nor a duration", from)
+		}
+		since = time.Now().Add(-ago)
+	}
+	if rate < 0 {
+		Logger.Fatalln("Rate must not be negative")
+	}
+	files := []string{journal}
+	if info, err := os.Stat(journal); err != nil {
+		Logger.Fatalln("Failed to open journal!", err)
+	} else if info.IsDir() {
+		entries, err := ioutil.ReadDir(journal)
+		if err != nil {
+			Logger.Fatalln("Failed to open journal!", err)
+		}
+		files = files[:0]
+		for _, e := range entries {
+			if e.Mode().IsRegular() {
+				files = append(files, filepath.Join(journal, e.Name()))
+			}
+		}
+	}
+	sink, err := openSink(sinkURL)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+
+	var pace <-chan time.Time
+	if rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+	replayed, failed := 0, 0
+	for _, file := range files {
+		err := fsmonitor.FileJournal(file).Replay(since, func(n fsmonitor.Notice) error {
+			if pace != nil {
+				<-pace
+			}
+			/* queues of HTTP sinks fail publishing while full, publishing waits for them to drain */
+			err := sink.Publish(n)
+			for wait := time.Now().Add(time.Minute); err != nil && time.Now().Before(wait); err = sink.Publish(n) {
+				time.Sleep(100 * time.Millisecond)
+			}
+			if err != nil {
+				Logger.Printf("Failed to publish %v: %v", n, err)
+				failed++
+				return nil
+			}
+			replayed++
+			return nil
+		})
+		if err != nil {
+			Logger.Fatalln("Failed to replay journal!", err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		Logger.Fatalln("Failed to close sink!", err)
+	}
+	Logger.Printf("%d notices replayed since %s, %d failed", replayed, since.Format(time.RFC3339), failed)
+}
+
+// openSink returns the Sink of rawURL: a webhook of http and https URLs, a Splunk HTTP Event Collector of
+// splunk+http(s) URLs given the token as user, Grafana Loki of loki+http(s) URLs, a FileSink of file URLs, or JSON
+// lines to stdout of "-".
+func openSink(rawURL string) (fsmonitor.Sink, error) {
+	if rawURL == "-" {
+		return stdoutSink{}, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("Sink URL %q is malformed: %v", rawURL, err)
+	}
+	kind, scheme := "webhook", u.Scheme
+	if i := strings.Index(u.Scheme, "+"); i >= 0 {
+		kind, scheme = u.Scheme[:i], u.Scheme[i+1:]
+	}
+	if u.Scheme == "file" {
+		return fsmonitor.FileSink(u.Path)
+	}
+	token := u.User.Username()
+	base := *u
+	base.Scheme, base.User = scheme, nil
+
+	switch kind {
+	case "webhook":
+		return fsmonitor.WebhookSink(fsmonitor.Webhook{URL: base.String(), Logger: Logger})
+	case "splunk":
+		return fsmonitor.SplunkSink(fsmonitor.Splunk{URL: base.String(), Token: token, Logger: Logger})
+	case "loki":
+		return fsmonitor.LokiSink(fsmonitor.Loki{URL: base.String(), Logger: Logger})
+	}
+	return nil, fmt.Errorf("Sink URL %q is of no known sink", rawURL)
+}
+
+// stdoutSink writes notices as JSON lines to stdout.
+type stdoutSink struct{}
+
+func (stdoutSink) Publish(n fsmonitor.Notice) error {
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+func (stdoutSink) Close() error {
+	return nil
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: fsmon validate [flags]")
+	fmt.Fprintln(os.Stderr, "       fsmon explain [flags] path...")
+	fmt.Fprintln(os.Stderr, "       fsmon test-patterns [flags] [path...]")
+	fmt.Fprintln(os.Stderr, "       fsmon import [flags]")
+	fmt.Fprintln(os.Stderr, "       fsmon analyze [flags]")
+	fmt.Fprintln(os.Stderr, "       fsmon snapshot [flags]")
+	fmt.Fprintln(os.Stderr, "       fsmon replay -journal path -from t [-sink url] [-rate n]")
+	fmt.Fprintln(os.Stderr, "run with -h after the subcommand for flags")
+	os.Exit(2)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Fiery/fsmonitor"
+	"gopkg.in/yaml.v3"
+)
+
+// Config declares the Monitors run by the daemon.
+type Config struct {
+	Monitors []MonitorConfig `json:"monitors" yaml:"monitors" toml:"monitors"`
+}
+
+// MonitorConfig declares one Monitor and where its notices go.
+type MonitorConfig struct {
+	// Names the Monitor in logs, its index without
+	Name     string   `json:"name" yaml:"name" toml:"name"`
+	Paths    []string `json:"paths" yaml:"paths" toml:"paths"`
+	Patterns []string `json:"patterns" yaml:"patterns" toml:"patterns"`
+	Excludes []string `json:"excludes" yaml:"excludes" toml:"excludes"`
+	// Between scans, e.g. 10s, 10 seconds by default
+	Interval string `json:"interval" yaml:"interval" toml:"interval"`
+	// Event names, e.g. FileCreate, created, updated, removed and renamed files by default
+	Events []string `json:"events" yaml:"events" toml:"events"`
+	// Builtin Watcher, path, native or hybrid, path by default
+	Watcher string `json:"watcher" yaml:"watcher" toml:"watcher"`
+	// Scan profile, local or nfs, local by default
+	Profile string       `json:"profile" yaml:"profile" toml:"profile"`
+	Sinks   []SinkConfig `json:"sinks" yaml:"sinks" toml:"sinks"`
+}
+
+// SinkConfig declares a destination of notices, fields apply by Type.
+type SinkConfig struct {
+	// stdout, webhook or kafka
+	Type string `json:"type" yaml:"type" toml:"type"`
+	// webhook
+	URL    string `json:"url" yaml:"url" toml:"url"`
+	Secret string `json:"secret" yaml:"secret" toml:"secret"`
+	Batch  int    `json:"batch" yaml:"batch" toml:"batch"`
+	// kafka
+	Brokers []string `json:"brokers" yaml:"brokers" toml:"brokers"`
+	Topic   string   `json:"topic" yaml:"topic" toml:"topic"`
+	Async   bool     `json:"async" yaml:"async" toml:"async"`
+}
+
+// loadConfig reads the configuration file at path, YAML, TOML or JSON by its extension, and validates it.
+func loadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Config
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(&c)
+	case ".toml":
+		var md toml.MetaData
+		if md, err = toml.Decode(string(data), &c); err == nil && len(md.Undecoded()) > 0 {
+			err = fmt.Errorf("Keys not recognized: %v", md.Undecoded())
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&c)
+	default:
+		return nil, fmt.Errorf("Config format of %s not recognized, must be .yaml, .toml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Malformed config %s: %v", path, err)
+	}
+	if len(c.Monitors) == 0 {
+		return nil, fmt.Errorf("Config %s declares no monitors", path)
+	}
+	for i := range c.Monitors {
+		mc := &c.Monitors[i]
+		if mc.Name == "" {
+			mc.Name = fmt.Sprint(i)
+		}
+		if _, err := mc.options(); err != nil {
+			return nil, fmt.Errorf("Monitor %s: %v", mc.Name, err)
+		}
+		if _, err := mc.interval(); err != nil {
+			return nil, fmt.Errorf("Monitor %s: %v", mc.Name, err)
+		}
+		if _, err := mc.events(); err != nil {
+			return nil, fmt.Errorf("Monitor %s: %v", mc.Name, err)
+		}
+		if len(mc.Sinks) == 0 {
+			return nil, fmt.Errorf("Monitor %s declares no sinks", mc.Name)
+		}
+		for _, s := range mc.Sinks {
+			switch s.Type {
+			case "stdout", "webhook", "kafka":
+			default:
+				return nil, fmt.Errorf("Monitor %s: sink type not recognized: %q", mc.Name, s.Type)
+			}
+		}
+	}
+	return &c, nil
+}
+
+// options returns the options of the Monitor.
+func (mc *MonitorConfig) options() ([]fsmonitor.Option, error) {
+	if len(mc.Paths) == 0 {
+		return nil, fmt.Errorf("Paths to watch must be given")
+	}
+	opts := []fsmonitor.Option{
+		fsmonitor.WithPaths(mc.Paths...),
+		fsmonitor.WithPatterns(mc.Patterns...),
+		fsmonitor.WithExcludes(mc.Excludes...),
+	}
+	if mc.Watcher != "" {
+		opts = append(opts, fsmonitor.WithWatcher(mc.Watcher))
+	}
+	switch mc.Profile {
+	case "", "local":
+	case "nfs":
+		opts = append(opts, fsmonitor.WithProfile(fsmonitor.NFS))
+	default:
+		return nil, fmt.Errorf("Profile not recognized: %s", mc.Profile)
+	}
+	return opts, fsmonitor.Validate("", nil, "path", opts...)
+}
+
+// interval returns the time between scans.
+func (mc *MonitorConfig) interval() (time.Duration, error) {
+	if mc.Interval == "" {
+		return 10 * time.Second, nil
+	}
+	d, err := time.ParseDuration(mc.Interval)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Interval %q is invalid: %v", mc.Interval, err)
+	}
+	return d, nil
+}
+
+// events returns the event types delivered.
+func (mc *MonitorConfig) events() (fsmonitor.Event, error) {
+	if len(mc.Events) == 0 {
+		return fsmonitor.FileCreate | fsmonitor.FileUpdate | fsmonitor.FileRemove | fsmonitor.FileRename, nil
+	}
+	var events fsmonitor.Event
+	for _, name := range mc.Events {
+		if !strings.Contains(name, ".") {
+			name = "notice." + name
+		}
+		e, err := fsmonitor.ParseEvent(name)
+		if err != nil {
+			return 0, err
+		}
+		events |= e
+	}
+	return events, nil
+}
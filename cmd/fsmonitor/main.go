@@ -0,0 +1,304 @@
+// Command fsmonitor runs the Monitors declared by a configuration file, publishing their notices to sinks.
+//
+//	fsmonitor -config fsmonitor.yaml [-check]
+//
+// The file is YAML, TOML or JSON by its extension, e.g.:
+//
+//	monitors:
+//	  - name: incoming
+//	    paths: [/data/incoming]
+//	    patterns: ["glob:**/*.csv"]
+//	    interval: 10s
+//	    events: [FileCreate, FileUpdate]
+//	    sinks:
+//	      - type: stdout
+//	      - type: webhook
+//	        url: https://example.com/hook
+//	        secret: s3cr3t
+//	      - type: kafka
+//	        brokers: [localhost:9092]
+//	        topic: monitor
+//
+// SIGHUP reloads the file once it's valid and the Monitors and sinks it declares anew were created, keeping the
+// running Monitors otherwise: Monitors whose patterns, excludes or interval changed only are updated in place,
+// keeping what they track, others changed are replaced and those no longer declared are stopped.
+// SIGINT and SIGTERM stop them, publishing notices delivered so far.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/Fiery/fsmonitor/kafkasink"
+)
+
+var Logger = log.New(os.Stderr, "[Fsmonitor] ", log.LstdFlags)
+
+var (
+	configFile = flag.String("config", "fsmonitor.yaml", "Configuration file, .yaml, .toml or .json")
+	check      = flag.Bool("check", false, "Validate the configuration file and exit")
+	verbose    = flag.Bool("verbose", false, "Log scanning of monitors")
+)
+
+func main() {
+	flag.Parse()
+	if *verbose {
+		fsmonitor.Logger = log.New(os.Stderr, "[Monitor] ", log.LstdFlags)
+	}
+
+	c, err := loadConfig(*configFile)
+	if err != nil {
+		Logger.Fatalln("Invalid configuration!", err)
+	}
+	if *check {
+		fmt.Println("Configuration is valid.")
+		return
+	}
+
+	running, err := start(c)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			Logger.Printf("%v received, stopping %d monitors", sig, len(running))
+			stop(running)
+			return
+		}
+
+		c, err := loadConfig(*configFile)
+		if err != nil {
+			Logger.Println("Invalid configuration, keeping the running one!", err)
+			continue
+		}
+		Logger.Printf("Reloading %s", *configFile)
+		if running, err = reload(running, c); err != nil {
+			Logger.Println("Failed to reload, keeping the running monitors!", err)
+		}
+	}
+}
+
+// monitor is a running Monitor along with the configuration it was started by.
+type monitor struct {
+	*fsmonitor.Monitor
+	conf MonitorConfig
+}
+
+// start creates and starts the Monitors of c with their sinks, stopping those started already on failure.
+func start(c *Config) ([]*monitor, error) {
+	var running []*monitor
+	for i := range c.Monitors {
+		m, err := startMonitor(&c.Monitors[i])
+		if err != nil {
+			stop(running)
+			return nil, err
+		}
+		running = append(running, m)
+	}
+	return running, nil
+}
+
+// startMonitor creates and starts the Monitor of mc with its sinks.
+func startMonitor(mc *MonitorConfig) (*monitor, error) {
+	p, err := prepare(mc)
+	if err != nil {
+		return nil, err
+	}
+	return p.start(), nil
+}
+
+// prepared is the Monitor of conf created along with its sinks, not started yet.
+type prepared struct {
+	*fsmonitor.Monitor
+	sinks []fsmonitor.Sink
+	conf  *MonitorConfig
+}
+
+// prepare creates the Monitor of mc and its sinks.
+func prepare(mc *MonitorConfig) (*prepared, error) {
+	opts, err := mc.options()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start monitor %s: %v", mc.Name, err)
+	}
+	m, err := fsmonitor.NewMonitor(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to start monitor %s: %v", mc.Name, err)
+	}
+	p := &prepared{Monitor: m, conf: mc}
+	for _, sc := range mc.Sinks {
+		s, err := newSink(sc)
+		if err != nil {
+			p.discard()
+			return nil, fmt.Errorf("Failed to start monitor %s: %v", mc.Name, err)
+		}
+		p.sinks = append(p.sinks, s)
+	}
+	return p, nil
+}
+
+// start attaches the sinks and starts the Monitor.
+func (p *prepared) start() *monitor {
+	for _, s := range p.sinks {
+		p.AttachSink(s)
+	}
+	interval, _ := p.conf.interval()
+	events, _ := p.conf.events()
+	go p.Start(interval, events)
+	Logger.Printf("Monitor %s watching %v every %v", p.conf.Name, p.conf.Paths, interval)
+	return &monitor{Monitor: p.Monitor, conf: *p.conf}
+}
+
+// discard closes the sinks of a Monitor never started.
+func (p *prepared) discard() {
+	for _, s := range p.sinks {
+		s.Close()
+	}
+}
+
+// newSink creates the sink declared by sc.
+func newSink(sc SinkConfig) (fsmonitor.Sink, error) {
+	switch sc.Type {
+	case "stdout":
+		return stdout, nil
+	case "webhook":
+		return fsmonitor.WebhookSink(fsmonitor.Webhook{URL: sc.URL, Secret: sc.Secret, Batch: sc.Batch, Logger: Logger})
+	case "kafka":
+		return kafkasink.New(kafkasink.Config{Brokers: sc.Brokers, Topic: sc.Topic, Async: sc.Async, Logger: Logger})
+	}
+	return nil, fmt.Errorf("Sink type not recognized: %q", sc.Type)
+}
+
+// reload applies c to the running Monitors by name, updating in place those whose patterns, excludes or interval
+// changed only, replacing others changed, stopping those no longer declared and starting new ones. The Monitors
+// started anew are created first: once one fails, nothing is stopped and running is returned as is along with the
+// error.
+func reload(running []*monitor, c *Config) ([]*monitor, error) {
+	byName := make(map[string]*monitor)
+	for _, m := range running {
+		byName[m.conf.Name] = m
+	}
+	type update struct {
+		m  *monitor
+		mc *MonitorConfig
+	}
+	var updates []update
+	var pending []*prepared
+	for i := range c.Monitors {
+		mc := &c.Monitors[i]
+		if m, ok := byName[mc.Name]; ok && m.updatable(mc) {
+			updates = append(updates, update{m, mc})
+			delete(byName, mc.Name)
+			continue
+		}
+		p, err := prepare(mc)
+		if err != nil {
+			for _, p := range pending {
+				p.discard()
+			}
+			return running, err
+		}
+		pending = append(pending, p)
+	}
+
+	var kept, stale []*monitor
+	for _, u := range updates {
+		if u.m.update(u.mc) {
+			kept = append(kept, u.m)
+			continue
+		}
+		p, err := prepare(u.mc)
+		if err != nil {
+			Logger.Printf("Failed to replace monitor %s, keeping it! %v", u.mc.Name, err)
+			kept = append(kept, u.m)
+			continue
+		}
+		stale = append(stale, u.m)
+		pending = append(pending, p)
+	}
+	for _, m := range byName {
+		stale = append(stale, m)
+	}
+	/* replaced ones stop first, so no path is watched twice */
+	stop(stale)
+	for _, p := range pending {
+		kept = append(kept, p.start())
+	}
+	return kept, nil
+}
+
+// updatable reports whether mc differs from the configuration of the running Monitor in patterns, excludes or
+// interval only.
+func (m *monitor) updatable(mc *MonitorConfig) bool {
+	conf, next := m.conf, *mc
+	conf.Patterns, conf.Excludes, conf.Interval = nil, nil, ""
+	next.Patterns, next.Excludes, next.Interval = nil, nil, ""
+	return reflect.DeepEqual(conf, next)
+}
+
+// update applies mc, updatable, to the running Monitor, reporting whether it did.
+func (m *monitor) update(mc *MonitorConfig) bool {
+	if reflect.DeepEqual(m.conf, *mc) {
+		return true
+	}
+	/* the interval is kept as is unless changed */
+	old, _ := m.conf.interval()
+	interval, _ := mc.interval()
+	if interval == old {
+		interval = 0
+	}
+	if err := m.UpdateConfig(fsmonitor.Config{Patterns: mc.Patterns, Excludes: mc.Excludes, Interval: interval}); err != nil {
+		Logger.Printf("Failed to update monitor %s, replacing it! %v", mc.Name, err)
+		return false
+	}
+	Logger.Printf("Monitor %s updated, watching %v", mc.Name, mc.Paths)
+	m.conf = *mc
+	return true
+}
+
+// stop stops every Monitor, waiting for their sinks to publish what was delivered.
+func stop(running []*monitor) {
+	var wg sync.WaitGroup
+	for _, m := range running {
+		wg.Add(1)
+		go func(m *monitor) {
+			defer wg.Done()
+			if err := m.Stop(); err != nil {
+				Logger.Println("Failed to stop monitor!", err)
+			}
+		}(m)
+	}
+	wg.Wait()
+}
+
+// stdoutSink writes notices as JSON lines to stdout, shared by every Monitor.
+type stdoutSink struct {
+	mu sync.Mutex
+}
+
+var stdout = &stdoutSink{}
+
+func (s *stdoutSink) Publish(n fsmonitor.Notice) error {
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = os.Stdout.Write(append(data, '\n'))
+	return err
+}
+
+// Close keeps stdout open for other Monitors and reloads.
+func (s *stdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,102 @@
+// Command fsmonsoak stress tests the "path" Watcher on a temporary tree, asserting notice invariants.
+// Run it with the race detector to validate concurrency changes:
+//
+//	go run -race ./cmd/fsmonsoak -duration 10m
+//
+// With -model it checks the diff engine against a reference model instead:
+//
+//	go run ./cmd/fsmonsoak -model -steps 1000
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/Fiery/fsmonitor/fsmonitortest"
+)
+
+var (
+	root      = flag.String("root", "", "Directory to mutate, a temporary one by default")
+	interval  = flag.Duration("interval", 100*time.Millisecond, "Scan interval")
+	duration  = flag.Duration("duration", time.Minute, "Total run time")
+	mutations = flag.Int("mutations", 50, "Paths mutated per round")
+	dirs      = flag.Int("dirs", 10, "Sub-directories to spread files over")
+	seed      = flag.Int64("seed", time.Now().UnixNano(), "Random seed, reuse to reproduce a run")
+	verbose   = flag.Bool("verbose", false, "Turn on Monitor logging")
+	workers   = flag.Int("concurrency", 1, "Directories read concurrently by a scan")
+
+	model   = flag.Bool("model", false, "Check the diff engine against a reference model")
+	steps   = flag.Int("steps", 500, "Mutate-then-scan steps of the model check")
+	pattern = flag.String("pattern", "", "File patterns of the model check, as a comma separated list")
+)
+
+var Logger = log.New(os.Stdout, "[Soak] ", log.LstdFlags)
+
+func main() {
+
+	flag.Parse()
+	if *verbose {
+		fsmonitor.Logger = log.New(os.Stdout, "[Monitor] ", log.LstdFlags)
+	}
+
+	dir := *root
+	if dir == "" {
+		tmp, err := os.MkdirTemp("", "fsmonsoak")
+		if err != nil {
+			Logger.Fatalln("Failed to create temporary directory!", err)
+		}
+		defer os.RemoveAll(tmp)
+		dir = tmp
+	}
+
+	var opts []fsmonitor.Option
+	if *workers > 1 {
+		opts = append(opts, fsmonitor.WithScanConcurrency(*workers))
+	}
+
+	if *model {
+		var patterns []string
+		if *pattern != "" {
+			patterns = strings.Split(*pattern, ",")
+		}
+		Logger.Printf("Model checking %s for %d steps with seed %d", dir, *steps, *seed)
+		if err := fsmonitortest.CheckModel(fsmonitortest.ModelConfig{
+			Root:      dir,
+			Steps:     *steps,
+			Mutations: *mutations,
+			Pattern:   patterns,
+			Options:   opts,
+			Seed:      *seed,
+		}); err != nil {
+			Logger.Println("Model mismatch!", err)
+			os.RemoveAll(dir)
+			os.Exit(1)
+		}
+		Logger.Println("Notices matched the model.")
+		return
+	}
+
+	Logger.Printf("Soaking %s for %v with seed %d", dir, *duration, *seed)
+	report, err := fsmonitortest.Soak(fsmonitortest.SoakConfig{
+		Root:      dir,
+		Interval:  *interval,
+		Duration:  *duration,
+		Mutations: *mutations,
+		Dirs:      *dirs,
+		Options:   opts,
+		Seed:      *seed,
+	})
+	if report != nil {
+		Logger.Printf("%d rounds, %d mutations, notices: %v", report.Rounds, report.Mutations, report.Notices)
+	}
+	if err != nil {
+		Logger.Println("Invariant violated!", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	Logger.Println("All invariants held.")
+}
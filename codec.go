@@ -0,0 +1,516 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// SnapshotCodec encodes the FileState records of snapshot files, see DirSnapshotsCodec.
+type SnapshotCodec interface {
+	// Name of the codec, as taken by ParseSnapshotCodec
+	String() string
+	// Encode writes files to w as a stream of records
+	Encode(w io.Writer, files []FileState) error
+	// Decode reads the records written by Encode
+	Decode(r io.Reader) ([]FileState, error)
+}
+
+var (
+	// JSONSnapshots encodes line-delimited JSON records, human-inspectable, e.g. by jq
+	JSONSnapshots SnapshotCodec = jsonCodec{}
+	// CBORSnapshots encodes a CBOR sequence (RFC 8742) of maps keyed as the JSON records, with modtime in
+	// nanoseconds since the epoch, a third smaller than JSON and faster to decode
+	CBORSnapshots SnapshotCodec = cborCodec{}
+	// ProtoSnapshots encodes varint length-delimited protobuf messages, half the size of JSON, as defined by
+	//
+	//	message FileState {
+	//	  string path = 1;
+	//	  int64 size = 2;
+	//	  uint32 mode = 3;
+	//	  int64 modtime = 4; // nanoseconds since the epoch
+	//	  string id = 5;
+	//	  string target = 6;
+	//	  bool broken = 7;
+	//	  map<string, string> streams = 8;
+	//	}
+	ProtoSnapshots SnapshotCodec = protoCodec{}
+)
+
+var snapshotCodecs = []SnapshotCodec{JSONSnapshots, CBORSnapshots, ProtoSnapshots}
+
+// ParseSnapshotCodec returns the builtin SnapshotCodec named s, json, cbor or proto.
+func ParseSnapshotCodec(s string) (SnapshotCodec, error) {
+	for _, c := range snapshotCodecs {
+		if c.String() == s {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("Snapshot codec not recognized: %q", s)
+}
+
+// jsonCodec implements SnapshotCodec by line-delimited JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) String() string { return "json" }
+
+func (jsonCodec) Encode(w io.Writer, files []FileState) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for i := range files {
+		if err := enc.Encode(&files[i]); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (jsonCodec) Decode(r io.Reader) ([]FileState, error) {
+	files := []FileState{}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for {
+		var state FileState
+		if err := dec.Decode(&state); err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		files = append(files, state)
+	}
+}
+
+/* CBOR major types */
+const (
+	cbor_uint   = 0
+	cbor_negint = 1
+	cbor_bytes  = 2
+	cbor_text   = 3
+	cbor_array  = 4
+	cbor_map    = 5
+	cbor_tag    = 6
+)
+
+// cborCodec implements SnapshotCodec by a CBOR sequence of maps.
+type cborCodec struct{}
+
+func (cborCodec) String() string { return "cbor" }
+
+func (cborCodec) Encode(w io.Writer, files []FileState) error {
+	bw := bufio.NewWriter(w)
+	var buf []byte
+	for i := range files {
+		f := &files[i]
+		fields := uint64(4)
+		for _, present := range []bool{f.ID != "", f.Target != "", f.Broken, f.Streams != nil} {
+			if present {
+				fields++
+			}
+		}
+		buf = cborHead(buf[:0], cbor_map, fields)
+		buf = cborText(cborText(buf, "path"), f.Path)
+		buf = cborInt(cborText(buf, "size"), f.Size)
+		buf = cborHead(cborText(buf, "mode"), cbor_uint, uint64(f.Mode))
+		buf = cborInt(cborText(buf, "modtime"), f.ModTime.UnixNano())
+		if f.ID != "" {
+			buf = cborText(cborText(buf, "id"), f.ID)
+		}
+		if f.Target != "" {
+			buf = cborText(cborText(buf, "target"), f.Target)
+		}
+		if f.Broken {
+			buf = append(cborText(buf, "broken"), 0xf5)
+		}
+		if f.Streams != nil {
+			buf = cborHead(cborText(buf, "streams"), cbor_map, uint64(len(f.Streams)))
+			for _, name := range sortedKeys(f.Streams) {
+				buf = cborText(cborText(buf, name), f.Streams[name])
+			}
+		}
+		if _, err := bw.Write(buf); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (cborCodec) Decode(r io.Reader) ([]FileState, error) {
+	br := bufio.NewReader(r)
+	files := []FileState{}
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return files, nil
+		}
+		var f FileState
+		major, fields, err := cborReadHead(br)
+		if err != nil {
+			return nil, err
+		}
+		if major != cbor_map {
+			return nil, fmt.Errorf("Record %d is not a CBOR map", len(files)+1)
+		}
+		for ; fields > 0; fields-- {
+			key, err := cborReadText(br)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "path":
+				f.Path, err = cborReadText(br)
+			case "size":
+				f.Size, err = cborReadInt(br)
+			case "mode":
+				var mode int64
+				mode, err = cborReadInt(br)
+				f.Mode = os.FileMode(mode)
+			case "modtime":
+				var ns int64
+				ns, err = cborReadInt(br)
+				f.ModTime = time.Unix(0, ns)
+			case "id":
+				f.ID, err = cborReadText(br)
+			case "target":
+				f.Target, err = cborReadText(br)
+			case "broken":
+				var b byte
+				b, err = br.ReadByte()
+				f.Broken = b == 0xf5
+			case "streams":
+				f.Streams, err = cborReadTextMap(br)
+			default:
+				/* written by a later version */
+				err = cborSkip(br)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("Record %d failed decoding %s: %v", len(files)+1, key, err)
+			}
+		}
+		files = append(files, f)
+	}
+}
+
+func cborHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return append(buf, m|25, byte(n>>8), byte(n))
+	case n <= math.MaxUint32:
+		return append(buf, m|26, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	var arg [8]byte
+	binary.BigEndian.PutUint64(arg[:], n)
+	return append(append(buf, m|27), arg[:]...)
+}
+
+func cborInt(buf []byte, i int64) []byte {
+	if i < 0 {
+		return cborHead(buf, cbor_negint, uint64(-1-i))
+	}
+	return cborHead(buf, cbor_uint, uint64(i))
+}
+
+func cborText(buf []byte, s string) []byte {
+	return append(cborHead(buf, cbor_text, uint64(len(s))), s...)
+}
+
+// cborReadHead reads the major type and argument of the next item, indefinite lengths are not supported.
+func cborReadHead(br *bufio.Reader) (byte, uint64, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+	major, info := b>>5, b&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, uint64(info), nil
+	case info <= 27:
+		size = 1 << (info - 24)
+	default:
+		return major, 0, fmt.Errorf("Unsupported CBOR item 0x%02x", b)
+	}
+	var arg [8]byte
+	if _, err := io.ReadFull(br, arg[8-size:]); err != nil {
+		return major, 0, io.ErrUnexpectedEOF
+	}
+	return major, binary.BigEndian.Uint64(arg[:]), nil
+}
+
+func cborReadInt(br *bufio.Reader) (int64, error) {
+	major, n, err := cborReadHead(br)
+	switch {
+	case err != nil:
+		return 0, err
+	case major == cbor_uint && n <= math.MaxInt64:
+		return int64(n), nil
+	case major == cbor_negint && n <= math.MaxInt64:
+		return -1 - int64(n), nil
+	}
+	return 0, fmt.Errorf("Not a CBOR integer in range")
+}
+
+func cborReadText(br *bufio.Reader) (string, error) {
+	major, n, err := cborReadHead(br)
+	if err != nil {
+		return "", err
+	}
+	if major != cbor_text {
+		return "", fmt.Errorf("Not a CBOR text string")
+	}
+	b, err := cborReadN(br, n)
+	return string(b), err
+}
+
+func cborReadTextMap(br *bufio.Reader) (map[string]string, error) {
+	major, n, err := cborReadHead(br)
+	if err != nil {
+		return nil, err
+	}
+	if major != cbor_map {
+		return nil, fmt.Errorf("Not a CBOR map")
+	}
+	m := make(map[string]string)
+	for ; n > 0; n-- {
+		k, err := cborReadText(br)
+		if err != nil {
+			return nil, err
+		}
+		if m[k], err = cborReadText(br); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// cborReadN reads n bytes, not trusting n to allocate.
+func cborReadN(br *bufio.Reader, n uint64) ([]byte, error) {
+	var b []byte
+	for n > 0 {
+		chunk := n
+		if chunk > 1<<16 {
+			chunk = 1 << 16
+		}
+		start := len(b)
+		b = append(b, make([]byte, chunk)...)
+		if _, err := io.ReadFull(br, b[start:]); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		n -= chunk
+	}
+	return b, nil
+}
+
+// cborSkip skips the next item.
+func cborSkip(br *bufio.Reader) error {
+	major, n, err := cborReadHead(br)
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cbor_bytes, cbor_text:
+		_, err = cborReadN(br, n)
+	case cbor_array:
+		for ; n > 0 && err == nil; n-- {
+			err = cborSkip(br)
+		}
+	case cbor_map:
+		for ; n > 0 && err == nil; n-- {
+			if err = cborSkip(br); err == nil {
+				err = cborSkip(br)
+			}
+		}
+	case cbor_tag:
+		err = cborSkip(br)
+	}
+	return err
+}
+
+/* protobuf wire types */
+const (
+	proto_varint  = 0
+	proto_fixed64 = 1
+	proto_bytes   = 2
+	proto_fixed32 = 5
+	/* bounds a record, corrupted lengths don't allocate gigabytes */
+	proto_record_max = 1 << 24
+)
+
+// protoCodec implements SnapshotCodec by length-delimited protobuf messages.
+type protoCodec struct{}
+
+func (protoCodec) String() string { return "proto" }
+
+func (protoCodec) Encode(w io.Writer, files []FileState) error {
+	bw := bufio.NewWriter(w)
+	var msg, entry, head []byte
+	for i := range files {
+		f := &files[i]
+		msg = protoString(msg[:0], 1, f.Path)
+		msg = protoVarint(msg, 2, uint64(f.Size))
+		msg = protoVarint(msg, 3, uint64(f.Mode))
+		msg = protoVarint(msg, 4, uint64(f.ModTime.UnixNano()))
+		msg = protoString(msg, 5, f.ID)
+		msg = protoString(msg, 6, f.Target)
+		if f.Broken {
+			msg = protoVarint(msg, 7, 1)
+		}
+		for _, name := range sortedKeys(f.Streams) {
+			entry = protoString(protoString(entry[:0], 1, name), 2, f.Streams[name])
+			msg = protoString(msg, 8, string(entry))
+		}
+		head = appendUvarint(head[:0], uint64(len(msg)))
+		if _, err := bw.Write(head); err != nil {
+			return err
+		}
+		if _, err := bw.Write(msg); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (protoCodec) Decode(r io.Reader) ([]FileState, error) {
+	br := bufio.NewReader(r)
+	files := []FileState{}
+	for {
+		size, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			return files, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if size > proto_record_max {
+			return nil, fmt.Errorf("Record %d is too large: %d bytes", len(files)+1, size)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(br, msg); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		var f FileState
+		err = protoFields(msg, func(field uint64, varint uint64, bytes []byte) error {
+			switch field {
+			case 1:
+				f.Path = string(bytes)
+			case 2:
+				f.Size = int64(varint)
+			case 3:
+				f.Mode = os.FileMode(varint)
+			case 4:
+				f.ModTime = time.Unix(0, int64(varint))
+			case 5:
+				f.ID = string(bytes)
+			case 6:
+				f.Target = string(bytes)
+			case 7:
+				f.Broken = varint != 0
+			case 8:
+				var name, digest string
+				err := protoFields(bytes, func(field uint64, _ uint64, bytes []byte) error {
+					switch field {
+					case 1:
+						name = string(bytes)
+					case 2:
+						digest = string(bytes)
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				if f.Streams == nil {
+					f.Streams = make(map[string]string)
+				}
+				f.Streams[name] = digest
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Record %d failed decoding: %v", len(files)+1, err)
+		}
+		files = append(files, f)
+	}
+}
+
+func protoVarint(buf []byte, field int, v uint64) []byte {
+	if v == 0 {
+		/* default values aren't written */
+		return buf
+	}
+	buf = appendUvarint(buf, uint64(field)<<3|proto_varint)
+	return appendUvarint(buf, v)
+}
+
+func protoString(buf []byte, field int, s string) []byte {
+	if s == "" {
+		return buf
+	}
+	buf = appendUvarint(buf, uint64(field)<<3|proto_bytes)
+	buf = appendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// protoFields passes the fields of msg to fn, varint or bytes by wire type, skipping fixed-size ones.
+func protoFields(msg []byte, fn func(field uint64, varint uint64, bytes []byte) error) error {
+	for len(msg) > 0 {
+		key, n := binary.Uvarint(msg)
+		if n <= 0 {
+			return fmt.Errorf("Malformed field key")
+		}
+		msg = msg[n:]
+		var varint uint64
+		var bytes []byte
+		switch key & 7 {
+		case proto_varint:
+			if varint, n = binary.Uvarint(msg); n <= 0 {
+				return fmt.Errorf("Malformed varint")
+			}
+			msg = msg[n:]
+		case proto_bytes:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return fmt.Errorf("Malformed length")
+			}
+			bytes, msg = msg[n:n+int(size)], msg[n+int(size):]
+		case proto_fixed64, proto_fixed32:
+			size := 8
+			if key&7 == proto_fixed32 {
+				size = 4
+			}
+			if len(msg) < size {
+				return fmt.Errorf("Truncated field")
+			}
+			msg = msg[size:]
+			continue
+		default:
+			return fmt.Errorf("Unsupported wire type %d", key&7)
+		}
+		if err := fn(key>>3, varint, bytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+// sortedKeys returns the keys of m in order, so encodings are deterministic.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
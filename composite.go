@@ -0,0 +1,171 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// SourcedNotice is implemented by notices of a CompositeWatcher, telling the name of the Watcher they're from.
+type SourcedNotice interface {
+	Notice
+	Source() string
+}
+
+// sourceNotice implements SourcedNotice by wrapping the discovered Notice.
+type sourceNotice struct {
+	Notice
+	source string
+}
+
+func (s *sourceNotice) Unwrap() Notice {
+	return s.Notice
+}
+
+func (s *sourceNotice) Source() string {
+	return s.source
+}
+
+// CompositeWatcher returns a Watcher checking the Watchers of sources concurrently every scan, merging their notices,
+// e.g. the builtin "path" Watcher, an S3 and an SFTP Watcher aggregated by one Monitor given WithWatcher. Notices
+// implement SourcedNotice telling the name of their Watcher, labeled as Source by NoticeLabels. Failures are isolated:
+// sources failing a scan, or stopped altogether, are sent by Monitor.Errors as *ScanError with their name as Root,
+// degrading the Monitor, while the others go on at the interval, scans pause as given WithBackoff only if all fail.
+func CompositeWatcher(sources map[string]Watcher) (Watcher, error) {
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("Composite Watcher must have sources")
+	}
+	c := &compositeWatcher{}
+	for name, w := range sources {
+		if name == "" || w == nil {
+			return nil, fmt.Errorf("Sources must be named and have a Watcher")
+		}
+		c.sources = append(c.sources, &watchedSource{name: name, watcher: w})
+	}
+	/* in order of names, so previews and errors are */
+	sort.Slice(c.sources, func(i, j int) bool { return c.sources[i].name < c.sources[j].name })
+	return c, nil
+}
+
+// compositeWatcher implements Watcher by checking several Watchers concurrently, see CompositeWatcher.
+type compositeWatcher struct {
+	sources []*watchedSource
+}
+
+// watchedSource is a Watcher of a compositeWatcher.
+type watchedSource struct {
+	name    string
+	watcher Watcher
+
+	/* protocol of the Watcher once watching */
+	ncc    chan<- chan<- Notice
+	errors <-chan error
+	/* the Watcher returned, it can't be sent further checks */
+	stopped bool
+}
+
+// scan runs one check of the source, sending its notices tagged by its name to changed.
+func (s *watchedSource) scan(changed chan<- Notice) error {
+	relay := make(chan Notice)
+	if !s.stopped {
+		select {
+		case s.ncc <- relay:
+		/* a Watcher returning closes its errors, no longer receiving checks */
+		case _, ok := <-s.errors:
+			s.stopped = !ok
+		}
+	}
+	for !s.stopped {
+		select {
+		case n := <-relay:
+			changed <- &sourceNotice{Notice: n, source: s.name}
+		case err, ok := <-s.errors:
+			if ok {
+				return err
+			}
+			s.stopped = true
+		}
+	}
+	return fmt.Errorf("Watcher of %s has stopped", s.name)
+}
+
+// stop ends watching.
+func (s *watchedSource) stop() {
+	close(s.ncc)
+	for range s.errors {
+	}
+}
+
+// Watch checks every source for every notice channel sent by Monitor, the error joins those of all sources.
+func (c *compositeWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+	for _, s := range c.sources {
+		s.ncc, s.errors = s.watcher.Watch()
+	}
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error) {
+		defer close(errors)
+		defer func() {
+			for _, s := range c.sources {
+				s.stop()
+			}
+		}()
+
+		for changed := range ncc {
+			var wg sync.WaitGroup
+			errs := make([]error, len(c.sources))
+			for i, s := range c.sources {
+				wg.Add(1)
+				go func(i int, s *watchedSource) {
+					defer wg.Done()
+					errs[i] = s.scan(changed)
+				}(i, s)
+			}
+			wg.Wait()
+
+			failed := &scanErrors{roots: len(c.sources), isolated: true}
+			for i, err := range errs {
+				if err != nil {
+					failed.errs = append(failed.errs, scanError(c.sources[i].name, err))
+				}
+			}
+			if len(failed.errs) > 0 {
+				errors <- failed
+				continue
+			}
+			errors <- nil
+		}
+	}(ncc, errors)
+	return ncc, errors
+}
+
+// Preview collects notices previewed by the Watchers of all sources.
+func (c *compositeWatcher) Preview() ([]Notice, error) {
+	var notices []Notice
+	for _, s := range c.sources {
+		p, ok := s.watcher.(Previewer)
+		if !ok {
+			return nil, fmt.Errorf("Watcher %T doesn't support preview", s.watcher)
+		}
+		previewed, err := p.Preview()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", s.name, err)
+		}
+		for _, n := range previewed {
+			notices = append(notices, &sourceNotice{Notice: n, source: s.name})
+		}
+	}
+	return notices, nil
+}
+
+// ScanCounts sums the counts of sources telling theirs.
+func (c *compositeWatcher) ScanCounts() (visited, tracked int) {
+	for _, s := range c.sources {
+		if sc, ok := s.watcher.(ScanCounter); ok {
+			v, t := sc.ScanCounts()
+			visited, tracked = visited+v, tracked+t
+		}
+	}
+	return visited, tracked
+}
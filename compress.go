@@ -0,0 +1,498 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	/* heads files of gzip frames, plain files of lines start with '{' */
+	frame_magic = "FSMZ"
+	/* extension of files of gzip frames */
+	frame_extension = ".fsmz"
+	/* bytes of heads told apart by readLines */
+	head_size = 4
+)
+
+// lineWriter appends lines to a file, written through to the OS line by line.
+type lineWriter interface {
+	writeLine(line []byte) error
+	Close() error
+}
+
+// Compression compresses the lines of FileJournal and FileSink files whose paths end in its Extension. Every line
+// is compressed as a stream of its own, e.g. a gzip member, appended by a single write, so files are read by the
+// usual tools, e.g. zcat, and a stream torn by a crash is cut off when reopened. Lines don't share compression, so
+// short ones compress less than in files of gzip frames, see FileJournal. gzip is registered for ".gz", package
+// zstdfile registers zstd for ".zst".
+type Compression struct {
+	// Extension of the paths of compressed files, e.g. ".zst"
+	Extension string
+	// Magic heads every stream, telling compressed files apart when read
+	Magic []byte
+	// NewWriter returns a writer of a stream to w, ended by Close; writers implementing Reset(io.Writer) are reused
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+	// NewReader returns a reader of the streams of r one after another, failing at a torn one
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var compressions struct {
+	sync.Mutex
+	list []Compression
+}
+
+func init() {
+	RegisterCompression(Compression{
+		Extension: ".gz",
+		Magic:     []byte{0x1f, 0x8b},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriter(w), nil
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+}
+
+// RegisterCompression registers c, replacing the one registered for its extension before, e.g. by the init
+// function of a package.
+func RegisterCompression(c Compression) {
+	compressions.Lock()
+	defer compressions.Unlock()
+	for i, r := range compressions.list {
+		if r.Extension == c.Extension {
+			compressions.list[i] = c
+			return
+		}
+	}
+	compressions.list = append(compressions.list, c)
+}
+
+// compressionOf returns the Compression registered for the extension of path, or the one whose magic heads head.
+func compressionOf(path string, head []byte) (Compression, bool) {
+	compressions.Lock()
+	defer compressions.Unlock()
+	for _, c := range compressions.list {
+		if path != "" && strings.HasSuffix(path, c.Extension) || head != nil && len(c.Magic) > 0 && bytes.HasPrefix(head, c.Magic) {
+			return c, true
+		}
+	}
+	return Compression{}, false
+}
+
+// openLines opens the file at path for appending lines, compressed in gzip frames if the path ends in ".fsmz" or
+// by the Compression registered for its extension.
+func openLines(path string) (lineWriter, error) {
+	if strings.HasSuffix(path, frame_extension) {
+		return openFrames(path)
+	}
+	if c, ok := compressionOf(path, nil); ok {
+		/* files of gzip frames written as ".gz" before ".fsmz", appended as such */
+		if head, err := readHead(path); err != nil {
+			return nil, err
+		} else if string(head) == frame_magic {
+			return openFrames(path)
+		}
+		return openStreams(path, c)
+	}
+	return openPlain(path)
+}
+
+// readHead returns the first bytes of the file at path, none if it doesn't exist.
+func readHead(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	head := make([]byte, head_size)
+	n, err := io.ReadFull(f, head)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return head[:n], err
+}
+
+// readLines calls fn with every whole line of the file at path, in order, until fn returns an error. Lines torn by
+// a crash are skipped, compressed files are told by their head and decompressed.
+func readLines(path string, fn func(line []byte) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	head, _ := r.Peek(head_size)
+	if string(head) == frame_magic {
+		r.Discard(len(frame_magic))
+		return readFrames(r, fn)
+	}
+	if c, ok := compressionOf("", head); ok {
+		return readStreams(r, c, fn)
+	}
+	return scanLines(r, fn)
+}
+
+// scanLines calls fn with every whole line of r.
+func scanLines(r *bufio.Reader, fn func(line []byte) error) error {
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			/* the line being appended, or torn by a crash */
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if len(line) == 1 {
+			continue
+		}
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+}
+
+// plainLines appends lines to a file as they are.
+type plainLines struct {
+	*os.File
+}
+
+// openPlain opens the file for appending, ending a line torn by a crash so the next one is whole.
+func openPlain(path string) (*plainLines, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err = f.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+			_, err = f.Write([]byte{'\n'})
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &plainLines{File: f}, nil
+}
+
+func (p *plainLines) writeLine(line []byte) error {
+	_, err := p.Write(append(line, '\n'))
+	return err
+}
+
+// streamLines appends lines compressed as streams of their own, see Compression.
+type streamLines struct {
+	file *os.File
+	c    Compression
+	buf  bytes.Buffer
+	zw   io.WriteCloser
+}
+
+// openStreams opens the file for appending streams of c, cutting off a stream torn by a crash.
+func openStreams(path string, c Compression) (*streamLines, error) {
+	if err := cutStreams(path, c); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &streamLines{file: f, c: c}, nil
+}
+
+// cutStreams rewrites the file at path by its whole lines if its last stream is torn, so streams appended after
+// are read.
+func cutStreams(path string, c Compression) error {
+	head, err := readHead(path)
+	if err != nil || len(head) == 0 {
+		return err
+	}
+	if !bytes.HasPrefix(head, c.Magic) {
+		return fmt.Errorf("File %s isn't compressed as its extension tells", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := c.NewReader(bufio.NewReader(f))
+	if err == nil {
+		_, err = io.Copy(ioutil.Discard, zr)
+		zr.Close()
+	}
+	if err == nil {
+		return nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	temp := path + ".cut"
+	out, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	s := &streamLines{file: out, c: c}
+	err = readStreams(bufio.NewReader(f), c, func(line []byte) error {
+		return s.writeLine(line[:len(line)-1])
+	})
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(temp, path)
+	}
+	if err != nil {
+		os.Remove(temp)
+	}
+	return err
+}
+
+// readStreams calls fn with every whole line of the streams of r, up to a torn one.
+func readStreams(r *bufio.Reader, c Compression, fn func(line []byte) error) error {
+	zr, err := c.NewReader(r)
+	if err != nil {
+		/* the first stream is torn */
+		return nil
+	}
+	defer zr.Close()
+	return scanLines(bufio.NewReader(tornReader{zr}), fn)
+}
+
+// tornReader ends at the first failure, that of a torn stream.
+type tornReader struct {
+	r io.Reader
+}
+
+func (t tornReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if err != nil {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (s *streamLines) writeLine(line []byte) error {
+	s.buf.Reset()
+	if r, ok := s.zw.(interface{ Reset(io.Writer) }); ok {
+		r.Reset(&s.buf)
+	} else {
+		zw, err := s.c.NewWriter(&s.buf)
+		if err != nil {
+			return err
+		}
+		s.zw = zw
+	}
+	s.zw.Write(line)
+	s.zw.Write([]byte{'\n'})
+	if err := s.zw.Close(); err != nil {
+		return err
+	}
+	/* a single write, so a crash tears the stream at most */
+	_, err := s.file.Write(s.buf.Bytes())
+	return err
+}
+
+func (s *streamLines) Close() error {
+	return s.file.Close()
+}
+
+// gzipFrames appends lines compressed by gzip in frames: every line is flushed as a frame of its own, prefixed by
+// the length and CRC-32 of its compressed bytes, so a frame torn by a crash is told and cut off when reopened.
+// Frames of a gzip member follow each other until a frame of length 0 starts the next member, as every reopening
+// does, so lines share the compression of those before within a member.
+type gzipFrames struct {
+	file *os.File
+	buf  bytes.Buffer
+	zw   *gzip.Writer
+}
+
+// openFrames opens the file for appending frames, cutting off a frame torn by a crash.
+func openFrames(path string) (*gzipFrames, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	end, err := framesEnd(f)
+	if err == nil {
+		err = f.Truncate(end)
+	}
+	if err == nil {
+		_, err = f.Seek(end, io.SeekStart)
+	}
+	if err == nil {
+		/* the head of a new file, or the start of a new member */
+		if end == 0 {
+			_, err = f.Write([]byte(frame_magic))
+		} else {
+			_, err = f.Write(frameHead(nil))
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	g := &gzipFrames{file: f}
+	g.zw = gzip.NewWriter(&g.buf)
+	return g, nil
+}
+
+// framesEnd returns the offset after the last whole frame of f, 0 if f is empty.
+func framesEnd(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	head, err := r.Peek(len(frame_magic))
+	if err == io.EOF && len(head) == 0 {
+		return 0, nil
+	}
+	if string(head) != frame_magic {
+		return 0, errors.New("File of gzip frames is malformed: " + f.Name())
+	}
+	r.Discard(len(frame_magic))
+	end := int64(len(frame_magic))
+	for {
+		_, size, err := nextFrame(r)
+		if err != nil {
+			return end, nil
+		}
+		end += size
+	}
+}
+
+// frameHead returns the head of a frame of payload.
+func frameHead(payload []byte) []byte {
+	head := make([]byte, binary.MaxVarintLen64+4)
+	n := binary.PutUvarint(head, uint64(len(payload)))
+	binary.LittleEndian.PutUint32(head[n:], crc32.ChecksumIEEE(payload))
+	return head[:n+4]
+}
+
+// nextFrame reads a frame, returning its payload and size in the file. Fails at the end of r or a torn frame.
+func nextFrame(r *bufio.Reader) ([]byte, int64, error) {
+	length, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, 0, io.EOF
+	}
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return nil, 0, io.EOF
+	}
+	/* a torn length may be large, what's read is bounded by the file */
+	payload, err := readAtMost(r, length)
+	if err != nil || crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(sum[:]) {
+		return nil, 0, io.EOF
+	}
+	return payload, int64(len(frameHead(payload)) + len(payload)), nil
+}
+
+// readAtMost reads n bytes of r, failing if r ends before.
+func readAtMost(r io.Reader, n uint64) ([]byte, error) {
+	var b bytes.Buffer
+	read, err := io.Copy(&b, io.LimitReader(r, int64(n&(1<<62-1))))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(read) != n {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return b.Bytes(), nil
+}
+
+func (g *gzipFrames) writeLine(line []byte) error {
+	g.buf.Reset()
+	g.zw.Write(line)
+	g.zw.Write([]byte{'\n'})
+	if err := g.zw.Flush(); err != nil {
+		return err
+	}
+	return g.frame()
+}
+
+// frame writes what was compressed as a frame, by a single write so a crash tears it at most.
+func (g *gzipFrames) frame() error {
+	payload := g.buf.Bytes()
+	_, err := g.file.Write(append(frameHead(payload), payload...))
+	return err
+}
+
+// Close ends the gzip member, the file is read by gzip as is once its frames are stripped.
+func (g *gzipFrames) Close() error {
+	g.buf.Reset()
+	err := g.zw.Close()
+	if err == nil {
+		err = g.frame()
+	}
+	if cerr := g.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// memberReader reads the payloads of the frames of a gzip member.
+type memberReader struct {
+	r       *bufio.Reader
+	payload []byte
+	/* a frame of length 0 started the next member */
+	next bool
+	/* r ended or a frame is torn */
+	done bool
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	for len(m.payload) == 0 {
+		if m.next || m.done {
+			return 0, io.EOF
+		}
+		payload, _, err := nextFrame(m.r)
+		switch {
+		case err != nil:
+			m.done = true
+		case len(payload) == 0:
+			m.next = true
+		}
+		m.payload = payload
+	}
+	n := copy(p, m.payload)
+	m.payload = m.payload[n:]
+	return n, nil
+}
+
+// readFrames calls fn with every whole line of the frames of r.
+func readFrames(r *bufio.Reader, fn func(line []byte) error) error {
+	for {
+		m := &memberReader{r: r}
+		zr, err := gzip.NewReader(m)
+		if err == nil {
+			zr.Multistream(false)
+			/* members of a crashed writer end unexpectedly, after their last line flushed */
+			err = scanLines(bufio.NewReader(zr), fn)
+			if err != nil {
+				return err
+			}
+		}
+		/* what's left of the member, e.g. of one without lines */
+		for !m.next && !m.done {
+			m.payload = nil
+			m.Read(nil)
+		}
+		if m.done {
+			return nil
+		}
+	}
+}
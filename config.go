@@ -0,0 +1,82 @@
+package fsmonitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const (
+	config_interval    = time.Second
+	config_debounce    = 2 * time.Second
+	config_backoff_max = time.Minute
+)
+
+// OnConfigChange calls reload whenever any of the files at paths changed, e.g. to apply edited configuration files.
+// Files are checked by path every second, so replacing one by rename, as editors and deployment tools do, or
+// retargeting a symlink counts as a change, and so does removing one. Changes are debounced by 2 seconds, with several
+// files changed at once reloading once. A failed reload is retried with exponential backoff up to a minute, until it
+// succeeds or the next change. opt tune the Monitor watching them, e.g. WithDebounce or WithLogger.
+// Returns a func stopping the watch, which waits for a reload in progress.
+func OnConfigChange(paths []string, reload func() error, opt ...Option) (func(), error) {
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("Config files to watch must be given")
+	}
+	if reload == nil {
+		return nil, fmt.Errorf("Reload func must be given")
+	}
+	m, err := NewMonitor(append([]Option{WithPaths(paths...), WithDebounce(config_debounce)}, opt...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go m.StartContext(ctx, config_interval, FileCreate, FileUpdate, FileRemove, FileRename, SymlinkRetargeted)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var retry <-chan time.Time
+		backoff := config_interval
+		for {
+			select {
+			case n, ok := <-m.Notices():
+				if !ok {
+					return
+				}
+				m.logger.info("Config changed", "path", n.Name(), "event", n.Type())
+				drain(m.Notices())
+				backoff = config_interval
+			case <-retry:
+			}
+			if err := reload(); err != nil {
+				m.logger.error("Config reload failed", "retry", backoff, "error", err)
+				retry = time.After(backoff)
+				if backoff *= 2; backoff > config_backoff_max {
+					backoff = config_backoff_max
+				}
+				continue
+			}
+			retry = nil
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// drain discards notices already delivered, so changes noticed together are handled once.
+func drain(notices <-chan Notice) {
+	for {
+		select {
+		case _, ok := <-notices:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	/* defaults of ConnPoolConfig */
+	pool_max_concurrent = 4
+	pool_keepalive      = 30 * time.Second
+	pool_backoff        = time.Second
+	pool_max_backoff    = time.Minute
+)
+
+// PooledConn is a connection shared by a ConnPool, e.g. an SFTP session.
+type PooledConn interface {
+	// Check fails unless the connection is still usable, e.g. by a request the server answers cheaply, called
+	// every keepalive while idle
+	Check() error
+	Close() error
+}
+
+// ConnPoolConfig configures a ConnPool, zero values take defaults.
+type ConnPoolConfig struct {
+	// Calls using the connection to a server at once, 4 by default, further calls wait
+	MaxConcurrent int
+	// Idle connections are checked that often, keeping them alive through firewalls, 30 seconds by default
+	Keepalive time.Duration
+	// Pause dialing a server after dialing failed, 1 second by default, doubled for every further failure in a row
+	// up to MaxBackoff, 1 minute by default
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// ConnPool shares connections to servers among remote Watchers, e.g. sftpwatcher and HTTPWatcher watching many
+// trees of the same server: a connection per server is dialed once, used by a bounded number of calls at once,
+// checked while idle and dialed again once lost. Close it once the Monitors using it stopped.
+type ConnPool struct {
+	config ConnPoolConfig
+	quit   chan struct{}
+	done   chan struct{}
+
+	mu     sync.Mutex
+	conns  map[string]*poolEntry
+	client *http.Client
+	closed bool
+}
+
+// poolEntry is the connection to a server.
+type poolEntry struct {
+	/* calls using the connection, bounded by capacity */
+	slots chan struct{}
+
+	mu   sync.Mutex
+	conn PooledConn
+	busy int
+	/* the pool closed, the connection closes once released */
+	closed bool
+	/* dialing failed that many times in a row, last by err, not tried again before retry */
+	failures int
+	err      error
+	retry    time.Time
+}
+
+// NewConnPool returns a ConnPool checking idle connections until closed.
+func NewConnPool(c ConnPoolConfig) *ConnPool {
+	if c.MaxConcurrent <= 0 {
+		c.MaxConcurrent = pool_max_concurrent
+	}
+	if c.Keepalive <= 0 {
+		c.Keepalive = pool_keepalive
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = pool_backoff
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = pool_max_backoff
+	}
+	p := &ConnPool{config: c, quit: make(chan struct{}), done: make(chan struct{}), conns: make(map[string]*poolEntry)}
+	go p.keepalive()
+	return p
+}
+
+// Get returns the connection to the server named by key, e.g. "sftp://user@host:22", dialing it by dial unless
+// connected, and waiting while MaxConcurrent calls use it. The connection must be released once the call is done,
+// telling whether it was lost, so the next call dials again.
+func (p *ConnPool) Get(key string, dial func() (PooledConn, error)) (conn PooledConn, release func(lost bool), err error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, fmt.Errorf("Connection pool is closed")
+	}
+	e, ok := p.conns[key]
+	if !ok {
+		e = &poolEntry{slots: make(chan struct{}, p.config.MaxConcurrent)}
+		p.conns[key] = e
+	}
+	p.mu.Unlock()
+
+	select {
+	case e.slots <- struct{}{}:
+	case <-p.quit:
+		return nil, nil, fmt.Errorf("Connection pool is closed")
+	}
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		<-e.slots
+		return nil, nil, fmt.Errorf("Connection pool is closed")
+	}
+	if e.conn == nil {
+		if now := time.Now(); now.Before(e.retry) {
+			e.mu.Unlock()
+			<-e.slots
+			return nil, nil, fmt.Errorf("Connecting %s is paused for %v after failures: %v", key, e.retry.Sub(now).Round(time.Second), e.err)
+		}
+		if e.conn, err = dial(); err != nil {
+			e.failures++
+			e.err = err
+			backoff := p.config.Backoff << uint(e.failures-1)
+			if backoff > p.config.MaxBackoff || backoff <= 0 {
+				backoff = p.config.MaxBackoff
+			}
+			e.retry = time.Now().Add(backoff)
+			e.mu.Unlock()
+			<-e.slots
+			return nil, nil, err
+		}
+		e.failures, e.err = 0, nil
+	}
+	conn = e.conn
+	e.busy++
+	e.mu.Unlock()
+
+	var once sync.Once
+	return conn, func(lost bool) {
+		once.Do(func() {
+			e.mu.Lock()
+			e.busy--
+			if e.conn == conn && (lost || e.closed && e.busy == 0) {
+				e.conn.Close()
+				e.conn = nil
+			}
+			e.mu.Unlock()
+			<-e.slots
+		})
+	}, nil
+}
+
+// HTTPClient returns the http.Client of the pool, e.g. for HTTPWatcher or the AWS SDK of s3watcher: connections to
+// a server are kept alive and at most MaxConcurrent at once, requests time out after 30 seconds.
+func (p *ConnPool) HTTPClient() *http.Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client == nil {
+		p.client = &http.Client{
+			Timeout: http_timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: http_timeout, KeepAlive: p.config.Keepalive}).DialContext,
+				MaxConnsPerHost:     p.config.MaxConcurrent,
+				MaxIdleConnsPerHost: p.config.MaxConcurrent,
+				IdleConnTimeout:     90 * time.Second,
+				TLSHandshakeTimeout: 10 * time.Second,
+			},
+		}
+	}
+	return p.client
+}
+
+// keepalive checks idle connections every Keepalive until closed, dropping those failing.
+func (p *ConnPool) keepalive() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.config.Keepalive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.quit:
+			return
+		}
+		p.mu.Lock()
+		entries := make([]*poolEntry, 0, len(p.conns))
+		for _, e := range p.conns {
+			entries = append(entries, e)
+		}
+		p.mu.Unlock()
+		for _, e := range entries {
+			e.mu.Lock()
+			if e.conn != nil && e.busy == 0 {
+				if err := e.conn.Check(); err != nil {
+					e.conn.Close()
+					e.conn = nil
+				}
+			}
+			e.mu.Unlock()
+		}
+	}
+}
+
+// Close closes the connections, those in use once released, and fails further calls of Get.
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.quit)
+	conns := p.conns
+	client := p.client
+	p.mu.Unlock()
+	<-p.done
+
+	for _, e := range conns {
+		e.mu.Lock()
+		e.closed = true
+		if e.conn != nil && e.busy == 0 {
+			e.conn.Close()
+			e.conn = nil
+		}
+		e.mu.Unlock()
+	}
+	if client != nil {
+		client.CloseIdleConnections()
+	}
+	return nil
+}
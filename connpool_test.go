@@ -0,0 +1,87 @@
+package fsmonitor_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// countedConn counts the calls using it at once.
+type countedConn struct {
+	mu          sync.Mutex
+	using, most int
+	closed      int32
+}
+
+func (c *countedConn) use(d time.Duration) {
+	c.mu.Lock()
+	if c.using++; c.using > c.most {
+		c.most = c.using
+	}
+	c.mu.Unlock()
+	time.Sleep(d)
+	c.mu.Lock()
+	c.using--
+	c.mu.Unlock()
+}
+
+func (c *countedConn) Check() error { return nil }
+
+func (c *countedConn) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+// TestConnPool shares a connection among calls, expecting at most MaxConcurrent at once and dialing again once lost.
+func TestConnPool(t *testing.T) {
+	p := fsmonitor.NewConnPool(fsmonitor.ConnPoolConfig{MaxConcurrent: 2})
+	defer p.Close()
+	var dialed int32
+	conn := &countedConn{}
+	dial := func() (fsmonitor.PooledConn, error) {
+		atomic.AddInt32(&dialed, 1)
+		return conn, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, release, err := p.Get("test", dial)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer release(false)
+			c.(*countedConn).use(5 * time.Millisecond)
+		}()
+	}
+	wg.Wait()
+	if dialed != 1 {
+		t.Errorf("Dialed %d times, expected once", dialed)
+	}
+	if conn.most > 2 {
+		t.Errorf("%d calls used the connection at once", conn.most)
+	}
+
+	_, release, err := p.Get("test", dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(true)
+	if conn.closed != 1 {
+		t.Error("Connection lost wasn't closed")
+	}
+	_, release, err = p.Get("test", dial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release(false)
+	if dialed != 2 {
+		t.Errorf("Dialed %d times, expected again once lost", dialed)
+	}
+}
@@ -0,0 +1,293 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/* larger files are noticed at file level only */
+	content_size_limit = 1 << 20
+)
+
+// ContentParser decodes the content of a structured file into maps, slices and values
+// as encoding/json does, e.g. yaml.v3 Unmarshal into an interface{} can be plugged in for ".yaml".
+type ContentParser func(data []byte) (interface{}, error)
+
+// DefaultParsers are used by ContentWatcher without parsers given.
+var DefaultParsers = map[string]ContentParser{
+	".json": ParseJSON,
+	".env":  ParseEnv,
+}
+
+// ParseJSON decodes JSON content.
+func ParseJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+// ParseEnv decodes KEY=VALUE lines of dotenv files, skipping comments and blank lines.
+func ParseEnv(data []byte) (interface{}, error) {
+	env := make(map[string]interface{})
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimPrefix(text, "export "), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Line %d is not a KEY=VALUE assignment", line)
+		}
+		value := strings.TrimSpace(kv[1])
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(kv[0])] = value
+	}
+	return env, scanner.Err()
+}
+
+// KeyNotice is implemented by notices of key-level changes within structured files, see ContentWatcher.
+type KeyNotice interface {
+	Notice
+	// JSON pointer of the key, e.g. /db/host
+	Key() string
+	// Values before and after the change, nil when added or removed
+	Old() interface{}
+	New() interface{}
+}
+
+// keyNotice implements KeyNotice, uses file name as Notice.Name and itself as Notice.More.
+type keyNotice struct {
+	path      string
+	event     Event
+	key       string
+	old       interface{}
+	new       interface{}
+	timestamp time.Time
+}
+
+func (k *keyNotice) String() string {
+	return fmt.Sprintf("{%v#%v : %v}", k.path, k.key, k.event)
+}
+
+func (k *keyNotice) Name() string {
+	return k.path
+}
+
+func (k *keyNotice) Type() Event {
+	return k.event
+}
+
+func (k *keyNotice) More() interface{} {
+	return k
+}
+
+func (k *keyNotice) Info() NoticeInfo {
+	return NoticeInfo{}
+}
+
+func (k *keyNotice) Time() time.Time {
+	return k.timestamp
+}
+
+func (k *keyNotice) Key() string {
+	return k.key
+}
+
+func (k *keyNotice) Old() interface{} {
+	return k.old
+}
+
+func (k *keyNotice) New() interface{} {
+	return k.new
+}
+
+// ContentWatcher wraps a Watcher, following every notice of a created or updated file having a parser
+// for its extension (e.g. ".json") by KeyAdded, KeyChanged and KeyRemoved notices implementing KeyNotice.
+// Parsable files under address are read beforehand, so the first update of a file is diffed too.
+// Files failing to parse, e.g. half written, are noticed at file level only.
+func ContentWatcher(w Watcher, address string, parsers map[string]ContentParser) (Watcher, error) {
+	if parsers == nil {
+		parsers = DefaultParsers
+	}
+	c := &contentWatcher{parsers: parsers, contents: make(map[string]interface{})}
+
+	err := filepath.Walk(canonicalAddress(address), func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if v, ok := c.parse(file); ok {
+			c.contents[file] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoratedWatcher{
+		watcher:  w,
+		decorate: func(n Notice) Notice { return n },
+		derive:   c.derive,
+	}, nil
+}
+
+// contentWatcher keeps the last parsed content of files to diff against.
+type contentWatcher struct {
+	parsers map[string]ContentParser
+
+	mu       sync.Mutex
+	contents map[string]interface{}
+}
+
+// parse reads and parses file, if it has a parser.
+func (c *contentWatcher) parse(file string) (interface{}, bool) {
+	parser, ok := c.parsers[filepath.Ext(file)]
+	if !ok {
+		return nil, false
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(f, content_size_limit+1))
+	if err != nil || len(data) > content_size_limit {
+		return nil, false
+	}
+	v, err := parser(data)
+	if err != nil {
+		logSink{}.warn("Failed to parse content", "path", file, "error", err)
+		return nil, false
+	}
+	return v, true
+}
+
+// derive diffs the content of the noticed file against its last content.
+func (c *contentWatcher) derive(n Notice) []Notice {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove) == 0 {
+		return nil
+	}
+	if _, ok := c.parsers[filepath.Ext(n.Name())]; !ok {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if n.Type() == FileRemove {
+		delete(c.contents, n.Name())
+		return nil
+	}
+	v, ok := c.parse(n.Name())
+	if !ok {
+		return nil
+	}
+	old, known := c.contents[n.Name()]
+	c.contents[n.Name()] = v
+	if !known {
+		/* compare against empty document of the same kind */
+		switch v.(type) {
+		case map[string]interface{}:
+			old = map[string]interface{}{}
+		case []interface{}:
+			old = []interface{}{}
+		default:
+			return []Notice{&keyNotice{path: n.Name(), event: KeyAdded, new: v, timestamp: time.Now()}}
+		}
+	}
+
+	var notices []Notice
+	diffContent("", old, v, func(event Event, key string, old, new interface{}) {
+		notices = append(notices, &keyNotice{
+			path:      n.Name(),
+			event:     event,
+			key:       key,
+			old:       old,
+			new:       new,
+			timestamp: time.Now(),
+		})
+	})
+	return notices
+}
+
+// pointerEscaper escapes reference tokens of JSON pointers.
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// diffContent emits changes between old and new, descending into maps and slices present in both.
+func diffContent(ptr string, old, new interface{}, emit func(event Event, key string, old, new interface{})) {
+	switch o := old.(type) {
+	case map[string]interface{}:
+		if n, ok := new.(map[string]interface{}); ok {
+			keys := make([]string, 0, len(o)+len(n))
+			for k := range o {
+				keys = append(keys, k)
+			}
+			for k := range n {
+				if _, ok := o[k]; !ok {
+					keys = append(keys, k)
+				}
+			}
+			/* in key order, so the same change always emits the same */
+			sort.Strings(keys)
+			for _, k := range keys {
+				diffMember(ptr+"/"+pointerEscaper.Replace(k), o, n, k, emit)
+			}
+			return
+		}
+	case []interface{}:
+		if n, ok := new.([]interface{}); ok {
+			length := len(o)
+			if len(n) > length {
+				length = len(n)
+			}
+			for i := 0; i < length; i++ {
+				key := ptr + "/" + strconv.Itoa(i)
+				switch {
+				case i >= len(n):
+					emit(KeyRemoved, key, o[i], nil)
+				case i >= len(o):
+					emit(KeyAdded, key, nil, n[i])
+				default:
+					diffContent(key, o[i], n[i], emit)
+				}
+			}
+			return
+		}
+	}
+	if !reflect.DeepEqual(old, new) {
+		emit(KeyChanged, ptr, old, new)
+	}
+}
+
+// diffMember emits the change of key k between maps o and n.
+func diffMember(ptr string, o, n map[string]interface{}, k string, emit func(event Event, key string, old, new interface{})) {
+	ov, inOld := o[k]
+	nv, inNew := n[k]
+	switch {
+	case !inNew:
+		emit(KeyRemoved, ptr, ov, nil)
+	case !inOld:
+		emit(KeyAdded, ptr, nil, nv)
+	default:
+		diffContent(ptr, ov, nv, emit)
+	}
+}
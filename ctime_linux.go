@@ -0,0 +1,20 @@
+// +build linux
+
+package fsmonitor
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// changeTime returns the inode change time of info if the platform reports it.
+func changeTime(info os.FileInfo) (time.Time, bool) {
+	switch st := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return time.Unix(int64(st.Ctim.Sec), int64(st.Ctim.Nsec)), true
+	case *stateRecord:
+		return st.changeTime()
+	}
+	return time.Time{}, false
+}
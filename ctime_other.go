@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!freebsd,!netbsd
+
+package fsmonitor
+
+import (
+	"os"
+	"time"
+)
+
+// changeTime returns the inode change time of info if the platform reports it.
+func changeTime(info os.FileInfo) (time.Time, bool) {
+	return time.Time{}, false
+}
@@ -0,0 +1,201 @@
+package fsmonitor
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/* stops replaying a journal once a subscription is cancelled */
+var errCancelled = errors.New("Subscription cancelled")
+
+// CursorJournal is implemented by Journals replaying the times notices were appended at, so subscribers resume
+// where they left off, see Monitor.SubscribeFrom. FileJournal implements it.
+type CursorJournal interface {
+	Journal
+	// ReplayFrom calls fn with the notices appended at or after since and the time they were appended at, in order,
+	// until fn returns an error
+	ReplayFrom(since time.Time, fn func(t time.Time, n Notice) error) error
+}
+
+// Cursor is the position of a subscriber in the journal of a Monitor, the time the last notice received was
+// appended at, see Monitor.SubscribeFrom. The zero Cursor is before every notice. Persisted by its text form.
+type Cursor struct {
+	at time.Time
+}
+
+// ParseCursor returns the Cursor of the text form of String, the zero Cursor of an empty string.
+func ParseCursor(s string) (Cursor, error) {
+	if s == "" {
+		return Cursor{}, nil
+	}
+	nanos, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("Cursor %q is malformed", s)
+	}
+	return Cursor{at: time.Unix(0, nanos)}, nil
+}
+
+// Time returns the time the last notice received was appended at, zero for the zero Cursor.
+func (c Cursor) Time() time.Time {
+	return c.at
+}
+
+func (c Cursor) String() string {
+	if c.at.IsZero() {
+		return ""
+	}
+	return strconv.FormatInt(c.at.UnixNano(), 10)
+}
+
+func (c Cursor) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c *Cursor) UnmarshalText(text []byte) error {
+	cursor, err := ParseCursor(string(text))
+	if err != nil {
+		return err
+	}
+	*c = cursor
+	return nil
+}
+
+// journaledNotice tells the time the wrapped Notice was appended to the journal at, see WithJournal.
+type journaledNotice struct {
+	Notice
+	at time.Time
+}
+
+func (j *journaledNotice) Unwrap() Notice {
+	return j.Notice
+}
+
+func (j *journaledNotice) appendedAt() time.Time {
+	return j.at
+}
+
+func (j *journaledNotice) MarshalJSON() ([]byte, error) {
+	return MarshalNotice(j)
+}
+
+// appended is implemented by notices appended to the journal.
+type appended interface {
+	appendedAt() time.Time
+}
+
+// Subscription is a subscriber resuming by cursor, see Monitor.SubscribeFrom.
+type Subscription struct {
+	notices chan Notice
+	quit    chan struct{}
+	cancel  sync.Once
+
+	mu     sync.Mutex
+	cursor Cursor
+}
+
+// Notices returns the notices of the subscription, closed once cancelled or after the last one once the Monitor
+// stopped.
+func (s *Subscription) Notices() <-chan Notice {
+	return s.notices
+}
+
+// Cursor returns the position after the notices received from Notices(), to be persisted once they were processed.
+// Delivery is at least once: a notice may be delivered again after resuming if it was received as Cursor was called.
+func (s *Subscription) Cursor() Cursor {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cursor
+}
+
+// Cancel ends the subscription, Notices() is closed.
+func (s *Subscription) Cancel() {
+	s.cancel.Do(func() { close(s.quit) })
+}
+
+// SubscribeFrom adds a consumer receiving the notices passing filter appended to the journal after cursor, then
+// those delivered by Start, as Subscribe does. Notices are replayed from the journal, decoded by UnmarshalNotice,
+// and so are those dropped while the subscriber fell behind, so none are lost once journaled. Resuming by the Cursor
+// of a previous subscription, e.g. persisted before a restart, continues after the notices it received. The Monitor
+// must be given a Journal implementing CursorJournal by WithJournal.
+func (m *Monitor) SubscribeFrom(cursor Cursor, filter Filter) (*Subscription, error) {
+	j, ok := m.journal.(CursorJournal)
+	if !ok {
+		return nil, fmt.Errorf("Monitor has no journal replaying cursors")
+	}
+	/* notices delivered while replaying are buffered meanwhile */
+	live, cancel, err := m.subscribe(filter, OverflowDropNewest)
+	if err != nil {
+		return nil, err
+	}
+	s := &Subscription{notices: make(chan Notice), quit: make(chan struct{}), cursor: cursor}
+
+	m.goroutines.run("cursor", func() {
+		defer close(s.notices)
+		defer cancel()
+
+		send := func(at time.Time, n Notice) error {
+			select {
+			case s.notices <- n:
+			case <-s.quit:
+				return errCancelled
+			}
+			s.mu.Lock()
+			s.cursor = Cursor{at: at}
+			s.mu.Unlock()
+			return nil
+		}
+		/* replays what was journaled after the cursor, the notices buffered live are skipped once replayed */
+		replay := func() error {
+			err := j.ReplayFrom(s.Cursor().at.Add(1), func(t time.Time, n Notice) error {
+				if !live.matches(n) {
+					return nil
+				}
+				return send(t, n)
+			})
+			if err != nil && err != errCancelled {
+				m.logger.error("Failed to replay journal", "cursor", s.Cursor(), "error", err)
+			}
+			return err
+		}
+
+		drops := live.dropped()
+		if replay() == errCancelled {
+			return
+		}
+		for {
+			select {
+			case n, ok := <-live.notices:
+				if !ok {
+					/* replays what was dropped last */
+					if live.dropped() != drops {
+						replay()
+					}
+					return
+				}
+				var a appended
+				if NoticeAs(n, &a) {
+					if !a.appendedAt().After(s.Cursor().at) {
+						continue
+					}
+					if send(a.appendedAt(), n) != nil {
+						return
+					}
+				} else if send(s.Cursor().at, n) != nil {
+					return
+				}
+				if d := live.dropped(); d != drops {
+					drops = d
+					if replay() == errCancelled {
+						return
+					}
+				}
+			case <-s.quit:
+				return
+			}
+		}
+	})
+	return s, nil
+}
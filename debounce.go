@@ -0,0 +1,133 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// WithDebounce holds notices of created, updated and removed files back until their path saw none for window,
+// coalescing them into one, e.g. for editors and build tools writing a file over consecutive scans:
+// Create+Update is delivered as Create, Create+Remove as nothing, Remove+Create as Update, otherwise the latest.
+// Notices of other event types are delivered right away, after those held back for their path.
+func WithDebounce(window time.Duration) Option {
+	return func(o *options) error {
+		if window <= 0 {
+			return fmt.Errorf("Debounce window must be positive")
+		}
+		o.debounce = window
+		return nil
+	}
+}
+
+// debouncer coalesces notices per path, see WithDebounce.
+type debouncer struct {
+	window  time.Duration
+	pending map[string]*debounced
+}
+
+// debounced is the coalesced event of the notices of a path held back, and the latest of them.
+type debounced struct {
+	n     Notice
+	event Event
+	last  time.Time
+}
+
+// coalescedNotice reports the coalesced event of a debounced path by its latest notice.
+type coalescedNotice struct {
+	Notice
+	event Event
+}
+
+func (c *coalescedNotice) Unwrap() Notice {
+	return c.Notice
+}
+
+func (c *coalescedNotice) Type() Event {
+	return c.event
+}
+
+func (c *coalescedNotice) String() string {
+	return fmt.Sprintf("{%v : %v}", c.Name(), c.event)
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{window: window, pending: make(map[string]*debounced)}
+}
+
+// add holds n back, returning notices to deliver right away.
+func (d *debouncer) add(n Notice, now time.Time) []Notice {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove) == 0 {
+		return append(d.take(n.Name()), n)
+	}
+	p, ok := d.pending[n.Name()]
+	if !ok {
+		d.pending[n.Name()] = &debounced{n: n, event: n.Type(), last: now}
+		return nil
+	}
+	if p.event = coalesce(p.event, n.Type()); p.event == 0 {
+		delete(d.pending, n.Name())
+		return nil
+	}
+	p.n, p.last = n, now
+	return nil
+}
+
+// coalesce returns the event of a path noticed as first, then next, zero if nothing happened to it after all.
+func coalesce(first, next Event) Event {
+	switch {
+	case first == FileCreate && next == FileRemove:
+		return 0
+	case first == FileCreate:
+		return FileCreate
+	case first == FileRemove && next != FileRemove:
+		/* replaced */
+		return FileUpdate
+	}
+	return next
+}
+
+// take returns the notice held back for path, if any.
+func (d *debouncer) take(path string) []Notice {
+	p, ok := d.pending[path]
+	if !ok {
+		return nil
+	}
+	delete(d.pending, path)
+	return []Notice{p.notice()}
+}
+
+// due returns notices of paths quiet for window, in order of their latest notices.
+func (d *debouncer) due(now time.Time) []Notice {
+	return d.collect(func(p *debounced) bool { return now.Sub(p.last) >= d.window })
+}
+
+// flush returns all notices held back, in order of their latest notices.
+func (d *debouncer) flush() []Notice {
+	return d.collect(func(*debounced) bool { return true })
+}
+
+func (d *debouncer) collect(ready func(*debounced) bool) []Notice {
+	var collected []*debounced
+	for path, p := range d.pending {
+		if ready(p) {
+			collected = append(collected, p)
+			delete(d.pending, path)
+		}
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].last.Before(collected[j].last) })
+
+	notices := make([]Notice, 0, len(collected))
+	for _, p := range collected {
+		notices = append(notices, p.notice())
+	}
+	return notices
+}
+
+// notice returns the latest notice, reporting the coalesced event.
+func (p *debounced) notice() Notice {
+	if p.event == p.n.Type() {
+		return p.n
+	}
+	return &coalescedNotice{Notice: p.n, event: p.event}
+}
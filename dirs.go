@@ -0,0 +1,40 @@
+package fsmonitor
+
+import (
+	"os"
+	"time"
+)
+
+// WithDirEvents makes the builtin "path" Watcher notice directories too, sending DirCreate, DirRemove and DirRename
+// for directories other than the watched path itself, e.g. to mirror a tree including its empty directories.
+// Patterns apply to files only, excludes apply to directories as well. Files within are noticed as before.
+func WithDirEvents() Option {
+	return func(o *options) error {
+		o.dirs = true
+		return nil
+	}
+}
+
+// walkedDir emits DirCreate for a directory walked first time unless baselining, FileAttrib if its mode or owner changed.
+func (s *pathScanner) walkedDir(dir string, info os.FileInfo, joined bool, emit func(*fileSystemNotice)) {
+	if joined || s.lastCheck == nil && s.initial != EmitExisting {
+		return
+	}
+	if oldinfo, ok := s.tracked(dir); ok {
+		if ainfo := attribChanged(oldinfo, info); ainfo != nil {
+			emit(&fileSystemNotice{
+				path:      dir,
+				fileinfo:  ainfo,
+				timestamp: time.Now(),
+				event:     FileAttrib,
+			})
+		}
+		return
+	}
+	emit(&fileSystemNotice{
+		path:      dir,
+		fileinfo:  info,
+		timestamp: time.Now(),
+		event:     DirCreate,
+	})
+}
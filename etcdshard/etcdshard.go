@@ -0,0 +1,205 @@
+// Package etcdshard keeps the processes sharing the scan of a tree as members in etcd, for fsmonitor.WithShards:
+//
+//	members, err := etcdshard.Join(etcdshard.Config{Client: client, Prefix: "/fsmonitor/filer1/"})
+//	...
+//	defer members.Close()
+//	monitor, err := fsmonitor.NewMonitor(fsmonitor.WithPath("/mnt/filer1"), fsmonitor.WithShards(members.Coordinator()))
+//
+// Every process puts a key of its own below Prefix, attached to a lease it keeps alive, so processes stopping,
+// crashing or partitioned away drop out once their lease expires, and their shards move to the others by
+// fsmonitor.Rendezvous. A process whose lease expired fails its scans until it registered again, so it doesn't
+// scan shards the others took over meanwhile.
+package etcdshard
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	default_prefix  = "/fsmonitor/members/"
+	default_ttl     = 10 * time.Second
+	request_timeout = 5 * time.Second
+)
+
+// Logger reports leases lost and registering again, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[etcd] ", log.LstdFlags)
+
+// Config of the membership, Client is required.
+type Config struct {
+	Client *clientv3.Client
+	// Keys of members are put below Prefix, "/fsmonitor/members/" by default, one per tree shared
+	Prefix string
+	// Name of this process among the members, its host name and process ID by default
+	Self string
+	// Members drop out once not heard of for TTL, 10 seconds by default, rounded to seconds
+	TTL    time.Duration
+	Logger *log.Logger
+}
+
+// Members is the membership of this process, see Join.
+type Members struct {
+	config Config
+	ctx    context.Context
+	cancel func()
+	/* closed once keepAlive returned */
+	done chan struct{}
+
+	mu sync.Mutex
+	/* lease of the key of this process, 0 while not registered for err */
+	lease clientv3.LeaseID
+	err   error
+}
+
+// Join registers this process as member, failing unless etcd is reachable, and keeps it registered until Close.
+func Join(c Config) (*Members, error) {
+	if c.Client == nil {
+		return nil, fmt.Errorf("etcd client must be given")
+	}
+	if c.Prefix == "" {
+		c.Prefix = default_prefix
+	}
+	if c.Self == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to name the member by host name: %v", err)
+		}
+		c.Self = fmt.Sprintf("%s:%d", host, os.Getpid())
+	}
+	if c.TTL < time.Second {
+		c.TTL = default_ttl
+	}
+	if c.Logger == nil {
+		c.Logger = Logger
+	}
+
+	m := &Members{config: c, done: make(chan struct{})}
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	if err := m.register(); err != nil {
+		m.cancel()
+		return nil, err
+	}
+	go m.keepAlive()
+	return m, nil
+}
+
+// Coordinator returns the Coordinator assigning shards among the members, see fsmonitor.Rendezvous.
+func (m *Members) Coordinator() fsmonitor.Coordinator {
+	return fsmonitor.Rendezvous(m.config.Self, m.Members)
+}
+
+// Members returns the other members, failing while this process isn't registered.
+func (m *Members) Members() ([]string, error) {
+	m.mu.Lock()
+	lease, err := m.lease, m.err
+	m.mu.Unlock()
+	if lease == 0 {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(m.ctx, request_timeout)
+	defer cancel()
+	resp, err := m.config.Client.Get(ctx, m.config.Prefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list members in etcd: %v", err)
+	}
+	members := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		if name := strings.TrimPrefix(string(kv.Key), m.config.Prefix); name != m.config.Self {
+			members = append(members, name)
+		}
+	}
+	return members, nil
+}
+
+// Close stops keeping this process registered and revokes its lease, so its shards move to the others at once.
+func (m *Members) Close() error {
+	m.cancel()
+	<-m.done
+	m.mu.Lock()
+	lease := m.lease
+	m.lease, m.err = 0, fmt.Errorf("Membership of %s in etcd is closed", m.config.Self)
+	m.mu.Unlock()
+	if lease == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), request_timeout)
+	defer cancel()
+	if _, err := m.config.Client.Revoke(ctx, lease); err != nil {
+		return fmt.Errorf("Failed to revoke lease of %s in etcd: %v", m.config.Self, err)
+	}
+	return nil
+}
+
+// register grants a lease and puts the key of this process attached to it.
+func (m *Members) register() error {
+	ctx, cancel := context.WithTimeout(m.ctx, request_timeout)
+	defer cancel()
+	lease, err := m.config.Client.Grant(ctx, int64(m.config.TTL/time.Second))
+	if err != nil {
+		return fmt.Errorf("Failed to grant lease in etcd: %v", err)
+	}
+	if _, err := m.config.Client.Put(ctx, m.config.Prefix+m.config.Self, m.config.Self, clientv3.WithLease(lease.ID)); err != nil {
+		return fmt.Errorf("Failed to register %s in etcd: %v", m.config.Self, err)
+	}
+	m.mu.Lock()
+	m.lease, m.err = lease.ID, nil
+	m.mu.Unlock()
+	return nil
+}
+
+// keepAlive keeps the lease alive until closed, registering again once it's lost, e.g. expired while etcd was
+// unreachable, pausing after failures up to the TTL.
+func (m *Members) keepAlive() {
+	defer close(m.done)
+	backoff := time.Second
+	for m.ctx.Err() == nil {
+		m.mu.Lock()
+		lease := m.lease
+		m.mu.Unlock()
+		if lease == 0 {
+			if err := m.register(); err != nil {
+				m.mu.Lock()
+				m.err = err
+				m.mu.Unlock()
+				m.config.Logger.Printf("%v, retrying in %v", err, backoff)
+				select {
+				case <-time.After(backoff):
+				case <-m.ctx.Done():
+					return
+				}
+				if backoff *= 2; backoff > m.config.TTL {
+					backoff = m.config.TTL
+				}
+				continue
+			}
+			m.config.Logger.Printf("Registered %s again", m.config.Self)
+			backoff = time.Second
+			continue
+		}
+
+		/* responses close once the lease can't be kept alive anymore */
+		alive, err := m.config.Client.KeepAlive(m.ctx, lease)
+		if err == nil {
+			for range alive {
+			}
+		}
+		if m.ctx.Err() != nil {
+			return
+		}
+		m.mu.Lock()
+		m.lease, m.err = 0, fmt.Errorf("Lease of %s in etcd is lost, registering again", m.config.Self)
+		m.mu.Unlock()
+		m.config.Logger.Printf("Lease of %s lost, registering again", m.config.Self)
+	}
+}
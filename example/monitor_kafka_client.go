@@ -2,6 +2,7 @@ package main
 
 import (
 
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -10,12 +11,15 @@ import (
 	"flag"
 	"io/ioutil"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"time"
 
 	"github.com/Fiery/fsmonitor"
+	"github.com/Fiery/fsmonitor/kafkasink"
+	"github.com/Fiery/fsmonitor/wasmfilter"
 	"github.com/Shopify/sarama"
 )
 
@@ -36,11 +40,14 @@ var (
 
 	sleep = flag.Int("sleep", 10, "Checking period in second")
 	topic = flag.String("topic","monitor", "Kafka topics to be stored")
+	filters = flag.String("filters", "", "Optional WASM filter modules applied in order, as a comma separated list")
+	metrics = flag.String("metrics", "", "Optional address serving Prometheus metrics on /metrics, e.g. :9100")
+	ids = flag.String("ids", "", "Optional notice IDs sent as idempotency key header, uuidv7, ulid or content")
 
 )
 
 var Logger = log.New(os.Stdout, "[Main] ", log.LstdFlags)
-var noticeSender sarama.SyncProducer
+var noticeSender *kafkasink.Sink
 var noticeLogger sarama.AsyncProducer
 
 func main() {
@@ -59,16 +66,33 @@ func main() {
 	}
 	tlsConfig:=createTLSConfiguration()
 
-	noticeSender = *newSyncProducer(tlsConfig, strings.Split(*brokers,","))
+	sender, err := kafkasink.New(kafkasink.Config{Brokers: strings.Split(*brokers,","), Topic: *topic, TLS: tlsConfig})
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	noticeSender = sender
 
 	noticeLogger = *newAsyncProducer(tlsConfig, strings.Split(*brokers,","))
 
-	monitor:=fsmonitor.New(*address, strings.Split(*pattern, ","), *watcher)
+	var opts []fsmonitor.Option
+	if *ids != "" {
+		g, err := fsmonitor.ParseIDGenerator(*ids)
+		if err != nil {
+			Logger.Fatalln(err)
+		}
+		opts = append(opts, fsmonitor.WithIDs(g))
+	}
+
+	monitor:=fsmonitor.New(*address, strings.Split(*pattern, ","), newWatcher(), opts...)
 
 	Logger.Printf("Starting monitoring file system changes on %s", *address)
 
 	go monitor.Start(time.Duration(*sleep)*time.Second, fsmonitor.FileCreate)
 
+	if *metrics != "" {
+		go serveMetrics(monitor)
+	}
+
 
 	/* Handles Ctrl+C signal */
 	go func() {
@@ -100,6 +124,39 @@ func main() {
 
 
 
+/* Decorates builtin watcher with site logic loaded from WASM filters, if any */
+func newWatcher() interface{} {
+	if *filters == "" {
+		return *watcher
+	}
+
+	w, err := fsmonitor.NewWatcher(*watcher, *address, strings.Split(*pattern, ","))
+	if err != nil {
+		Logger.Fatalln("Failed to create watcher:", err)
+	}
+
+	var chain []*wasmfilter.Filter
+	for _, path := range strings.Split(*filters, ",") {
+		f, err := wasmfilter.Open(context.Background(), path)
+		if err != nil {
+			Logger.Fatalln("Failed to load filter:", err)
+		}
+		chain = append(chain, f)
+	}
+	return fsmonitor.Decorate(w, wasmfilter.Chain(chain...))
+}
+
+/* Exposes distributions of file sizes and detection latencies for scraping */
+func serveMetrics(monitor *fsmonitor.Monitor) {
+	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := monitor.Stats().WritePrometheus(w); err != nil {
+			Logger.Printf("Failed to write metrics: %v", err)
+		}
+	})
+	Logger.Fatalln(http.ListenAndServe(*metrics, nil))
+}
+
 func createTLSConfiguration() (t *tls.Config) {
 	if *certFile != "" && *keyFile != "" && *authFile != "" {
 		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
@@ -135,21 +192,9 @@ func forwarding(pl ...ProcessLogic) ProcessLogic {
 			p.Process(n)
 		}
 
-		/* If no message key set, all messages will be distributed randomly
-		 * over the different partitions.*/
-		partition, offset, err := noticeSender.SendMessage(&sarama.ProducerMessage{
-			Topic: *topic,
-			Key:   sarama.StringEncoder(fmt.Sprintf("%v", n.Type())),
-			Value: sarama.StringEncoder(n.Name()),
-		})
-
-		if err != nil {
+		/* keyed by path, with the notice ID in an "id" header for consumers to deduplicate by */
+		if err := noticeSender.Publish(n); err != nil {
 			Logger.Printf("Failed to store your data:, %s", err)
-		} else {
-			// The tuple (topic, partition, offset) can be used as a unique identifier
-
-			// for a message in a Kafka cluster.
-			Logger.Printf("Your data is stored with unique identifier kafka://%s/%d/%d", *topic, partition, offset)
 		}
 	})
 }
@@ -216,25 +261,6 @@ func (ple *processLogEntry) Encode() ([]byte, error) {
 	return ple.encoded, ple.err
 }
 
-func newSyncProducer(tlsConfig *tls.Config, brokerList []string) *sarama.SyncProducer {
-	config := sarama.NewConfig()
-	config.Producer.RequiredAcks = sarama.WaitForAll // Wait for all in-sync replicas to ack the message
-	config.Producer.Retry.Max = 10                   // Retry up to 10 times to produce the message
-
-	/* On the broker side, you may want to change the following settings to get
-	 * stronger consistency guarantees:
-	 * - For your broker, set `unclean.leader.election.enable` to false
-	 * - For the topic, you could increase `min.insync.replicas`.*/
-
-	producer, err := sarama.NewSyncProducer(brokerList, config)
-	if err != nil {
-		log.Fatalln("Failed to start Sarama producer:", err)
-	}
-
-	return &producer
-
-}
-
 func newAsyncProducer(tlsConfig *tls.Config, brokerList []string) *sarama.AsyncProducer {
 	config := sarama.NewConfig()
 
@@ -0,0 +1,174 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/* stderr of a command logged at most, further output is cut */
+	exec_stderr_max = 64 * 1024
+)
+
+// Exec configures a Sink running a program for every notice, only Command is required, see ExecSink.
+type Exec struct {
+	// Program and arguments, {path}, {event}, {time} and {id} in arguments are replaced for the notice,
+	// e.g. []string{"sh", "-c", `convert "$FSMONITOR_PATH" ...`} to run shell commands
+	Command []string
+	// Event types running the command, all without any
+	Events Event
+	// Names must match any of the patterns, regular expressions or globs (see CompilePattern), all names without patterns
+	Patterns []string
+	// Commands running at once, 1 by default, so they run in order of notices
+	Concurrency int
+	// Killed after running that long, 1 minute by default
+	Timeout time.Duration
+	// Notices queued for running, 1000 by default, Publish fails once full
+	Queue int
+	// Working directory of the command, that of the process by default
+	Dir    string
+	Logger *log.Logger
+	// Writes structured records instead of Logger, see WithFieldLogger
+	FieldLogger FieldLogger
+}
+
+// execSink implements Sink by running commands from a queue.
+type execSink struct {
+	Exec
+	filter noticeFilter
+	queue  chan Notice
+	done   sync.WaitGroup
+
+	/* guards publishing against closing */
+	mu     sync.Mutex
+	closed bool
+}
+
+// ExecSink returns a Sink running e.Command for every notice passing e.Events and e.Patterns, like incron, e.g. to
+// convert or forward files as they arrive. Besides the placeholders of arguments, the command is given the notice
+// as FSMONITOR_PATH, FSMONITOR_EVENT, FSMONITOR_TIME (RFC 3339) and FSMONITOR_ID (see WithIDs) environment variables.
+// Its stderr is logged line by line, as is its failure, stdout is discarded. Close waits for queued commands to run.
+func ExecSink(e Exec) (Sink, error) {
+	if len(e.Command) == 0 || e.Command[0] == "" {
+		return nil, fmt.Errorf("Command to run must be given")
+	}
+	filter, err := newNoticeFilter(e.Events, e.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	if e.Concurrency <= 0 {
+		e.Concurrency = 1
+	}
+	if e.Timeout <= 0 {
+		e.Timeout = time.Minute
+	}
+	if e.Queue <= 0 {
+		e.Queue = notice_buffer_length
+	}
+
+	s := &execSink{Exec: e, filter: filter, queue: make(chan Notice, e.Queue)}
+	s.done.Add(e.Concurrency)
+	for i := 0; i < e.Concurrency; i++ {
+		go func() {
+			defer s.done.Done()
+			for n := range s.queue {
+				s.run(n)
+			}
+		}()
+	}
+	return s, nil
+}
+
+// Publish queues n unless filtered, failing if the queue is full.
+func (s *execSink) Publish(n Notice) error {
+	if !s.filter.matches(n) {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("Exec sink is closed")
+	}
+	select {
+	case s.queue <- n:
+		return nil
+	default:
+		return fmt.Errorf("Exec queue is full, %d notices waiting", cap(s.queue))
+	}
+}
+
+// Close waits for queued commands to run.
+func (s *execSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	s.done.Wait()
+	return nil
+}
+
+// run runs the command for n until it exits or times out, logging its stderr.
+func (s *execSink) run(n Notice) {
+	var id string
+	var i IdentifiedNotice
+	if NoticeAs(n, &i) {
+		id = i.ID()
+	}
+	timestamp := n.Time().Format(time.RFC3339Nano)
+	replacer := strings.NewReplacer("{path}", n.Name(), "{event}", n.Type().String(), "{time}", timestamp, "{id}", id)
+	args := make([]string, len(s.Command)-1)
+	for i, arg := range s.Command[1:] {
+		args[i] = replacer.Replace(arg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, s.Command[0], args...)
+	cmd.Dir = s.Dir
+	cmd.Env = append(os.Environ(),
+		"FSMONITOR_PATH="+n.Name(),
+		"FSMONITOR_EVENT="+n.Type().String(),
+		"FSMONITOR_TIME="+timestamp,
+		"FSMONITOR_ID="+id,
+	)
+	/* a file rather than a pipe, so children left behind by a killed command don't hold up waiting */
+	stderr, err := ioutil.TempFile("", "fsmonitor-stderr")
+	if err != nil {
+		s.logger().error("Command failed", "command", s.Command, "path", n.Name(), "event", n.Type(), "error", err)
+		return
+	}
+	defer os.Remove(stderr.Name())
+	defer stderr.Close()
+	cmd.Stderr = stderr
+
+	err = cmd.Run()
+	l := s.logger().with("command", s.Command, "path", n.Name(), "event", n.Type())
+	if _, e := stderr.Seek(0, io.SeekStart); e == nil {
+		scanner := bufio.NewScanner(io.LimitReader(stderr, exec_stderr_max))
+		for scanner.Scan() {
+			l.warn("Command wrote to stderr", "stderr", scanner.Text())
+		}
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		l.error("Command killed", "timeout", s.Timeout)
+	case err != nil:
+		l.error("Command failed", "error", err)
+	}
+}
+
+// logger returns what the sink logs through.
+func (s *execSink) logger() logSink {
+	return newLogSink(s.Logger, s.FieldLogger)
+}
@@ -0,0 +1,183 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Explainer is implemented by Watchers able to tell how they treat a given path.
+type Explainer interface {
+	Explain(path string) *Explanation
+}
+
+// Explanation reports which rules of the Watcher apply to a path and whether its changes are noticed.
+type Explanation struct {
+	Path string
+	// Path is located under the watched address
+	Watched bool
+	// Include patterns matching the path, no patterns include every path
+	Patterns []string
+	// Path was found by last check
+	Tracked bool
+	// Changes of the path would be noticed
+	Noticed bool
+	// Human readable reasoning, in the order rules are applied
+	Reasons []string
+}
+
+func (e *Explanation) String() string {
+	verdict := "not noticed"
+	if e.Noticed {
+		verdict = "noticed"
+	}
+	return fmt.Sprintf("%s: %s\n  %s", e.Path, verdict, strings.Join(e.Reasons, "\n  "))
+}
+
+// Explain applies the rules of the scanner to path, without walking the directory.
+func (s *pathScanner) Explain(path string) (e *Explanation) {
+	e = &Explanation{Path: canonicalAddress(path)}
+
+	if !within(e.Path, s.address) {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("outside of watched address %s", s.address))
+		return
+	}
+	e.Watched = true
+	e.Reasons = append(e.Reasons, fmt.Sprintf("under watched address %s", s.address))
+
+	if resolved, err := s.resolve(e.Path); err != nil {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("not accessible: %v", err))
+	} else if info, err := os.Lstat(resolved); err == nil && info.IsDir() {
+		e.Reasons = append(e.Reasons, "directories are not noticed, only files inside")
+		return
+	}
+
+	for _, re := range s.pattern {
+		if re.FindStringIndex(e.Path) != nil {
+			e.Patterns = append(e.Patterns, re.String())
+		}
+	}
+	if !s.matches(e.Path) {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("matches none of the patterns %v", s.patterns()))
+		return
+	}
+	if len(s.pattern) == 0 {
+		e.Reasons = append(e.Reasons, "no patterns, every file is included")
+	} else {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("included by patterns %v", e.Patterns))
+	}
+	var excluded bool
+	var by string
+	s.serialized(func() {
+		excluded, by = s.excludedPath(e.Path)
+	})
+	if excluded {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("excluded by %s", by))
+		return
+	}
+	if s.beyond(e.Path) {
+		e.Reasons = append(e.Reasons, fmt.Sprintf("deeper than max depth of %d", s.maxDepth))
+		return
+	}
+	if resolved, err := s.resolve(e.Path); err == nil {
+		if info, err := os.Lstat(resolved); err == nil {
+			if reason := s.limited(info, time.Now().Add(-s.modWithin)); reason != "" {
+				e.Reasons = append(e.Reasons, reason)
+				return
+			}
+		}
+	}
+	e.Noticed = true
+
+	s.serialized(func() {
+		if shard := s.shard(e.Path); s.owned != nil && shard != "" && !s.owned[shard] {
+			e.Noticed = false
+			e.Reasons = append(e.Reasons, fmt.Sprintf("shard %s is scanned by another process", shard))
+			return
+		}
+		_, e.Tracked = s.tracked(e.Path)
+		switch {
+		case s.lastCheck == nil && s.initial == EmitExisting:
+			e.Reasons = append(e.Reasons, "no check yet, first scan sends existing files as created")
+		case s.lastCheck == nil:
+			e.Reasons = append(e.Reasons, "no check yet, first scan baselines existing files without notices")
+		case e.Tracked:
+			e.Reasons = append(e.Reasons, "tracked since last check, updates and removal are noticed")
+		default:
+			e.Reasons = append(e.Reasons, "not found by last check, creation is noticed")
+		}
+	})
+	return
+}
+
+// patterns returns the source of the compiled patterns.
+func (s *pathScanner) patterns() []string {
+	pats := make([]string, 0, len(s.pattern))
+	for _, re := range s.pattern {
+		pats = append(pats, re.String())
+	}
+	return pats
+}
+
+// Trace reports how the Monitor treats a notice once a Watcher sent it, see Monitor.Trace.
+type Trace struct {
+	Path  string
+	Event Event
+	// Notice as delivered, e.g. tagged by rules, nil if dropped
+	Notice Notice
+	// Names of the rules matching it, in order
+	Rules []string
+	// Human readable reasoning, in the order filters and rules are applied
+	Reasons []string
+}
+
+func (t *Trace) String() string {
+	verdict := "dropped"
+	if t.Notice != nil {
+		verdict = "delivered"
+	}
+	return fmt.Sprintf("%s %v: %s\n  %s", t.Path, t.Event, verdict, strings.Join(t.Reasons, "\n  "))
+}
+
+// Trace passes a notice of event e about path through the event types, filters, maintenance windows and rules
+// of the Monitor, as if a Watcher sent it, for debugging rules. Commands of rules aren't run, samples are
+// reported without dropping the notice. Event types are the ones given to Start, or by WithFilters.
+func (m *Monitor) Trace(path string, e Event) *Trace {
+	n := &fileSystemNotice{path: canonicalAddress(path), event: e, timestamp: time.Now()}
+	if info, err := os.Lstat(path); err == nil && e&(FileCreate|FileUpdate) != 0 {
+		n.fileinfo = info
+	}
+	t := &Trace{Path: n.path, Event: e}
+
+	m.mu.Lock()
+	f := m.filters
+	debounce := m.debounce
+	m.mu.Unlock()
+	pushdown := Pushdown{Events: f.Events, Prefix: f.Prefix, MinSize: f.MinSize, MaxSize: f.MaxSize}
+	if !pushdown.matches(n) {
+		t.Reasons = append(t.Reasons, fmt.Sprintf("filtered out by events %v, prefix %q and sizes %d to %d",
+			f.Events, f.Prefix, f.MinSize, f.MaxSize))
+		return t
+	}
+	t.Reasons = append(t.Reasons, "passes event types and filters")
+
+	mn := m.maintenance(n)
+	if mn == nil {
+		t.Reasons = append(t.Reasons, "suppressed by a maintenance window")
+		return t
+	}
+	if mn != Notice(n) {
+		t.Reasons = append(t.Reasons, fmt.Sprintf("tagged by maintenance window: %v", mn))
+	}
+	if t.Notice = m.applyRules(mn, t); t.Notice == nil {
+		return t
+	}
+	if len(t.Rules) == 0 {
+		t.Reasons = append(t.Reasons, "matches no rules")
+	}
+	if debounce > 0 {
+		t.Reasons = append(t.Reasons, fmt.Sprintf("held back until its path is quiet for %v", debounce))
+	}
+	return t
+}
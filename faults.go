@@ -0,0 +1,35 @@
+package fsmonitor
+
+import (
+	"fmt"
+)
+
+// FaultInjector injects faults into file system operations of the builtin "path" Watcher, see WithFaults.
+// Methods are called concurrently with WithScanConcurrency.
+type FaultInjector interface {
+	// Fault runs before op, one of "lstat", "readdir", "readlink" or "streams", on path.
+	// Returning an error fails the operation, sleeping delays it within Profile.Timeout.
+	Fault(op, path string) error
+	// Listing returns the names to list in dir, e.g. some of them as a truncated listing would.
+	Listing(dir string, names []string) []string
+}
+
+// WithFaults makes the builtin "path" Watcher pass every file system operation through f,
+// e.g. fsmonitortest.Faults to check how consumers handle scan errors and catch up in tests and staging.
+func WithFaults(f FaultInjector) Option {
+	return func(o *options) error {
+		if f == nil {
+			return fmt.Errorf("FaultInjector must not be nil")
+		}
+		o.faults = f
+		return nil
+	}
+}
+
+// fault runs the FaultInjector of the Profile before op on path, if any.
+func (p *Profile) fault(op, path string) error {
+	if p.faults == nil {
+		return nil
+	}
+	return p.faults.Fault(op, path)
+}
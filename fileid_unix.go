@@ -0,0 +1,25 @@
+//go:build !windows
+// +build !windows
+
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileID returns the device and inode of info if the platform reports them.
+func fileID(info os.FileInfo) (string, bool) {
+	switch st := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return fmt.Sprintf("%d:%d", uint64(st.Dev), uint64(st.Ino)), true
+	case snapshotID:
+		/* restored by WithSnapshots */
+		return string(st), st != ""
+	case *stateRecord:
+		/* kept between scans, see WithStateStore */
+		return st.id()
+	}
+	return "", false
+}
@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"os"
+)
+
+// fileID returns the file index of info if the platform reports it.
+// Infos of os.Lstat don't carry it on Windows, and a removed file can't be opened to get it.
+func fileID(info os.FileInfo) (string, bool) {
+	return "", false
+}
@@ -0,0 +1,63 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// fileSink implements Sink by appending lines to a file.
+type fileSink struct {
+	path string
+
+	mu  sync.Mutex
+	out lineWriter
+}
+
+// FileSink returns a Sink appending every notice as JSON line, encoded by MarshalNotice, to the file at path, e.g.
+// to archive notices. Every notice is written through to the OS, surviving crashes of the process, a line torn by a
+// crash is ended when reopened. Paths ending in ".gz", ".fsmz" or the extension of another registered Compression
+// are compressed as by FileJournal. Files of any are read by ReadFileSink.
+func FileSink(path string) (Sink, error) {
+	out, err := openLines(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path, out: out}, nil
+}
+
+func (s *fileSink) Publish(n Notice) error {
+	data, err := MarshalNotice(n)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		return fmt.Errorf("File sink %s is closed", s.path)
+	}
+	return s.out.writeLine(data)
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.out == nil {
+		return nil
+	}
+	err := s.out.Close()
+	s.out = nil
+	return err
+}
+
+// ReadFileSink calls fn with the notices of the file written by FileSink at path, decoded by UnmarshalNotice, in
+// order, until fn returns an error. Compressed files are told by their head, lines torn by a crash are skipped.
+func ReadFileSink(path string, fn func(Notice) error) error {
+	return readLines(path, func(line []byte) error {
+		n, err := UnmarshalNotice(line)
+		if err != nil {
+			/* torn lines were ended when reopened */
+			return nil
+		}
+		return fn(n)
+	})
+}
@@ -0,0 +1,120 @@
+package fsmonitor_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+func TestFileSinkRecovers(t *testing.T) {
+	for _, name := range []string{"notices.jsonl", "notices.jsonl.gz", "notices.jsonl.fsmz"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			publish := func(from, to int) {
+				s, err := fsmonitor.FileSink(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := from; i < to; i++ {
+					if err := s.Publish(fsmonitor.NewNotice(fmt.Sprintf("/a/%d", i), fsmonitor.FileCreate, nil)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := s.Close(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			publish(0, 10)
+			/* a crash tearing the last line */
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			before := info.Size()
+			publish(10, 11)
+			if info, err = os.Stat(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Truncate(path, before+(info.Size()-before)/2); err != nil {
+				t.Fatal(err)
+			}
+			publish(11, 20)
+
+			var names []string
+			err = fsmonitor.ReadFileSink(path, func(n fsmonitor.Notice) error {
+				names = append(names, n.Name())
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(names) != 19 {
+				t.Fatalf("Read %d notices, expected 19: %v", len(names), names)
+			}
+			for i, n := range names {
+				expected := i
+				if i >= 10 {
+					expected++
+				}
+				if n != fmt.Sprintf("/a/%d", expected) {
+					t.Fatalf("Read %s at %d, expected /a/%d", n, i, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestFileJournalCompressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.gz")
+	j := fsmonitor.FileJournal(path)
+	at := time.Unix(1700000000, 0)
+	for i := 0; i < 100; i++ {
+		if err := j.Append(at.Add(time.Duration(i)*time.Second), fsmonitor.NewNotice(fmt.Sprintf("/a/%d", i), fsmonitor.FileUpdate, nil)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	/* replayed while still open, and once closed */
+	for _, closed := range []bool{false, true} {
+		if closed {
+			if err := j.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var replayed int
+		err := j.Replay(at.Add(50*time.Second), func(n fsmonitor.Notice) error {
+			if n.Name() != fmt.Sprintf("/a/%d", 50+replayed) {
+				t.Fatalf("Replayed %s at %d", n.Name(), replayed)
+			}
+			replayed++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replayed != 50 {
+			t.Errorf("Replayed %d notices, expected 50", replayed)
+		}
+	}
+	/* members read by gzip as is, e.g. by zcat */
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines int
+	for scanner := bufio.NewScanner(zr); scanner.Scan(); lines++ {
+	}
+	if lines != 100 {
+		t.Errorf("Read %d lines by gzip, expected 100", lines)
+	}
+}
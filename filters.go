@@ -0,0 +1,62 @@
+package fsmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// FilterSet is the serializable filter configuration of a Monitor, see Monitor.Filters and WithFilters.
+type FilterSet struct {
+	// Patterns given to builtin Watchers
+	Patterns []string `json:"patterns,omitempty"`
+	// Exclude patterns given to builtin Watchers
+	Excludes []string `json:"excludes,omitempty"`
+	// Event types delivered by Start
+	Events Event `json:"events"`
+	// Names delivered must start with it, all names without, see Pushdown
+	Prefix string `json:"prefix,omitempty"`
+	// Sizes of created and updated files delivered, unbounded if 0, see Pushdown
+	MinSize int64 `json:"min_size,omitempty"`
+	MaxSize int64 `json:"max_size,omitempty"`
+	// Window notices are debounced by, in nanoseconds when encoded, none if 0, see WithDebounce
+	Debounce time.Duration `json:"debounce,omitempty"`
+}
+
+// ParseFilterSet decodes and validates an exported FilterSet.
+func ParseFilterSet(data []byte) (FilterSet, error) {
+	var f FilterSet
+	if err := json.Unmarshal(data, &f); err != nil {
+		return f, fmt.Errorf("Malformed filter set: %v", err)
+	}
+	return f, f.Validate()
+}
+
+// Validate checks every pattern compiles, sizes are a range and the debounce window isn't negative.
+func (f FilterSet) Validate() error {
+	if f.MinSize < 0 || f.MaxSize < 0 || f.MaxSize > 0 && f.MaxSize < f.MinSize {
+		return fmt.Errorf("Size range %d to %d is invalid", f.MinSize, f.MaxSize)
+	}
+	if f.Debounce < 0 {
+		return fmt.Errorf("Debounce window must not be negative")
+	}
+	for _, pat := range append(f.Patterns[:len(f.Patterns):len(f.Patterns)], f.Excludes...) {
+		if _, err := CompilePattern(pat); err != nil {
+			return fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+	}
+	return nil
+}
+
+// WithFilters imports a FilterSet: its patterns and excludes extend those given to New and WithExcludes,
+// its event types are delivered when Start is given none, its prefix and sizes select the notices delivered and
+// its debounce window applies unless WithDebounce gives one.
+func WithFilters(f FilterSet) Option {
+	return func(o *options) error {
+		if err := f.Validate(); err != nil {
+			return err
+		}
+		o.filters = f
+		return nil
+	}
+}
@@ -0,0 +1,109 @@
+package fsmonitortest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock implements fsmonitor.Clock by time passing only when advanced, e.g. given WithClock so tests decide when
+// the Monitor scans: WaitTimers(1, time.Second) until the next scan is due, then Advance by the interval.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []clockTimer
+	/* closed and replaced once timers change */
+	changed chan struct{}
+}
+
+// clockTimer is a channel of After, sent on once due.
+type clockTimer struct {
+	due time.Time
+	c   chan time.Time
+}
+
+// NewClock returns a Clock at now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now, changed: make(chan struct{})}
+}
+
+// Now implements fsmonitor.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After implements fsmonitor.Clock.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := clockTimer{due: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t.c
+	}
+	c.timers = append(c.timers, t)
+	c.signal()
+	return t.c
+}
+
+// Advance moves the time forward by d, sending on the channels of After due meanwhile, earliest first.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	var due []clockTimer
+	for _, t := range c.timers {
+		if t.due.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			due = append(due, t)
+		}
+	}
+	c.timers = pending
+	for len(due) > 0 {
+		first := 0
+		for i, t := range due {
+			if t.due.Before(due[first].due) {
+				first = i
+			}
+		}
+		due[first].c <- due[first].due
+		due = append(due[:first], due[first+1:]...)
+	}
+	c.signal()
+}
+
+// Timers returns the number of channels of After not due yet.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitTimers waits until at least n channels of After are not due yet, reporting whether before timeout passed
+// in real time, e.g. the Monitor waiting for its next scan.
+func (c *Clock) WaitTimers(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		c.mu.Lock()
+		waiting, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if waiting >= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+// signal wakes WaitTimers. Must be called holding mu.
+func (c *Clock) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
@@ -0,0 +1,72 @@
+package fsmonitortest
+
+import (
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// T is the part of testing.TB assertions report failures by.
+type T interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+// Receive returns the next notice, failing t unless one is received within timeout.
+func Receive(t T, notices <-chan fsmonitor.Notice, timeout time.Duration) fsmonitor.Notice {
+	t.Helper()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case n, ok := <-notices:
+		if !ok {
+			t.Fatalf("Notices closed, no notice received")
+		}
+		return n
+	case <-deadline.C:
+		t.Fatalf("No notice received within %v", timeout)
+	}
+	return nil
+}
+
+// Expect receives a notice for every one of want in order, of the same path and event, failing t on the first
+// other notice, or unless all are received within timeout. Returns the notices received.
+func Expect(t T, notices <-chan fsmonitor.Notice, timeout time.Duration, want ...*Notice) []fsmonitor.Notice {
+	t.Helper()
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	got := make([]fsmonitor.Notice, 0, len(want))
+	for i, w := range want {
+		select {
+		case n, ok := <-notices:
+			if !ok {
+				t.Fatalf("Notices closed after %d of %d expected notices, expecting %v", i, len(want), w)
+				return got
+			}
+			if n.Name() != w.Path || n.Type() != w.Event {
+				t.Fatalf("Notice %d is %v, expected %v", i+1, n, w)
+				return got
+			}
+			got = append(got, n)
+		case <-deadline.C:
+			t.Fatalf("Received %d of %d expected notices within %v, expecting %v", i, len(want), timeout, w)
+			return got
+		}
+	}
+	return got
+}
+
+// ExpectNone fails t if a notice is received within d.
+func ExpectNone(t T, notices <-chan fsmonitor.Notice, d time.Duration) {
+	t.Helper()
+	deadline := time.NewTimer(d)
+	defer deadline.Stop()
+	select {
+	case n, ok := <-notices:
+		if ok {
+			t.Fatalf("Unexpected notice %v", n)
+		}
+	case <-deadline.C:
+	}
+}
@@ -0,0 +1,74 @@
+package fsmonitortest
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrInjected is the cause of operations failed by Faults.
+var ErrInjected = errors.New("injected fault")
+
+// Faults implements fsmonitor.FaultInjector by random faults, e.g. WithFaults(&Faults{StatError: 0.01, Seed: 1})
+// to check consumers handle scan errors, retries and catching up. Zero values inject nothing.
+type Faults struct {
+	// Probability of every lstat, readlink and streams operation to fail
+	StatError float64
+	// Probability of every directory listing to fail
+	ReadDirError float64
+	// Probability of every directory listing to lose a random part of its names
+	Truncate float64
+	// Probability of every operation to be delayed by Delay
+	DelayRate float64
+	Delay     time.Duration
+	// Only faults of paths matching Match are injected, all paths without it
+	Match func(path string) bool
+	// Seed of the random source, same seed injects same faults for the same operations
+	Seed int64
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// chance reports whether an event of probability p happens.
+func (f *Faults) chance(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rand == nil {
+		f.rand = rand.New(rand.NewSource(f.Seed))
+	}
+	return f.rand.Float64() < p
+}
+
+// Fault implements fsmonitor.FaultInjector.
+func (f *Faults) Fault(op, path string) error {
+	if f.Match != nil && !f.Match(path) {
+		return nil
+	}
+	if f.chance(f.DelayRate) {
+		time.Sleep(f.Delay)
+	}
+	rate := f.StatError
+	if op == "readdir" {
+		rate = f.ReadDirError
+	}
+	if f.chance(rate) {
+		return &os.PathError{Op: op, Path: path, Err: ErrInjected}
+	}
+	return nil
+}
+
+// Listing implements fsmonitor.FaultInjector.
+func (f *Faults) Listing(dir string, names []string) []string {
+	if len(names) == 0 || f.Match != nil && !f.Match(dir) || !f.chance(f.Truncate) {
+		return names
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return names[:f.rand.Intn(len(names))]
+}
@@ -0,0 +1,180 @@
+package fsmonitortest
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Distribution shapes the notice stream produced by Generate.
+type Distribution struct {
+	// Prefix of generated paths
+	Root string
+	// Number of directories and their maximum nesting depth
+	Dirs  int
+	Depth int
+	// Relative weights of generated event types
+	Create, Update, Remove int
+	// Probability the next notice stays in the directory of the previous one
+	Locality float64
+	// Probability a tick starts a burst of BurstSize notices sent back to back
+	BurstProbability float64
+	BurstSize        int
+	// Seed of the random source, same seed generates same paths and events
+	Seed int64
+}
+
+// DefaultDistribution resembles a busy project tree: mostly updates, strong locality, occasional bursts.
+var DefaultDistribution = Distribution{
+	Root:             "/generated",
+	Dirs:             100,
+	Depth:            4,
+	Create:           3,
+	Update:           6,
+	Remove:           1,
+	Locality:         0.8,
+	BurstProbability: 0.05,
+	BurstSize:        200,
+	Seed:             1,
+}
+
+// Generate sends synthetic notices at rate per second until the returned stop function is called.
+// Updates and removes only refer to previously created paths, like a real file system would.
+func Generate(rate float64, d Distribution) (<-chan fsmonitor.Notice, func()) {
+	notices := make(chan fsmonitor.Notice)
+	quit := make(chan struct{})
+
+	g := newGenerator(d)
+	go func() {
+		defer close(notices)
+
+		tick := time.NewTicker(time.Duration(float64(time.Second) / rate))
+		defer tick.Stop()
+
+		for {
+			select {
+			case <-quit:
+				return
+			case <-tick.C:
+			}
+
+			count := 1
+			if g.rand.Float64() < d.BurstProbability {
+				count = d.BurstSize
+			}
+			for i := 0; i < count; i++ {
+				select {
+				case notices <- g.next():
+				case <-quit:
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return notices, func() {
+		once.Do(func() { close(quit) })
+	}
+}
+
+// generator keeps track of generated files so the stream stays consistent.
+type generator struct {
+	d     Distribution
+	rand  *rand.Rand
+	dirs  []string
+	files map[string][]string
+	seq   int
+	dir   string
+}
+
+func newGenerator(d Distribution) *generator {
+	if d.Dirs < 1 {
+		d.Dirs = 1
+	}
+	if d.Depth < 1 {
+		d.Depth = 1
+	}
+	if d.Create+d.Update+d.Remove == 0 {
+		d.Create = 1
+	}
+	g := &generator{
+		d:     d,
+		rand:  rand.New(rand.NewSource(d.Seed)),
+		files: make(map[string][]string),
+	}
+	for i := 0; i < d.Dirs; i++ {
+		dir := d.Root
+		for depth := g.rand.Intn(d.Depth) + 1; depth > 0; depth-- {
+			dir = path.Join(dir, fmt.Sprintf("d%d", g.rand.Intn(d.Dirs)))
+		}
+		g.dirs = append(g.dirs, dir)
+	}
+	g.dir = g.dirs[0]
+	return g
+}
+
+// next picks the directory by locality, then an event by weight.
+func (g *generator) next() fsmonitor.Notice {
+	if g.rand.Float64() >= g.d.Locality {
+		g.dir = g.dirs[g.rand.Intn(len(g.dirs))]
+	}
+	files := g.files[g.dir]
+
+	event := fsmonitor.FileCreate
+	if len(files) > 0 {
+		switch w := g.rand.Intn(g.d.Create + g.d.Update + g.d.Remove); {
+		case w < g.d.Create:
+		case w < g.d.Create+g.d.Update:
+			event = fsmonitor.FileUpdate
+		default:
+			event = fsmonitor.FileRemove
+		}
+	}
+
+	var file string
+	switch event {
+	case fsmonitor.FileCreate:
+		g.seq++
+		file = path.Join(g.dir, fmt.Sprintf("f%d", g.seq))
+		g.files[g.dir] = append(files, file)
+	case fsmonitor.FileUpdate:
+		file = files[g.rand.Intn(len(files))]
+	case fsmonitor.FileRemove:
+		i := g.rand.Intn(len(files))
+		file = files[i]
+		files[i] = files[len(files)-1]
+		g.files[g.dir] = files[:len(files)-1]
+	}
+
+	now := time.Now()
+	return &Notice{
+		Path:      file,
+		Event:     event,
+		Timestamp: now,
+		Info: &fileInfo{
+			name:    path.Base(file),
+			size:    g.rand.Int63n(1 << 20),
+			modTime: now,
+		},
+	}
+}
+
+// fileInfo implements os.FileInfo for generated notices.
+type fileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *fileInfo) Name() string       { return i.name }
+func (i *fileInfo) Size() int64        { return i.size }
+func (i *fileInfo) Mode() os.FileMode  { return 0644 }
+func (i *fileInfo) ModTime() time.Time { return i.modTime }
+func (i *fileInfo) IsDir() bool        { return false }
+func (i *fileInfo) Sys() interface{}   { return nil }
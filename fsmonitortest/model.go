@@ -0,0 +1,267 @@
+package fsmonitortest
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// ModelConfig controls the model check of CheckModel.
+type ModelConfig struct {
+	// Directory mutated by the check, must be empty or not exist
+	Root string
+	// Number of mutate-then-scan steps
+	Steps int
+	// Maximum mutations per step, the same path may be mutated repeatedly within a step
+	Mutations int
+	// Patterns given to the "path" Watcher, the model applies them independently
+	Pattern []string
+	// Options given to the "path" Watcher besides patterns, e.g. WithScanConcurrency
+	Options []fsmonitor.Option
+	Seed    int64
+}
+
+// CheckModel checks the diff engine of the "path" Watcher against an in-memory reference model.
+// Every step applies random mutations (create, grow, touch, remove, recreate, remove whole directories)
+// to both the model and Root, scans once, then compares the notices of the scan with the diff
+// expected from the model's snapshots before and after the step. Returns the first mismatch.
+func CheckModel(c ModelConfig) error {
+	if c.Steps <= 0 || c.Mutations <= 0 {
+		return fmt.Errorf("Steps and mutations must be positive")
+	}
+	if err := os.MkdirAll(c.Root, 0755); err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(c.Root); err != nil {
+		return err
+	} else if len(entries) > 0 {
+		return fmt.Errorf("Root %s is not empty", c.Root)
+	}
+
+	/* the baseline is marked by InitialScanDone */
+	opts := append([]fsmonitor.Option{fsmonitor.WithInitialScan(fsmonitor.SuppressExisting)}, c.Options...)
+	w, err := fsmonitor.NewWatcher("path", c.Root, c.Pattern, opts...)
+	if err != nil {
+		return err
+	}
+	m := &model{
+		c:     c,
+		rand:  rand.New(rand.NewSource(c.Seed)),
+		files: make(map[string]modelFile),
+	}
+	for _, pat := range c.Pattern {
+		re, err := fsmonitor.CompilePattern(pat)
+		if err != nil {
+			return err
+		}
+		m.pattern = append(m.pattern, re)
+	}
+
+	ncc, errors := w.Watch()
+	defer func() {
+		close(ncc)
+		for range errors {
+		}
+	}()
+
+	/* first scan baselines without notices but InitialScanDone of Root */
+	notices, err := scan(ncc, errors)
+	done := 0
+	for _, n := range notices {
+		if n.Type() == fsmonitor.InitialScanDone && n.Name() == filepath.Clean(c.Root) {
+			done++
+		}
+	}
+	if err != nil || done != 1 || len(notices) > done {
+		return fmt.Errorf("Baseline scan: expected only %v, got notices %v, error %v", fsmonitor.InitialScanDone, notices, err)
+	}
+
+	for step := 1; step <= c.Steps; step++ {
+		before := m.snapshot()
+		log, err := m.mutate()
+		if err != nil {
+			return err
+		}
+		expected := diff(before, m.snapshot())
+
+		notices, err := scan(ncc, errors)
+		if err != nil {
+			return fmt.Errorf("Step %d: scan failed: %v", step, err)
+		}
+		got := make(map[string]fsmonitor.Event)
+		for _, n := range notices {
+			if e, ok := got[n.Name()]; ok {
+				return fmt.Errorf("Step %d: duplicate notices %v and %v for %s after %v", step, e, n.Type(), n.Name(), log)
+			}
+			got[n.Name()] = n.Type()
+		}
+		for file, e := range expected {
+			if got[file] != e {
+				return fmt.Errorf("Step %d: expected %v for %s, got %v after %v", step, e, file, got[file], log)
+			}
+			delete(got, file)
+		}
+		if len(got) > 0 {
+			return fmt.Errorf("Step %d: unexpected notices %v after %v", step, got, log)
+		}
+	}
+	return nil
+}
+
+// scan runs one check of the Watcher, collecting its notices.
+func scan(ncc chan<- chan<- fsmonitor.Notice, errors <-chan error) ([]fsmonitor.Notice, error) {
+	changed := make(chan fsmonitor.Notice)
+	ncc <- changed
+
+	var notices []fsmonitor.Notice
+	for {
+		select {
+		case n := <-changed:
+			notices = append(notices, n)
+		case err := <-errors:
+			return notices, err
+		}
+	}
+}
+
+// model is the reference file system, files are identified by size and modification time.
+type model struct {
+	c       ModelConfig
+	rand    *rand.Rand
+	pattern []*regexp.Regexp
+	files   map[string]modelFile
+	seq     int
+}
+
+type modelFile struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshot returns the files the Watcher is expected to track.
+func (m *model) snapshot() map[string]modelFile {
+	snap := make(map[string]modelFile)
+	for file, f := range m.files {
+		if m.matches(file) {
+			snap[file] = f
+		}
+	}
+	return snap
+}
+
+func (m *model) matches(file string) bool {
+	if len(m.pattern) == 0 {
+		return true
+	}
+	for _, re := range m.pattern {
+		if re.MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// diff derives the expected notices between two snapshots.
+func diff(before, after map[string]modelFile) map[string]fsmonitor.Event {
+	expected := make(map[string]fsmonitor.Event)
+	for file, f := range after {
+		if old, ok := before[file]; !ok {
+			expected[file] = fsmonitor.FileCreate
+		} else if old.size != f.size || f.modTime.After(old.modTime) {
+			expected[file] = fsmonitor.FileUpdate
+		}
+	}
+	for file := range before {
+		if _, ok := after[file]; !ok {
+			expected[file] = fsmonitor.FileRemove
+		}
+	}
+	return expected
+}
+
+// mutate applies random mutations to both the model and Root, returning what was done.
+func (m *model) mutate() ([]string, error) {
+	var log []string
+	for i := m.rand.Intn(m.c.Mutations) + 1; i > 0; i-- {
+		existing := m.existing()
+		var file string
+		if len(existing) > 0 {
+			file = existing[m.rand.Intn(len(existing))]
+		}
+
+		var err error
+		switch op := m.rand.Intn(6); {
+		case op == 0 || file == "":
+			m.seq++
+			ext := []string{".log", ".txt", ""}[m.rand.Intn(3)]
+			file = filepath.Join(m.c.Root, fmt.Sprintf("d%d", m.rand.Intn(4)), fmt.Sprintf("d%d", m.rand.Intn(3)), fmt.Sprintf("f%d%s", m.seq, ext))
+			log = append(log, "create "+file)
+			err = m.write(file, 1+m.rand.Int63n(64))
+		case op == 1:
+			log = append(log, "grow "+file)
+			err = m.write(file, m.files[file].size+1+m.rand.Int63n(64))
+		case op == 2:
+			/* same size, later modification time */
+			log = append(log, "touch "+file)
+			mtime := m.files[file].modTime.Add(time.Second)
+			if err = os.Chtimes(file, mtime, mtime); err == nil {
+				m.files[file] = modelFile{size: m.files[file].size, modTime: mtime}
+			}
+		case op == 3:
+			log = append(log, "remove "+file)
+			delete(m.files, file)
+			err = os.Remove(file)
+		case op == 4:
+			log = append(log, "recreate "+file)
+			if err = os.Remove(file); err == nil {
+				err = m.write(file, m.files[file].size+1+m.rand.Int63n(64))
+			}
+		default:
+			dir := filepath.Dir(file)
+			log = append(log, "remove directory "+dir)
+			for f := range m.files {
+				if strings.HasPrefix(f, dir+string(filepath.Separator)) {
+					delete(m.files, f)
+				}
+			}
+			err = os.RemoveAll(dir)
+		}
+		if err != nil {
+			return log, err
+		}
+	}
+	return log, nil
+}
+
+// write replaces file with size bytes, recording what the file system reports.
+func (m *model) write(file string, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, make([]byte, size), 0644); err != nil {
+		return err
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	m.files[file] = modelFile{size: info.Size(), modTime: info.ModTime()}
+	return nil
+}
+
+// existing lists model files in stable order, so runs are reproducible by seed.
+func (m *model) existing() []string {
+	files := make([]string, 0, len(m.files))
+	for file := range m.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
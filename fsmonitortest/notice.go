@@ -0,0 +1,39 @@
+// Package fsmonitortest provides utilities for testing fsmonitor consumers without touching real disks.
+package fsmonitortest
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Notice implements fsmonitor.Notice with plain fields, for building notices in tests.
+type Notice struct {
+	Path      string
+	Event     fsmonitor.Event
+	Timestamp time.Time
+	// Returned by More(), may be nil
+	Info os.FileInfo
+}
+
+func (n *Notice) String() string {
+	return fmt.Sprintf("{%v : %v}", n.Path, n.Event)
+}
+
+func (n *Notice) Name() string {
+	return n.Path
+}
+
+func (n *Notice) Type() fsmonitor.Event {
+	return n.Event
+}
+
+func (n *Notice) More() interface{} {
+	return n.Info
+}
+
+func (n *Notice) Time() time.Time {
+	return n.Timestamp
+}
@@ -0,0 +1,87 @@
+package fsmonitortest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Scan is what a Script sends for one scan of the Monitor.
+type Scan struct {
+	Notices []fsmonitor.Notice
+	// Reported once the notices are sent, e.g. a *fsmonitor.ScanError
+	Err error
+}
+
+// Script implements fsmonitor.Watcher by sending predefined scans in order, nothing once they ran out, so
+// tests of consumers don't depend on the file system. E.g. given WithWatcher along with the Clock of WithClock.
+type Script struct {
+	scans []Scan
+
+	mu   sync.Mutex
+	done int
+	/* closed and replaced once a scan is done */
+	changed chan struct{}
+}
+
+// NewScript returns a Script sending scans in order.
+func NewScript(scans ...Scan) *Script {
+	return &Script{scans: scans, changed: make(chan struct{})}
+}
+
+// Watch implements fsmonitor.Watcher.
+func (s *Script) Watch() (chan<- chan<- fsmonitor.Notice, <-chan error) {
+	ncc := make(chan chan<- fsmonitor.Notice)
+	errors := make(chan error)
+
+	go func() {
+		defer close(errors)
+		for changed := range ncc {
+			s.mu.Lock()
+			var scan Scan
+			if s.done < len(s.scans) {
+				scan = s.scans[s.done]
+			}
+			s.mu.Unlock()
+
+			for _, n := range scan.Notices {
+				changed <- n
+			}
+			errors <- scan.Err
+
+			s.mu.Lock()
+			s.done++
+			close(s.changed)
+			s.changed = make(chan struct{})
+			s.mu.Unlock()
+		}
+	}()
+	return ncc, errors
+}
+
+// Scans returns the number of scans done, beyond the script too.
+func (s *Script) Scans() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// WaitScans waits until at least n scans are done, reporting whether before timeout passed.
+func (s *Script) WaitScans(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		s.mu.Lock()
+		done, changed := s.done, s.changed
+		s.mu.Unlock()
+		if done >= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
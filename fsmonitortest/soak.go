@@ -0,0 +1,199 @@
+package fsmonitortest
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// SoakConfig controls the stress run of Soak.
+type SoakConfig struct {
+	// Directory mutated by the run, must be empty or not exist
+	Root string
+	// Scan interval of the Monitor under test
+	Interval time.Duration
+	// Total run time, rounds keep going until it passes
+	Duration time.Duration
+	// Distinct paths mutated per round
+	Mutations int
+	// Sub-directories files are spread over
+	Dirs int
+	// Time to wait for the notices of a round, 10 intervals by default
+	Timeout time.Duration
+	// Options given to the Monitor under test, e.g. WithScanConcurrency
+	Options []fsmonitor.Option
+	Seed    int64
+}
+
+// SoakReport summarizes a successful Soak run.
+type SoakReport struct {
+	Rounds    int
+	Mutations int
+	Notices   map[fsmonitor.Event]int
+}
+
+// Soak runs a Monitor on Root while randomly creating, updating and removing files there,
+// checking after every round that each mutation produced exactly one matching notice,
+// no duplicates showed up and notices of a path follow create, update..., remove order.
+// Files are replaced atomically by rename, so no partial writes are observed by scans.
+// Returns the first invariant violation, run the caller with -race to also catch data races.
+func Soak(c SoakConfig) (*SoakReport, error) {
+	if c.Interval <= 0 || c.Duration <= 0 || c.Mutations <= 0 {
+		return nil, fmt.Errorf("Interval, duration and mutations must be positive")
+	}
+	if c.Dirs < 1 {
+		c.Dirs = 1
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * c.Interval
+	}
+	if err := os.MkdirAll(c.Root, 0755); err != nil {
+		return nil, err
+	}
+	if entries, err := os.ReadDir(c.Root); err != nil {
+		return nil, err
+	} else if len(entries) > 0 {
+		return nil, fmt.Errorf("Root %s is not empty", c.Root)
+	}
+
+	/* staging area outside of the watched tree, on the same file system for atomic renames */
+	staging, err := os.MkdirTemp(filepath.Dir(filepath.Clean(c.Root)), ".soak-staging")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	for i := 0; i < c.Dirs; i++ {
+		if err := os.MkdirAll(filepath.Join(c.Root, fmt.Sprintf("d%d", i)), 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fsmonitor.Validate(c.Root, nil, "path"); err != nil {
+		return nil, err
+	}
+	monitor := fsmonitor.New(c.Root, nil, "path", c.Options...)
+	go monitor.Start(c.Interval, fsmonitor.FileCreate, fsmonitor.FileUpdate, fsmonitor.FileRemove)
+	defer func() {
+		go func() {
+			for range monitor.Notices() {
+			}
+		}()
+		monitor.Stop()
+	}()
+
+	/* let the first scan baseline the empty tree */
+	time.Sleep(2 * c.Interval)
+
+	s := &soak{
+		c:       c,
+		rand:    rand.New(rand.NewSource(c.Seed)),
+		staging: staging,
+		exists:  make(map[string]int),
+		report:  &SoakReport{Notices: make(map[fsmonitor.Event]int)},
+		notices: monitor.Notices(),
+	}
+	deadline := time.Now().Add(c.Duration)
+	for time.Now().Before(deadline) {
+		if err := s.round(); err != nil {
+			return s.report, err
+		}
+	}
+
+	/* late duplicates of the last round */
+	select {
+	case n := <-s.notices:
+		return s.report, fmt.Errorf("Unexpected notice after last round: %v", n)
+	case <-time.After(3 * c.Interval):
+	}
+	return s.report, nil
+}
+
+// soak tracks the state expected from the Monitor.
+type soak struct {
+	c       SoakConfig
+	rand    *rand.Rand
+	staging string
+	/* existing files and their size, every update grows the file */
+	exists  map[string]int
+	seq     int
+	report  *SoakReport
+	notices <-chan fsmonitor.Notice
+}
+
+// round mutates distinct paths and waits for exactly one notice of each.
+func (s *soak) round() error {
+	expected := make(map[string]fsmonitor.Event)
+	for len(expected) < s.c.Mutations {
+		file, event := s.pick()
+		if _, ok := expected[file]; ok {
+			continue
+		}
+		if err := s.mutate(file, event); err != nil {
+			return err
+		}
+		expected[file] = event
+	}
+	s.report.Rounds++
+	s.report.Mutations += len(expected)
+
+	timeout := time.After(s.c.Timeout)
+	for len(expected) > 0 {
+		select {
+		case n, ok := <-s.notices:
+			if !ok {
+				return fmt.Errorf("Notice channel closed during round %d", s.report.Rounds)
+			}
+			event, ok := expected[n.Name()]
+			if !ok {
+				return fmt.Errorf("Round %d: unexpected or duplicate notice %v", s.report.Rounds, n)
+			}
+			if event != n.Type() {
+				return fmt.Errorf("Round %d: expected %v for %s, got %v", s.report.Rounds, event, n.Name(), n.Type())
+			}
+			delete(expected, n.Name())
+			s.report.Notices[n.Type()]++
+		case <-timeout:
+			return fmt.Errorf("Round %d: %d mutations not noticed within %v: %v", s.report.Rounds, len(expected), s.c.Timeout, expected)
+		}
+	}
+	return nil
+}
+
+// pick chooses the next mutation, only existing files are updated or removed.
+func (s *soak) pick() (string, fsmonitor.Event) {
+	if len(s.exists) > 0 && s.rand.Intn(3) > 0 {
+		/* map iteration order isn't random enough, pick by index */
+		i := s.rand.Intn(len(s.exists))
+		for file := range s.exists {
+			if i == 0 {
+				if s.rand.Intn(2) == 0 {
+					return file, fsmonitor.FileUpdate
+				}
+				return file, fsmonitor.FileRemove
+			}
+			i--
+		}
+	}
+	s.seq++
+	return filepath.Join(s.c.Root, fmt.Sprintf("d%d", s.rand.Intn(s.c.Dirs)), fmt.Sprintf("f%d", s.seq)), fsmonitor.FileCreate
+}
+
+// mutate applies the event to file, writes are staged and renamed into place.
+func (s *soak) mutate(file string, event fsmonitor.Event) error {
+	if event == fsmonitor.FileRemove {
+		delete(s.exists, file)
+		return os.Remove(file)
+	}
+
+	size := s.exists[file] + 1 + s.rand.Intn(64)
+	staged := filepath.Join(s.staging, filepath.Base(file))
+	if err := os.WriteFile(staged, make([]byte, size), 0644); err != nil {
+		return err
+	}
+	s.exists[file] = size
+	return os.Rename(staged, file)
+}
@@ -0,0 +1,240 @@
+// Package fsnotify exposes fsmonitor through the API of github.com/fsnotify/fsnotify, so consumers written
+// against fsnotify can switch to polling, e.g. on NFS where inotify misses remote changes, by changing the import.
+//
+// Unlike fsnotify, watching a directory reports changes of files in its whole subtree.
+// Changes of mode and ownership are reported as Chmod, as by fsnotify.
+package fsnotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Interval between scans of Monitors created by Add.
+var Interval = time.Second
+
+var (
+	ErrNonExistentWatch = errors.New("fsnotify: can't remove non-existent watch")
+	ErrClosed           = errors.New("fsnotify: watcher already closed")
+)
+
+// Op describes a set of file operations.
+type Op uint32
+
+const (
+	Create Op = 1 << iota
+	Write
+	Remove
+	Rename
+	Chmod
+)
+
+var opName = []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"}
+
+// String implements fmt.Stringer.
+func (op Op) String() string {
+	var s []string
+	for i, name := range opName {
+		if op&(1<<uint(i)) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+// Has reports whether op includes h.
+func (op Op) Has(h Op) bool {
+	return op&h == h
+}
+
+// Event represents a single file system notification.
+type Event struct {
+	Name string
+	Op   Op
+}
+
+// Has reports whether the event includes op.
+func (e Event) Has(op Op) bool {
+	return e.Op.Has(op)
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%-13s %q", e.Op.String(), e.Name)
+}
+
+// noticeOp maps events of notices to operations, others aren't forwarded.
+var noticeOp = map[fsmonitor.Event]Op{
+	fsmonitor.FileCreate: Create,
+	fsmonitor.FileUpdate: Write,
+	fsmonitor.FileRemove: Remove,
+	fsmonitor.FileRename: Rename,
+	fsmonitor.DirCreate:  Create,
+	fsmonitor.DirRemove:  Remove,
+	fsmonitor.DirRename:  Rename,
+	fsmonitor.FileAttrib: Chmod,
+}
+
+// Watcher delivers notices of Monitors as Events, and scan errors as Errors.
+// Both channels close once Close returns.
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	opts []fsmonitor.Option
+
+	mu       sync.Mutex
+	monitors map[string]*fsmonitor.Monitor
+	/* given to Wrap, not removable by name */
+	wrapped []*fsmonitor.Monitor
+	closed  bool
+
+	done  chan struct{}
+	relay sync.WaitGroup
+}
+
+// NewWatcher creates a Watcher without watches, Monitors created by Add are tuned by opt.
+func NewWatcher(opt ...fsmonitor.Option) (*Watcher, error) {
+	return &Watcher{
+		Events:   make(chan Event),
+		Errors:   make(chan error),
+		opts:     opt,
+		monitors: make(map[string]*fsmonitor.Monitor),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Wrap exposes a Monitor already started with the events of interest, it is stopped by Close.
+// Wrapping takes over Notices() of the Monitor.
+func Wrap(m *fsmonitor.Monitor) *Watcher {
+	w, _ := NewWatcher()
+	w.wrapped = append(w.wrapped, m)
+	w.forward(m)
+	return w
+}
+
+// Add starts watching the file or directory at name, by a Monitor of the builtin "path" Watcher
+// scanning every Interval.
+func (w *Watcher) Add(name string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	if _, ok := w.monitors[name]; ok {
+		return nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return err
+	}
+	m, err := fsmonitor.NewMonitor(append([]fsmonitor.Option{fsmonitor.WithPath(name)}, w.opts...)...)
+	if err != nil {
+		return err
+	}
+	go m.Start(Interval, fsmonitor.FileCreate, fsmonitor.FileUpdate, fsmonitor.FileRemove, fsmonitor.FileRename, fsmonitor.FileError,
+		fsmonitor.DirCreate, fsmonitor.DirRemove, fsmonitor.DirRename, fsmonitor.FileAttrib)
+	w.monitors[name] = m
+	w.forward(m)
+	return nil
+}
+
+// Remove stops watching name, stopping its Monitor.
+func (w *Watcher) Remove(name string) error {
+	w.mu.Lock()
+	m, ok := w.monitors[name]
+	delete(w.monitors, name)
+	w.mu.Unlock()
+
+	if !ok {
+		return ErrNonExistentWatch
+	}
+	return m.Stop()
+}
+
+// WatchList returns the names added and not removed yet.
+func (w *Watcher) WatchList() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names := make([]string, 0, len(w.monitors))
+	for name := range w.monitors {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Close stops every Monitor and closes Events and Errors, notices still pending are dropped.
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	monitors := w.wrapped
+	for _, m := range w.monitors {
+		monitors = append(monitors, m)
+	}
+	w.monitors = nil
+	w.mu.Unlock()
+
+	/* unblock forwarding so Monitors can return */
+	close(w.done)
+
+	var err error
+	for _, m := range monitors {
+		if e := m.Stop(); e != nil && err == nil {
+			err = e
+		}
+	}
+	w.relay.Wait()
+
+	close(w.Events)
+	close(w.Errors)
+	return err
+}
+
+// forward relays notices of m until its Notices() closes.
+func (w *Watcher) forward(m *fsmonitor.Monitor) {
+	w.relay.Add(1)
+	go func() {
+		defer w.relay.Done()
+
+		for n := range m.Notices() {
+			if n.Type() == fsmonitor.FileError {
+				if err, ok := n.More().(error); ok {
+					select {
+					case w.Errors <- err:
+					case <-w.done:
+					}
+				}
+				continue
+			}
+			if r, ok := n.More().(*fsmonitor.RenameInfo); ok {
+				/* as fsnotify does, rename of the old name followed by create of the new one */
+				w.send(Event{Name: r.OldPath, Op: Rename})
+				w.send(Event{Name: r.NewPath, Op: Create})
+				continue
+			}
+			op, ok := noticeOp[n.Type()]
+			if !ok {
+				continue
+			}
+			w.send(Event{Name: n.Name(), Op: op})
+		}
+	}()
+}
+
+// send delivers e unless closing.
+func (w *Watcher) send(e Event) {
+	select {
+	case w.Events <- e:
+	case <-w.done:
+	}
+}
@@ -0,0 +1,190 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FSWatcher returns a Watcher scanning fsys by fs.WalkDir, e.g. an embed.FS, a zip.Reader, an fstest.MapFS in
+// tests, or an afero.Fs adapted by afero.NewIOFS, for a Monitor given WithWatcher. Files are noticed by their
+// slash-separated names within fsys, diffed by size and modification time as the "path" Watcher does, creates and
+// removes of the same file are sent as renames if the Monitor delivers FileRename. Patterns and WithExcludes, WithInitialScan and WithMaxDepth apply,
+// relative globs are anchored at the root of fsys. Unreadable directories fail the scan keeping what was known.
+func FSWatcher(fsys fs.FS, pattern []string, opt ...Option) (Watcher, error) {
+	if fsys == nil {
+		return nil, fmt.Errorf("File system to watch must not be nil")
+	}
+	opts, err := apply(opt)
+	if err != nil {
+		return nil, err
+	}
+	s := &fsScanner{fsys: fsys, initial: opts.initial, scanDone: opts.scanDone, maxDepth: opts.maxDepth}
+	for _, pat := range append(pattern[:len(pattern):len(pattern)], opts.patterns...) {
+		exp, err := compilePatternAt(pat, ".")
+		if err != nil {
+			return nil, fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+		s.pattern = append(s.pattern, *exp)
+	}
+	for _, pat := range opts.excludes {
+		exp, err := compilePatternAt(pat, ".")
+		if err != nil {
+			return nil, fmt.Errorf("Exclude pattern failed compilation, please check syntax! %v", err)
+		}
+		s.exclude = append(s.exclude, *exp)
+	}
+	return s, nil
+}
+
+// fsScanner implements Watcher by walking an fs.FS.
+type fsScanner struct {
+	fsys      fs.FS
+	pattern   []regexp.Regexp
+	exclude   []regexp.Regexp
+	initial   InitialScan
+	scanDone  bool
+	maxDepth  int
+	lastCheck map[string]fs.FileInfo
+	profile   Profile
+	/* filters of the Monitor, only its events are evaluated */
+	pushdown Pushdown
+}
+
+// PushDown keeps p from the next check on, renames are paired only if its events ask for them.
+func (s *fsScanner) PushDown(p Pushdown) {
+	s.pushdown = p
+}
+
+// Watch walks fsys and sends changes since last check.
+func (s *fsScanner) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error) {
+		defer close(errors)
+
+		for changed := range ncc {
+			initial := s.lastCheck == nil
+			err := s.scan(changed)
+			if initial && s.lastCheck != nil && s.scanDone {
+				changed <- &fileSystemNotice{
+					path:      ".",
+					timestamp: time.Now(),
+					event:     InitialScanDone,
+					labels:    Labels{Watcher: "fs"},
+				}
+			}
+			errors <- scanError(".", err)
+		}
+	}(ncc, errors)
+	return ncc, errors
+}
+
+// scan walks fsys and diffs what was found against lastCheck.
+func (s *fsScanner) scan(changed chan<- Notice) error {
+	r := newRenames(s.pushdown.Events, func(n *fileSystemNotice) {
+		n.labels = Labels{Watcher: "fs"}
+		changed <- n
+	})
+	defer r.flush()
+
+	visited := make(map[string]fs.FileInfo)
+	/* directories failing to be read, files known under them are kept */
+	var failed []string
+	var failure error
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if name == "." {
+				return err
+			}
+			failed = append(failed, name)
+			failure = err
+			if d != nil && d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if name == "." {
+			return nil
+		}
+		depth := strings.Count(name, "/") + 1
+		if s.excluded(name) || s.maxDepth > 0 && depth > s.maxDepth {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			if s.maxDepth > 0 && depth == s.maxDepth {
+				/* entries would be beyond max depth */
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !s.matches(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			/* removed since listed */
+			return nil
+		}
+		visited[name] = info
+
+		if oldinfo, ok := s.lastCheck[name]; ok {
+			if s.profile.changed(oldinfo, info) {
+				r.send(&fileSystemNotice{path: name, fileinfo: info, timestamp: time.Now(), event: FileUpdate})
+			}
+		} else if s.lastCheck != nil || s.initial == EmitExisting {
+			r.send(&fileSystemNotice{path: name, fileinfo: info, timestamp: time.Now(), event: FileCreate})
+		}
+		return nil
+	})
+	if err != nil {
+		/* keep state untouched until the root can be read again */
+		return err
+	}
+
+	for name, info := range s.lastCheck {
+		if _, ok := visited[name]; ok {
+			continue
+		}
+		kept := false
+		for _, dir := range failed {
+			if name == dir || strings.HasPrefix(name, dir+"/") {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			visited[name] = info
+			continue
+		}
+		r.send(&fileSystemNotice{path: name, fileinfo: info, timestamp: time.Now(), event: FileRemove})
+	}
+	s.lastCheck = visited
+	return failure
+}
+
+// matches reports whether name matches any of the patterns, all names match without patterns.
+func (s *fsScanner) matches(name string) bool {
+	for _, re := range s.pattern {
+		if re.FindStringIndex(name) != nil {
+			return true
+		}
+	}
+	return len(s.pattern) == 0
+}
+
+// excluded reports whether name matches any of the exclude patterns.
+func (s *fsScanner) excluded(name string) bool {
+	for _, re := range s.exclude {
+		if re.FindStringIndex(name) != nil {
+			return true
+		}
+	}
+	return false
+}
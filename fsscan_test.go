@@ -0,0 +1,291 @@
+package fsmonitor_test
+
+import (
+	"fmt"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// TestFSWatcherModel checks the diff engine against an in-memory reference model: every step mutates the model
+// and a MapFS alike, scans once and compares the notices with the diff of the model before and after the step.
+func TestFSWatcherModel(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		opts     []fsmonitor.Option
+		// notices of the baseline scan
+		baseline []fsmonitor.Event
+	}{
+		{name: "all"},
+		{name: "patterns", patterns: []string{`\.log$`}},
+		{name: "initial", opts: []fsmonitor.Option{fsmonitor.WithInitialScan(fsmonitor.SuppressExisting)}, baseline: []fsmonitor.Event{fsmonitor.InitialScanDone}},
+	}
+	for _, c := range cases {
+		for seed := int64(1); seed <= 10; seed++ {
+			c, seed := c, seed
+			t.Run(fmt.Sprintf("%s/seed%d", c.name, seed), func(t *testing.T) {
+				checkModel(t, c.patterns, c.opts, c.baseline, seed)
+			})
+		}
+	}
+}
+
+func checkModel(t *testing.T, patterns []string, opts []fsmonitor.Option, baseline []fsmonitor.Event, seed int64) {
+	m := &fsModel{
+		rand:  rand.New(rand.NewSource(seed)),
+		fsys:  fstest.MapFS{},
+		clock: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for _, pat := range patterns {
+		m.suffix = append(m.suffix, strings.TrimSuffix(strings.ReplaceAll(pat, `\`, ""), "$"))
+	}
+	/* files known before watching are baselined */
+	m.mutate(5)
+
+	w, err := fsmonitor.FSWatcher(m.fsys, patterns, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ncc, errors := w.Watch()
+	defer func() {
+		close(ncc)
+		for range errors {
+		}
+	}()
+
+	notices, err := scanOnce(ncc, errors)
+	if err != nil {
+		t.Fatalf("Baseline scan failed: %v", err)
+	}
+	var got []fsmonitor.Event
+	for _, n := range notices {
+		got = append(got, n.Type())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(baseline) {
+		t.Fatalf("Baseline scan: expected %v, got %v", baseline, notices)
+	}
+
+	for step := 1; step <= 50; step++ {
+		before := m.snapshot()
+		log := m.mutate(8)
+		expected := expectedDiff(before, m.snapshot())
+
+		notices, err := scanOnce(ncc, errors)
+		if err != nil {
+			t.Fatalf("Step %d: scan failed: %v", step, err)
+		}
+		got := make(map[string]string)
+		for _, n := range notices {
+			if e, ok := got[n.Name()]; ok {
+				t.Fatalf("Step %d: duplicate notices %v and %v for %s after %v", step, e, n, n.Name(), log)
+			}
+			got[n.Name()] = n.Type().String()
+			if n.Type() == fsmonitor.FileRename {
+				got[n.Name()] += " from " + fsmonitor.InfoOf(n).OldPath
+			}
+		}
+		for file, e := range expected {
+			if got[file] != e {
+				t.Fatalf("Step %d: expected %s for %s, got %q after %v", step, e, file, got[file], log)
+			}
+			delete(got, file)
+		}
+		if len(got) > 0 {
+			t.Fatalf("Step %d: unexpected notices %v after %v", step, got, log)
+		}
+	}
+}
+
+// TestFSWatcherRenamesAskedFor moves a file, expecting a FileRename only if pushed down events ask for it.
+func TestFSWatcherRenamesAskedFor(t *testing.T) {
+	for _, events := range []fsmonitor.Event{fsmonitor.FileCreate | fsmonitor.FileRemove, fsmonitor.FileRename} {
+		fsys := fstest.MapFS{"a.txt": {Data: []byte("a"), ModTime: time.Unix(1700000000, 0)}}
+		w, err := fsmonitor.FSWatcher(fsys, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.(fsmonitor.Pushdowner).PushDown(fsmonitor.Pushdown{Events: events})
+		ncc, errors := w.Watch()
+		if _, err := scanOnce(ncc, errors); err != nil {
+			t.Fatal(err)
+		}
+		fsys["b.txt"] = fsys["a.txt"]
+		delete(fsys, "a.txt")
+		notices, err := scanOnce(ncc, errors)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, n := range notices {
+			got = append(got, n.Type().String())
+		}
+		sort.Strings(got)
+		expected := []string{fsmonitor.FileRename.String()}
+		if events != fsmonitor.FileRename {
+			expected = []string{fsmonitor.FileCreate.String(), fsmonitor.FileRemove.String()}
+			sort.Strings(expected)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(expected) {
+			t.Errorf("Events %v: expected %v, got %v", events, expected, got)
+		}
+		close(ncc)
+		for range errors {
+		}
+	}
+}
+
+// scanOnce runs one check of the Watcher, collecting its notices.
+func scanOnce(ncc chan<- chan<- fsmonitor.Notice, errors <-chan error) ([]fsmonitor.Notice, error) {
+	changed := make(chan fsmonitor.Notice)
+	ncc <- changed
+
+	var notices []fsmonitor.Notice
+	for {
+		select {
+		case n := <-changed:
+			notices = append(notices, n)
+		case err := <-errors:
+			return notices, err
+		}
+	}
+}
+
+// fsModel is the reference file system, mirrored into fsys. Every write gets a modification time of its own,
+// so files are told apart by size and modification time as the Watcher does.
+type fsModel struct {
+	rand   *rand.Rand
+	fsys   fstest.MapFS
+	suffix []string
+	clock  time.Time
+	seq    int
+}
+
+type modelFile struct {
+	size    int
+	modTime time.Time
+}
+
+// snapshot returns the files the Watcher is expected to track.
+func (m *fsModel) snapshot() map[string]modelFile {
+	snap := make(map[string]modelFile)
+	for name, f := range m.fsys {
+		if m.matches(name) {
+			snap[name] = modelFile{size: len(f.Data), modTime: f.ModTime}
+		}
+	}
+	return snap
+}
+
+func (m *fsModel) matches(name string) bool {
+	for _, suffix := range m.suffix {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return len(m.suffix) == 0
+}
+
+// expectedDiff derives the notices between two snapshots, pairing files removed and created unambiguously by
+// size and modification time into renames.
+func expectedDiff(before, after map[string]modelFile) map[string]string {
+	expected := make(map[string]string)
+	removed := make(map[modelFile][]string)
+	for name, f := range before {
+		if _, ok := after[name]; !ok {
+			removed[f] = append(removed[f], name)
+		}
+	}
+	for name, f := range after {
+		old, ok := before[name]
+		switch {
+		case ok && (old.size != f.size || f.modTime.After(old.modTime)):
+			expected[name] = fsmonitor.FileUpdate.String()
+		case !ok && len(removed[f]) == 1:
+			expected[name] = fsmonitor.FileRename.String() + " from " + removed[f][0]
+			delete(removed, f)
+		case !ok:
+			expected[name] = fsmonitor.FileCreate.String()
+		}
+	}
+	for _, names := range removed {
+		for _, name := range names {
+			expected[name] = fsmonitor.FileRemove.String()
+		}
+	}
+	return expected
+}
+
+// mutate applies up to max random mutations, returning what was done.
+func (m *fsModel) mutate(max int) []string {
+	var log []string
+	for i := m.rand.Intn(max) + 1; i > 0; i-- {
+		existing := make([]string, 0, len(m.fsys))
+		for name := range m.fsys {
+			existing = append(existing, name)
+		}
+		/* stable order, so runs are reproducible by seed */
+		sort.Strings(existing)
+		var name string
+		if len(existing) > 0 {
+			name = existing[m.rand.Intn(len(existing))]
+		}
+
+		switch op := m.rand.Intn(7); {
+		case op == 0 || name == "":
+			name = m.newName()
+			log = append(log, "create "+name)
+			m.write(name, 1+m.rand.Intn(64))
+		case op == 1:
+			log = append(log, "grow "+name)
+			m.write(name, len(m.fsys[name].Data)+1+m.rand.Intn(64))
+		case op == 2:
+			/* same size, later modification time, replaced as FileInfos of fstest.MapFS refer to their MapFile */
+			log = append(log, "touch "+name)
+			m.clock = m.clock.Add(time.Second)
+			touched := *m.fsys[name]
+			touched.ModTime = m.clock
+			m.fsys[name] = &touched
+		case op == 3:
+			log = append(log, "remove "+name)
+			delete(m.fsys, name)
+		case op == 4:
+			log = append(log, "recreate "+name)
+			delete(m.fsys, name)
+			m.write(name, 1+m.rand.Intn(64))
+		case op == 5:
+			moved := m.newName()
+			log = append(log, "move "+name+" to "+moved)
+			m.fsys[moved] = m.fsys[name]
+			delete(m.fsys, name)
+		default:
+			dir := path.Dir(name)
+			log = append(log, "remove directory "+dir)
+			for f := range m.fsys {
+				if strings.HasPrefix(f, dir+"/") {
+					delete(m.fsys, f)
+				}
+			}
+		}
+	}
+	return log
+}
+
+// newName returns a path not used before.
+func (m *fsModel) newName() string {
+	m.seq++
+	ext := []string{".log", ".txt", ""}[m.rand.Intn(3)]
+	return fmt.Sprintf("d%d/d%d/f%d%s", m.rand.Intn(4), m.rand.Intn(3), m.seq, ext)
+}
+
+// write replaces name with size bytes, modified at a time of its own.
+func (m *fsModel) write(name string, size int) {
+	m.clock = m.clock.Add(time.Second)
+	m.fsys[name] = &fstest.MapFile{Data: make([]byte, size), Mode: 0644, ModTime: m.clock}
+}
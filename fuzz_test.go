@@ -0,0 +1,134 @@
+package fsmonitor
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+/* Fuzz targets for go test, e.g.:
+ *   go test -run '^$' -fuzz FuzzPattern
+ * Inputs seeded here are checked by every go test run.
+ */
+
+// FuzzPattern compiles pattern, as regular expression or glob, and explains path by a Monitor given it.
+func FuzzPattern(f *testing.F) {
+	f.Add(`\.log$`, "a/b.log")
+	f.Add("glob:**/*.csv", "data/x.csv")
+	f.Add("glob:[!a-c]?/{x", "d1/{x")
+	f.Add("(", "x")
+	f.Fuzz(func(t *testing.T, pattern, path string) {
+		if _, err := CompilePattern(pattern); err != nil {
+			return
+		}
+		m, err := build(".", []string{pattern}, "path")
+		if err != nil {
+			return
+		}
+		if e, err := m.Explain(path); err != nil || e == nil {
+			t.Fatalf("Explaining %q by %q failed: %v", path, pattern, err)
+		}
+	})
+}
+
+// FuzzIgnoreFile parses data as ignore file and matches path by its rules.
+func FuzzIgnoreFile(f *testing.F) {
+	f.Add([]byte("# comment\n*.tmp\n!keep.tmp\nbuild/\n/root/**/x?\n\\#literal\n[a-\n"), "build/keep.tmp", false)
+	f.Add([]byte("**\n"), "a/b", true)
+	f.Fuzz(func(t *testing.T, data []byte, path string, dir bool) {
+		rules, err := parseIgnore(data)
+		if err != nil {
+			return
+		}
+		s := &pathScanner{address: "/watched", ignore: rules}
+		s.excluded("/watched/"+path, dir)
+	})
+}
+
+// FuzzNotice decodes data as notice record and checks encoding it again round-trips.
+func FuzzNotice(f *testing.F) {
+	for _, n := range seedNotices() {
+		data, _ := MarshalNotice(n)
+		f.Add(data)
+	}
+	f.Add([]byte(`{"version":1,"path":"a","event":"notice.FileCreate","size":-1,"mode":4294967295}`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, err := UnmarshalNotice(data)
+		if err != nil {
+			return
+		}
+		roundTrip(t, n, MarshalNotice, UnmarshalNotice)
+	})
+}
+
+// FuzzMessage decodes value as keyed message of key.
+func FuzzMessage(f *testing.F) {
+	f.Add([]byte("notice.FileUpdate"), []byte("/a/b"))
+	f.Add([]byte(""), []byte(`{"path":"/a","event":"notice.FileRemove"}`))
+	f.Fuzz(func(t *testing.T, key, value []byte) {
+		n, err := UnmarshalMessage(key, value)
+		if err != nil || !utf8.ValidString(n.Name()) {
+			/* JSON replaces invalid UTF-8 of raw paths */
+			return
+		}
+		roundTrip(t, n, MarshalNotice, UnmarshalNotice)
+	})
+}
+
+// FuzzNoticeProto decodes data as protobuf notice and checks encoding it again round-trips.
+func FuzzNoticeProto(f *testing.F) {
+	for _, n := range seedNotices() {
+		data, _ := MarshalNoticeProto(n)
+		f.Add(data)
+	}
+	f.Add([]byte{0x08, 0x01, 0x1a, 0x01, 'a', 0x52, 0x02, 0x0a})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		n, err := UnmarshalNoticeProto(data)
+		if err != nil {
+			return
+		}
+		roundTrip(t, n, MarshalNoticeProto, UnmarshalNoticeProto)
+	})
+}
+
+// seedNotices returns notices to encode as seeds, with and without metadata and ID.
+func seedNotices() []Notice {
+	notices := []Notice{NewNotice("/a/c", FileRemove, nil)}
+	if info, err := os.Stat("."); err == nil {
+		notices = append(notices,
+			NewNotice("/a/b.log", FileCreate, info),
+			&identifiedNotice{Notice: NewNotice("/a/d", FileUpdate, info), id: "01J"},
+			&tracedNotice{Notice: NewNotice("/a/e", FileCreate, info), ctx: context.Background(), trace: map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}})
+	}
+	return notices
+}
+
+// roundTrip fails t unless n survives encoding and decoding by the given functions unchanged.
+func roundTrip(t *testing.T, n Notice, marshal func(Notice) ([]byte, error), unmarshal func([]byte) (Notice, error)) {
+	data, err := marshal(n)
+	if err != nil {
+		t.Fatalf("Encoding %v failed: %v", n, err)
+	}
+	d, err := unmarshal(data)
+	if err != nil {
+		t.Fatalf("Decoding %q failed: %v", data, err)
+	}
+	if d.Name() != n.Name() || d.Type() != n.Type() || !d.Time().Equal(n.Time()) {
+		t.Fatalf("%v changed to %v by round trip", n, d)
+	}
+	info, ok := n.More().(os.FileInfo)
+	dinfo, dok := d.More().(os.FileInfo)
+	if ok != dok || ok && (info.Size() != dinfo.Size() || info.Mode() != dinfo.Mode() || !info.ModTime().Equal(dinfo.ModTime())) {
+		t.Fatalf("Metadata of %v changed by round trip to %v", n, d)
+	}
+	var i, di IdentifiedNotice
+	if NoticeAs(n, &i) != NoticeAs(d, &di) || i != nil && i.ID() != di.ID() {
+		t.Fatalf("ID of %v changed by round trip to %v", n, d)
+	}
+	var tn, dtn TracedNotice
+	if NoticeAs(n, &tn) != NoticeAs(d, &dtn) || tn != nil && !reflect.DeepEqual(tn.Trace(), dtn.Trace()) {
+		t.Fatalf("Trace of %v changed by round trip to %v", n, d)
+	}
+}
@@ -0,0 +1,399 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithGitAware makes the builtin "path" Watcher treat git checkouts under the watched address as git does: .git
+// directories aren't walked, paths ignored by .gitignore files of every directory and .git/info/exclude are skipped.
+// With enrich, notices of files within checkouts implement GitNotice telling whether git tracks the file, and the
+// branch and commit checked out. Repositories are read directly, the git binary isn't needed.
+func WithGitAware(enrich bool) Option {
+	return func(o *options) error {
+		o.gitAware, o.gitEnrich = true, enrich
+		return nil
+	}
+}
+
+// GitInfo is what's known of a file within a git checkout, see WithGitAware.
+type GitInfo struct {
+	// Root of the checkout
+	Worktree string
+	// The file is in the index, i.e. committed or staged
+	Tracked bool
+	// Branch checked out, empty when HEAD is detached
+	Branch string
+	// Commit checked out, as hex, empty before the first commit
+	Commit string
+}
+
+// GitNotice is implemented by notices of files within git checkouts given WithGitAware(true).
+type GitNotice interface {
+	Notice
+	Git() GitInfo
+}
+
+// gitNotice implements GitNotice by wrapping the discovered Notice.
+type gitNotice struct {
+	Notice
+	git GitInfo
+}
+
+func (g *gitNotice) Unwrap() Notice {
+	return g.Notice
+}
+
+func (g *gitNotice) Git() GitInfo {
+	return g.git
+}
+
+// gitAware is what the "path" Watcher knows of checkouts, shared by the goroutines walking.
+type gitAware struct {
+	enrich bool
+
+	mu sync.Mutex
+	/* rules of the .gitignore of directories, read once every walk */
+	ignores map[string][]ignoreRule
+	/* checkout of directories, "" outside of any, found once every walk */
+	worktrees map[string]string
+	/* repositories by checkout, HEAD read again every walk, the index once changed */
+	repos map[string]*gitRepo
+}
+
+func newGitAware(enrich bool) *gitAware {
+	g := &gitAware{enrich: enrich, repos: make(map[string]*gitRepo)}
+	g.reset()
+	return g
+}
+
+// reset drops what's read every walk.
+func (g *gitAware) reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ignores = make(map[string][]ignoreRule)
+	g.worktrees = make(map[string]string)
+	for worktree, repo := range g.repos {
+		if repo == nil {
+			/* looked for again */
+			delete(g.repos, worktree)
+			continue
+		}
+		repo.fresh = false
+	}
+}
+
+// ignored reports whether file is a .git directory or ignored by git, and by which rule.
+func (g *gitAware) ignored(file string, dir bool) (bool, string) {
+	if filepath.Base(file) == ".git" {
+		return true, ".git"
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	worktree := g.worktree(filepath.Dir(file))
+	if worktree == "" {
+		return false, ""
+	}
+	var dirs []string
+	for d := filepath.Dir(file); ; d = filepath.Dir(d) {
+		dirs = append(dirs, d)
+		if d == worktree || d == filepath.Dir(d) {
+			break
+		}
+	}
+
+	/* last matching rule decides, those of deeper directories come later */
+	ignored, by := false, ""
+	match := func(base string, rules []ignoreRule, source string) {
+		rel, err := filepath.Rel(base, file)
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		for _, r := range rules {
+			if (!r.dir || dir) && r.re.MatchString(rel) {
+				ignored, by = !r.negate, fmt.Sprintf("%s of %s", r.line, source)
+			}
+		}
+	}
+	if repo := g.repo(worktree); repo != nil {
+		match(worktree, repo.exclude, filepath.Join(repo.common, "info", "exclude"))
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		match(dirs[i], g.gitignore(dirs[i]), filepath.Join(dirs[i], ".gitignore"))
+	}
+	return ignored, by
+}
+
+// gitignore returns the rules of the .gitignore of dir. Must be called holding mu.
+func (g *gitAware) gitignore(dir string) []ignoreRule {
+	rules, ok := g.ignores[dir]
+	if ok {
+		return rules
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dir, ".gitignore")); err == nil {
+		if rules, err = parseIgnore(data); err != nil {
+			logSink{}.warn("Failed to parse .gitignore", "path", dir, "error", err)
+		}
+	}
+	g.ignores[dir] = rules
+	return rules
+}
+
+// worktree returns the root of the checkout holding dir, "" if none. Must be called holding mu.
+func (g *gitAware) worktree(dir string) string {
+	if w, ok := g.worktrees[dir]; ok {
+		return w
+	}
+	var w string
+	if _, err := os.Lstat(filepath.Join(dir, ".git")); err == nil {
+		w = dir
+	} else if parent := filepath.Dir(dir); parent != dir {
+		w = g.worktree(parent)
+	}
+	g.worktrees[dir] = w
+	return w
+}
+
+// info returns what's known of file, false outside of checkouts.
+func (g *gitAware) info(file string) (GitInfo, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	worktree := g.worktree(filepath.Dir(file))
+	if worktree == "" {
+		return GitInfo{}, false
+	}
+	repo := g.repo(worktree)
+	if repo == nil {
+		return GitInfo{}, false
+	}
+	rel, err := filepath.Rel(worktree, file)
+	if err != nil {
+		return GitInfo{}, false
+	}
+	return GitInfo{
+		Worktree: worktree,
+		Tracked:  repo.tracked[filepath.ToSlash(rel)],
+		Branch:   repo.branch,
+		Commit:   repo.commit,
+	}, true
+}
+
+// enriched wraps n in a GitNotice if enriching and its file is within a checkout.
+func (g *gitAware) enriched(n Notice) Notice {
+	if g == nil || !g.enrich {
+		return n
+	}
+	info, ok := g.info(n.Name())
+	if !ok {
+		return n
+	}
+	return &gitNotice{Notice: n, git: info}
+}
+
+// gitRepo is what's read of the repository of a checkout.
+type gitRepo struct {
+	/* repository, and the one holding refs and info of linked worktrees */
+	dir, common string
+	exclude     []ignoreRule
+	branch      string
+	commit      string
+	/* paths in the index, slash separated relative to the checkout */
+	tracked map[string]bool
+	/* modification of the index as read */
+	indexMod time.Time
+	/* read during this walk */
+	fresh bool
+}
+
+// repo returns the repository of worktree, read again if changed, nil if unreadable. Must be called holding mu.
+func (g *gitAware) repo(worktree string) *gitRepo {
+	repo, ok := g.repos[worktree]
+	if !ok {
+		dir, err := gitDir(worktree)
+		if err != nil {
+			logSink{}.warn("Failed to find git repository", "path", worktree, "error", err)
+			g.repos[worktree] = nil
+			return nil
+		}
+		repo = &gitRepo{dir: dir, common: dir}
+		if data, err := ioutil.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+			common := strings.TrimSpace(string(data))
+			if !filepath.IsAbs(common) {
+				common = filepath.Join(dir, common)
+			}
+			repo.common = filepath.Clean(common)
+		}
+		if data, err := ioutil.ReadFile(filepath.Join(repo.common, "info", "exclude")); err == nil {
+			repo.exclude, _ = parseIgnore(data)
+		}
+		g.repos[worktree] = repo
+	}
+	if repo == nil || repo.fresh {
+		return repo
+	}
+	repo.fresh = true
+	repo.readHead()
+	if g.enrich {
+		repo.readIndex(worktree)
+	}
+	return repo
+}
+
+// gitDir returns the repository of worktree, following .git files of linked worktrees and submodules.
+func gitDir(worktree string) (string, error) {
+	dot := filepath.Join(worktree, ".git")
+	info, err := os.Stat(dot)
+	if err != nil || info.IsDir() {
+		return dot, err
+	}
+	data, err := ioutil.ReadFile(dot)
+	if err != nil {
+		return "", err
+	}
+	line := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(line, "gitdir: ") {
+		return "", fmt.Errorf("%s is not a gitdir link", dot)
+	}
+	dir := strings.TrimPrefix(line, "gitdir: ")
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(worktree, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// readIndex reads the paths tracked, unless the index is unchanged.
+func (r *gitRepo) readIndex(worktree string) {
+	index := filepath.Join(r.dir, "index")
+	info, err := os.Stat(index)
+	if err != nil {
+		r.tracked, r.indexMod = nil, time.Time{}
+		return
+	}
+	if r.tracked != nil && info.ModTime().Equal(r.indexMod) {
+		return
+	}
+	tracked, err := readGitIndex(index)
+	if err != nil {
+		logSink{}.warn("Failed to read git index", "path", worktree, "error", err)
+	}
+	r.tracked, r.indexMod = tracked, info.ModTime()
+}
+
+// readHead reads the branch and commit checked out.
+func (r *gitRepo) readHead() {
+	r.branch, r.commit = "", ""
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, "HEAD"))
+	if err != nil {
+		return
+	}
+	head := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(head, "ref: ") {
+		r.commit = head
+		return
+	}
+	ref := strings.TrimPrefix(head, "ref: ")
+	r.branch = strings.TrimPrefix(ref, "refs/heads/")
+	r.commit = r.resolve(ref)
+}
+
+// resolve returns the commit of ref, loose or packed, "" if unborn.
+func (r *gitRepo) resolve(ref string) string {
+	if data, err := ioutil.ReadFile(filepath.Join(r.common, filepath.FromSlash(ref))); err == nil {
+		return strings.TrimSpace(string(data))
+	}
+	f, err := os.Open(filepath.Join(r.common, "packed-refs"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) == 2 && fields[1] == ref {
+			return fields[0]
+		}
+	}
+	return ""
+}
+
+// readGitIndex returns the paths in the index file, of versions 2 to 4.
+func readGitIndex(file string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[:4]) != "DIRC" {
+		return nil, fmt.Errorf("%s is not a git index", file)
+	}
+	version := binary.BigEndian.Uint32(data[4:8])
+	if version < 2 || version > 4 {
+		return nil, fmt.Errorf("Git index version %d is not supported", version)
+	}
+	entries := int(binary.BigEndian.Uint32(data[8:12]))
+
+	tracked := make(map[string]bool, entries)
+	pos, name := 12, ""
+	for i := 0; i < entries; i++ {
+		/* stat data, mode, object ID and flags */
+		const fixed = 62
+		if pos+fixed > len(data) {
+			return nil, fmt.Errorf("%s is truncated", file)
+		}
+		start := pos
+		flags := binary.BigEndian.Uint16(data[pos+60 : pos+62])
+		pos += fixed
+		if version >= 3 && flags&0x4000 != 0 {
+			pos += 2
+		}
+		if version == 4 {
+			/* names strip a number of trailing bytes of the previous one */
+			strip, n := gitVarint(data[pos:])
+			if n == 0 || strip > len(name) {
+				return nil, fmt.Errorf("%s is corrupt", file)
+			}
+			pos += n
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("%s is truncated", file)
+			}
+			name = name[:len(name)-strip] + string(data[pos:pos+end])
+			pos += end + 1
+		} else {
+			end := bytes.IndexByte(data[pos:], 0)
+			if end < 0 {
+				return nil, fmt.Errorf("%s is truncated", file)
+			}
+			name = string(data[pos : pos+end])
+			/* entries are padded with 1 to 8 NULs to a multiple of 8 */
+			pos = start + (pos+end-start+8)&^7
+		}
+		tracked[name] = true
+	}
+	return tracked, nil
+}
+
+// gitVarint decodes the offset varint of git index entries, returning the bytes read, 0 if malformed.
+func gitVarint(data []byte) (int, int) {
+	if len(data) == 0 {
+		return 0, 0
+	}
+	val, i := int(data[0]&0x7f), 1
+	for c := data[0]; c&0x80 != 0; i++ {
+		if i >= len(data) {
+			return 0, 0
+		}
+		c = data[i]
+		val = (val+1)<<7 | int(c&0x7f)
+	}
+	return val, i
+}
@@ -0,0 +1,77 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	/* prefix of patterns in glob syntax, see CompilePattern */
+	glob_prefix = "glob:"
+	/* prefix of globs relative to the watched path */
+	rel_prefix = "rel:"
+)
+
+// WithGlobPatterns adds patterns in glob syntax, e.g. WithGlobPatterns("**/*.log", "configs/*.yaml").
+// Same as WithPatterns given the patterns prefixed by "glob:", see CompilePattern.
+func WithGlobPatterns(glob ...string) Option {
+	return func(o *options) error {
+		for _, g := range glob {
+			if _, err := CompilePattern(glob_prefix + g); err != nil {
+				return err
+			}
+			o.patterns = append(o.patterns, glob_prefix+g)
+		}
+		return nil
+	}
+}
+
+// CompilePattern compiles a pattern given to builtin Watchers, a regular expression found anywhere in paths,
+// or a glob prefixed by "glob:" matching the end of paths from a directory boundary on. * and ? don't match separators,
+// ** matches across directories and [...] matches a character class, e.g. "glob:**/*.log" matches every .log file,
+// "glob:configs/*.yaml" the .yaml files right inside every configs directory. Globs use / as separator on every platform.
+//
+// Globs prefixed by "rel:" match whole paths relative to the watched path instead, e.g. "rel:logs/**/*.log" matches
+// the .log files below the logs directory at the top of the watched path only, so one configuration behaves the
+// same on Windows and Unix deployments watching different paths. Builtin Watchers anchor them at the path they watch,
+// elsewhere, e.g. in Subscribe filters, they match relative paths only.
+func CompilePattern(pat string) (*regexp.Regexp, error) {
+	return compilePatternAt(pat, ".")
+}
+
+// compilePatternAt compiles pat as CompilePattern, with "rel:" globs relative to root.
+func compilePatternAt(pat, root string) (*regexp.Regexp, error) {
+	var glob, anchor string
+	switch {
+	case strings.HasPrefix(pat, glob_prefix):
+		glob = strings.TrimPrefix(pat, glob_prefix)
+	case strings.HasPrefix(pat, rel_prefix):
+		glob = strings.TrimPrefix(strings.TrimPrefix(pat, rel_prefix), "./")
+		glob = strings.TrimPrefix(glob, "/")
+	default:
+		return regexp.Compile(pat)
+	}
+	if glob == "" {
+		return nil, fmt.Errorf("Glob pattern must not be empty")
+	}
+	sep := "/"
+	if filepath.Separator != '/' {
+		sep += string(filepath.Separator)
+	}
+	separator := "[" + regexp.QuoteMeta(sep) + "]"
+
+	switch {
+	case !strings.HasPrefix(pat, rel_prefix):
+		anchor = "(?:^|" + separator + ")"
+	case root == ".":
+		anchor = "^"
+	case strings.ContainsRune(sep, rune(root[len(root)-1])):
+		/* the root of a file system */
+		anchor = "^" + regexp.QuoteMeta(root)
+	default:
+		anchor = "^" + regexp.QuoteMeta(root) + separator
+	}
+	return regexp.Compile(anchor + globSeparatorRegexp(glob, sep) + "$")
+}
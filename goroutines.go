@@ -0,0 +1,95 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// goroutines registers the goroutines of a Monitor by what they do, see Monitor.VerifyShutdown.
+type goroutines struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+// run runs f in a goroutine registered as name until it returns.
+func (g *goroutines) run(name string, f func()) {
+	g.enter(name)
+	go func() {
+		defer g.exit(name)
+		f()
+	}()
+}
+
+// enter registers a goroutine running as name, until exit.
+func (g *goroutines) enter(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running == nil {
+		g.running = make(map[string]int)
+	}
+	g.running[name]++
+}
+
+// exit unregisters a goroutine entered as name.
+func (g *goroutines) exit(name string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.running[name]--; g.running[name] <= 0 {
+		delete(g.running, name)
+	}
+}
+
+// list returns the goroutines running, by name with their number if several, in order of names.
+func (g *goroutines) list() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	names := make([]string, 0, len(g.running))
+	for name, count := range g.running {
+		if count > 1 {
+			name = fmt.Sprintf("%s (%d)", name, count)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// VerifyShutdown checks that the Monitor stopped and left none of its goroutines running, waiting up to timeout
+// for those about to return, e.g. in tests of services restarting Monitors. Once stopped Notices() and Batches()
+// are closed, and the Watcher goroutine, subscriptions, sinks, rescans and commands of rules must have returned.
+// Goroutines of a file system operation hung beyond the Timeout of its Profile are not the Monitor's,
+// see IgnoredGoroutines to tell them to leak checkers.
+func (m *Monitor) VerifyShutdown(timeout time.Duration) error {
+	select {
+	case <-m.stopped:
+	case <-time.After(timeout):
+		return fmt.Errorf("Monitor has not stopped")
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		running := m.goroutines.list()
+		if len(running) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Monitor left goroutines running: %s", strings.Join(running, ", "))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// IgnoredGoroutines returns the functions of goroutines allowed to outlive Stop, a file system operation hung beyond
+// the Timeout of its Profile keeps its goroutine until it returns. E.g. for go.uber.org/goleak:
+//
+//	var opts []goleak.Option
+//	for _, f := range fsmonitor.IgnoredGoroutines() {
+//		opts = append(opts, goleak.IgnoreAnyFunction(f))
+//	}
+//	goleak.VerifyNone(t, opts...)
+func IgnoredGoroutines() []string {
+	return []string{"github.com/Fiery/fsmonitor.(*Profile).timed.func1"}
+}
@@ -0,0 +1,115 @@
+package grpc
+
+import (
+	"fmt"
+
+	"github.com/Fiery/fsmonitor"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// notice is the Notice message of notice.proto.
+type notice struct {
+	fsmonitor.Notice
+}
+
+// codec encodes the messages of WatchService by hand, as fsmonitor does notices, and others by the protobuf runtime
+// as the "proto" codec of gRPC does, which it replaces.
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case *StreamRequest:
+		return v.marshal(), nil
+	case *notice:
+		return fsmonitor.MarshalNoticeProto(v.Notice)
+	}
+	m, err := message(v)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(m)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	switch v := v.(type) {
+	case *StreamRequest:
+		return v.unmarshal(data)
+	case *notice:
+		n, err := fsmonitor.UnmarshalNoticeProto(data)
+		if err != nil {
+			return err
+		}
+		v.Notice = n
+		return nil
+	}
+	m, err := message(v)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func (codec) Name() string {
+	return "proto"
+}
+
+// message returns v as message of the protobuf runtime.
+func message(v interface{}) (proto.Message, error) {
+	switch v := v.(type) {
+	case proto.Message:
+		return v, nil
+	case protoadapt.MessageV1:
+		return protoadapt.MessageV2Of(v), nil
+	}
+	return nil, fmt.Errorf("Message of type %T is no protobuf message", v)
+}
+
+// marshal encodes r as StreamRequest of watch.proto.
+func (r *StreamRequest) marshal() []byte {
+	var b []byte
+	if r.Events != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(r.Events))
+	}
+	for _, pattern := range r.Patterns {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, pattern)
+	}
+	return b
+}
+
+// unmarshal decodes b, a StreamRequest of watch.proto, into r, skipping unknown fields.
+func (r *StreamRequest) unmarshal(b []byte) error {
+	*r = StreamRequest{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("StreamRequest is malformed: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			var events uint64
+			events, n = protowire.ConsumeVarint(b)
+			r.Events = fsmonitor.Event(events)
+		case num == 2 && typ == protowire.BytesType:
+			var pattern string
+			pattern, n = protowire.ConsumeString(b)
+			r.Patterns = append(r.Patterns, pattern)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("StreamRequest is malformed: %v", protowire.ParseError(n))
+		}
+		b = b[n:]
+	}
+	return nil
+}
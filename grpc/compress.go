@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// Compressors are the compressors of streamed notices in order of preference, the first one the client supports
+// compresses the stream, none if it supports neither. Both are registered by this package, so clients in Go
+// importing it advertise them.
+var Compressors = []string{zstd_name, gzip.Name}
+
+/* name of the zstd compressor registered, replacing any registered before */
+const zstd_name = "zstd"
+
+func init() {
+	encoding.RegisterCompressor(zstdCompressor{})
+}
+
+// zstdCompressor implements encoding.Compressor by zstd.
+type zstdCompressor struct{}
+
+func (zstdCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+func (zstdCompressor) Decompress(r io.Reader) (io.Reader, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zstdReader{d}, nil
+}
+
+func (zstdCompressor) Name() string {
+	return zstd_name
+}
+
+// zstdReader releases its decoder once read to the end.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (r zstdReader) Read(p []byte) (int, error) {
+	n, err := r.Decoder.Read(p)
+	if err == io.EOF {
+		r.Decoder.Close()
+	}
+	return n, err
+}
+
+// compress compresses the responses of the call of ctx by the first of Compressors the client supports.
+func compress(ctx context.Context) error {
+	supported, err := grpclib.ClientSupportedCompressors(ctx)
+	if err != nil {
+		return err
+	}
+	for _, name := range Compressors {
+		for _, s := range supported {
+			if s == name {
+				return grpclib.SetSendCompressor(ctx, name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Package grpc serves the notices of a Monitor over gRPC, e.g. to a central collector subscribing to agents on many
+// hosts, by the WatchService of watch.proto:
+//
+//	server := grpc.NewServer(monitor, grpc.Config{TLS: tlsConfig})
+//	go server.Serve(listener)
+//	...
+//	stream, err := grpc.StreamNotices(ctx, conn, fsmonitor.Filter{Events: fsmonitor.FileCreate})
+//	for n, err := stream.Recv(); err == nil; n, err = stream.Recv() {
+//	...
+//
+// Notices are encoded by fsmonitor.MarshalNoticeProto as the Notice of notice.proto, so consumers in other languages
+// generate their clients from watch.proto and notice.proto by protoc. The messages of WatchService are encoded by
+// this package: it registers a "proto" codec taking them, leaving other messages to the protobuf runtime. Streams
+// are compressed by zstd or gzip as negotiated with the client, see Compressors.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/Fiery/fsmonitor"
+	grpclib "google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+/* full name of the method, see watch.proto */
+const stream_notices_method = "/fsmonitor.WatchService/StreamNotices"
+
+// Config of a server, all optional.
+type Config struct {
+	// Enables TLS, e.g. with client certificates verified by ClientCAs and ClientAuth, plaintext without
+	TLS *tls.Config
+	// Further options of the server, e.g. grpc.MaxConcurrentStreams, overridden by the settings above
+	Options []grpclib.ServerOption
+}
+
+// StreamRequest selects the notices streamed, see fsmonitor.Filter.
+type StreamRequest struct {
+	// Event types streamed, all without any
+	Events fsmonitor.Event
+	// Names must match any of the patterns, regular expressions or globs (see fsmonitor.CompilePattern), all names
+	// without patterns
+	Patterns []string
+}
+
+// watchService is the handler type of WatchService.
+type watchService interface {
+	streamNotices(req *StreamRequest, stream grpclib.ServerStream) error
+}
+
+var serviceDesc = grpclib.ServiceDesc{
+	ServiceName: "fsmonitor.WatchService",
+	HandlerType: (*watchService)(nil),
+	Streams: []grpclib.StreamDesc{{
+		StreamName:    "StreamNotices",
+		ServerStreams: true,
+		Handler: func(srv interface{}, stream grpclib.ServerStream) error {
+			req := new(StreamRequest)
+			if err := stream.RecvMsg(req); err != nil {
+				return err
+			}
+			return srv.(watchService).streamNotices(req, stream)
+		},
+	}},
+	Metadata: "watch.proto",
+}
+
+// server implements WatchService by subscriptions of a Monitor.
+type server struct {
+	m *fsmonitor.Monitor
+}
+
+// NewServer returns a gRPC server serving WatchService of m, see Register.
+func NewServer(m *fsmonitor.Monitor, c Config) *grpclib.Server {
+	options := c.Options[:len(c.Options):len(c.Options)]
+	if c.TLS != nil {
+		options = append(options, grpclib.Creds(credentials.NewTLS(c.TLS)))
+	}
+	s := grpclib.NewServer(options...)
+	Register(s, m)
+	return s
+}
+
+// Register adds WatchService of m to s, e.g. besides services of its own. StreamNotices streams the notices passing
+// the filter of the request as they are delivered by Start, until the client cancels or the Monitor stops. Notices
+// are streamed by subscriptions (see fsmonitor.Monitor.Subscribe), so Notices() of the Monitor must not be consumed
+// by anything else once serving, and a client falling behind by more than 1000 notices loses notices. Malformed
+// patterns fail the call by InvalidArgument. Notices are compressed by the first of Compressors the client supports.
+func Register(s grpclib.ServiceRegistrar, m *fsmonitor.Monitor) {
+	s.RegisterService(&serviceDesc, &server{m: m})
+}
+
+func (s *server) streamNotices(req *StreamRequest, stream grpclib.ServerStream) error {
+	sub, cancel, err := s.m.Subscribe(fsmonitor.Filter{Events: req.Events, Patterns: req.Patterns})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cancel()
+	if err := compress(stream.Context()); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+
+	for {
+		select {
+		case n, ok := <-sub:
+			if !ok {
+				return nil
+			}
+			if err := stream.SendMsg(&notice{n}); err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// NoticeStream receives the notices of a call of StreamNotices.
+type NoticeStream struct {
+	stream grpclib.ClientStream
+}
+
+// StreamNotices calls WatchService of the server at cc for the notices passing filter, Buffer aside. The call lasts
+// until ctx is done or the server ends it, see Register.
+func StreamNotices(ctx context.Context, cc grpclib.ClientConnInterface, filter fsmonitor.Filter) (*NoticeStream, error) {
+	stream, err := cc.NewStream(ctx, &serviceDesc.Streams[0], stream_notices_method)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&StreamRequest{Events: filter.Events, Patterns: filter.Patterns}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &NoticeStream{stream: stream}, nil
+}
+
+// Recv returns the next notice, decoded by fsmonitor.UnmarshalNoticeProto, io.EOF once the server ended the call.
+func (s *NoticeStream) Recv() (fsmonitor.Notice, error) {
+	var n notice
+	if err := s.stream.RecvMsg(&n); err != nil {
+		return nil, err
+	}
+	return n.Notice, nil
+}
@@ -0,0 +1,139 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	/* defaults of WithHandlerPool */
+	handler_workers = 4
+	handler_timeout = time.Minute
+)
+
+// handler is a function registered by Monitor.Handle.
+type handler struct {
+	events Event
+	fn     func(Notice)
+}
+
+// WithHandlerPool sets how many handlers registered by Monitor.Handle run at once, 4 by default, and how long
+// one may run for a notice, 1 minute by default, before the next notice is dispatched without waiting for it.
+func WithHandlerPool(workers int, timeout time.Duration) Option {
+	return func(o *options) error {
+		if workers <= 0 || timeout <= 0 {
+			return fmt.Errorf("Handler pool must have positive workers and timeout")
+		}
+		o.hdlWorkers, o.hdlTimeout = workers, timeout
+		return nil
+	}
+}
+
+// Handle registers fn to be called with every notice of events delivered by Start, all of them if 0, as an
+// alternative to consuming Notices(). Handlers are called from a pool of goroutines (see WithHandlerPool), so they
+// may run concurrently and out of order of notices, in order per path given WithOrdering. Panics are recovered and logged, handlers running past the
+// timeout are logged and left running. Handlers are a subscription (see Subscribe), so Notices() must not be
+// consumed by anything else once registering, and notices are dropped while handlers fall behind by more than
+// 1000. Stop waits for handlers running.
+func (m *Monitor) Handle(events Event, fn func(Notice)) {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, handler{events: events, fn: fn})
+	start := len(m.handlers) == 1
+	m.mu.Unlock()
+	if start {
+		m.dispatch()
+	}
+}
+
+// OnCreate registers fn to be called with every FileCreate notice, see Handle.
+func (m *Monitor) OnCreate(fn func(Notice)) {
+	m.Handle(FileCreate, fn)
+}
+
+// OnUpdate registers fn to be called with every FileUpdate notice, see Handle.
+func (m *Monitor) OnUpdate(fn func(Notice)) {
+	m.Handle(FileUpdate, fn)
+}
+
+// OnRemove registers fn to be called with every FileRemove notice, see Handle.
+func (m *Monitor) OnRemove(fn func(Notice)) {
+	m.Handle(FileRemove, fn)
+}
+
+// dispatch starts the pool calling handlers with the notices delivered.
+func (m *Monitor) dispatch() {
+	/* a filter without patterns can't fail */
+	notices, _, _ := m.Subscribe(Filter{})
+	workers, timeout := m.hdlWorkers, m.hdlTimeout
+	if workers == 0 {
+		workers, timeout = handler_workers, handler_timeout
+	}
+
+	type call struct {
+		fn func(Notice)
+		n  Notice
+	}
+	/* one queue per worker, so notices of a path go to the same given WithOrdering */
+	queues := 1
+	if m.order != nil {
+		queues = workers
+	}
+	calls := make([]chan call, queues)
+	for i := range calls {
+		calls[i] = make(chan call)
+	}
+	m.sinks.Add(workers + 1)
+	m.goroutines.run("handler dispatch", func() {
+		defer m.sinks.Done()
+		defer func() {
+			for _, c := range calls {
+				close(c)
+			}
+		}()
+		for n := range notices {
+			if n = m.aged(n, time.Now()); n == nil {
+				continue
+			}
+			m.mu.Lock()
+			handlers := m.handlers
+			m.mu.Unlock()
+			queue := calls[worker(n.Name(), queues)]
+			for _, h := range handlers {
+				if h.events == 0 || n.Type()&h.events != 0 {
+					queue <- call{fn: h.fn, n: n}
+				}
+			}
+		}
+	})
+	for i := 0; i < workers; i++ {
+		queue := calls[i%queues]
+		m.goroutines.run("handler worker", func() {
+			defer m.sinks.Done()
+			for c := range queue {
+				m.call(c.fn, c.n, timeout)
+			}
+		})
+	}
+}
+
+// call calls fn with n, waiting until it returns or timeout passed.
+func (m *Monitor) call(fn func(Notice), n Notice, timeout time.Duration) {
+	done := make(chan struct{})
+	m.goroutines.run("handler", func() {
+		defer close(done)
+		defer func() {
+			if r := recover(); r != nil {
+				m.logger.error("Handler panicked", "path", n.Name(), "event", n.Type(), "panic", r)
+			}
+		}()
+		fn(n)
+	})
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		m.logger.error("Handler timed out, left running", "path", n.Name(), "event", n.Type(), "timeout", timeout)
+	}
+}
@@ -0,0 +1,162 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	/* events telling a file appeared, went away, moved or changed, others don't change states */
+	history_created = FileCreate | DirCreate
+	history_removed = FileRemove | DirRemove
+	history_renamed = FileRename | DirRename
+	history_changed = FileUpdate | FileAttrib | StreamChanged | SymlinkRetargeted | SymlinkBroken
+)
+
+// History answers what files watched by the builtin "path" Watcher looked like, and what changed, at times past:
+// the state saved by WithSnapshots is the state as of the end of the journal given by WithJournal, and notices
+// journaled tell how files got there. Both are only read, e.g. by incident responders asking what /etc looked
+// like before an incident, while the Monitor runs or after it stopped.
+type History struct {
+	address   string
+	snapshots SnapshotStore
+	journal   CursorJournal
+}
+
+// NewHistory returns the History of address, watched by a Monitor given snapshots by WithSnapshots and journal by
+// WithJournal. FileJournal implements CursorJournal.
+func NewHistory(address string, snapshots SnapshotStore, journal CursorJournal) (*History, error) {
+	if snapshots == nil || journal == nil {
+		return nil, fmt.Errorf("History needs both snapshots and a journal")
+	}
+	return &History{address: canonicalAddress(address), snapshots: snapshots, journal: journal}, nil
+}
+
+// pathHistory is what the journal tells about the state of a path at a time.
+type pathHistory struct {
+	present bool
+	state   FileState
+	/* changed at or before the time, the last of those changes tells the state */
+	before bool
+	/* changed after the time, the first of those changes tells the state unless changed before */
+	after bool
+}
+
+// StateAt returns the files at or under path as of t, sorted by path, failing for times before the journal
+// starts. Files changed before t are told exactly, as are those created, removed or renamed first after it.
+// The state a file had before an update isn't journaled, so files updated after t, without changing before it,
+// are told by their state after that update.
+func (h *History) StateAt(path string, t time.Time) ([]FileState, error) {
+	path = filepath.Clean(path)
+	snapshot, err := h.snapshots.Load(h.address)
+	if err != nil {
+		return nil, err
+	}
+	if snapshot == nil {
+		return nil, fmt.Errorf("No snapshot of %s was saved", h.address)
+	}
+
+	var start time.Time
+	paths := make(map[string]*pathHistory)
+	/* change tells the state of p before and after a change at at, nil info where absent */
+	change := func(p string, at time.Time, before, after os.FileInfo) {
+		if !within(p, path) {
+			return
+		}
+		ph, ok := paths[p]
+		if !ok {
+			ph = &pathHistory{}
+			paths[p] = ph
+		}
+		switch {
+		case !at.After(t):
+			ph.before = true
+			ph.present, ph.state = after != nil, historyState(p, after)
+		case !ph.after:
+			ph.after = true
+			if !ph.before {
+				ph.present, ph.state = before != nil, historyState(p, before)
+			}
+		}
+	}
+	err = h.journal.ReplayFrom(time.Time{}, func(at time.Time, n Notice) error {
+		if start.IsZero() {
+			start = at
+		}
+		info, _ := n.More().(os.FileInfo)
+		if info == nil {
+			/* present either way, its state isn't known */
+			info = &recordInfo{name: filepath.Base(n.Name())}
+		}
+		switch ev := n.Type(); {
+		case ev&history_created != 0:
+			change(n.Name(), at, nil, info)
+		case ev&history_removed != 0:
+			change(n.Name(), at, info, nil)
+		case ev&history_renamed != 0:
+			if r, ok := n.More().(*RenameInfo); ok && r.OldPath != "" {
+				change(r.OldPath, at, info, nil)
+			}
+			change(n.Name(), at, nil, info)
+		case ev&history_changed != 0:
+			change(n.Name(), at, info, info)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if start.IsZero() || t.Before(start) {
+		return nil, fmt.Errorf("Journal of %s starts after %v, earlier states are unknown", h.address, t)
+	}
+
+	var files []FileState
+	for _, f := range snapshot {
+		if _, changed := paths[f.Path]; !changed && within(f.Path, path) {
+			files = append(files, f)
+		}
+	}
+	for _, ph := range paths {
+		if ph.present {
+			files = append(files, ph.state)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// ChangesBetween returns the notices of files at or under prefix journaled at or after t1 and before t2, in order.
+func (h *History) ChangesBetween(t1, t2 time.Time, prefix string) ([]Notice, error) {
+	prefix = filepath.Clean(prefix)
+	var changes []Notice
+	err := h.journal.ReplayFrom(t1, func(at time.Time, n Notice) error {
+		if !at.Before(t2) {
+			return errHistoryEnd
+		}
+		if within(n.Name(), prefix) {
+			changes = append(changes, n)
+		} else if r, ok := n.More().(*RenameInfo); ok && within(r.OldPath, prefix) {
+			/* moved out of prefix */
+			changes = append(changes, n)
+		}
+		return nil
+	})
+	if err != nil && err != errHistoryEnd {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// errHistoryEnd stops replaying the journal past the times asked for.
+var errHistoryEnd = fmt.Errorf("End of history")
+
+// historyState converts info of a journaled notice about file, the zero FileState if nil.
+func historyState(file string, info os.FileInfo) FileState {
+	if info == nil {
+		return FileState{}
+	}
+	return FileState{Path: file, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+}
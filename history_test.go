@@ -0,0 +1,93 @@
+package fsmonitor_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// TestHistory journals a file created, updated and another created then renamed, expecting the states between.
+func TestHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsmonitor-history-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	watched := filepath.Join(dir, "watched")
+	info := func(size int) os.FileInfo {
+		file := filepath.Join(dir, "info")
+		if err := ioutil.WriteFile(file, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fi
+	}
+	a, b, c := filepath.Join(watched, "a"), filepath.Join(watched, "b"), filepath.Join(watched, "c")
+
+	journal := fsmonitor.FileJournal(filepath.Join(dir, "journal"))
+	defer journal.Close()
+	start := time.Now()
+	at := func(i int) time.Time { return start.Add(time.Duration(i) * time.Second) }
+	for i, n := range []fsmonitor.Notice{
+		fsmonitor.NewNotice(a, fsmonitor.FileCreate, info(1)),
+		fsmonitor.NewNotice(b, fsmonitor.FileCreate, info(2)),
+		fsmonitor.NewNotice(c, fsmonitor.FileRename, &fsmonitor.RenameInfo{FileInfo: info(2), OldPath: b, NewPath: c}),
+		fsmonitor.NewNotice(a, fsmonitor.FileUpdate, info(3)),
+	} {
+		if err := journal.Append(at(i), n); err != nil {
+			t.Fatal(err)
+		}
+	}
+	snapshots := fsmonitor.DirSnapshots(filepath.Join(dir, "snapshots"))
+	if err := snapshots.Save(watched, []fsmonitor.FileState{{Path: a, Size: 3}, {Path: c, Size: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := fsmonitor.NewHistory(watched, snapshots, journal.(fsmonitor.CursorJournal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.StateAt(watched, start.Add(-time.Second)); err == nil {
+		t.Error("State before the journal starts told")
+	}
+	for i, expected := range []map[string]int64{
+		{a: 1},
+		{a: 1, b: 2},
+		{a: 1, c: 2},
+		{a: 3, c: 2},
+	} {
+		files, err := h.StateAt(watched, at(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make(map[string]int64)
+		for _, f := range files {
+			got[f.Path] = f.Size
+		}
+		if len(got) != len(expected) {
+			t.Errorf("State at %d is %v, expected %v", i, got, expected)
+			continue
+		}
+		for path, size := range expected {
+			if s, ok := got[path]; !ok || s != size {
+				t.Errorf("State at %d is %v, expected %v", i, got, expected)
+				break
+			}
+		}
+	}
+
+	changes, err := h.ChangesBetween(at(1), at(3), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Type() != fsmonitor.FileCreate || changes[1].Type() != fsmonitor.FileRename {
+		t.Errorf("Changes of %s are %v", b, changes)
+	}
+}
@@ -0,0 +1,304 @@
+// Package hotfolder ingests files dropped into a directory: every file is claimed once it stopped changing,
+// by moving it into a work directory, handed to a callback, and moved to a done or failed directory by its outcome.
+//
+// Claiming by rename makes sure a file is handled by one consumer only, even with several processes sharing Drop.
+// Files left in Work by a previous run, e.g. after a crash, are handled again first.
+package hotfolder
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Logger is used unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[Hotfolder] ", log.LstdFlags)
+
+// Handler handles a claimed file at path in the work directory, it's retried while returning an error.
+// ctx is done once Run is asked to return, a file whose handling is abandoned stays in the work directory.
+type Handler func(ctx context.Context, path string) error
+
+// Config of a hot folder, only Drop is required.
+type Config struct {
+	// Directory files are dropped into, files at its top level are ingested
+	Drop string
+	// Directories files are moved into when claimed, once handled and once failed for good,
+	// sub-directories "work", "done" and "failed" of Drop by default
+	Work   string
+	Done   string
+	Failed string
+	// Names must match any of the patterns, regular expressions or globs (see fsmonitor.CompilePattern),
+	// all files are ingested without patterns
+	Patterns []string
+	// Time a dropped file must keep its size and modification time before it's claimed, 5 seconds by default
+	Stable time.Duration
+	// Interval between scans of Drop, 1 second by default
+	Interval time.Duration
+	// Attempts to handle a file before it's moved to Failed, 3 by default
+	Attempts int
+	// Delay before the first retry, doubled for every further one, 1 second by default
+	Backoff time.Duration
+	// Files handled concurrently, 1 by default
+	Workers int
+	// Further options of the Monitor watching Drop
+	Options []fsmonitor.Option
+	Logger  *log.Logger
+}
+
+// withDefaults returns c with defaults filled in and absolute directories.
+func (c Config) withDefaults() (Config, error) {
+	if c.Drop == "" {
+		return c, fmt.Errorf("Drop directory must be given")
+	}
+	var err error
+	if c.Drop, err = filepath.Abs(c.Drop); err != nil {
+		return c, err
+	}
+	for dir, name := range map[*string]string{&c.Work: "work", &c.Done: "done", &c.Failed: "failed"} {
+		if *dir == "" {
+			*dir = filepath.Join(c.Drop, name)
+		}
+		if *dir, err = filepath.Abs(*dir); err != nil {
+			return c, err
+		}
+	}
+	if c.Stable <= 0 {
+		c.Stable = 5 * time.Second
+	}
+	if c.Interval <= 0 {
+		c.Interval = time.Second
+	}
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.Workers <= 0 {
+		c.Workers = 1
+	}
+	if c.Logger == nil {
+		c.Logger = Logger
+	}
+	return c, nil
+}
+
+// folder is the state of a running hot folder.
+type folder struct {
+	Config
+	handle  Handler
+	pattern []*regexp.Regexp
+	drop    os.FileInfo
+
+	/* dropped files not claimed yet, by the size and modification time last seen */
+	pending map[string]*observed
+
+	workers chan struct{}
+	running sync.WaitGroup
+}
+
+// observed is the state of a dropped file while waiting for it to stop changing.
+type observed struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+}
+
+// Run ingests files dropped into c.Drop by handle until ctx is done, then waits for handlers in progress.
+// Files already in Drop are ingested too. Returns an error if the configuration is invalid.
+func Run(ctx context.Context, c Config, handle Handler) error {
+	c, err := c.withDefaults()
+	if err != nil {
+		return err
+	}
+	f := &folder{
+		Config:  c,
+		handle:  handle,
+		pending: make(map[string]*observed),
+		workers: make(chan struct{}, c.Workers),
+	}
+	for _, pat := range c.Patterns {
+		re, err := fsmonitor.CompilePattern(pat)
+		if err != nil {
+			return fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+		f.pattern = append(f.pattern, re)
+	}
+	if f.drop, err = os.Stat(c.Drop); err != nil {
+		return err
+	}
+	for _, dir := range []string{c.Work, c.Done, c.Failed} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	opts := []fsmonitor.Option{
+		fsmonitor.WithPath(c.Drop),
+		fsmonitor.WithExcludes(exactly(c.Work), exactly(c.Done), exactly(c.Failed)),
+	}
+	m, err := fsmonitor.NewMonitor(append(opts, c.Options...)...)
+	if err != nil {
+		return err
+	}
+	watchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go m.StartContext(watchCtx, c.Interval, fsmonitor.FileCreate, fsmonitor.FileUpdate, fsmonitor.FileRename)
+
+	/* left over by a previous run, claimed already */
+	claimed, err := ioutil.ReadDir(c.Work)
+	if err != nil {
+		return err
+	}
+	for _, info := range claimed {
+		if !info.IsDir() {
+			f.process(ctx, filepath.Join(c.Work, info.Name()))
+		}
+	}
+	dropped, err := ioutil.ReadDir(c.Drop)
+	if err != nil {
+		return err
+	}
+	for _, info := range dropped {
+		f.dropped(filepath.Join(c.Drop, info.Name()))
+	}
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	notices := m.Notices()
+	for {
+		select {
+		case <-ctx.Done():
+			f.running.Wait()
+			return nil
+		case n, ok := <-notices:
+			if !ok {
+				notices = nil
+				continue
+			}
+			f.dropped(n.Name())
+		case now := <-ticker.C:
+			f.settle(ctx, now)
+		}
+	}
+}
+
+// exactly returns the pattern matching path only.
+func exactly(path string) string {
+	return "^" + regexp.QuoteMeta(path) + "$"
+}
+
+// dropped starts waiting for the file at path to stop changing, unless it isn't at the top level of Drop.
+func (f *folder) dropped(path string) {
+	if dir, err := os.Stat(filepath.Dir(path)); err != nil || !os.SameFile(dir, f.drop) || !f.matches(path) {
+		return
+	}
+	if _, ok := f.pending[path]; !ok {
+		f.pending[path] = nil
+	}
+}
+
+// matches reports whether path matches any of the patterns, all paths match without patterns.
+func (f *folder) matches(path string) bool {
+	for _, re := range f.pattern {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return len(f.pattern) == 0
+}
+
+// settle claims dropped files unchanged for Stable, forgetting those gone or not regular.
+func (f *folder) settle(ctx context.Context, now time.Time) {
+	for path, o := range f.pending {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			/* claimed by another consumer, or not a file to ingest */
+			delete(f.pending, path)
+			continue
+		}
+		if o == nil || info.Size() != o.size || !info.ModTime().Equal(o.modTime) {
+			f.pending[path] = &observed{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if now.Sub(o.since) < f.Stable {
+			continue
+		}
+		delete(f.pending, path)
+
+		work := unique(f.Work, filepath.Base(path))
+		if err := os.Rename(path, work); err != nil {
+			f.Logger.Printf("Failed to claim %s: %v", path, err)
+			continue
+		}
+		f.process(ctx, work)
+	}
+}
+
+// process handles the claimed file at path by a worker, retrying with backoff, then moves it to Done or Failed.
+func (f *folder) process(ctx context.Context, path string) {
+	f.running.Add(1)
+	go func() {
+		defer f.running.Done()
+		select {
+		case f.workers <- struct{}{}:
+			defer func() { <-f.workers }()
+		case <-ctx.Done():
+			return
+		}
+
+		backoff := f.Backoff
+		var err error
+		for attempt := 1; ; attempt++ {
+			if err = f.handle(ctx, path); err == nil {
+				f.move(path, f.Done)
+				return
+			}
+			f.Logger.Printf("Attempt %d of %d to handle %s failed: %v", attempt, f.Attempts, path, err)
+			if attempt == f.Attempts {
+				break
+			}
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				/* handled again by the next run */
+				return
+			}
+		}
+		if failed := f.move(path, f.Failed); failed != "" {
+			if err := ioutil.WriteFile(failed+".error", []byte(err.Error()+"\n"), 0644); err != nil {
+				f.Logger.Printf("Failed to record error of %s: %v", failed, err)
+			}
+		}
+	}()
+}
+
+// move moves the file at path into dir, returning its new path, empty if it failed.
+func (f *folder) move(path, dir string) string {
+	target := unique(dir, filepath.Base(path))
+	if err := os.Rename(path, target); err != nil {
+		f.Logger.Printf("Failed to move %s to %s: %v", path, dir, err)
+		return ""
+	}
+	return target
+}
+
+// unique returns the path of name in dir, suffixed by the current time if taken already.
+func unique(dir, name string) string {
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(name)
+	return filepath.Join(dir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), time.Now().UnixNano(), ext))
+}
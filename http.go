@@ -0,0 +1,262 @@
+package fsmonitor
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	/* a resource is removed once not found by that many scans in a row, so outages of the server aren't removals */
+	http_missing_scans = 3
+	http_timeout       = 30 * time.Second
+)
+
+// ResourceInfo is the os.FileInfo of resources watched by HTTPWatcher, returned by Notice.More.
+type ResourceInfo struct {
+	URL          string
+	ETag         string
+	LastModified time.Time
+	// -1 if not told
+	ContentLength int64
+}
+
+func (r *ResourceInfo) Name() string       { return r.URL }
+func (r *ResourceInfo) Size() int64        { return r.ContentLength }
+func (r *ResourceInfo) Mode() os.FileMode  { return 0444 }
+func (r *ResourceInfo) ModTime() time.Time { return r.LastModified }
+func (r *ResourceInfo) IsDir() bool        { return false }
+func (r *ResourceInfo) Sys() interface{}   { return nil }
+
+// changed reports whether the resource differs from old by ETag, Last-Modified or Content-Length.
+func (r *ResourceInfo) changed(old *ResourceInfo) bool {
+	return r.ETag != old.ETag || !r.LastModified.Equal(old.LastModified) || r.ContentLength != old.ContentLength
+}
+
+// HTTPWatcher returns a Watcher polling HTTP(S) resources, noticed by their URLs, e.g. remote configuration files
+// and feeds, for a Monitor given WithWatcher. Every scan requests the headers of every resource: FileUpdate is sent
+// when ETag, Last-Modified or Content-Length change, FileRemove once not found by 3 scans in a row, and FileCreate
+// when it appears. URLs ending in "/" are WebDAV collections, whose members are listed by PROPFIND every scan.
+// Other failures, e.g. unreachable servers, fail the scan keeping what was known. Requests time out after
+// 30 seconds if client is nil. Watchers of the same servers share connections given the HTTPClient of a ConnPool.
+func HTTPWatcher(urls []string, client *http.Client) (Watcher, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("URLs to watch must be given")
+	}
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return nil, fmt.Errorf("URL %q is malformed: %v", u, err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return nil, fmt.Errorf("URL %q must be of http or https scheme", u)
+		}
+	}
+	if client == nil {
+		client = &http.Client{Timeout: http_timeout}
+	}
+	return &httpScanner{urls: urls, client: client, missing: make(map[string]int)}, nil
+}
+
+// httpScanner implements Watcher by polling HTTP resources and WebDAV collections.
+type httpScanner struct {
+	urls      []string
+	client    *http.Client
+	lastCheck map[string]*ResourceInfo
+	/* scans in a row not finding a watched URL */
+	missing map[string]int
+}
+
+// Watch requests the watched URLs and sends changes since last check.
+func (h *httpScanner) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error) {
+		defer close(errors)
+
+		for changed := range ncc {
+			errors <- h.scan(changed)
+		}
+	}(ncc, errors)
+	return ncc, errors
+}
+
+// scan checks every watched URL and diffs what was found against lastCheck, the first scan baselines.
+func (h *httpScanner) scan(changed chan<- Notice) error {
+	current := make(map[string]*ResourceInfo)
+	var failed error
+	for _, u := range h.urls {
+		var found bool
+		var err error
+		if strings.HasSuffix(u, "/") {
+			found, err = h.propfind(u, current)
+		} else {
+			found, err = h.head(u, current)
+		}
+		if found {
+			delete(h.missing, u)
+			continue
+		}
+		if err == nil {
+			if h.missing[u]++; h.missing[u] >= http_missing_scans {
+				continue
+			}
+		} else {
+			failed = err
+		}
+		/* keep what was known until it's told */
+		for resource, info := range h.lastCheck {
+			if resource == u || strings.HasSuffix(u, "/") && strings.HasPrefix(resource, u) {
+				current[resource] = info
+			}
+		}
+	}
+
+	if h.lastCheck != nil {
+		h.diff(current, changed)
+	}
+	h.lastCheck = current
+	return failed
+}
+
+// diff sends notices of resources changed in current since lastCheck, in order of their URLs.
+func (h *httpScanner) diff(current map[string]*ResourceInfo, changed chan<- Notice) {
+	resources := make([]string, 0, len(current)+len(h.lastCheck))
+	for resource := range current {
+		resources = append(resources, resource)
+	}
+	for resource := range h.lastCheck {
+		if _, ok := current[resource]; !ok {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Strings(resources)
+
+	for _, resource := range resources {
+		info, ok := current[resource]
+		old, existed := h.lastCheck[resource]
+		var event Event
+		switch {
+		case !ok:
+			info, event = old, FileRemove
+		case !existed:
+			event = FileCreate
+		case info.changed(old):
+			event = FileUpdate
+		default:
+			continue
+		}
+		changed <- &fileSystemNotice{
+			path:      resource,
+			fileinfo:  info,
+			timestamp: time.Now(),
+			event:     event,
+		}
+	}
+}
+
+// head requests the headers of the resource at u into found, reporting whether it was found.
+// Servers not allowing HEAD are sent GET, without reading the body.
+func (h *httpScanner) head(u string, found map[string]*ResourceInfo) (bool, error) {
+	resp, err := h.client.Head(u)
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp.Body.Close()
+		resp, err = h.client.Get(u)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return false, nil
+	case resp.StatusCode >= 300:
+		return false, fmt.Errorf("Request of %s failed: %s", u, resp.Status)
+	}
+	info := &ResourceInfo{URL: u, ETag: resp.Header.Get("ETag"), ContentLength: resp.ContentLength}
+	info.LastModified, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	found[u] = info
+	return true, nil
+}
+
+// multistatus is the response of PROPFIND.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ETag          string    `xml:"DAV: getetag"`
+				LastModified  string    `xml:"DAV: getlastmodified"`
+				ContentLength string    `xml:"DAV: getcontentlength"`
+				Collection    *struct{} `xml:"DAV: resourcetype>collection"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfind_body = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><getetag/><getlastmodified/><getcontentlength/><resourcetype/></prop></propfind>`
+
+// propfind lists the members of the WebDAV collection at u into found, reporting whether it was found.
+// Nested collections are not listed.
+func (h *httpScanner) propfind(u string, found map[string]*ResourceInfo) (bool, error) {
+	base, _ := url.Parse(u)
+	req, err := http.NewRequest("PROPFIND", u, strings.NewReader(propfind_body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return false, nil
+	case resp.StatusCode != http.StatusMultiStatus:
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, fmt.Errorf("Listing of %s failed: %s", u, resp.Status)
+	}
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return false, fmt.Errorf("Listing of %s is malformed: %v", u, err)
+	}
+	for _, r := range ms.Responses {
+		href, err := base.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		info := &ResourceInfo{URL: href.String(), ContentLength: -1}
+		collection := false
+		for _, ps := range r.Propstat {
+			if !strings.Contains(ps.Status, " 200 ") {
+				continue
+			}
+			collection = ps.Prop.Collection != nil
+			info.ETag = ps.Prop.ETag
+			info.LastModified, _ = http.ParseTime(ps.Prop.LastModified)
+			if length, err := strconv.ParseInt(ps.Prop.ContentLength, 10, 64); err == nil {
+				info.ContentLength = length
+			}
+		}
+		if collection || info.URL == base.String() {
+			continue
+		}
+		found[info.URL] = info
+	}
+	return true, nil
+}
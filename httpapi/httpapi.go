@@ -0,0 +1,244 @@
+// Package httpapi exposes a Monitor over HTTP, e.g. to wire dashboards and browser clients to a running Monitor:
+//
+//	GET /notices  Server-Sent Events stream of notices, filtered by query parameters
+//	GET /status   statistics of the Monitor as JSON
+//	GET /noise    paths noticed the most and exclude patterns suggested, as JSON
+//	GET /query    SQL query of the files known to the Monitor, answered as JSON
+//	GET /sinks    statistics of the sinks attached, by name, as JSON
+//	DELETE /sinks/{name}  closes the sink attached by name, publishing what it buffered first
+//	GET /maintenance      maintenance windows declared and not expired yet, as JSON
+//	POST /maintenance     declares a maintenance window given as JSON, answered with its ID
+//	DELETE /maintenance/{id}  ends the maintenance window declared by POST early
+//
+// Notices are streamed by subscriptions (see fsmonitor.Monitor.Subscribe), so Notices() of the Monitor must not
+// be consumed by anything else once serving.
+package httpapi
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+const (
+	/* bytes of POSTed queries and maintenance windows read */
+	max_query_size  = 64 << 10
+	max_window_size = 4 << 10
+)
+
+// Heartbeat is the interval of comments sent on idle streams, so proxies don't close them.
+var Heartbeat = 15 * time.Second
+
+// Handler serves m:
+//
+// /notices streams every notice as an SSE event named by its event type, with the notice encoded by
+// fsmonitor.MarshalNotice as data and its ID, if identified, as event ID. Query parameters "event" select
+// event types by name (e.g. notice.FileCreate, several joined by "|" or repeated), "pattern" names matching
+// regular expressions or globs (repeated for any of several), all notices without either.
+//
+// /status returns fsmonitor.Stats as JSON.
+//
+// /noise returns the fsmonitor.NoiseReport of the Monitor as JSON, starting a new period if query parameter
+// "reset" is given, and 404 unless the Monitor was given fsmonitor.WithNoiseAnalysis.
+//
+// /query answers the SQL query given by query parameter "q" or a POST body by fsmonitor.Monitor.Query,
+// as a JSON object of "columns" and "rows", 400 if the query is malformed.
+//
+// /sinks returns fsmonitor.Stats.Sinks as JSON, a DELETE of /sinks/{name} closes the sink by
+// fsmonitor.Monitor.CloseSink, waiting as long as the request lasts: 204 once closed, 404 unless attached.
+//
+// /maintenance returns the windows of fsmonitor.Monitor.MaintenanceWindows as a JSON array of Window, a POST of
+// a Window declares one by fsmonitor.Monitor.Maintain, e.g. by deployment pipelines ahead of changing files,
+// answered by 201 with the Window and its ID, 400 if malformed. A DELETE of /maintenance/{id} ends that window
+// early: 204 once ended, 404 unless declared by this Handler and not expired.
+//
+// Expose /sinks and /maintenance to administrators only, e.g. behind an authenticating proxy.
+func Handler(m *fsmonitor.Monitor) http.Handler {
+	mux := http.NewServeMux()
+	windows := &maintenance{ends: make(map[string]declared)}
+	mux.HandleFunc("/notices", func(w http.ResponseWriter, r *http.Request) {
+		notices(m, w, r)
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(m.Stats()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/noise", func(w http.ResponseWriter, r *http.Request) {
+		_, reset := r.URL.Query()["reset"]
+		report, err := m.Noise(reset)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		query(m, w, r)
+	})
+	mux.HandleFunc("/sinks", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		sinks := m.Stats().Sinks
+		if sinks == nil {
+			sinks = map[string]fsmonitor.SinkStats{}
+		}
+		if err := json.NewEncoder(w).Encode(sinks); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+	mux.HandleFunc("/sinks/", func(w http.ResponseWriter, r *http.Request) {
+		closeSink(m, w, r)
+	})
+	mux.HandleFunc("/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		windows.serve(m, w, r)
+	})
+	mux.HandleFunc("/maintenance/", func(w http.ResponseWriter, r *http.Request) {
+		windows.end(w, r)
+	})
+	return mux
+}
+
+// closeSink closes the sink named by the path of r.
+func closeSink(m *fsmonitor.Monitor, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, "Sinks are closed by DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/sinks/")
+	if _, ok := m.Stats().Sinks[name]; !ok {
+		http.Error(w, fmt.Sprintf("Sink %q is not attached", name), http.StatusNotFound)
+		return
+	}
+	if err := m.CloseSink(r.Context(), name); err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// query answers the query given by r.
+func query(m *fsmonitor.Monitor, w http.ResponseWriter, r *http.Request) {
+	sql := r.URL.Query().Get("q")
+	if r.Method == http.MethodPost {
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, max_query_size))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sql = string(body)
+	}
+	if _, err := fsmonitor.ParseQuery(sql); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := m.Query(sql)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// notices streams notices passing the filter given by the query of r until the client goes away.
+func notices(m *fsmonitor.Monitor, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	var filter fsmonitor.Filter
+	for _, name := range r.URL.Query()["event"] {
+		event, err := fsmonitor.ParseEvent(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Events |= event
+	}
+	filter.Patterns = r.URL.Query()["pattern"]
+
+	sub, cancel, err := m.Subscribe(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Add("Vary", "Accept-Encoding")
+	var out io.Writer = w
+	flush := flusher.Flush
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		/* every event is flushed through, so compression carries over between events only */
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		out = gz
+		flush = func() {
+			gz.Flush()
+			flusher.Flush()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case n, ok := <-sub:
+			if !ok {
+				return
+			}
+			data, err := fsmonitor.MarshalNotice(n)
+			if err != nil {
+				fmt.Fprintf(out, ": notice %v failed encoding: %v\n\n", n, err)
+				continue
+			}
+			var i fsmonitor.IdentifiedNotice
+			if fsmonitor.NoticeAs(n, &i) {
+				fmt.Fprintf(out, "id: %s\n", i.ID())
+			}
+			fmt.Fprintf(out, "event: %s\ndata: %s\n\n", n.Type(), data)
+		case <-heartbeat.C:
+			fmt.Fprint(out, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			return
+		}
+		flush()
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header accepts gzip.
+func acceptsGzip(header string) bool {
+	for _, coding := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		q := strings.TrimSpace(params)
+		if !strings.HasPrefix(q, "q=") {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q[len("q="):], 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
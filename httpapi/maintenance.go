@@ -0,0 +1,129 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// Window is a maintenance window as served by /maintenance, see fsmonitor.MaintenanceWindow.
+type Window struct {
+	// Assigned when declared by POST, ends the window by DELETE of /maintenance/{id}
+	ID     string `json:"id,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Now unless given
+	Start time.Time `json:"start"`
+	// Either End or Duration from Start, e.g. "30m", must be given when declaring
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration,omitempty"`
+	Suppress bool      `json:"suppress,omitempty"`
+	Reason   string    `json:"reason,omitempty"`
+}
+
+// maintenance keeps the windows declared by POST, so they're ended by ID.
+type maintenance struct {
+	mu   sync.Mutex
+	next uint64
+	ends map[string]declared
+}
+
+// declared is a window declared by POST, ended by end.
+type declared struct {
+	expires time.Time
+	end     func()
+}
+
+// serve lists maintenance windows, or declares one given by a POST.
+func (d *maintenance) serve(m *fsmonitor.Monitor, w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		windows := []Window{}
+		for _, mw := range m.MaintenanceWindows() {
+			windows = append(windows, Window{Prefix: mw.Prefix, Start: mw.Start, End: mw.End, Suppress: mw.Suppress, Reason: mw.Reason})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(windows); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		d.declare(m, w, r)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "Maintenance windows are listed by GET and declared by POST", http.StatusMethodNotAllowed)
+	}
+}
+
+// declare declares the maintenance window POSTed by r.
+func (d *maintenance) declare(m *fsmonitor.Monitor, w http.ResponseWriter, r *http.Request) {
+	var win Window
+	if err := json.NewDecoder(io.LimitReader(r.Body, max_window_size)).Decode(&win); err != nil {
+		http.Error(w, fmt.Sprintf("Malformed maintenance window: %v", err), http.StatusBadRequest)
+		return
+	}
+	if win.Start.IsZero() {
+		win.Start = time.Now()
+	}
+	if win.Duration != "" {
+		duration, err := time.ParseDuration(win.Duration)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Malformed maintenance window duration: %v", err), http.StatusBadRequest)
+			return
+		}
+		win.End = win.Start.Add(duration)
+	}
+	end, err := m.Maintain(fsmonitor.MaintenanceWindow{Prefix: win.Prefix, Start: win.Start, End: win.End, Suppress: win.Suppress, Reason: win.Reason})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	d.mu.Lock()
+	d.prune(time.Now())
+	d.next++
+	win.ID = strconv.FormatUint(d.next, 10)
+	d.ends[win.ID] = declared{expires: win.End, end: end}
+	d.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/maintenance/"+win.ID)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(&win)
+}
+
+// end ends the maintenance window whose ID is the last element of the path of r.
+func (d *maintenance) end(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", http.MethodDelete)
+		http.Error(w, "Maintenance windows are ended by DELETE", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/maintenance/")
+
+	d.mu.Lock()
+	d.prune(time.Now())
+	win, ok := d.ends[id]
+	delete(d.ends, id)
+	d.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("Maintenance window %q is not declared", id), http.StatusNotFound)
+		return
+	}
+	win.end()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// prune forgets windows expired by now, called holding d.mu.
+func (d *maintenance) prune(now time.Time) {
+	for id, win := range d.ends {
+		if !now.Before(win.expires) {
+			delete(d.ends, id)
+		}
+	}
+}
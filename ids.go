@@ -0,0 +1,122 @@
+package fsmonitor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// IDGenerator assigns every notice the ID downstream systems deduplicate it by, see WithIDs.
+type IDGenerator interface {
+	ID(n Notice) string
+}
+
+// IDFunc implements IDGenerator by a function.
+type IDFunc func(n Notice) string
+
+func (f IDFunc) ID(n Notice) string {
+	return f(n)
+}
+
+var (
+	// UUIDv7 generates time ordered random UUIDs, unique for every notice.
+	UUIDv7 IDGenerator = IDFunc(uuidv7)
+	// ULID generates time ordered random ULIDs, unique for every notice.
+	ULID IDGenerator = IDFunc(ulid)
+	// ContentKey hashes path, event, size and modification time, so the same change noticed twice,
+	// e.g. by two processes or after a restart, has the same idempotency key.
+	ContentKey IDGenerator = IDFunc(contentKey)
+)
+
+// IdentifiedNotice is implemented by notices of Monitors given an IDGenerator by WithIDs.
+type IdentifiedNotice interface {
+	Notice
+	ID() string
+}
+
+// identifiedNotice implements IdentifiedNotice by wrapping the discovered Notice.
+type identifiedNotice struct {
+	Notice
+	id string
+}
+
+func (i *identifiedNotice) Unwrap() Notice {
+	return i.Notice
+}
+
+func (i *identifiedNotice) ID() string {
+	return i.id
+}
+
+// WithIDs assigns every delivered notice an ID generated by g, notices implement IdentifiedNotice.
+// MarshalNotice encodes the ID, so sinks can pass it on as idempotency key.
+func WithIDs(g IDGenerator) Option {
+	return func(o *options) error {
+		if g == nil {
+			return fmt.Errorf("IDGenerator must not be nil")
+		}
+		o.ids = g
+		return nil
+	}
+}
+
+// ParseIDGenerator returns one of the builtin IDGenerators by name: "uuidv7", "ulid" or "content".
+func ParseIDGenerator(name string) (IDGenerator, error) {
+	switch name {
+	case "uuidv7":
+		return UUIDv7, nil
+	case "ulid":
+		return ULID, nil
+	case "content":
+		return ContentKey, nil
+	}
+	return nil, fmt.Errorf("ID generator not recognized: %q", name)
+}
+
+// timeRandom returns 16 bytes starting with milliseconds since epoch of t in 48 bits, followed by random bits.
+func timeRandom(t time.Time) [16]byte {
+	var b [16]byte
+	rand.Read(b[6:])
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixNano()/int64(time.Millisecond))<<16|uint64(binary.BigEndian.Uint16(b[6:8])))
+	return b
+}
+
+func uuidv7(n Notice) string {
+	b := timeRandom(time.Now())
+	b[6] = b[6]&0x0f | 0x70
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// crockford is the base32 alphabet of ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+func ulid(n Notice) string {
+	b := timeRandom(time.Now())
+	v := new(big.Int).SetBytes(b[:])
+	mod := new(big.Int)
+	base := big.NewInt(32)
+
+	var s [26]byte
+	for i := len(s) - 1; i >= 0; i-- {
+		v.DivMod(v, base, mod)
+		s[i] = crockford[mod.Int64()]
+	}
+	return string(s[:])
+}
+
+func contentKey(n Notice) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%v\x00", n.Name(), n.Type())
+	if info, ok := n.More().(os.FileInfo); ok && info != nil {
+		fmt.Fprintf(h, "%d\x00%d", info.Size(), info.ModTime().UnixNano())
+	} else {
+		fmt.Fprintf(h, "%d", n.Time().UnixNano())
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
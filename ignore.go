@@ -0,0 +1,194 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WithExcludes makes the builtin "path" Watcher skip paths matching any of the patterns, even if included.
+// Excluded directories aren't walked at all, e.g. WithExcludes(`/node_modules$`, `glob:*.tmp`), see CompilePattern.
+func WithExcludes(pattern ...string) Option {
+	return func(o *options) error {
+		for _, pat := range pattern {
+			if _, err := CompilePattern(pat); err != nil {
+				return fmt.Errorf("Exclude pattern failed compilation, please check syntax! %v", err)
+			}
+		}
+		o.excludes = append(o.excludes, pattern...)
+		return nil
+	}
+}
+
+// WithIgnoreFile makes the builtin "path" Watcher skip paths listed in the file of that name
+// at the watched address, e.g. ".fsmonitorignore", in gitignore syntax. The file is read before every walk.
+func WithIgnoreFile(name string) Option {
+	return func(o *options) error {
+		if name == "" || strings.ContainsRune(name, filepath.Separator) {
+			return fmt.Errorf("Ignore file must be a file name")
+		}
+		o.ignoreFile = name
+		return nil
+	}
+}
+
+// ignoreRule is a line of an ignore file.
+type ignoreRule struct {
+	line   string
+	re     *regexp.Regexp
+	negate bool
+	/* only matches directories */
+	dir bool
+}
+
+// parseIgnore parses gitignore syntax: blank lines and # comments are skipped, ! negates,
+// a trailing / matches directories only, and patterns with a / other than trailing are relative to the root.
+func parseIgnore(data []byte) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		r := ignoreRule{line: text}
+		if strings.HasPrefix(text, "!") {
+			r.negate, text = true, text[1:]
+		} else if strings.HasPrefix(text, `\`) {
+			text = text[1:]
+		}
+		if strings.HasSuffix(text, "/") {
+			r.dir, text = true, strings.TrimRight(text, "/")
+		}
+
+		prefix := "^(?:.*/)?"
+		if strings.Contains(text, "/") {
+			prefix, text = "^", strings.TrimPrefix(text, "/")
+		}
+		re, err := regexp.Compile(prefix + globRegexp(text) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("Line %d is not a valid pattern: %v", line, err)
+		}
+		r.re = re
+		rules = append(rules, r)
+	}
+	return rules, scanner.Err()
+}
+
+// globRegexp translates glob syntax into a regular expression matching slash separated paths:
+// * and ? don't match /, ** matches across directories, [...] matches a character class.
+func globRegexp(glob string) string {
+	return globSeparatorRegexp(glob, "/")
+}
+
+// globSeparatorRegexp translates glob syntax as globRegexp, matching any of the characters of sep as separators.
+func globSeparatorRegexp(glob, sep string) string {
+	separator, other := "["+regexp.QuoteMeta(sep)+"]", "[^"+regexp.QuoteMeta(sep)+"]"
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*" + separator + ")?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString(other + "*")
+		case c == '?':
+			b.WriteString(other)
+		case c == '/':
+			b.WriteString(separator)
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.Replace(class, `\`, `\\`, -1) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// loadIgnore reads the ignore file at the watched address, if any.
+func (s *pathScanner) loadIgnore() {
+	if s.ignoreFile == "" {
+		return
+	}
+	s.ignore = nil
+	resolved, err := s.resolve(s.address)
+	if err != nil {
+		return
+	}
+	data, err := ioutil.ReadFile(filepath.Join(resolved, s.ignoreFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			s.logger.error("Failed to read ignore file", "path", s.ignoreFile, "error", err)
+		}
+		return
+	}
+	if s.ignore, err = parseIgnore(data); err != nil {
+		s.logger.error("Ignore file is ignored", "path", s.ignoreFile, "error", err)
+	}
+}
+
+// excluded reports whether file is skipped by exclude patterns or the ignore file, and by which.
+func (s *pathScanner) excluded(file string, dir bool) (bool, string) {
+	if file == s.address {
+		return false, ""
+	}
+	for _, re := range s.exclude {
+		if re.FindStringIndex(file) != nil {
+			return true, re.String()
+		}
+	}
+	if s.git != nil {
+		if ignored, by := s.git.ignored(file, dir); ignored {
+			return true, by
+		}
+	}
+	if len(s.ignore) == 0 {
+		return false, ""
+	}
+	rel, err := filepath.Rel(s.address, file)
+	if err != nil {
+		return false, ""
+	}
+	rel = filepath.ToSlash(rel)
+
+	/* last matching rule decides */
+	ignored, by := false, ""
+	for _, r := range s.ignore {
+		if (!r.dir || dir) && r.re.MatchString(rel) {
+			ignored, by = !r.negate, r.line
+		}
+	}
+	if ignored {
+		by = fmt.Sprintf("%s of %s", by, s.ignoreFile)
+	}
+	return ignored, by
+}
+
+// excludedPath reports whether path or any directory above it under the watched address is excluded.
+func (s *pathScanner) excludedPath(path string) (bool, string) {
+	for dir := filepath.Dir(path); within(dir, s.address) && dir != s.address; dir = filepath.Dir(dir) {
+		if ok, by := s.excluded(dir, true); ok {
+			return true, by
+		}
+	}
+	return s.excluded(path, false)
+}
@@ -0,0 +1,296 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFormat identifies logs of other tools read by ImportLog and ImportWatcher.
+type LogFormat int
+
+const (
+	// Output of inotifywait -m in its default format ("%w %,e %f"). A leading Unix time field,
+	// e.g. by --timefmt %s --format '%T %w %,e %f', is taken as timestamp, otherwise time of reading is.
+	InotifywaitLog LogFormat = iota
+	// Output of inotifywait -m --csv
+	InotifywaitCSVLog
+	// Records of auditd, e.g. /var/log/audit/audit.log
+	AuditLog
+)
+
+var logFormatName = map[LogFormat]string{
+	InotifywaitLog:    "inotifywait",
+	InotifywaitCSVLog: "inotifywait-csv",
+	AuditLog:          "auditd",
+}
+
+// String implements fmt.Stringer.
+func (f LogFormat) String() string {
+	return logFormatName[f]
+}
+
+// ParseLogFormat converts the output of LogFormat.String() back into a LogFormat.
+func ParseLogFormat(s string) (LogFormat, error) {
+	for f, name := range logFormatName {
+		if name == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("Log format not recognized: %q", s)
+}
+
+// logParser converts lines of a log into notices, keeping state across lines of multi-line records.
+type logParser interface {
+	// Returns nil for lines not describing a file change
+	parse(line string) Notice
+}
+
+func newLogParser(format LogFormat, key string) (logParser, error) {
+	switch format {
+	case InotifywaitLog:
+		return inotifywaitParser{}, nil
+	case InotifywaitCSVLog:
+		return inotifywaitParser{csv: true}, nil
+	case AuditLog:
+		return &auditParser{key: key, events: make(map[string]*auditEvent)}, nil
+	}
+	return nil, fmt.Errorf("Log format not recognized: %d", format)
+}
+
+// ImportLog reads a log of inotifywait or auditd and passes every file change in it to emit, in log order,
+// e.g. to backfill a pipeline with history recorded before migrating to fsmonitor.
+// For AuditLog, only records tagged with key are imported unless key is empty, notices implement ActorNotice.
+func ImportLog(r io.Reader, format LogFormat, key string, emit func(Notice)) error {
+	p, err := newLogParser(format, key)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if n := p.parse(scanner.Text()); n != nil {
+			emit(n)
+		}
+	}
+	return scanner.Err()
+}
+
+// ImportWatcher creates a Watcher reading file changes from a log of inotifywait or auditd instead of scanning,
+// so deployments can move their existing tooling onto fsmonitor pipelines. The first scan sends the history
+// already in the log, later ones what has been appended since, see ImportLog.
+func ImportWatcher(logfile string, format LogFormat, key string) (Watcher, error) {
+	p, err := newLogParser(format, key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(logfile)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return &logWatcher{logfile: logfile, parser: p}, nil
+}
+
+// logWatcher implements Watcher by following a log file.
+type logWatcher struct {
+	logfile string
+	parser  logParser
+	/* end of the last complete line read */
+	offset int64
+}
+
+// Watch reads lines appended to the log since last check.
+func (l *logWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error) {
+		defer close(errors)
+
+		for changed := range ncc {
+			errors <- l.read(changed)
+		}
+	}(ncc, errors)
+
+	return ncc, errors
+}
+
+// read sends notices of complete lines after offset, starting over when the log was truncated or rotated.
+func (l *logWatcher) read(changed chan<- Notice) error {
+	f, err := os.Open(l.logfile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil {
+		return err
+	} else if info.Size() < l.offset {
+		logSink{}.info("Log was truncated, reading from the beginning", "path", l.logfile)
+		l.offset = 0
+	}
+	if _, err := f.Seek(l.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			/* partial line is read again once complete */
+			return nil
+		} else if err != nil {
+			return err
+		}
+		l.offset += int64(len(line))
+		if n := l.parser.parse(strings.TrimRight(line, "\r\n")); n != nil {
+			changed <- n
+		}
+	}
+}
+
+// inotifywaitEvent maps inotify event names to events, others aren't file changes.
+var inotifywaitEvent = map[string]Event{
+	"CREATE":      FileCreate,
+	"MODIFY":      FileUpdate,
+	"CLOSE_WRITE": FileUpdate,
+	"ATTRIB":      FileUpdate,
+	"DELETE":      FileRemove,
+	"DELETE_SELF": FileRemove,
+	"MOVED_FROM":  FileRename,
+	"MOVED_TO":    FileRename,
+	"MOVE_SELF":   FileRename,
+}
+
+// inotifywaitParser parses lines of inotifywait -m, e.g.:
+// /srv/data/ CLOSE_WRITE,CLOSE report.csv
+// /srv/data/,"CLOSE_WRITE,CLOSE",report.csv
+type inotifywaitParser struct {
+	csv bool
+}
+
+func (p inotifywaitParser) parse(line string) Notice {
+	timestamp := time.Now()
+	fields := strings.SplitN(line, " ", 3)
+	if p.csv {
+		record, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil {
+			return nil
+		}
+		fields = record
+	} else if sec, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+		/* directories are printed with trailing separator, so never parse as time */
+		timestamp = time.Unix(sec, 0)
+		fields = strings.SplitN(line, " ", 4)[1:]
+	}
+	if len(fields) < 2 {
+		return nil
+	}
+
+	var event Event
+	for _, name := range strings.Split(fields[1], ",") {
+		if name == "ISDIR" {
+			return nil
+		}
+		if e, ok := inotifywaitEvent[name]; ok && event == 0 {
+			event = e
+		}
+	}
+	if event == 0 {
+		return nil
+	}
+
+	/* file name is empty for events on the watched file itself */
+	path := fields[0]
+	if len(fields) > 2 && fields[2] != "" {
+		path = filepath.Join(path, fields[2])
+	}
+	return &fileSystemNotice{
+		path:      filepath.Clean(path),
+		event:     event,
+		timestamp: timestamp,
+	}
+}
+
+// auditNameType maps nametype of PATH records to events, others aren't file changes.
+var auditNameType = map[string]Event{
+	"CREATE": FileCreate,
+	"NORMAL": FileUpdate,
+	"DELETE": FileRemove,
+}
+
+// auditParser parses auditd records, e.g.:
+// type=SYSCALL msg=audit(1364481363.243:24287): ... success=yes ... pid=2686 auid=500 uid=0 ... exe="/bin/vi" key="fsmonitor"
+// type=CWD msg=audit(1364481363.243:24287): cwd="/root"
+// type=PATH msg=audit(1364481363.243:24287): item=0 name="/etc/passwd" ... nametype=NORMAL
+// Records of one syscall share the serial in msg=audit(time:serial).
+type auditParser struct {
+	key    string
+	events map[string]*auditEvent
+}
+
+func (p *auditParser) parse(line string) Notice {
+	fields := auditFields(line)
+	stamp := fields["msg"]
+	if !strings.HasPrefix(stamp, "audit(") {
+		return nil
+	}
+	stamp = strings.TrimSuffix(strings.TrimPrefix(stamp, "audit("), "):")
+	sep := strings.LastIndex(stamp, ":")
+	if sep < 0 {
+		return nil
+	}
+	serial := stamp[sep+1:]
+
+	switch fields["type"] {
+	case "SYSCALL":
+		if fields["success"] == "no" || p.key != "" && fields["key"] != p.key {
+			return nil
+		}
+		if len(p.events) >= audit_pending_limit {
+			p.events = make(map[string]*auditEvent)
+		}
+		actor := &Actor{Exe: fields["exe"]}
+		actor.UID, _ = strconv.Atoi(fields["uid"])
+		actor.AUID, _ = strconv.Atoi(fields["auid"])
+		actor.PID, _ = strconv.Atoi(fields["pid"])
+		if sec, err := strconv.ParseFloat(stamp[:sep], 64); err == nil {
+			actor.Time = time.Unix(0, int64(sec*float64(time.Second)))
+		}
+		p.events[serial] = &auditEvent{actor: actor}
+	case "CWD":
+		if ev, ok := p.events[serial]; ok {
+			ev.cwd = fields["cwd"]
+		}
+	case "PATH":
+		ev, ok := p.events[serial]
+		if !ok {
+			return nil
+		}
+		event, ok := auditNameType[fields["nametype"]]
+		name := fields["name"]
+		if !ok || name == "" || name == "(null)" {
+			return nil
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(ev.cwd, name)
+		}
+		return &actorNotice{
+			Notice: &fileSystemNotice{
+				path:      filepath.Clean(name),
+				event:     event,
+				timestamp: ev.actor.Time,
+			},
+			actor: ev.actor,
+		}
+	case "EOE":
+		delete(p.events, serial)
+	}
+	return nil
+}
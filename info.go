@@ -0,0 +1,56 @@
+package fsmonitor
+
+import (
+	"os"
+	"time"
+)
+
+// NoticeInfo is the typed metadata of a notice returned by InfoOf, fields the notice doesn't tell are zero.
+type NoticeInfo struct {
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+	// Checksum of the content, e.g. "sha256:<hex>", see Checksummer
+	Checksum string
+	// Path before FileRename, DirRename and MoveDetected, see RenameInfo and MoveInfo
+	OldPath string
+	// Watched path of Monitors watching several, see RootedNotice
+	Root string
+}
+
+// InfoNotice is implemented by notices telling their typed metadata, as those of this package do. Notices
+// implemented elsewhere needn't, see InfoOf.
+type InfoNotice interface {
+	Notice
+	// Typed metadata, also of notices found through wrapping ones
+	Info() NoticeInfo
+}
+
+// InfoOf returns the typed metadata of n instead of asserting the type of Notice.More: told by n if it implements
+// InfoNotice, derived from what More returns otherwise, the metadata of an os.FileInfo, the checksum of a
+// Checksummer and the old path of a RenameInfo or MoveInfo.
+func InfoOf(n Notice) NoticeInfo {
+	if i, ok := n.(InfoNotice); ok {
+		return i.Info()
+	}
+	return moreInfo(n.More())
+}
+
+// moreInfo returns the NoticeInfo told by more, as returned by Notice.More.
+func moreInfo(more interface{}) NoticeInfo {
+	var i NoticeInfo
+	if info, ok := more.(os.FileInfo); ok && info != nil {
+		i.Size, i.Mode, i.ModTime, i.IsDir = info.Size(), info.Mode(), info.ModTime(), info.IsDir()
+	}
+	if c, ok := more.(Checksummer); ok && c != nil {
+		i.Checksum = c.Checksum()
+	}
+	switch more := more.(type) {
+	case *RenameInfo:
+		i.OldPath = more.OldPath
+	case *MoveInfo:
+		i.OldPath = more.OldPath
+	}
+	return i
+}
@@ -0,0 +1,42 @@
+package fsmonitor
+
+import (
+	"fmt"
+)
+
+// InitialScan is what the first scan of a builtin Watcher does with the files found, see WithInitialScan.
+type InitialScan int
+
+const (
+	// Baselines them without notices, only changes from the next scan on are sent
+	SuppressExisting InitialScan = iota
+	// Sends every file as FileCreate, e.g. for consumers to index all current files on startup
+	EmitExisting
+)
+
+func (i InitialScan) String() string {
+	switch i {
+	case SuppressExisting:
+		return "suppress-existing"
+	case EmitExisting:
+		return "emit-existing"
+	}
+	return fmt.Sprintf("initial-scan(%d)", int(i))
+}
+
+// WithInitialScan sets what the first scan of the "path", "native" and "hybrid" Watchers does with the files found,
+// baselining them by default. Either way an InitialScanDone notice named by the watched path follows the first scan
+// completing, delivered only when asked for in Start. State restored by WithSnapshots is diffed against instead,
+// without InitialScanDone as no scan baselined it.
+func WithInitialScan(mode InitialScan) Option {
+	return func(o *options) error {
+		switch mode {
+		case SuppressExisting, EmitExisting:
+		default:
+			return fmt.Errorf("Initial scan mode not recognized: %v", mode)
+		}
+		o.initial = mode
+		o.scanDone = true
+		return nil
+	}
+}
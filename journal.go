@@ -0,0 +1,208 @@
+package fsmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Journal persists notices before they are delivered, so they can be audited and replayed after downtime,
+// see WithJournal and Monitor.Replay.
+type Journal interface {
+	// Append persists n, appended at t
+	Append(t time.Time, n Notice) error
+	// Replay calls fn with the notices appended at or after since, in order, until fn returns an error
+	Replay(since time.Time, fn func(Notice) error) error
+	// Close releases the journal once the Monitor stops, Replay still works afterwards
+	Close() error
+}
+
+// WithJournal appends every delivered notice to j before delivering it, see Monitor.Replay.
+// Notices are appended after IDs are assigned, so replayed ones keep their IDs, but before debouncing releases them.
+func WithJournal(j Journal) Option {
+	return func(o *options) error {
+		if j == nil {
+			return fmt.Errorf("Journal must not be nil")
+		}
+		o.journal = j
+		return nil
+	}
+}
+
+// Replay returns the notices appended to the journal at or after since, closed once all were sent.
+// The channel must be drained, failures reading the journal are sent as ErrorNotice before it closes.
+// Replayed notices are decoded by UnmarshalNotice. Monitor must be given a Journal by WithJournal.
+func (m *Monitor) Replay(since time.Time) (<-chan Notice, error) {
+	if m.journal == nil {
+		return nil, fmt.Errorf("Monitor has no journal to replay")
+	}
+	replayed := make(chan Notice)
+	m.goroutines.run("replay", func() {
+		defer close(replayed)
+		err := m.journal.Replay(since, func(n Notice) error {
+			replayed <- n
+			return nil
+		})
+		if err != nil {
+			replayed <- &ErrorNotice{Address: m.address, Err: err, timestamp: time.Now()}
+		}
+	})
+	return replayed, nil
+}
+
+// journaled appends n to the journal if any, a failure doesn't hold back delivery. Returns the time appended at,
+// later than that of the notice appended before, so cursors tell notices apart by it.
+func (m *Monitor) journaled(n Notice) time.Time {
+	t := time.Now().Round(0)
+	if m.journal == nil {
+		return t
+	}
+	if !t.After(m.appended) {
+		t = m.appended.Add(1)
+	}
+	m.appended = t
+	if err := m.journal.Append(t, n); err != nil {
+		m.logger.error("Failed to journal notice", "path", n.Name(), "event", n.Type(), "error", err)
+	}
+	return t
+}
+
+// journalEntry is a line of a FileJournal.
+type journalEntry struct {
+	Time   time.Time       `json:"time"`
+	Notice json.RawMessage `json:"notice,omitempty"`
+	/* path of the notice appended at Time acknowledged, see AckJournal */
+	Ack string `json:"ack,omitempty"`
+}
+
+// FileJournal returns a Journal appending notices as JSON lines to the file at path, each a "time" appended at
+// and a "notice" encoded by MarshalNotice. Every notice is written through to the OS, surviving crashes of the
+// process, a line torn by a crash is skipped. Given a path ending in ".gz", or the extension of another registered
+// Compression, e.g. ".zst", every line is compressed as a stream of its own, read by zcat, and a stream torn by a
+// crash is cut off when reopened. Given a path ending in ".fsmz" lines are compressed by gzip in frames of a format
+// of this package, each prefixed by its length and CRC-32: lines share compression, so files are smaller, and a
+// frame torn by a crash is cut off when reopened. It implements AckJournal by lines of the "time" a notice was
+// appended at and its path as "ack", and CursorJournal.
+func FileJournal(path string) Journal {
+	return &fileJournal{path: path}
+}
+
+// fileJournal implements Journal by an append-only file.
+type fileJournal struct {
+	path string
+
+	mu  sync.Mutex
+	out lineWriter
+}
+
+func (j *fileJournal) Append(t time.Time, n Notice) error {
+	data, err := MarshalNotice(n)
+	if err != nil {
+		return err
+	}
+	return j.append(&journalEntry{Time: t, Notice: data})
+}
+
+func (j *fileJournal) Ack(t time.Time, n Notice) error {
+	return j.append(&journalEntry{Time: t, Ack: n.Name()})
+}
+
+// append writes e as a line.
+func (j *fileJournal) append(e *journalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.out == nil {
+		if j.out, err = openLines(j.path); err != nil {
+			return err
+		}
+	}
+	return j.out.writeLine(line)
+}
+
+func (j *fileJournal) Replay(since time.Time, fn func(Notice) error) error {
+	return j.ReplayFrom(since, func(_ time.Time, n Notice) error {
+		return fn(n)
+	})
+}
+
+func (j *fileJournal) ReplayFrom(since time.Time, fn func(t time.Time, n Notice) error) error {
+	return j.entries(func(e *journalEntry) error {
+		if e.Ack != "" || e.Time.Before(since) {
+			return nil
+		}
+		n, err := UnmarshalNotice(e.Notice)
+		if err != nil {
+			return fmt.Errorf("Malformed journal %s: %v", j.path, err)
+		}
+		return fn(e.Time, n)
+	})
+}
+
+func (j *fileJournal) Unacked(fn func(t time.Time, n Notice) error) error {
+	type appended struct {
+		t time.Time
+		n Notice
+	}
+	var unacked []*appended
+	index := make(map[string]*appended)
+	key := func(t time.Time, path string) string {
+		return fmt.Sprint(t.UnixNano(), path)
+	}
+	err := j.entries(func(e *journalEntry) error {
+		if e.Ack != "" {
+			if a, ok := index[key(e.Time, e.Ack)]; ok {
+				a.n = nil
+			}
+			return nil
+		}
+		n, err := UnmarshalNotice(e.Notice)
+		if err != nil {
+			return fmt.Errorf("Malformed journal %s: %v", j.path, err)
+		}
+		a := &appended{t: e.Time, n: n}
+		unacked = append(unacked, a)
+		index[key(e.Time, n.Name())] = a
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range unacked {
+		if a.n == nil {
+			continue
+		}
+		if err := fn(a.t, a.n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entries calls fn with every whole line of the file, in order, until fn returns an error.
+func (j *fileJournal) entries(fn func(e *journalEntry) error) error {
+	return readLines(j.path, func(line []byte) error {
+		var e journalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			/* torn lines were ended when reopened */
+			return nil
+		}
+		return fn(&e)
+	})
+}
+
+func (j *fileJournal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.out == nil {
+		return nil
+	}
+	err := j.out.Close()
+	j.out = nil
+	return err
+}
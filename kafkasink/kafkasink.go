@@ -0,0 +1,219 @@
+// Package kafkasink publishes notices to a Kafka topic as a fsmonitor.Sink, by the Sarama client:
+//
+//	sink, err := kafkasink.New(kafkasink.Config{Brokers: brokers, Topic: "monitor"})
+//	...
+//	monitor.AttachSink(sink)
+//
+// Messages carry the notice encoded by fsmonitor.MarshalNotice as JSON value, its path as key, so changes of
+// a file stay in order on one partition, and its ID, if identified (see fsmonitor.WithIDs), in an "id" header
+// for consumers to deduplicate redelivered notices by. Its labels (see fsmonitor.NoticeLabels) are "root",
+// "watcher" and "shard" headers, and can key messages instead, partitioning by source. The trace context of notices
+// traced by fsmonitor.WithTracer is sent as headers too, e.g. "traceparent".
+package kafkasink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/Shopify/sarama"
+)
+
+// Logger reports failures of asynchronous publishing, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[Kafka] ", log.LstdFlags)
+
+// Config of a Sink, Brokers and Topic are required.
+type Config struct {
+	Brokers []string
+	Topic   string
+	// Keys messages by a label instead of the path: root, watcher, shard or source, notices without it by path
+	KeyBy string
+	// Enables TLS, e.g. with client certificates, plaintext without
+	TLS *tls.Config
+	// Publish returns once the message is queued instead of acknowledged, failures are logged,
+	// messages are compressed by Snappy and flushed every 500ms
+	Async bool
+	// Attempts to resend a message after failing, 10 by default
+	Retries int
+	// Delay before resending, 100ms by default
+	Backoff time.Duration
+	// Replicas acknowledging a message, all in-sync ones by default, the leader only in async mode
+	Acks sarama.RequiredAcks
+	// Base configuration of the producer, e.g. for SASL or the client ID, overridden by the settings above
+	Sarama *sarama.Config
+	Logger *log.Logger
+}
+
+// Sink implements fsmonitor.Sink by a Sarama producer.
+type Sink struct {
+	topic  string
+	keyBy  string
+	logger *log.Logger
+
+	producer sarama.SyncProducer
+	queue    sarama.AsyncProducer
+	/* guards publishing against closing, as the async input must not be written once closed */
+	mu     sync.Mutex
+	closed bool
+	errors sync.WaitGroup
+}
+
+var _ fsmonitor.Sink = (*Sink)(nil)
+
+// New connects a producer to c.Brokers, failing if none of them is reachable.
+func New(c Config) (*Sink, error) {
+	if len(c.Brokers) == 0 {
+		return nil, fmt.Errorf("Kafka brokers must be given")
+	}
+	if c.Topic == "" {
+		return nil, fmt.Errorf("Kafka topic must be given")
+	}
+	switch c.KeyBy {
+	case "", "path", "root", "watcher", "shard", "source":
+	default:
+		return nil, fmt.Errorf("Kafka key label not recognized: %q", c.KeyBy)
+	}
+	config := c.Sarama
+	if config == nil {
+		config = sarama.NewConfig()
+	}
+	if c.TLS != nil {
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = c.TLS
+	}
+	config.Producer.Retry.Max = 10
+	if c.Retries > 0 {
+		config.Producer.Retry.Max = c.Retries
+	}
+	config.Producer.Retry.Backoff = 100 * time.Millisecond
+	if c.Backoff > 0 {
+		config.Producer.Retry.Backoff = c.Backoff
+	}
+	/* on the broker side, unclean.leader.election.enable=false and min.insync.replicas > 1 strengthen guarantees */
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	if c.Async {
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+		config.Producer.Compression = sarama.CompressionSnappy
+		config.Producer.Flush.Frequency = 500 * time.Millisecond
+	}
+	if c.Acks != 0 {
+		config.Producer.RequiredAcks = c.Acks
+	}
+	/* record headers need 0.11 */
+	if !config.Version.IsAtLeast(sarama.V0_11_0_0) {
+		config.Version = sarama.V0_11_0_0
+	}
+
+	s := &Sink{topic: c.Topic, keyBy: c.KeyBy, logger: c.Logger}
+	if s.logger == nil {
+		s.logger = Logger
+	}
+	var err error
+	if !c.Async {
+		config.Producer.Return.Successes = true
+		if s.producer, err = sarama.NewSyncProducer(c.Brokers, config); err != nil {
+			return nil, fmt.Errorf("Failed to start Kafka producer: %v", err)
+		}
+		return s, nil
+	}
+
+	config.Producer.Return.Successes = false
+	config.Producer.Return.Errors = true
+	if s.queue, err = sarama.NewAsyncProducer(c.Brokers, config); err != nil {
+		return nil, fmt.Errorf("Failed to start Kafka producer: %v", err)
+	}
+	/* failures are only returned after all retries, the channel closes once the producer is closed */
+	s.errors.Add(1)
+	go func() {
+		defer s.errors.Done()
+		for err := range s.queue.Errors() {
+			s.logger.Printf("Failed to publish to %s: %v", s.topic, err)
+		}
+	}()
+	return s, nil
+}
+
+// Publish sends n to the topic, waiting for acknowledgment unless in async mode.
+func (s *Sink) Publish(n fsmonitor.Notice) error {
+	msg, err := s.message(n)
+	if err != nil {
+		return err
+	}
+	if s.producer != nil {
+		_, _, err := s.producer.SendMessage(msg)
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("Kafka sink is closed")
+	}
+	s.queue.Input() <- msg
+	return nil
+}
+
+// message encodes n as message to the topic.
+func (s *Sink) message(n fsmonitor.Notice) (*sarama.ProducerMessage, error) {
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+	}
+	labels := fsmonitor.NoticeLabels(n)
+	key := n.Name()
+	switch {
+	case s.keyBy == "root" && labels.Root != "":
+		key = labels.Root
+	case s.keyBy == "watcher" && labels.Watcher != "":
+		key = labels.Watcher
+	case s.keyBy == "shard" && labels.Shard != "":
+		key = labels.Shard
+	case s.keyBy == "source" && labels.Source != "":
+		key = labels.Source
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: s.topic,
+		Key:   sarama.StringEncoder(key),
+		Value: sarama.ByteEncoder(data),
+	}
+	var i fsmonitor.IdentifiedNotice
+	if fsmonitor.NoticeAs(n, &i) {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte("id"), Value: []byte(i.ID())})
+	}
+	for _, h := range [][2]string{{"root", labels.Root}, {"watcher", labels.Watcher}, {"shard", labels.Shard}, {"source", labels.Source}} {
+		if h[1] != "" {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(h[0]), Value: []byte(h[1])})
+		}
+	}
+	/* consumers continue the trace of the scan, see fsmonitor.WithTracer */
+	var t fsmonitor.TracedNotice
+	if fsmonitor.NoticeAs(n, &t) {
+		for key, value := range t.Trace() {
+			msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+		}
+	}
+	return msg, nil
+}
+
+// Close flushes messages queued in async mode and closes the producer.
+func (s *Sink) Close() error {
+	if s.producer != nil {
+		return s.producer.Close()
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	err := s.queue.Close()
+	s.errors.Wait()
+	return err
+}
@@ -0,0 +1,79 @@
+package fsmonitor
+
+import (
+	"reflect"
+)
+
+// Labels tell where a notice comes from, so downstream topology can partition by source, see NoticeLabels.
+type Labels struct {
+	// Watched path of Monitors watching several, see RootedNotice
+	Root string `json:"root,omitempty"`
+	// Name of the builtin Watcher, e.g. path or hybrid
+	Watcher string `json:"watcher,omitempty"`
+	// Top-level entry under the watched path, with shards given by WithShards only
+	Shard string `json:"shard,omitempty"`
+	// Name of the Watcher of a CompositeWatcher, see SourcedNotice
+	Source string `json:"source,omitempty"`
+}
+
+// LabeledNotice is implemented by notices of builtin Watchers, telling their Labels but the root.
+type LabeledNotice interface {
+	Notice
+	Labels() Labels
+}
+
+// NoticeLabels returns the labels of n, found through notices wrapping it, e.g. by WithIDs or rules.
+// MarshalNotice encodes them, sinks can route by them.
+func NoticeLabels(n Notice) Labels {
+	var l Labels
+	var ln LabeledNotice
+	if NoticeAs(n, &ln) {
+		l = ln.Labels()
+	}
+	var rn RootedNotice
+	if NoticeAs(n, &rn) {
+		l.Root = rn.Root()
+	}
+	var sn SourcedNotice
+	if NoticeAs(n, &sn) {
+		l.Source = sn.Source()
+	}
+	return l
+}
+
+// NoticeAs finds the first notice implementing the interface target points to, starting from n through the
+// notices it wraps, e.g. those tagged by rules or identified by WithIDs, which hide interfaces of the wrapped one.
+// Sets target to it, reporting whether found, e.g. var r RootedNotice; if NoticeAs(n, &r) { ... }.
+// Panics unless target is a non-nil pointer to an interface.
+func NoticeAs(n Notice, target interface{}) bool {
+	v := reflect.ValueOf(target)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Interface {
+		panic("fsmonitor: target must be a non-nil pointer to an interface")
+	}
+	t := v.Elem().Type()
+	for n != nil {
+		if reflect.TypeOf(n).Implements(t) {
+			v.Elem().Set(reflect.ValueOf(n))
+			return true
+		}
+		w, ok := n.(interface{ Unwrap() Notice })
+		if !ok {
+			return false
+		}
+		n = w.Unwrap()
+	}
+	return false
+}
+
+func (f *fileSystemNotice) Labels() Labels {
+	return f.labels
+}
+
+// labels returns the labels of notices about file.
+func (s *pathScanner) labels(file string) Labels {
+	l := Labels{Watcher: s.kind}
+	if s.shards != nil {
+		l.Shard = s.shard(file)
+	}
+	return l
+}
@@ -0,0 +1,122 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Leases coordinates consumers sharing one notice stream, e.g. workers processing a drop folder,
+// so a file is processed by one consumer at a time and reprocessed when its consumer fails to finish.
+type Leases struct {
+	ttl time.Duration
+
+	mu   sync.Mutex
+	held map[string]*Lease
+
+	requeued chan Notice
+}
+
+// Lease is held by the consumer processing the file of a Notice, see Leases.Claim.
+type Lease struct {
+	Notice Notice
+
+	leases  *Leases
+	expires time.Time
+	timer   *time.Timer
+	/* latest notice of the file claimed by others while held */
+	missed Notice
+}
+
+// NewLeases creates Leases expiring ttl after being claimed or renewed.
+func NewLeases(ttl time.Duration) *Leases {
+	return &Leases{
+		ttl:      ttl,
+		held:     make(map[string]*Lease),
+		requeued: make(chan Notice, notice_buffer_length),
+	}
+}
+
+// Claim leases the file of n to the caller, reporting false while another consumer holds it.
+// A notice claimed in vain is requeued once the holder is done, so changes made meanwhile are processed too.
+func (l *Leases) Claim(n Notice) (*Lease, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lease, ok := l.held[n.Name()]; ok {
+		lease.missed = n
+		return nil, false
+	}
+	lease := &Lease{Notice: n, leases: l, expires: time.Now().Add(l.ttl)}
+	lease.timer = time.AfterFunc(l.ttl, lease.expire)
+	l.held[n.Name()] = lease
+	return lease, true
+}
+
+// Requeued returns notices to be claimed again: those whose lease expired before Done,
+// and those claimed in vain while their file was held.
+func (l *Leases) Requeued() <-chan Notice {
+	return l.requeued
+}
+
+// requeue must be called holding mu.
+func (l *Leases) requeue(n Notice) {
+	select {
+	case l.requeued <- n:
+	default:
+		logSink{}.warn("Requeued notices aren't consumed, notice dropped", "path", n.Name(), "event", n.Type())
+	}
+}
+
+// Done releases the lease once the file has been processed.
+func (l *Lease) Done() {
+	l.leases.mu.Lock()
+	defer l.leases.mu.Unlock()
+
+	if l.leases.held[l.Notice.Name()] != l {
+		return
+	}
+	l.timer.Stop()
+	delete(l.leases.held, l.Notice.Name())
+	if l.missed != nil {
+		l.leases.requeue(l.missed)
+	}
+}
+
+// Renew extends the lease by the ttl of Leases, e.g. while processing a large file.
+func (l *Lease) Renew() error {
+	l.leases.mu.Lock()
+	defer l.leases.mu.Unlock()
+
+	if l.leases.held[l.Notice.Name()] != l {
+		return fmt.Errorf("Lease of %s has expired", l.Notice.Name())
+	}
+	l.expires = time.Now().Add(l.leases.ttl)
+	l.timer.Reset(l.leases.ttl)
+	return nil
+}
+
+// Expires returns when the lease expires unless renewed.
+func (l *Lease) Expires() time.Time {
+	l.leases.mu.Lock()
+	defer l.leases.mu.Unlock()
+	return l.expires
+}
+
+// expire releases the lease and requeues its notice, the latest one if claimed in vain meanwhile.
+func (l *Lease) expire() {
+	l.leases.mu.Lock()
+	defer l.leases.mu.Unlock()
+
+	/* renewed after timer fired */
+	if l.leases.held[l.Notice.Name()] != l || time.Now().Before(l.expires) {
+		return
+	}
+	delete(l.leases.held, l.Notice.Name())
+	logSink{}.info("Lease expired, requeued", "path", l.Notice.Name(), "event", l.Notice.Type())
+	if l.missed != nil {
+		l.leases.requeue(l.missed)
+	} else {
+		l.leases.requeue(l.Notice)
+	}
+}
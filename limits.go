@@ -0,0 +1,74 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WithMaxDepth limits how deep the "path", "native" and "hybrid" Watchers walk below the watched path, e.g. 1 for
+// its files only, 2 for those of its subdirectories too. Deeper directories are pruned instead of walked.
+func WithMaxDepth(levels int) Option {
+	return func(o *options) error {
+		if levels < 1 {
+			return fmt.Errorf("Max depth must be at least 1")
+		}
+		o.maxDepth = levels
+		return nil
+	}
+}
+
+// WithMaxFileSize makes the "path", "native" and "hybrid" Watchers skip files larger than size bytes, e.g. disk
+// images. Files growing larger are no longer watched, without a notice, and noticed as created once smaller again.
+func WithMaxFileSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("Max file size must be positive")
+		}
+		o.maxSize = size
+		return nil
+	}
+}
+
+// WithModifiedWithin makes the "path", "native" and "hybrid" Watchers skip files last modified longer than age ago,
+// e.g. archives of past years. Files ageing out are no longer watched, without a notice. Directories are walked
+// regardless of their own modification time, which doesn't tell when files inside last changed.
+func WithModifiedWithin(age time.Duration) Option {
+	return func(o *options) error {
+		if age <= 0 {
+			return fmt.Errorf("Modification age must be positive")
+		}
+		o.modWithin = age
+		return nil
+	}
+}
+
+// depth returns the level of file below the watched address, 1 for its entries and 0 for the address itself.
+func (s *pathScanner) depth(file string) int {
+	rel, err := filepath.Rel(s.address, file)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// beyond reports whether file lies deeper than the max depth, if any.
+func (s *pathScanner) beyond(file string) bool {
+	return s.maxDepth > 0 && s.depth(file) > s.maxDepth
+}
+
+// limited reports why a file of info is skipped by its size or modification time before cutoff, empty if it isn't.
+func (s *pathScanner) limited(info os.FileInfo, cutoff time.Time) string {
+	if info.IsDir() {
+		return ""
+	}
+	if s.maxSize > 0 && info.Mode().IsRegular() && info.Size() > s.maxSize {
+		return fmt.Sprintf("larger than max file size of %d bytes", s.maxSize)
+	}
+	if s.modWithin > 0 && info.ModTime().Before(cutoff) {
+		return fmt.Sprintf("not modified within %v", s.modWithin)
+	}
+	return ""
+}
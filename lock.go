@@ -0,0 +1,91 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// WithLockWait makes the builtin "path" Watcher hold back notices of created, updated and renamed files while they're
+// locked or open for writing, sending them once released, e.g. for consumers not to ingest files producers still write.
+// A FileLocked notice tells when a change is held back. Files are probed when they change and again after every scan:
+// Unix probes flock and fcntl locks, Linux also scans /proc for processes having the file open for writing, which
+// tells the holders; Windows probes for a sharing violation opening the file without write sharing.
+// Notices held back when the Monitor stops are dropped.
+func WithLockWait() Option {
+	return func(o *options) error {
+		o.locks = true
+		return nil
+	}
+}
+
+// LockInfo is the os.FileInfo of FileLocked notices, returned by Notice.More.
+type LockInfo struct {
+	os.FileInfo
+	// Processes found holding the file, empty where the platform doesn't tell
+	Holders []LockHolder
+}
+
+// LockHolder is a process holding a file locked or open for writing.
+type LockHolder struct {
+	PID int
+	Exe string
+}
+
+func (h LockHolder) String() string {
+	return fmt.Sprintf("pid=%d exe=%s", h.PID, h.Exe)
+}
+
+// hold holds n back if its file is locked, sending FileLocked to changed, and reports whether it did.
+// Changes of a held file update the held notice, keeping its event, removal drops it, and is held back itself
+// if the file was created while held, as consumers were never told.
+func (s *pathScanner) hold(n *fileSystemNotice, changed chan<- Notice) bool {
+	held, ok := s.held[n.path]
+	switch n.event {
+	case FileRemove:
+		if ok {
+			delete(s.held, n.path)
+			return held.event == FileCreate
+		}
+		return false
+	case FileCreate, FileUpdate, FileRename:
+	default:
+		return false
+	}
+	if ok {
+		held.fileinfo = n.fileinfo
+		return true
+	}
+
+	locked, holders := probeLock(n.path)
+	if !locked {
+		return false
+	}
+	if s.held == nil {
+		s.held = make(map[string]*fileSystemNotice)
+	}
+	s.held[n.path] = n
+	changed <- &fileSystemNotice{
+		path:      n.path,
+		fileinfo:  &LockInfo{FileInfo: n.fileinfo, Holders: holders},
+		timestamp: time.Now(),
+		event:     FileLocked,
+	}
+	return true
+}
+
+// released sends notices held back for files not locked anymore by emit, once a scan completed.
+func (s *pathScanner) released(emit func(*fileSystemNotice)) {
+	for file, n := range s.held {
+		if locked, _ := probeLock(file); locked {
+			continue
+		}
+		delete(s.held, file)
+		if info, ok := s.tracked(file); ok {
+			n.fileinfo = info
+		}
+		n.timestamp = time.Now()
+		/* probed once more on the way, locked again in between is held again */
+		emit(n)
+	}
+}
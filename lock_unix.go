@@ -0,0 +1,120 @@
+//go:build linux || darwin || dragonfly || freebsd || netbsd || openbsd
+// +build linux darwin dragonfly freebsd netbsd openbsd
+
+package fsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// probeLock reports whether the file at path is locked by flock or fcntl, or open for writing by a process on Linux,
+// with the processes found holding it.
+func probeLock(path string) (bool, []LockHolder) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+
+	var holders []LockHolder
+	locked := false
+	fd := int(f.Fd())
+	if err := syscall.Flock(fd, syscall.LOCK_SH|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		locked = true
+	} else if err == nil {
+		syscall.Flock(fd, syscall.LOCK_UN)
+	}
+	/* closing f drops fcntl locks this process holds on the file, files to watch aren't locked by it */
+	lk := syscall.Flock_t{Type: syscall.F_RDLCK}
+	if err := syscall.FcntlFlock(f.Fd(), syscall.F_GETLK, &lk); err == nil && lk.Type != syscall.F_UNLCK {
+		locked = true
+		holders = append(holders, lockHolder(int(lk.Pid)))
+	}
+	if runtime.GOOS == "linux" {
+		for _, pid := range writers(path) {
+			locked = true
+			if !holding(holders, pid) {
+				holders = append(holders, lockHolder(pid))
+			}
+		}
+	}
+	return locked, holders
+}
+
+// lockHolder returns the holder pid, with its executable where /proc tells it.
+func lockHolder(pid int) LockHolder {
+	exe, _ := os.Readlink(filepath.Join("/proc", strconv.Itoa(pid), "exe"))
+	return LockHolder{PID: pid, Exe: exe}
+}
+
+// holding reports whether pid is among holders.
+func holding(holders []LockHolder, pid int) bool {
+	for _, h := range holders {
+		if h.PID == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// writers returns the processes having the file at path open for writing according to /proc,
+// other users' processes are only seen with privileges.
+func writers(path string) []int {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	procs, err := ioutil.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+	self := os.Getpid()
+	var pids []int
+	for _, proc := range procs {
+		pid, err := strconv.Atoi(proc.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		dir := filepath.Join("/proc", proc.Name())
+		fds, err := ioutil.ReadDir(filepath.Join(dir, "fd"))
+		if err != nil {
+			continue
+		}
+		for _, fd := range fds {
+			if target, err := os.Readlink(filepath.Join(dir, "fd", fd.Name())); err != nil || target != abs {
+				continue
+			}
+			if writable(filepath.Join(dir, "fdinfo", fd.Name())) {
+				pids = append(pids, pid)
+				break
+			}
+		}
+	}
+	return pids
+}
+
+// writable reports whether the flags at fdinfo tell the descriptor is open for writing.
+func writable(fdinfo string) bool {
+	data, err := ioutil.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if !strings.HasPrefix(line, "flags:") {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "flags:")), 8, 64)
+		if err != nil {
+			return false
+		}
+		mode := flags & syscall.O_ACCMODE
+		return mode == syscall.O_WRONLY || mode == syscall.O_RDWR
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"syscall"
+)
+
+/* ERROR_SHARING_VIOLATION */
+const error_sharing_violation syscall.Errno = 32
+
+// probeLock reports whether the file at path is open for writing, by a sharing violation opening it without
+// sharing write access. Holders aren't told.
+func probeLock(path string) (bool, []LockHolder) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false, nil
+	}
+	h, err := syscall.CreateFile(name, syscall.GENERIC_READ, syscall.FILE_SHARE_READ, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err != nil {
+		return err == error_sharing_violation, nil
+	}
+	syscall.CloseHandle(h)
+	return false, nil
+}
@@ -0,0 +1,113 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// LogLevel is the severity of log records, valued as slog levels so adapters convert it as is.
+type LogLevel int
+
+const (
+	LogDebug LogLevel = -4
+	LogInfo  LogLevel = 0
+	LogWarn  LogLevel = 4
+	LogError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch {
+	case l < LogInfo:
+		return "DEBUG"
+	case l < LogWarn:
+		return "INFO"
+	case l < LogError:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// FieldLogger writes structured log records, e.g. an adapter of slog, zap or zerolog, see WithFieldLogger.
+// Records of a Monitor tell the watched root, those of scans their scan number, those of files path and event.
+type FieldLogger interface {
+	// Log writes msg with fields given as alternating keys and values, as slog.Logger.Log takes them
+	Log(level LogLevel, msg string, keysAndValues ...interface{})
+}
+
+// WithFieldLogger makes the Monitor and builtin Watchers write structured records to l, instead of formatting
+// their fields into messages of WithLogger or the package Logger, e.g. an adapter of the slog.Logger of the
+// application:
+//
+//	type slogger struct{ *slog.Logger }
+//
+//	func (s slogger) Log(level fsmonitor.LogLevel, msg string, kv ...interface{}) {
+//		s.Logger.Log(context.Background(), slog.Level(level), msg, kv...)
+//	}
+func WithFieldLogger(l FieldLogger) Option {
+	return func(o *options) error {
+		if l == nil {
+			return fmt.Errorf("FieldLogger must not be nil")
+		}
+		o.fieldLog = l
+		return nil
+	}
+}
+
+// logSink is what Monitors, builtin Watchers and sinks log through: the FieldLogger if given, or else the
+// *log.Logger, or else the package Logger, formatting fields as key=value.
+type logSink struct {
+	std *log.Logger
+	out FieldLogger
+	/* fields of every record, e.g. the watched root */
+	fields []interface{}
+}
+
+// newLogSink returns the logSink of given loggers, adding fields to every record.
+func newLogSink(std *log.Logger, out FieldLogger, keysAndValues ...interface{}) logSink {
+	return logSink{std: std, out: out, fields: keysAndValues}
+}
+
+// with returns l adding fields to every record.
+func (l logSink) with(keysAndValues ...interface{}) logSink {
+	l.fields = append(l.fields[:len(l.fields):len(l.fields)], keysAndValues...)
+	return l
+}
+
+func (l logSink) debug(msg string, keysAndValues ...interface{}) { l.log(LogDebug, msg, keysAndValues) }
+func (l logSink) info(msg string, keysAndValues ...interface{})  { l.log(LogInfo, msg, keysAndValues) }
+func (l logSink) warn(msg string, keysAndValues ...interface{})  { l.log(LogWarn, msg, keysAndValues) }
+func (l logSink) error(msg string, keysAndValues ...interface{}) { l.log(LogError, msg, keysAndValues) }
+
+func (l logSink) log(level LogLevel, msg string, keysAndValues []interface{}) {
+	fields := append(l.fields[:len(l.fields):len(l.fields)], keysAndValues...)
+	if l.out != nil {
+		l.out.Log(level, msg, fields...)
+		return
+	}
+	std := l.std
+	if std == nil {
+		std = Logger
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(' ')
+		b.WriteString(fmt.Sprint(fields[i]))
+		b.WriteByte('=')
+		if i+1 < len(fields) {
+			b.WriteString(logValue(fields[i+1]))
+		}
+	}
+	std.Print(b.String())
+}
+
+// logValue formats v for text records, quoting it unless a single word.
+func logValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
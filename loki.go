@@ -0,0 +1,212 @@
+package fsmonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* path of the push API, see LokiSink */
+const loki_push_path = "/loki/api/v1/push"
+
+// Loki configures a Sink pushing notices to Grafana Loki, only URL is required, see LokiSink.
+type Loki struct {
+	// Base URL of Loki, e.g. http://loki:3100
+	URL string
+	// Labels of every stream besides host, root and event, e.g. job
+	Labels map[string]string
+	// Host label, the host name unless given
+	Host string
+	// Tenant of multi-tenant Loki, sent as X-Scope-OrgID
+	Tenant string
+	// Basic auth of requests unless empty
+	Username string
+	Password string
+	// Notices per request, 100 by default
+	Batch int
+	// Notices queued for sending, 1000 by default, Publish fails once full
+	Queue int
+	// Attempts to resend a request after failing, 5 by default
+	Retries int
+	// Delay before the first retry, doubled for every further one, 1 second by default
+	Backoff time.Duration
+	// Timeout of a request, 10 seconds by default, unless Client is given
+	Timeout time.Duration
+	Client  *http.Client
+	Logger  *log.Logger
+	// Writes structured records instead of Logger, see WithFieldLogger
+	FieldLogger FieldLogger
+}
+
+// lokiSink implements Sink by pushing from a queue.
+type lokiSink struct {
+	Loki
+	*sendQueue
+}
+
+// lokiStream is a stream of the push API, values being pairs of nanosecond timestamp and line.
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// LokiSink returns a Sink pushing every notice as log line, encoded by MarshalNotice, to Grafana Loki. Lines are
+// labelled by "host", "root" of the notice (see NoticeLabels) unless empty, "event" type and the Labels given,
+// and timed by the notice. Notices are queued and pushed by a goroutine of the Sink in batches of those waiting,
+// a stream per label set. Requests failing by network errors, timeouts, 408, 429 or 5xx responses are retried with
+// exponential backoff, others are dropped and logged, as is what still fails after all retries. Close sends what is
+// queued before returning.
+func LokiSink(l Loki) (Sink, error) {
+	u, err := url.Parse(l.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Loki URL %q is malformed: %v", l.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Loki URL %q must be of http or https scheme", l.URL)
+	}
+	for name := range l.Labels {
+		switch name {
+		case "host", "root", "event":
+			return nil, fmt.Errorf("Loki label %q is set by the sink", name)
+		}
+	}
+	l.URL = strings.TrimSuffix(l.URL, "/")
+	if l.Host == "" {
+		l.Host, _ = os.Hostname()
+	}
+	if l.Batch <= 0 {
+		l.Batch = 100
+	}
+	if l.Queue <= 0 {
+		l.Queue = notice_buffer_length
+	}
+	if l.Retries <= 0 {
+		l.Retries = 5
+	}
+	if l.Backoff <= 0 {
+		l.Backoff = time.Second
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = 10 * time.Second
+	}
+	if l.Client == nil {
+		l.Client = &http.Client{Timeout: l.Timeout}
+	}
+
+	s := &lokiSink{Loki: l}
+	s.sendQueue = newSendQueue("Loki", l.Queue, l.Batch, func(batch []Notice) {
+		if err := s.post(batch); err != nil {
+			s.logger().error("Loki failed, notices dropped", "url", l.URL, "dropped", len(batch), "error", err)
+		}
+	})
+	return s, nil
+}
+
+// post pushes batch, retrying with backoff.
+func (s *lokiSink) post(batch []Notice) error {
+	body, err := s.body(batch)
+	if err != nil {
+		return err
+	}
+	return retried(s.Retries, s.Backoff, func() (bool, error) {
+		return s.request(body)
+	}, func(retry time.Duration, err error) {
+		s.logger().warn("Loki failed, retrying", "url", s.URL, "retry", retry, "error", err)
+	})
+}
+
+// body encodes batch as push request, lines grouped into streams by labels in order of time.
+func (s *lokiSink) body(batch []Notice) ([]byte, error) {
+	now := time.Now()
+	at := func(n Notice) time.Time {
+		if t := n.Time(); !t.IsZero() {
+			return t
+		}
+		return now
+	}
+	sorted := append([]Notice(nil), batch...)
+	sort.SliceStable(sorted, func(i, j int) bool { return at(sorted[i]).Before(at(sorted[j])) })
+
+	var streams []*lokiStream
+	byLabels := make(map[string]*lokiStream)
+	for _, n := range sorted {
+		line, err := MarshalNotice(n)
+		if err != nil {
+			return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+		}
+		labels := s.labels(n)
+		/* encoding/json sorts map keys, so equal label sets encode alike */
+		key, _ := json.Marshal(labels)
+		stream, ok := byLabels[string(key)]
+		if !ok {
+			stream = &lokiStream{Stream: labels}
+			byLabels[string(key)] = stream
+			streams = append(streams, stream)
+		}
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(at(n).UnixNano(), 10), string(line)})
+	}
+	return json.Marshal(struct {
+		Streams []*lokiStream `json:"streams"`
+	}{streams})
+}
+
+// labels returns the labels of the stream of n.
+func (s *lokiSink) labels(n Notice) map[string]string {
+	labels := make(map[string]string, len(s.Labels)+3)
+	for name, value := range s.Labels {
+		labels[name] = value
+	}
+	if s.Host != "" {
+		labels["host"] = s.Host
+	}
+	if root := NoticeLabels(n).Root; root != "" {
+		labels["root"] = root
+	}
+	labels["event"] = n.Type().String()
+	return labels
+}
+
+// request POSTs body once, reporting whether a failure is worth retrying.
+func (s *lokiSink) request(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL+loki_push_path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.Tenant)
+	}
+	if s.Username != "" || s.Password != "" {
+		req.SetBasicAuth(s.Username, s.Password)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("Loki %s responded %s: %s", s.URL, resp.Status, bytes.TrimSpace(data))
+	}
+	return false, fmt.Errorf("Loki %s responded %s: %s", s.URL, resp.Status, bytes.TrimSpace(data))
+}
+
+// logger returns what the sink logs through.
+func (s *lokiSink) logger() logSink {
+	return newLogSink(s.Logger, s.FieldLogger)
+}
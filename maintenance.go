@@ -0,0 +1,122 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaintenanceWindow declares a period of expected changes, e.g. a deployment, see Monitor.Maintain.
+type MaintenanceWindow struct {
+	// Path prefix the window applies to, empty for every path
+	Prefix string
+	// Zero Start means now, windows expire automatically after End
+	Start time.Time
+	End   time.Time
+	// Drop notices during the window instead of tagging them as MaintenanceNotice
+	Suppress bool
+	Reason   string
+}
+
+func (w *MaintenanceWindow) String() string {
+	return fmt.Sprintf("{%q : %v - %v : %s}", w.Prefix, w.Start.Format(time.RFC3339), w.End.Format(time.RFC3339), w.Reason)
+}
+
+// applies reports whether the window covers a notice about path at t.
+func (w *MaintenanceWindow) applies(path string, t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End) && (w.Prefix == "" || within(path, w.Prefix))
+}
+
+// MaintenanceNotice is implemented by notices delivered during a maintenance window in tagging mode.
+type MaintenanceNotice interface {
+	Notice
+	Maintenance() *MaintenanceWindow
+}
+
+// maintenanceNotice implements MaintenanceNotice by wrapping the discovered Notice.
+type maintenanceNotice struct {
+	Notice
+	window *MaintenanceWindow
+}
+
+func (m *maintenanceNotice) Unwrap() Notice {
+	return m.Notice
+}
+
+func (m *maintenanceNotice) Maintenance() *MaintenanceWindow {
+	return m.window
+}
+
+func (m *maintenanceNotice) String() string {
+	return fmt.Sprintf("%v during maintenance %v", m.Notice, m.window)
+}
+
+// Maintain declares a maintenance window, during which matching notices are suppressed or tagged.
+// Returned function ends the window early.
+func (m *Monitor) Maintain(w MaintenanceWindow) (func(), error) {
+	if w.Start.IsZero() {
+		w.Start = time.Now()
+	}
+	if !w.End.After(w.Start) {
+		return nil, fmt.Errorf("Maintenance window must end after it starts")
+	}
+	if w.Prefix != "" {
+		w.Prefix = canonicalAddress(w.Prefix)
+	}
+	window := &w
+
+	m.mu.Lock()
+	m.windows = append(m.windows, window)
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, mw := range m.windows {
+			if mw == window {
+				m.windows = append(m.windows[:i], m.windows[i+1:]...)
+				break
+			}
+		}
+	}, nil
+}
+
+// MaintenanceWindows returns windows currently declared and not yet expired.
+func (m *Monitor) MaintenanceWindows() []MaintenanceWindow {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	windows := make([]MaintenanceWindow, 0, len(m.windows))
+	for _, w := range m.windows {
+		windows = append(windows, *w)
+	}
+	return windows
+}
+
+// maintenance suppresses or tags n when a window applies, pruning expired windows.
+func (m *Monitor) maintenance(n Notice) Notice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.windows) == 0 {
+		return n
+	}
+	now := time.Now()
+	active := m.windows[:0]
+	for _, w := range m.windows {
+		if now.Before(w.End) {
+			active = append(active, w)
+		}
+	}
+	m.windows = active
+
+	for _, w := range m.windows {
+		if w.applies(n.Name(), now) {
+			if w.Suppress {
+				m.logger.debug("Notice suppressed by maintenance", "window", w, "path", n.Name(), "event", n.Type())
+				return nil
+			}
+			return &maintenanceNotice{Notice: n, window: w}
+		}
+	}
+	return n
+}
@@ -0,0 +1,217 @@
+package fsmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+const (
+	/* default of ContentMatch.MaxSize */
+	match_size_default = 1 << 20
+	/* matches attached to a notice at most */
+	match_limit = 100
+)
+
+// ContentMatch configures MatchWatcher.
+type ContentMatch struct {
+	// Regular expressions lines of content are matched against, e.g. "FATAL|panic:"
+	Patterns []string
+	// Bytes read of a file at most, 1MiB by default
+	MaxSize int64
+	// Notices of created and updated files without matches are dropped
+	Suppress bool
+}
+
+// Match is a line of content matching a pattern, see MatchNotice.
+type Match struct {
+	Pattern string
+	// Offset of the line in the file
+	Offset int64
+	Line   string
+}
+
+// MatchNotice is implemented by notices of created and updated files whose content matched, see MatchWatcher.
+type MatchNotice interface {
+	Notice
+	// Lines matching, in order of the file, up to 100
+	Matches() []Match
+}
+
+// matchNotice implements MatchNotice by wrapping the discovered Notice.
+type matchNotice struct {
+	Notice
+	matches []Match
+}
+
+func (m *matchNotice) Unwrap() Notice {
+	return m.Notice
+}
+
+func (m *matchNotice) Matches() []Match {
+	return m.matches
+}
+
+func (m *matchNotice) String() string {
+	return fmt.Sprintf("%v (%d matches)", m.Notice, len(m.matches))
+}
+
+// MatchWatcher wraps a Watcher, matching the content of created and updated files against the patterns of
+// match, e.g. to be told of log files getting "FATAL" lines. Notices of files with matching lines implement
+// MatchNotice. Only the region a file grew by since its last notice is read, so lines appended to logs are matched
+// once, a line still being written is read with the rest of it. Files under address are sized beforehand for
+// their first update to be read from there. Files rewritten, or of unknown size, are read whole up to MaxSize,
+// larger ones by their last MaxSize bytes, and regions grown by more than MaxSize by their first MaxSize bytes.
+func MatchWatcher(w Watcher, address string, match ContentMatch) (Watcher, error) {
+	if len(match.Patterns) == 0 {
+		return nil, fmt.Errorf("Content patterns must be given")
+	}
+	if match.MaxSize < 0 {
+		return nil, fmt.Errorf("Content size must not be negative")
+	}
+	m := &matchWatcher{maxSize: match.MaxSize, suppress: match.Suppress, offsets: make(map[string]int64)}
+	if m.maxSize == 0 {
+		m.maxSize = match_size_default
+	}
+	for _, pat := range match.Patterns {
+		re, err := regexp.Compile(pat)
+		if err != nil {
+			return nil, fmt.Errorf("Content pattern failed compilation, please check syntax! %v", err)
+		}
+		m.patterns = append(m.patterns, re)
+	}
+
+	err := filepath.Walk(canonicalAddress(address), func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		m.offsets[file] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoratedWatcher{
+		watcher:  w,
+		decorate: m.decorate,
+	}, nil
+}
+
+// matchWatcher keeps the offset up to which every file was matched.
+type matchWatcher struct {
+	patterns []*regexp.Regexp
+	maxSize  int64
+	suppress bool
+
+	mu      sync.Mutex
+	offsets map[string]int64
+}
+
+// decorate matches the region changed of created and updated files, dropping them without matches if suppressing.
+func (m *matchWatcher) decorate(n Notice) Notice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch n.Type() {
+	case FileRemove:
+		delete(m.offsets, n.Name())
+		return n
+	case FileRename:
+		if old := InfoOf(n).OldPath; old != "" {
+			if offset, ok := m.offsets[old]; ok {
+				m.offsets[n.Name()] = offset
+			}
+			delete(m.offsets, old)
+		}
+		return n
+	case FileCreate, FileUpdate:
+	default:
+		return n
+	}
+
+	matches, err := m.match(n.Name())
+	if err != nil {
+		/* e.g. removed meanwhile, noticed by the next scan */
+		return n
+	}
+	if len(matches) == 0 {
+		if m.suppress {
+			return nil
+		}
+		return n
+	}
+	return &matchNotice{Notice: n, matches: matches}
+}
+
+// match reads the region of file changed since its offset, returning its matching lines.
+func (m *matchWatcher) match(file string) ([]Match, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		delete(m.offsets, file)
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+
+	offset, known := m.offsets[file]
+	start, appended := offset, known && offset <= size
+	if !appended {
+		start = 0
+		if size > m.maxSize {
+			start = size - m.maxSize
+		}
+	}
+	data := make([]byte, minSize(size-start, m.maxSize))
+	n, err := f.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	data = data[:n]
+
+	end := len(data)
+	if appended && int64(n) < m.maxSize {
+		/* a line still being written is matched once complete */
+		end = bytes.LastIndexByte(data, '\n') + 1
+		m.offsets[file] = start + int64(end)
+	} else {
+		m.offsets[file] = size
+	}
+	if start > 0 && !appended {
+		/* skip the line cut by reading the last bytes */
+		if i := bytes.IndexByte(data, '\n'); i >= 0 && i < end {
+			data, start, end = data[i+1:], start+int64(i+1), end-i-1
+		}
+	}
+
+	var matches []Match
+	for pos := 0; pos < end && len(matches) < match_limit; {
+		line := data[pos:end]
+		if i := bytes.IndexByte(line, '\n'); i >= 0 {
+			line = line[:i]
+		}
+		for _, re := range m.patterns {
+			if re.Match(line) {
+				matches = append(matches, Match{Pattern: re.String(), Offset: start + int64(pos), Line: string(line)})
+				break
+			}
+		}
+		pos += len(line) + 1
+	}
+	return matches, nil
+}
+
+func minSize(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -3,9 +3,12 @@
 package fsmonitor
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"regexp"
@@ -13,12 +16,91 @@ import (
 
 const (
 	notice_buffer_length = 1000
+	errors_buffer_length = 100
 )
 
 // Monitor initializes environment, coordinates with Watchers and collects events.
 type Monitor struct {
+	address string
 	notices chan Notice
+	/* see Errors */
+	errs    chan error
 	closing chan chan error
+	rescans chan rescanRequest
+	/* intervals swapped by UpdateConfig */
+	intervals chan time.Duration
+	stopped chan struct{}
+
+	/* effective filters, events are completed by Start() */
+	mu      sync.Mutex
+	filters FilterSet
+	windows []*MaintenanceWindow
+	rules   []compiledRule
+	stats   Stats
+
+	/* consumers Notices() is fanned out to, see Subscribe */
+	subs      map[*subscription]struct{}
+	fannedOut bool
+	/* sinks publishing subscriptions, see AttachSink */
+	sinks     sync.WaitGroup
+	attached  []*attachedSink
+	/* functions called with notices, see Handle and WithHandlerPool */
+	handlers   []handler
+	hdlWorkers int
+	hdlTimeout time.Duration
+	/* notices delivered until acknowledged, see WithAcks, and the context of Close */
+	acks *acker
+	drain context.Context
+	/* closed once closing gives up, blocked deliveries drop instead, see Close */
+	halt      chan struct{}
+	halting   sync.Once
+	undrained bool
+	/* schedules scans, the system clock if nil, see WithClock */
+	clock Clock
+	/* goroutines started, see VerifyShutdown */
+	goroutines goroutines
+
+	/* latencies recorded since previous scan, see WithSLO */
+	slo       SLO
+	sloTarget time.Duration
+	sloTotal  uint64
+	sloMet    uint64
+
+	/* see WithBufferSize and WithLogger */
+	buffer int
+	logger logSink
+
+	/* see WithIDs */
+	ids IDGenerator
+	/* scans by cron expression instead of every sleep, see WithSchedule */
+	schedule *Schedule
+	/* see WithAdaptiveInterval */
+	adaptive adaptive
+	/* see WithDebounce */
+	debounce time.Duration
+	/* removed files held back to pair with created ones, see WithMoves */
+	moves *mover
+	/* last notices of paths, see WithOrdering */
+	order *orderer
+	/* see WithJournal */
+	journal Journal
+	/* see WithTracer */
+	tracer Tracer
+	/* time the last notice was appended at, see journaled */
+	appended time.Time
+	/* see WithOverflow */
+	overflow Overflow
+	/* pause after failed scans, see WithBackoff */
+	backoff Backoff
+	/* see Pause */
+	pause pause
+	/* see WithNoiseAnalysis */
+	noise *NoiseAnalyzer
+	/* see WithMaxAge */
+	maxAge    time.Duration
+	dropStale bool
+	/* notices delivered per scan instead of through notices, see Batches */
+	batches chan *NoticeBatch
 
 	watcher Watcher	
 }
@@ -27,12 +109,46 @@ var Logger = log.New(ioutil.Discard, "[Monitor] ", log.LstdFlags)
 
 
 // Start starts Wathcer goroutine and loops until internal channels closes.
+// Only notices of given event types are delivered, including scan errors as ErrorNotice if FileError is given,
+// and LatencyAlert if LatencyViolation is given.
+// Without event types, those of the FilterSet given by WithFilters are delivered.
 func (m *Monitor) Start(sleep time.Duration, event ...Event){
+	m.StartContext(context.Background(), sleep, event...)
+}
+
+// StartContext behaves as Start, until ctx is done or Stop is called. Either way the Watcher goroutine
+// terminates and Notices() closes, Stop returns immediately afterwards.
+func (m *Monitor) StartContext(ctx context.Context, sleep time.Duration, event ...Event){
 
 	var returning chan error
+	var stopping bool
 
-	var noticeBuffer = make(chan Notice, notice_buffer_length)
-	var timeTick = time.Tick(sleep)
+	/* interval until the next scan, see WithAdaptiveInterval */
+	var interval = sleep
+	if m.adaptive.enabled() {
+		interval = m.adaptive.clamp(sleep)
+	}
+
+	m.mu.Lock()
+	if len(event) > 0 {
+		m.filters.Events = 0
+		for _, e := range event {
+			m.filters.Events |= e
+		}
+	}
+	var mask = m.filters.Events
+	var pushdown = Pushdown{Events: mask, Prefix: m.filters.Prefix, MinSize: m.filters.MinSize, MaxSize: m.filters.MaxSize}
+	m.sloTarget = time.Duration(float64(sleep) * m.slo.Intervals)
+	var batches = m.batches
+	if m.schedule == nil {
+		m.stats.Interval = interval
+	}
+	m.mu.Unlock()
+
+	var noticeBuffer = make(chan Notice, m.buffer)
+	/* partial rescans sending into noticeBuffer from goroutines of their own */
+	var rescanning sync.WaitGroup
+	var timeTick = m.tick(interval)
 
 	/* Kick off watcher goroutine here and use for range loop to avoid contention
 	 * by blocking only one scan() goroutine for the Notice channel
@@ -45,129 +161,713 @@ func (m *Monitor) Start(sleep time.Duration, event ...Event){
 	 * 
 	 */
 
+	/* Watchers able to skip what's filtered anyway don't send it at all */
+	if pd, ok := m.watcher.(Pushdowner); ok {
+		pd.PushDown(pushdown)
+	}
 	ncc, errorCheck := m.watcher.Watch()
+	done := ctx.Done()
+	/* the Watcher goroutine has returned once errorCheck closes */
+	m.goroutines.enter("scan loop")
+	defer m.goroutines.exit("scan loop")
+	m.goroutines.enter("watcher")
+
+	/* notices of the running scan when delivered in batches */
+	var batch *NoticeBatch
+	/* notices of full Notices() queued on disk, see WithOverflow */
+	var spilled *spill
+	if m.overflow == OverflowSpill {
+		spilled = newSpill(m)
+	}
+	send := func(n Notice){
+		if batches == nil {
+			m.offer(n, spilled)
+			return
+		}
+		if batch == nil {
+			batch = &NoticeBatch{Start: time.Now()}
+		}
+		batch.Notices = append(batch.Notices, n)
+	}
+	/* ends the batch of the completed scan, delivered unless empty */
+	sendBatch := func(err error){
+		if batches == nil {
+			return
+		}
+		if batch == nil {
+			batch = &NoticeBatch{Start: time.Now()}
+		}
+		if len(batch.Notices) > 0 || err != nil {
+			batch.End, batch.Err = time.Now(), err
+			select {
+			case batches<-batch:
+				m.blocked(time.Since(batch.End))
+			case <-m.halt:
+				m.dropped(uint64(len(batch.Notices)))
+			}
+		}
+		batch = nil
+	}
+
+	deliver := func(n Notice){
+		if m.order != nil && m.order.duplicate(n) {
+			m.duplicated()
+			return
+		}
+		/* notices identified by a Watcher already, e.g. MoveWatcher, keep their IDs */
+		var in IdentifiedNotice
+		if m.ids != nil && !NoticeAs(n, &in) {
+			n = &identifiedNotice{Notice: n, id: m.ids.ID(n)}
+		}
+		if n = m.aged(n, time.Now()); n == nil {
+			return
+		}
+		m.logger.debug("File change noticed", "path", n.Name(), "event", n.Type())
+		m.record(n)
+		at := m.journaled(n)
+		if m.journal != nil {
+			n = &journaledNotice{Notice: n, at: at}
+		}
+		if m.acks != nil && batches == nil {
+			n = m.acks.track(n, at)
+		}
+		send(n)
+	}
+
+	/* notices held back per path are checked a few times per window */
+	var debounce *debouncer
+	var debounceTick <-chan time.Time
+	if m.debounce > 0 {
+		debounce = newDebouncer(m.debounce)
+		ticker := time.NewTicker(m.debounce/4 + time.Millisecond)
+		defer ticker.Stop()
+		debounceTick = ticker.C
+	}
+
+	debounced := func(n Notice){
+		if debounce == nil {
+			deliver(n)
+			return
+		}
+		for _, n := range debounce.add(n, time.Now()) {
+			deliver(n)
+		}
+	}
+
+	/* removed files held back are checked a few times per window */
+	var moveTick <-chan time.Time
+	if m.moves != nil {
+		ticker := time.NewTicker(m.moves.window/4 + time.Millisecond)
+		defer ticker.Stop()
+		moveTick = ticker.C
+	}
+
+	/* failed scans in a row, degraded since the first */
+	var failures int
+	var degraded time.Time
+	var lastErr error
+	/* notices of the scan after resuming are dropped, see Pause */
+	var discarding bool
+	var discarded int
+	/* notices delivered since the previous scan, shrinking the adaptive interval */
+	var active bool
+	/* start and number of the scan running, see Stats */
+	var started time.Time
+	var scans uint64
+	/* trace of the scan running, see WithTracer */
+	var scanning *scanTrace
+
+	receive := func(n Notice){
+		n = scanning.traced(n)
+		if discarding {
+			discarded++
+			return
+		}
+		/* maintenance windows and rules may suppress or tag the notice */
+		if n.Type()&mask != 0 && pushdown.matches(n) {
+			active = true
+			if n = m.rule(m.maintenance(n)); n != nil {
+				if m.moves == nil {
+					debounced(n)
+				} else {
+					for _, n := range m.moves.add(n, time.Now()) {
+						debounced(n)
+					}
+				}
+			}
+		}
+	}
+
+	/* notices in flight are redelivered a few times per timeout, see WithAcks */
+	var ackTick <-chan time.Time
+	if m.acks != nil && batches == nil {
+		ticker := time.NewTicker(m.acks.timeout/4 + time.Millisecond)
+		defer ticker.Stop()
+		ackTick = ticker.C
+		for _, n := range m.acks.restore() {
+			send(n)
+		}
+	}
+
+	/* release pending Rescan() calls once the loop returns */
+	defer close(m.stopped)
 
 	for {
 		select {
 		case returning = <-m.closing:
-			Logger.Println("Returning from scanning loop...")
-			/* close so scan() can return */
-			close(ncc)
+			m.logger.debug("Returning from scanning loop")
+			if !stopping {
+				/* close so scan() can return */
+				close(ncc)
+				stopping, timeTick = true, nil
+			}
+		case <-done:
+			m.logger.debug("Context done, returning from scanning loop")
+			done = nil
+			if !stopping {
+				close(ncc)
+				stopping, timeTick = true, nil
+			}
 		case <-timeTick:
+			scan, discard := m.scanning(m.now())
+			if !scan {
+				/* schedules and adaptive intervals tick once, fixed intervals keep ticking */
+				if m.schedule != nil || m.adaptive.enabled() {
+					timeTick = m.tick(interval)
+				}
+				break
+			}
+			discarding = discard
 			timeTick = nil
+			if batches != nil && batch == nil {
+				batch = &NoticeBatch{Start: time.Now()}
+			}
+			started = time.Now()
+			scans++
+			scanning = m.startScan(ctx, scans)
 			ncc<-noticeBuffer
+		case sleep = <-m.intervals:
+			interval = sleep
+			if m.adaptive.enabled() {
+				interval = m.adaptive.clamp(sleep)
+			}
+			m.mu.Lock()
+			m.sloTarget = time.Duration(float64(sleep) * m.slo.Intervals)
+			m.stats.Interval = interval
+			m.mu.Unlock()
+			/* waiting for the next scan, not backing off */
+			if timeTick != nil && failures == 0 {
+				timeTick = m.tick(interval)
+			}
+		case req := <-m.rescans:
+			/* Watcher sends notices from rescan into the buffer drained by this loop,
+			 * so wait for the result in another goroutine */
+			rescanning.Add(1)
+			m.goroutines.run("rescan", func(){
+				defer rescanning.Done()
+				req.done <- m.watcher.(Rescanner).Rescan(req.subpath, noticeBuffer)
+			})
 		case n := <-noticeBuffer:
-			for _, e := range event {
-				if e == n.Type() {
-					Logger.Printf("File change noticed: %v", n)
-					m.notices<-n
-				}
+			receive(n)
+		case now := <-ackTick:
+			for _, n := range m.acks.due(now) {
+				send(n)
+			}
+		case now := <-moveTick:
+			for _, n := range m.moves.due(now) {
+				debounced(n)
+			}
+		case now := <-debounceTick:
+			for _, n := range debounce.due(now) {
+				deliver(n)
 			}
 		/* use error channel to indicate accomplishment of every check from Watcher */
 		// still selectable after closing errorCheck, even without ok check
 		case err , ok:= <-errorCheck:
 			if !ok{
 				/* scan() closes status channel, which means it returns due to close of channel of notice channel */
+				m.goroutines.exit("watcher")
+				drain := m.draining()
+				/* rescans in flight may still send into the buffer, e.g. relayed by Decorate, until they return */
+				rescanned := make(chan struct{})
+				m.goroutines.run("rescans", func(){
+					rescanning.Wait()
+					close(rescanned)
+				})
+				for waiting := true; waiting; {
+					select{
+					case n := <-noticeBuffer:
+						if drain != nil {
+							receive(n)
+						} else {
+							m.dropped(1)
+						}
+					case <-rescanned:
+						waiting = false
+					}
+				}
 				select{
 				/* check buffered notice */
 				case n:=<-noticeBuffer:
-					Logger.Printf("System interrupt! %d buffered notices ignored from %v", len(noticeBuffer)+1, n)
+					if drain != nil {
+						/* closing delivers what Stop ignores */
+						for receive(n); len(noticeBuffer) > 0; {
+							receive(<-noticeBuffer)
+						}
+						break
+					}
+					m.logger.warn("System interrupt, buffered notices ignored", "ignored", len(noticeBuffer)+1, "path", n.Name(), "event", n.Type())
+					m.dropped(uint64(len(noticeBuffer)+1))
 				default:
-					Logger.Printf("System interrupt! no buffered notice ignored.")
+					m.logger.debug("System interrupt, no buffered notice ignored")
+				}
+				/* notices held back are delivered rather than lost */
+				if m.moves != nil {
+					for _, n := range m.moves.flush() {
+						debounced(n)
+					}
+				}
+				if debounce != nil {
+					for _, n := range debounce.flush() {
+						deliver(n)
+					}
+				}
+				sendBatch(nil)
+				if drain != nil && ackTick != nil {
+					m.acked(drain, ackTick, send)
+				}
+				/* nothing is delivered anymore */
+				if m.journal != nil {
+					if err := m.journal.Close(); err != nil {
+						m.logger.error("Failed to close journal", "error", err)
+					}
+				}
+				/* spilled notices are sent before closing */
+				if spilled != nil {
+					spilled.close()
+				}
+				if drain != nil && drain.Err() != nil {
+					m.logger.warn("Draining timed out, notices left were dropped", "error", drain.Err())
+					m.mu.Lock()
+					m.undrained = true
+					m.mu.Unlock()
 				}
 				/* notice channel can safely close as scan() has returned already */
 				close(noticeBuffer)
+				close(m.notices)
+				close(m.errs)
+				if batches != nil {
+					close(batches)
+				}
 				/* returns nil error as no error is supposed to show up in this block */
-				returning <- nil
+				if returning != nil {
+					returning <- nil
+				}
 				return
 
-			} else if err != nil {
-				Logger.Printf("Error occured while scanning, break for a while and continue: %v", err)
-				timeTick = time.After(time.Now().Add(100 * time.Second).Sub(time.Now()))
+			}
+			/* notices of the scan still buffered carry its trace */
+			for scanning != nil && len(noticeBuffer) > 0 {
+				receive(<-noticeBuffer)
+			}
+			if discarding {
+				m.logger.info("Changes made while paused discarded", "scan", scans, "discarded", discarded)
+				discarding, discarded = false, 0
+			}
+			if err != nil {
+				m.logger.error("Error occured while scanning, break for a while and continue", "scan", scans, "error", err)
+				m.failed(err)
+				/* deliver inline only to consumers asking for it */
+				if mask&FileError != 0 {
+					send(&ErrorNotice{Address: m.address, Err: err, timestamp: time.Now()})
+				}
+				if failures++; failures == 1 {
+					degraded = time.Now()
+					m.logger.warn("Monitor degraded", "scan", scans)
+					if mask&MonitorDegraded != 0 {
+						send(&DegradedNotice{Address: m.address, Err: err, Failures: failures, Since: degraded, event: MonitorDegraded, timestamp: degraded})
+					}
+				}
+				lastErr = err
+				sendBatch(err)
+				if !stopping {
+					if isolated(err) {
+						/* sources of a CompositeWatcher failing alone don't pause the others */
+						timeTick = m.tick(interval)
+					} else {
+						timeTick = m.after(m.backoff.pause(failures))
+					}
+				}
 			} else {
-				timeTick = time.Tick(sleep)
+				if failures > 0 {
+					m.logger.info("Monitor recovered", "scan", scans, "failures", failures)
+					if mask&MonitorRecovered != 0 {
+						send(&DegradedNotice{Address: m.address, Err: lastErr, Failures: failures, Since: degraded, event: MonitorRecovered, timestamp: time.Now()})
+					}
+					failures = 0
+				}
+				if a := m.evaluate(); a != nil {
+					m.logger.warn("Detection latency SLO violated", "scan", scans, "target", a.Target, "attained", a.Attained, "total", a.Total)
+					if mask&LatencyViolation != 0 {
+						send(a)
+					}
+				}
+				sendBatch(nil)
+				if !stopping {
+					if m.adaptive.enabled() {
+						interval = m.adaptive.adapt(interval, active)
+						m.mu.Lock()
+						m.stats.Interval = interval
+						m.mu.Unlock()
+					}
+					timeTick = m.tick(interval)
+				}
 			}
+			m.scanned(started, failures)
+			m.endScan(scanning, err)
+			scanning = nil
+			active = false
 		}
 	}
 }
 
 
+// Rescan re-checks only the given sub-resource (e.g. a sub-directory for the "path" Watcher)
+// immediately instead of waiting for next scan. Changes are delivered through Notices() as usual.
+// Blocks until the partial check completes, Watcher must implement Rescanner.
+func (m *Monitor) Rescan(subpath string) error {
+	if _, ok := m.watcher.(Rescanner); !ok {
+		return fmt.Errorf("Watcher %T doesn't support partial rescan", m.watcher)
+	}
+
+	done := make(chan error, 1)
+	select {
+	case m.rescans <- rescanRequest{subpath: subpath, done: done}:
+		return <-done
+	case <-m.stopped:
+		return fmt.Errorf("Monitor has been stopped")
+	}
+}
+
+// Preview checks for changes and returns notices the Watcher would send, without updating its state
+// or delivering them through Notices(). Notices are not filtered by event types given to Start.
+// Watcher must implement Previewer.
+func (m *Monitor) Preview() ([]Notice, error) {
+	p, ok := m.watcher.(Previewer)
+	if !ok {
+		return nil, fmt.Errorf("Watcher %T doesn't support preview", m.watcher)
+	}
+	return p.Preview()
+}
+
+// Explain reports which rules of the Watcher apply to path and whether its changes are noticed,
+// for debugging missing notices. Watcher must implement Explainer.
+func (m *Monitor) Explain(path string) (*Explanation, error) {
+	e, ok := m.watcher.(Explainer)
+	if !ok {
+		return nil, fmt.Errorf("Watcher %T doesn't support explaining", m.watcher)
+	}
+	return e.Explain(path), nil
+}
+
+// Filters exports the effective filter configuration, to be imported elsewhere by WithFilters.
+// Event types are the ones given to Start, once it has been called.
+func (m *Monitor) Filters() FilterSet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f := m.filters
+	f.Patterns = append([]string(nil), f.Patterns...)
+	f.Excludes = append([]string(nil), f.Excludes...)
+	return f
+}
+
 // Notices returns channel of all notices, which to be closed when calling Close().
 func (m *Monitor) Notices()  (<-chan Notice){
 	return m.notices
 }
 
-// Stop safely closes all internal channels and gracefully terminates all goroutines.
+// Stop safely closes all internal channels and gracefully terminates all goroutines, including attached sinks.
 func (m *Monitor) Stop() error {
+	err := m.stop()
+	/* notices left are published before sinks close */
+	m.sinks.Wait()
+	return err
+}
+
+// stop terminates the scan loop, returning once Notices() closed.
+func (m *Monitor) stop() error {
 	var err error
 	stopper := make(chan error)
 
 	/* terminate scan loop */
-	m.closing <- stopper
+	select {
+	case m.closing <- stopper:
+	case <-m.stopped:
+		/* already returned, e.g. as the context given to StartContext is done */
+		return nil
+	}
 
-	/* Block until Watch() for select loop return */
+	/* Block until Watch() for select loop return, which closes the notice channel */
 	if e := <-stopper; e != nil {
 		err = fmt.Errorf("%vScanner Error: %v\n", err, e)
-		Logger.Fatalln("Failed to stop scanner gracefully!", e)
+		m.logger.error("Failed to stop scanner gracefully", "error", e)
 	}
-	close(m.notices)
-
-	Logger.Printf("Event channel successfully closed!\n")
 
+	m.logger.debug("Event channel successfully closed")
 	return err
 }
 
 // New creates specified Watcher and include it in returned Monitor instance.
-func New(address string, pattern []string, watcher interface{}) *Monitor {
+// Options tune the Monitor and builtin Watchers, e.g. WithProfile(NFS).
+// Exits on invalid configuration, which can be checked beforehand by Validate, see NewMonitor for an error instead.
+func New(address string, pattern []string, watcher interface{}, opt ...Option) *Monitor {
+	m, err := build(address, pattern, watcher, opt...)
+	if err != nil {
+		Logger.Fatalln(err)
+	}
+	return m
+}
 
-	/* pattern filtering, return fatal status when pattern doesn't compile correctly. */
-	var patexp = make([]regexp.Regexp, len(pattern), len(pattern))
-	for _, pat := range pattern {
-		if exp, err := regexp.Compile(pat); err != nil {
+// Validate reports the configuration error New would exit on, without creating the Monitor.
+func Validate(address string, pattern []string, watcher interface{}, opt ...Option) error {
+	_, err := build(address, pattern, watcher, opt...)
+	return err
+}
 
-			Logger.Fatalln("Pattern string failed compilation, please check syntax!", err)
-		} else {
-			patexp = append(patexp, *exp)
+// NewMonitor creates the Monitor configured by options, returning error on invalid configuration, e.g.
+// NewMonitor(WithPath("/data"), WithPatterns(`\.csv$`)). The builtin "path" Watcher is used unless WithWatcher is given.
+func NewMonitor(opt ...Option) (*Monitor, error) {
+	opts, err := apply(opt)
+	if err != nil {
+		return nil, err
+	}
+	if opts.watcher == nil {
+		opts.watcher = "path"
+	}
+	if opts.debounce == 0 {
+		opts.debounce = opts.filters.Debounce
+	}
+	if opts.overflow != OverflowBlock && opts.outBuffer == 0 {
+		opts.outBuffer = notice_buffer_length
+	}
 
+	m := &Monitor{
+		address: opts.address,
+		notices: make(chan Notice, opts.outBuffer),
+		errs:    make(chan error, errors_buffer_length),
+		closing: make(chan chan error),
+		rescans: make(chan rescanRequest),
+		intervals: make(chan time.Duration),
+		stopped: make(chan struct{}),
+		halt:    make(chan struct{}),
+		filters: FilterSet{Events: opts.filters.Events, Prefix: opts.filters.Prefix, MinSize: opts.filters.MinSize, MaxSize: opts.filters.MaxSize, Debounce: opts.debounce},
+		stats:   newStats(),
+		slo:     opts.slo,
+		ids:     opts.ids,
+		schedule: opts.schedule,
+		adaptive: opts.adaptive,
+		debounce: opts.debounce,
+		journal: opts.journal,
+		tracer:  opts.tracer,
+		overflow: opts.overflow,
+		backoff: opts.backoff,
+		maxAge:  opts.maxAge,
+		dropStale: opts.dropStale,
+		buffer:  opts.buffer,
+		hdlWorkers: opts.hdlWorkers,
+		hdlTimeout: opts.hdlTimeout,
+		clock:   opts.clock,
+		logger:  newLogSink(opts.logger, opts.fieldLog),
+	}
+	if m.rules, err = compileRules(opts.rules); err != nil {
+		return nil, err
+	}
+	if m.schedule != nil && m.adaptive.enabled() {
+		return nil, fmt.Errorf("Schedule and adaptive interval must not be given both")
+	}
+	if m.buffer == 0 {
+		m.buffer = notice_buffer_length
+	}
+	if m.backoff.Initial == 0 {
+		m.backoff = Backoff{Initial: backoff_initial}
+	}
+	if opts.noise {
+		roots := opts.roots
+		if opts.address != "" {
+			roots = append([]string{opts.address}, roots...)
 		}
+		m.noise = NewNoiseAnalyzer(roots...)
 	}
 
-	switch tw:= watcher.(type){
-	default:
-		Logger.Fatalln("Watcher type not recognized! %T",tw)
+	switch tw:= opts.watcher.(type){
 	case string:
-		switch tw{
-		case "path":
-		return &Monitor{
-			notices: make(chan Notice),
-			closing: make(chan chan error),
-			watcher: &pathScanner{
-				address: address,
-				pattern: patexp,
-			},
-		}
-		case "file":
-		return &Monitor{
-			notices: make(chan Notice),
-			closing: make(chan chan error),
-			watcher: &fileScanner{
-				address: address,
-				pattern: patexp,
-			},
+		roots := opts.roots
+		if opts.address != "" {
+			roots = append([]string{opts.address}, roots...)
 		}
+		var w Watcher
+		switch {
+		case opts.multi:
+			m.address = strings.Join(roots, ", ")
+			w, err = newMultiWatcher(tw, roots, opts)
+		case len(roots) == 0:
+			return nil, fmt.Errorf("Path to watch must be given by WithPath")
 		default:
-			/* must provide valid watcher type */
-			Logger.Fatalln("Watcher name not recognized!")
+			w, err = newWatcher(tw, opts)
 		}
+		if err != nil {
+			return nil, err
+		}
+		m.watcher = w
+		m.filters.Patterns = append(opts.patterns[:len(opts.patterns):len(opts.patterns)], opts.filters.Patterns...)
+		m.filters.Excludes = append(opts.excludes[:len(opts.excludes):len(opts.excludes)], opts.filters.Excludes...)
 	case Watcher:
-		return &Monitor{
-			notices: make(chan Notice),
-			closing: make(chan chan error),
-			watcher: tw,
+		m.watcher = tw
+	}
+	if m.address != "" {
+		m.logger = m.logger.with("root", m.address)
+	}
+	if opts.ordered {
+		m.order = newOrderer()
+	}
+	if opts.moveWait > 0 {
+		roots := opts.roots
+		if opts.address != "" {
+			roots = append([]string{opts.address}, roots...)
+		}
+		m.moves = newMover(opts.moveWait, opts.moveBy, roots)
+	}
+	if opts.ackWait > 0 {
+		if m.overflow == OverflowSpill {
+			return nil, fmt.Errorf("Acks must not be given along with OverflowSpill")
 		}
+		m.acks = newAcker(opts.ackWait, m.journal, m.logger)
+	}
+	return m, nil
+}
 
+// NewWatcher creates one of the builtin Watchers by name, see New.
+// Useful to wrap builtin Watchers, e.g. by Decorate, before passing them to New.
+func NewWatcher(name string, address string, pattern []string, opt ...Option) (Watcher, error) {
+	opts, err := apply(opt)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	opts.address = address
+	opts.patterns = append(pattern[:len(pattern):len(pattern)], opts.patterns...)
+	return newWatcher(name, opts)
 }
 
+// newWatcher creates one of the builtin Watchers by name, watching the path and patterns given by options.
+func newWatcher(name string, opts *options) (Watcher, error) {
+
+	/* imported filter set extends given patterns */
+	pattern := append(opts.patterns[:len(opts.patterns):len(opts.patterns)], opts.filters.Patterns...)
+
+	/* pattern filtering, return error status when pattern doesn't compile correctly.
+	 * relative patterns are anchored at the watched path */
+	root := canonicalAddress(opts.address)
+	var patexp = make([]regexp.Regexp, 0, len(pattern))
+	for _, pat := range pattern {
+		if exp, err := compilePatternAt(pat, root); err != nil {
+			return nil, fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		} else {
+			patexp = append(patexp, *exp)
+
+		}
+	}
+
+	var exclude []regexp.Regexp
+	for _, pat := range append(opts.excludes[:len(opts.excludes):len(opts.excludes)], opts.filters.Excludes...) {
+		exp, err := compilePatternAt(pat, root)
+		if err != nil {
+			return nil, fmt.Errorf("Exclude pattern failed compilation, please check syntax! %v", err)
+		}
+		exclude = append(exclude, *exp)
+	}
+
+	switch name{
+	case "path", "native", "hybrid":
+		s := &pathScanner{
+			address: canonicalAddress(opts.address),
+			pattern: patexp,
+			exclude: exclude,
+			ignoreFile: opts.ignoreFile,
+			maxDepth: opts.maxDepth,
+			maxSize: opts.maxSize,
+			modWithin: opts.modWithin,
+			profile: opts.profile,
+			concurrency: opts.workers,
+			states: opts.states,
+			snapshots: opts.snapshots,
+			mountpoint: opts.mountpoint,
+			twoPhase: opts.twoPhase,
+			settle: opts.settle,
+			locks: opts.locks,
+			shards: opts.shards,
+			streams: opts.streams,
+			dirs: opts.dirs,
+			swaps: opts.swaps,
+			procRoot: opts.procRoot,
+			initial: opts.initial,
+			scanDone: opts.scanDone,
+			kind: name,
+			logger: newLogSink(opts.logger, opts.fieldLog, "root", canonicalAddress(opts.address)),
+		}
+		s.profile.faults = opts.faults
+		s.profile.follow = opts.follow
+		s.profile.statRate, s.profile.sumRate = opts.statRate, opts.sumRate
+		if opts.gitAware {
+			s.git = newGitAware(opts.gitEnrich)
+		}
+		if opts.subtrees != nil {
+			s.subtrees = newSubtrees(*opts.subtrees)
+		}
+		if opts.usage {
+			s.usage = newDiskUsage(s.address, opts.quotas)
+		}
+		if name != "path" {
+			native, err := newNativeWatcher()
+			if err != nil {
+				return nil, err
+			}
+			s.native = native
+			if opts.access != 0 {
+				s.access = newAccessLog(opts.access, opts.accessWin)
+				native.watchAccess(s.access)
+			}
+		}
+		if name == "hybrid" {
+			s.reconcile = opts.reconcile
+			if s.reconcile == 0 {
+				s.reconcile = reconcile_interval
+			}
+		}
+		return s, nil
+	case "file":
+		return &fileScanner{
+			address: opts.address,
+			pattern: patexp,
+		}, nil
+	}
+	/* must provide valid watcher type */
+	return nil, fmt.Errorf("Watcher name not recognized! %q", name)
+}
+
+// apply applies every Option.
+func apply(opt []Option) (*options, error) {
+	var opts options
+	for _, o := range opt {
+		if err := o(&opts); err != nil {
+			return nil, fmt.Errorf("Option failed to apply, please check its values! %v", err)
+		}
+	}
+	return &opts, nil
+}
+
+// build creates the Monitor, returning error on invalid configuration.
+func build(address string, pattern []string, watcher interface{}, opt ...Option) (*Monitor, error) {
+	return NewMonitor(append([]Option{WithPath(address), WithPatterns(pattern...), WithWatcher(watcher)}, opt...)...)
+}
 
@@ -0,0 +1,34 @@
+//go:build !windows
+// +build !windows
+
+package fsmonitor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// mounted reports whether a file system is mounted at path, by comparing its device with the parent's.
+func mounted(path string) (bool, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	parent, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		return false, err
+	}
+	/* file system root is its own parent */
+	if os.SameFile(info, parent) {
+		return true, nil
+	}
+	st, ok1 := info.Sys().(*syscall.Stat_t)
+	pst, ok2 := parent.Sys().(*syscall.Stat_t)
+	if !ok1 || !ok2 {
+		return true, nil
+	}
+	return st.Dev != pst.Dev, nil
+}
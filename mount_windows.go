@@ -0,0 +1,22 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"os"
+)
+
+// mounted reports whether the volume of path is present and path is accessible.
+func mounted(path string) (bool, error) {
+	resolved, err := resolveAddress(canonicalAddress(path))
+	if err != nil {
+		return false, nil
+	}
+	if _, err := os.Stat(resolved); os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,435 @@
+package fsmonitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	/* bytes digested at both ends of files, see MoveWatcher */
+	move_sample_length = 1 << 20
+)
+
+// MoveInfo is returned by Notice.More of MoveDetected notices, Notice.Name is the new path.
+type MoveInfo struct {
+	OldPath string
+	NewPath string
+	// IDs of the FileRemove and FileCreate notices linked, empty without IDGenerator
+	RemovedID string
+	CreatedID string
+	// When the file was noticed removed
+	Removed time.Time
+	Digest  string
+}
+
+// moveNotice implements Notice for a move linking notices of different scans,
+// uses the new path as Notice.Name and the MoveInfo as Notice.More.
+type moveNotice struct {
+	move      *MoveInfo
+	timestamp time.Time
+}
+
+func (m *moveNotice) String() string {
+	return fmt.Sprintf("{%v : %v : from %v}", m.move.NewPath, MoveDetected, m.move.OldPath)
+}
+
+func (m *moveNotice) Name() string {
+	return m.move.NewPath
+}
+
+func (m *moveNotice) Type() Event {
+	return MoveDetected
+}
+
+func (m *moveNotice) More() interface{} {
+	return m.move
+}
+
+func (m *moveNotice) Info() NoticeInfo {
+	return moreInfo(m.move)
+}
+
+func (m *moveNotice) Time() time.Time {
+	return m.timestamp
+}
+
+// MoveWatcher wraps a Watcher, following a FileCreate by a MoveDetected notice when the content of a file
+// removed within horizon before appears, e.g. as media libraries are reorganized over minutes.
+// Content is compared by size and digests of the first and last MiB, files under address are digested beforehand.
+// Given ids, FileCreate and FileRemove notices are assigned IDs implementing IdentifiedNotice, which Monitor keeps,
+// so MoveInfo references the notices linked.
+func MoveWatcher(w Watcher, address string, horizon time.Duration, ids IDGenerator) (Watcher, error) {
+	m := &moveWatcher{
+		horizon: horizon,
+		ids:     ids,
+		digests: make(map[string]string),
+		removed: make(map[string][]*removal),
+	}
+
+	err := filepath.Walk(canonicalAddress(address), func(file string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		if d, err := sampleDigest(file); err == nil {
+			m.digests[file] = d
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &decoratedWatcher{
+		watcher:  w,
+		decorate: m.decorate,
+		derive:   m.derive,
+	}, nil
+}
+
+// moveWatcher keeps digests of files, and those of files removed within horizon.
+type moveWatcher struct {
+	horizon time.Duration
+	ids     IDGenerator
+
+	mu      sync.Mutex
+	digests map[string]string
+	removed map[string][]*removal
+}
+
+// removal is a file removed within horizon.
+type removal struct {
+	path string
+	id   string
+	at   time.Time
+}
+
+// decorate digests created and updated files, keeps removed ones, and assigns IDs.
+func (m *moveWatcher) decorate(n Notice) Notice {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove) == 0 {
+		return n
+	}
+	var id string
+	if m.ids != nil && n.Type() != FileUpdate {
+		id = m.ids.ID(n)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire(n.Time())
+	switch n.Type() {
+	case FileRemove:
+		if d, ok := m.digests[n.Name()]; ok {
+			delete(m.digests, n.Name())
+			m.removed[d] = append(m.removed[d], &removal{path: n.Name(), id: id, at: n.Time()})
+		}
+	default:
+		if d, err := sampleDigest(n.Name()); err == nil {
+			m.digests[n.Name()] = d
+		} else {
+			delete(m.digests, n.Name())
+		}
+	}
+
+	if id == "" {
+		return n
+	}
+	return &identifiedNotice{Notice: n, id: id}
+}
+
+// derive links a created file to the earliest removed file of the same content.
+func (m *moveWatcher) derive(n Notice) []Notice {
+	if n.Type() != FileCreate {
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.digests[n.Name()]
+	if !ok || len(m.removed[d]) == 0 {
+		return nil
+	}
+	r := m.removed[d][0]
+	if m.removed[d] = m.removed[d][1:]; len(m.removed[d]) == 0 {
+		delete(m.removed, d)
+	}
+
+	move := &MoveInfo{OldPath: r.path, NewPath: n.Name(), RemovedID: r.id, Removed: r.at, Digest: d}
+	var in IdentifiedNotice
+	if NoticeAs(n, &in) {
+		move.CreatedID = in.ID()
+	}
+	return []Notice{&moveNotice{move: move, timestamp: time.Now()}}
+}
+
+// expire drops removed files older than horizon, must be called holding mu.
+func (m *moveWatcher) expire(now time.Time) {
+	for d, rs := range m.removed {
+		kept := rs[:0]
+		for _, r := range rs {
+			if now.Sub(r.at) <= m.horizon {
+				kept = append(kept, r)
+			}
+		}
+		if len(kept) == 0 {
+			delete(m.removed, d)
+		} else {
+			m.removed[d] = kept
+		}
+	}
+}
+
+// sampleDigest digests the size and both ends of a regular file.
+func sampleDigest(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("%s is not a regular file", file)
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00", info.Size())
+	if _, err := io.CopyN(h, f, move_sample_length); err != nil && err != io.EOF {
+		return "", err
+	}
+	if info.Size() > 2*move_sample_length {
+		if _, err := f.Seek(-move_sample_length, io.SeekEnd); err != nil {
+			return "", err
+		}
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	} else if info.Size() > move_sample_length {
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MoveKey tells how WithMoves recognizes a removed file created elsewhere.
+type MoveKey int
+
+const (
+	// Same device and inode, size and modification time, as renames within a scan are recognized
+	MoveByInode MoveKey = iota
+	// Same size and digests of the first and last MiB, files under the watched paths are digested beforehand
+	MoveByContent
+)
+
+// WithMoves holds notices of removed files back for window, so a file moved across scans, e.g. from staging to
+// processed by a slow mover, is delivered as one FileRename telling both paths by RenameInfo instead of a FileRemove
+// and a FileCreate processed twice. Removed files not created elsewhere within window are delivered as removed
+// then, along with those held back on Stop(). Files are recognized by key, by inode where the platform reports none.
+func WithMoves(window time.Duration, key MoveKey) Option {
+	return func(o *options) error {
+		if window <= 0 {
+			return fmt.Errorf("Move window must be positive")
+		}
+		if key != MoveByInode && key != MoveByContent {
+			return fmt.Errorf("Move key not recognized! %v", key)
+		}
+		o.moveWait, o.moveBy = window, key
+		return nil
+	}
+}
+
+// movedNotice reports the FileCreate of a file held back as removed as a FileRename from its old path.
+type movedNotice struct {
+	Notice
+	old string
+}
+
+func (m *movedNotice) Unwrap() Notice {
+	return m.Notice
+}
+
+func (m *movedNotice) Type() Event {
+	return FileRename
+}
+
+func (m *movedNotice) More() interface{} {
+	info, _ := m.Notice.More().(os.FileInfo)
+	return &RenameInfo{FileInfo: info, OldPath: m.old, NewPath: m.Name()}
+}
+
+func (m *movedNotice) Info() NoticeInfo {
+	i := InfoOf(m.Notice)
+	i.OldPath = m.old
+	return i
+}
+
+func (m *movedNotice) String() string {
+	return fmt.Sprintf("{%v : %v : from %v}", m.Name(), FileRename, m.old)
+}
+
+// mover pairs removed and created files across scans, see WithMoves.
+type mover struct {
+	window time.Duration
+	by     MoveKey
+	/* digests of files by path, by content only */
+	digests map[string]string
+	/* removes held back by key and by path */
+	held   map[string][]*heldRemove
+	byPath map[string]*heldRemove
+	seq    uint64
+}
+
+// heldRemove is the notice of a removed file held back.
+type heldRemove struct {
+	n   Notice
+	key string
+	at  time.Time
+	seq uint64
+}
+
+func newMover(window time.Duration, by MoveKey, roots []string) *mover {
+	m := &mover{window: window, by: by, held: make(map[string][]*heldRemove), byPath: make(map[string]*heldRemove)}
+	if by != MoveByContent {
+		return m
+	}
+	m.digests = make(map[string]string)
+	for _, root := range roots {
+		filepath.Walk(canonicalAddress(root), func(file string, info os.FileInfo, err error) error {
+			if err == nil && info.Mode().IsRegular() {
+				if d, err := sampleDigest(file); err == nil {
+					m.digests[file] = d
+				}
+			}
+			return nil
+		})
+	}
+	return m
+}
+
+// add holds n back if a removed file, returning notices to deliver right away.
+func (m *mover) add(n Notice, now time.Time) []Notice {
+	/* the removal of a path goes before anything else about it */
+	notices := m.take(n.Name())
+
+	switch n.Type() {
+	case FileRemove:
+		key := m.key(n)
+		if m.digests != nil {
+			delete(m.digests, n.Name())
+		}
+		if key == "" {
+			break
+		}
+		m.seq++
+		h := &heldRemove{n: n, key: key, at: now, seq: m.seq}
+		m.held[key] = append(m.held[key], h)
+		m.byPath[n.Name()] = h
+		return notices
+	case FileCreate, FileUpdate:
+		if m.digests != nil {
+			if d, err := sampleDigest(n.Name()); err == nil {
+				m.digests[n.Name()] = d
+			} else {
+				delete(m.digests, n.Name())
+			}
+		}
+		if n.Type() == FileUpdate {
+			break
+		}
+		key := m.key(n)
+		if hs := m.held[key]; key != "" && len(hs) > 0 {
+			/* the earliest removed of the same file */
+			m.remove(hs[0])
+			return append(notices, &movedNotice{Notice: n, old: hs[0].n.Name()})
+		}
+	case FileRename:
+		if old := InfoOf(n).OldPath; m.digests != nil && old != "" {
+			if d, ok := m.digests[old]; ok {
+				delete(m.digests, old)
+				m.digests[n.Name()] = d
+			}
+		}
+	}
+	return append(notices, n)
+}
+
+// key identifies the file of n, empty if unknown.
+func (m *mover) key(n Notice) string {
+	if m.by == MoveByContent {
+		return m.digests[n.Name()]
+	}
+	info, ok := n.More().(os.FileInfo)
+	if !ok || info == nil {
+		return ""
+	}
+	/* size and modification time alone tell apart too few files */
+	if _, ok := fileID(info); !ok {
+		return ""
+	}
+	return renameKey(info)
+}
+
+// take returns the removal of path held back, if any.
+func (m *mover) take(path string) []Notice {
+	h, ok := m.byPath[path]
+	if !ok {
+		return nil
+	}
+	m.remove(h)
+	return []Notice{h.n}
+}
+
+func (m *mover) remove(h *heldRemove) {
+	delete(m.byPath, h.n.Name())
+	hs := m.held[h.key]
+	for i := range hs {
+		if hs[i] == h {
+			hs = append(hs[:i], hs[i+1:]...)
+			break
+		}
+	}
+	if len(hs) == 0 {
+		delete(m.held, h.key)
+	} else {
+		m.held[h.key] = hs
+	}
+}
+
+// due returns the removals held back for window, in order of removal.
+func (m *mover) due(now time.Time) []Notice {
+	return m.collect(func(h *heldRemove) bool { return now.Sub(h.at) >= m.window })
+}
+
+// flush returns all removals held back, in order of removal.
+func (m *mover) flush() []Notice {
+	return m.collect(func(*heldRemove) bool { return true })
+}
+
+func (m *mover) collect(ready func(*heldRemove) bool) []Notice {
+	var collected []*heldRemove
+	for _, h := range m.byPath {
+		if ready(h) {
+			collected = append(collected, h)
+		}
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].seq < collected[j].seq })
+
+	notices := make([]Notice, 0, len(collected))
+	for _, h := range collected {
+		m.remove(h)
+		notices = append(notices, h.n)
+	}
+	return notices
+}
@@ -0,0 +1,201 @@
+// Package mqttsink publishes notices to an MQTT broker as a fsmonitor.Sink, by the Eclipse Paho client,
+// e.g. to forward changes from edge devices:
+//
+//	sink, err := mqttsink.New(mqttsink.Config{Broker: "tls://broker:8883", Topic: "fsmonitor/{host}/{event}"})
+//	...
+//	monitor.AttachSink(sink)
+//
+// Messages carry the notice encoded by fsmonitor.MarshalNotice as JSON payload. Given a Status topic, the agent
+// publishes "online" there once connected and "offline" on Close, and leaves "offline" as its last will, so the
+// broker tells subscribers when the agent is gone without closing.
+package mqttsink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Logger reports lost connections, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[MQTT] ", log.LstdFlags)
+
+// Config of a Sink, Broker and Topic are required.
+type Config struct {
+	// URL of the broker, e.g. tcp://broker:1883, ssl:// or tls:// for TLS, ws:// or wss:// for websockets
+	Broker string
+	// Template of the topic of every notice: {host} is replaced by the host name, {event} by its event name,
+	// e.g. FileCreate, {root} by the watched path it's from, e.g. srv_data for /srv/data, {watcher} and {shard}
+	// by those labels, "_" for labels missing, see fsmonitor.NoticeLabels
+	Topic string
+	// 0 at most once, 1 at least once, 2 exactly once
+	QoS byte
+	// Messages are retained by the broker for subscribers yet to come
+	Retained bool
+	// Enables TLS, e.g. with client certificates, by the system roots for ssl:// and tls:// brokers without
+	TLS *tls.Config
+	// fsmonitor-{host} by default, must be unique per broker
+	ClientID string
+	Username string
+	Password string
+	// Topic template of the retained status of the agent, "online" or "offline", also its last will, none without
+	Status string
+	// Delay waiting for the broker to connect or acknowledge a message of QoS 1 or 2, 10 seconds by default
+	Timeout time.Duration
+	Logger  *log.Logger
+}
+
+// Sink implements fsmonitor.Sink by a Paho client, reconnecting automatically.
+type Sink struct {
+	topic    string
+	status   string
+	qos      byte
+	retained bool
+	timeout  time.Duration
+	host     string
+
+	client mqtt.Client
+}
+
+var _ fsmonitor.Sink = (*Sink)(nil)
+
+// New connects to c.Broker, failing if it can't be reached within c.Timeout.
+func New(c Config) (*Sink, error) {
+	if c.Broker == "" {
+		return nil, fmt.Errorf("MQTT broker must be given")
+	}
+	if c.Topic == "" {
+		return nil, fmt.Errorf("MQTT topic must be given")
+	}
+	for _, topic := range []string{c.Topic, c.Status} {
+		if strings.ContainsAny(topic, "+#") {
+			return nil, fmt.Errorf("MQTT topic %q must not contain wildcards", topic)
+		}
+	}
+	if c.QoS > 2 {
+		return nil, fmt.Errorf("MQTT QoS must be 0, 1 or 2, not %d", c.QoS)
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 10 * time.Second
+	}
+	logger := c.Logger
+	if logger == nil {
+		logger = Logger
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get host name: %v", err)
+	}
+
+	s := &Sink{topic: c.Topic, qos: c.QoS, retained: c.Retained, timeout: c.Timeout, host: token(host)}
+	if c.Status != "" {
+		s.status = s.expand(c.Status, nil)
+	}
+	if c.ClientID == "" {
+		c.ClientID = "fsmonitor-" + s.host
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.Broker).
+		SetClientID(c.ClientID).
+		SetUsername(c.Username).
+		SetPassword(c.Password).
+		SetConnectTimeout(c.Timeout).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			logger.Printf("Connection to %s lost, reconnecting: %v", c.Broker, err)
+		})
+	if c.TLS != nil {
+		opts.SetTLSConfig(c.TLS)
+	}
+	if s.status != "" {
+		opts.SetWill(s.status, "offline", 1, true)
+		/* told again after every reconnect, as the will may have been published meanwhile */
+		opts.SetOnConnectHandler(func(client mqtt.Client) {
+			client.Publish(s.status, 1, true, "online")
+		})
+	}
+
+	s.client = mqtt.NewClient(opts)
+	t := s.client.Connect()
+	if !t.WaitTimeout(c.Timeout) {
+		s.client.Disconnect(0)
+		return nil, fmt.Errorf("Failed to connect to MQTT broker %s: timed out after %v", c.Broker, c.Timeout)
+	}
+	if err := t.Error(); err != nil {
+		return nil, fmt.Errorf("Failed to connect to MQTT broker %s: %v", c.Broker, err)
+	}
+	return s, nil
+}
+
+// Publish sends n to its topic, waiting for acknowledgment with QoS 1 or 2.
+func (s *Sink) Publish(n fsmonitor.Notice) error {
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return fmt.Errorf("Notice %v failed encoding: %v", n, err)
+	}
+	topic := s.expand(s.topic, n)
+	t := s.client.Publish(topic, s.qos, s.retained, data)
+	if s.qos == 0 {
+		return nil
+	}
+	if !t.WaitTimeout(s.timeout) {
+		return fmt.Errorf("Failed to publish to %s: timed out after %v", topic, s.timeout)
+	}
+	return t.Error()
+}
+
+// expand returns template with {host}, {event} and labels replaced for n, only {host} without n.
+func (s *Sink) expand(template string, n fsmonitor.Notice) string {
+	if n == nil {
+		return strings.Replace(template, "{host}", s.host, -1)
+	}
+	event := n.Type().String()
+	if i := strings.LastIndexByte(event, '.'); i >= 0 {
+		event = event[i+1:]
+	}
+	labels := fsmonitor.NoticeLabels(n)
+	return strings.NewReplacer("{host}", s.host, "{event}", token(event), "{root}", token(labels.Root), "{watcher}", token(labels.Watcher),
+		"{shard}", token(labels.Shard)).Replace(template)
+}
+
+// token returns s as a single level of topics, all but letters, digits, ., - and _ replaced by _.
+func token(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+	if t := strings.Trim(s, "_"); t != "" {
+		return t
+	}
+	return "_"
+}
+
+// Close tells the agent offline, as the broker doesn't publish the last will of clients disconnecting,
+// then disconnects, waiting up to 1 second for messages in flight.
+func (s *Sink) Close() error {
+	if !s.client.IsConnectionOpen() {
+		s.client.Disconnect(0)
+		return nil
+	}
+	var err error
+	if s.status != "" {
+		t := s.client.Publish(s.status, 1, true, "offline")
+		if !t.WaitTimeout(s.timeout) {
+			err = fmt.Errorf("Failed to publish to %s: timed out after %v", s.status, s.timeout)
+		} else {
+			err = t.Error()
+		}
+	}
+	s.client.Disconnect(1000)
+	return err
+}
@@ -0,0 +1,34 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// WithProcessRoot makes the builtin "path" Watcher watch its address as seen by process pid, through
+// /proc/<pid>/root on Linux, so a host-level daemon can watch inside containers (mount namespaces or chroots)
+// without per-container agents. Notices report paths as seen by the process.
+// Symlinks within the address itself are resolved against the host root by the kernel, so it should have none.
+func WithProcessRoot(pid int) Option {
+	return func(o *options) error {
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("Watching within another process root is only available on Linux")
+		}
+		if pid <= 0 {
+			return fmt.Errorf("Process ID must be positive")
+		}
+		o.procRoot = filepath.Join("/proc", strconv.Itoa(pid), "root")
+		return nil
+	}
+}
+
+// resolve maps a canonical path onto where it can currently be accessed, within the process root if any.
+func (s *pathScanner) resolve(path string) (string, error) {
+	resolved, err := resolveAddress(path)
+	if err != nil || s.procRoot == "" {
+		return resolved, err
+	}
+	return filepath.Join(s.procRoot, resolved), nil
+}
@@ -0,0 +1,45 @@
+package fsmonitor
+
+import (
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	/* default of WithReconciliation */
+	reconcile_interval = 5 * time.Minute
+)
+
+// changes re-checks paths reported by native events against lastCheck, must be called from the Watch() goroutine.
+// Paths are resolved ones, nested paths are covered by re-walking the outermost one.
+func (s *pathScanner) changes(paths []string, emit func(*fileSystemNotice)) error {
+	resolved, err := s.resolve(s.address)
+	if err != nil {
+		return err
+	}
+
+	/* files moved between re-checked paths are renames too */
+	r := newRenames(s.pushdown.Events, emit)
+	defer r.flush()
+
+	sort.Strings(paths)
+	var last string
+	for i, path := range paths {
+		if i > 0 && within(path, last) {
+			continue
+		}
+		last = path
+		if !within(path, resolved) {
+			continue
+		}
+
+		root := s.address + path[len(resolved):]
+		visited, err := s.walk(root, r.send)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.merge(root, visited)
+	}
+	return nil
+}
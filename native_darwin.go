@@ -0,0 +1,220 @@
+//go:build darwin && cgo
+// +build darwin,cgo
+
+package fsmonitor
+
+/*
+#cgo LDFLAGS: -framework CoreServices
+#include <CoreServices/CoreServices.h>
+#include <dispatch/dispatch.h>
+#include <errno.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <unistd.h>
+
+// writes flags and path of every event to the pipe given as info, read by nativeWatcher.read
+static void fsmonitor_write(int fd, const void *buf, size_t len) {
+	while (len > 0) {
+		ssize_t c = write(fd, buf, len);
+		if (c < 0) {
+			if (errno == EINTR) {
+				continue;
+			}
+			return;
+		}
+		buf = (const char *)buf + c;
+		len -= c;
+	}
+}
+
+static void fsmonitor_events(ConstFSEventStreamRef stream, void *info, size_t n, void *paths,
+		const FSEventStreamEventFlags flags[], const FSEventStreamEventId ids[]) {
+	int fd = (int)(intptr_t)info;
+	char **p = paths;
+	for (size_t i = 0; i < n; i++) {
+		uint32_t f = flags[i];
+		fsmonitor_write(fd, &f, sizeof(f));
+		fsmonitor_write(fd, p[i], strlen(p[i]) + 1);
+	}
+}
+
+static void *fsmonitor_start(const char *path, int fd, double latency) {
+	CFStringRef dir = CFStringCreateWithCString(NULL, path, kCFStringEncodingUTF8);
+	if (dir == NULL) {
+		return NULL;
+	}
+	CFArrayRef dirs = CFArrayCreate(NULL, (const void **)&dir, 1, &kCFTypeArrayCallBacks);
+	FSEventStreamContext ctx = {0, (void *)(intptr_t)fd, NULL, NULL, NULL};
+	FSEventStreamRef stream = FSEventStreamCreate(NULL, fsmonitor_events, &ctx, dirs, kFSEventStreamEventIdSinceNow,
+		latency, kFSEventStreamCreateFlagFileEvents | kFSEventStreamCreateFlagNoDefer | kFSEventStreamCreateFlagWatchRoot);
+	CFRelease(dirs);
+	CFRelease(dir);
+	if (stream == NULL) {
+		return NULL;
+	}
+	FSEventStreamSetDispatchQueue(stream, dispatch_queue_create("fsmonitor", DISPATCH_QUEUE_SERIAL));
+	if (!FSEventStreamStart(stream)) {
+		FSEventStreamInvalidate(stream);
+		FSEventStreamRelease(stream);
+		return NULL;
+	}
+	return stream;
+}
+
+// returns once the last callback did
+static void fsmonitor_stop(void *stream) {
+	FSEventStreamStop(stream);
+	FSEventStreamInvalidate(stream);
+	FSEventStreamRelease(stream);
+}
+*/
+import "C"
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	/* seconds FSEvents coalesce events for, well below any sensible interval */
+	native_latency = 0.1
+	/* statfs flag of volumes local to the host */
+	native_mnt_local = 0x1000
+
+	/* events were dropped, the watched path was moved, or volumes were mounted below it: UserDropped,
+	 * KernelDropped, RootChanged, Mount and Unmount. MustScanSubDirs alone is told by re-checking the path,
+	 * which walks its subtree */
+	native_flags_lost = 0x2 | 0x4 | 0x20 | 0x40 | 0x80
+)
+
+// nativeWatcher collects paths changed according to FSEvents, re-checked by the "native" Watcher on every tick.
+// A stream watches the whole tree, so only the watched path is added. FSEvents coalesce the flags of a path, so
+// flags only tell which paths are re-checked, events are told by diffing them as on other platforms. Volumes not
+// local to the host, whose changes made by other hosts FSEvents don't tell, are polled instead.
+type nativeWatcher struct {
+	/* events written by the FSEvents queue, read by read */
+	r, w *os.File
+
+	mu     sync.Mutex
+	stream unsafe.Pointer
+	/* the watched path, and where FSEvents report it, e.g. /private/var for /var */
+	dir, real string
+	dirty     map[string]bool
+	/* events were dropped, or the tree must be walked again */
+	overflow bool
+	/* walks every scan as the "path" Watcher does */
+	poll bool
+}
+
+func newNativeWatcher() (*nativeWatcher, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	return &nativeWatcher{r: r, w: w, dirty: make(map[string]bool)}, nil
+}
+
+// watchAccess does nothing, access events are only told on Linux, see WithAccessEvents.
+func (n *nativeWatcher) watchAccess(a *accessLog) {}
+
+// add watches dir with its subtree once, falling back to polling when FSEvents can't watch it.
+func (n *nativeWatcher) add(dir string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stream != nil || n.poll {
+		return nil
+	}
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err == nil && st.Flags&native_mnt_local == 0 {
+		n.poll = true
+		return fmt.Errorf("FSEvents don't tell changes made by other hosts to network volumes, polling %s instead", dir)
+	}
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		real = dir
+	}
+	path := C.CString(real)
+	defer C.free(unsafe.Pointer(path))
+	n.stream = C.fsmonitor_start(path, C.int(n.w.Fd()), native_latency)
+	if n.stream == nil {
+		n.poll = true
+		return fmt.Errorf("FSEvents failed to watch %s, polling instead", dir)
+	}
+	n.dir, n.real = dir, real
+	return nil
+}
+
+// drain returns paths changed since previous drain, and whether events were lost meanwhile.
+func (n *nativeWatcher) drain() ([]string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	paths := make([]string, 0, len(n.dirty))
+	for path := range n.dirty {
+		paths = append(paths, path)
+	}
+	overflow := n.overflow
+	n.dirty, n.overflow = make(map[string]bool), false
+	return paths, overflow
+}
+
+// polling reports whether FSEvents can't watch the tree, which is walked every scan instead.
+func (n *nativeWatcher) polling() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.poll
+}
+
+// read collects events until close.
+func (n *nativeWatcher) read() {
+	defer n.r.Close()
+	r := bufio.NewReader(n.r)
+	for {
+		var flags uint32
+		if err := binary.Read(r, binary.LittleEndian, &flags); err != nil {
+			return
+		}
+		path, err := r.ReadString(0)
+		if err != nil {
+			return
+		}
+		n.event(flags, strings.TrimSuffix(path, "\x00"))
+	}
+}
+
+func (n *nativeWatcher) event(flags uint32, path string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if flags&native_flags_lost != 0 {
+		n.overflow = true
+		return
+	}
+	if n.real != n.dir && within(path, n.real) {
+		path = n.dir + path[len(n.real):]
+	}
+	n.dirty[path] = true
+}
+
+func (n *nativeWatcher) close() error {
+	n.mu.Lock()
+	stream := n.stream
+	n.stream = nil
+	n.mu.Unlock()
+	/* the last callback may wait for read, which takes mu */
+	if stream != nil {
+		C.fsmonitor_stop(stream)
+	}
+	/* read returns once what was written is read */
+	n.w.Close()
+	return nil
+}
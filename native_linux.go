@@ -0,0 +1,222 @@
+//go:build linux
+// +build linux
+
+package fsmonitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+const (
+	native_event_mask = syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+		syscall.IN_ATTRIB | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF |
+		syscall.IN_DONT_FOLLOW | syscall.IN_ONLYDIR
+
+	/* f_type of SMB mounts by the kernel client, see statfs(2) */
+	native_cifs_magic = 0xFF534D42
+	native_smb2_magic = 0xFE534D42
+	/* _IOW(0xCF, 9, struct smb3_notify) of the kernel client, since Linux 5.6 */
+	native_cifs_ioc_notify = 0x4005CF09
+	/* FILE_NOTIFY_CHANGE_ FILE_NAME, DIR_NAME, ATTRIBUTES, SIZE, LAST_WRITE and CREATION */
+	native_smb_filter = 0x01 | 0x02 | 0x04 | 0x08 | 0x10 | 0x40
+)
+
+// nativeWatcher collects paths changed according to inotify, re-checked by the "native" Watcher on every tick.
+// Trees on SMB shares mounted by the kernel client are watched by SMB2 CHANGE_NOTIFY instead, which tells changes
+// made by other hosts too, as inotify only tells those of this one.
+type nativeWatcher struct {
+	fd   int
+	file *os.File
+
+	mu    sync.Mutex
+	dirs  map[int]string
+	dirty map[string]bool
+	/* events were dropped by the kernel */
+	overflow bool
+	/* the watched path was checked for being on an SMB share, the tree it roots if so, see notify */
+	checked bool
+	share   string
+	/* walks every scan as CHANGE_NOTIFY fails */
+	poll   bool
+	closed bool
+	/* files opened and read are counted, see WithAccessEvents */
+	access *accessLog
+}
+
+func newNativeWatcher() (*nativeWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &nativeWatcher{
+		fd: fd,
+		/* non-blocking, so reads are interrupted by close */
+		file:  os.NewFile(uintptr(fd), "inotify"),
+		dirs:  make(map[int]string),
+		dirty: make(map[string]bool),
+	}, nil
+}
+
+// watchAccess makes files opened and read within directories added later counted by a.
+func (n *nativeWatcher) watchAccess(a *accessLog) {
+	n.access = a
+}
+
+// add watches dir, its sub-directories are added as they are walked. The first one added is the watched path,
+// which on an SMB share is watched with its subtree by CHANGE_NOTIFY.
+func (n *nativeWatcher) add(dir string) error {
+	n.mu.Lock()
+	if !n.checked {
+		n.checked = true
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(dir, &st); err == nil && (uint32(st.Type) == native_cifs_magic || uint32(st.Type) == native_smb2_magic) {
+			f, err := os.Open(dir)
+			if err != nil {
+				n.mu.Unlock()
+				return err
+			}
+			n.share = dir
+			go n.notify(f)
+		}
+	}
+	share := n.share
+	n.mu.Unlock()
+	if share != "" && within(dir, share) {
+		return nil
+	}
+
+	mask := uint32(native_event_mask)
+	if n.access != nil {
+		if n.access.events&FileOpen != 0 {
+			mask |= syscall.IN_OPEN
+		}
+		if n.access.events&FileAccess != 0 {
+			mask |= syscall.IN_ACCESS
+		}
+	}
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, mask)
+	if err != nil {
+		return os.NewSyscallError("inotify_add_watch", err)
+	}
+	n.mu.Lock()
+	/* the same directory moved elsewhere keeps its descriptor */
+	n.dirs[wd] = dir
+	n.mu.Unlock()
+	return nil
+}
+
+// drain returns paths changed since previous drain, and whether events were lost meanwhile.
+func (n *nativeWatcher) drain() ([]string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	paths := make([]string, 0, len(n.dirty))
+	for path := range n.dirty {
+		paths = append(paths, path)
+	}
+	overflow := n.overflow
+	n.dirty, n.overflow = make(map[string]bool), false
+	return paths, overflow
+}
+
+// polling reports whether the tree is walked every scan as events can't be watched, never with inotify, but if the
+// kernel or SMB share fail CHANGE_NOTIFY, e.g. of SMB 1.
+func (n *nativeWatcher) polling() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.poll
+}
+
+// notify marks the share dirty every time CHANGE_NOTIFY of dir tells its tree changed, until close. Notifications
+// don't tell what changed, so the tree is walked again. A notification pending when closing can't be cancelled, it
+// returns by the next change.
+func (n *nativeWatcher) notify(dir *os.File) {
+	defer dir.Close()
+	/* struct smb3_notify, packed: completion filter and whether to watch the subtree */
+	var req [5]byte
+	*(*uint32)(unsafe.Pointer(&req[0])) = native_smb_filter
+	req[4] = 1
+	for {
+		_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dir.Fd(), native_cifs_ioc_notify, uintptr(unsafe.Pointer(&req[0])))
+		n.mu.Lock()
+		switch {
+		case n.closed:
+		case errno == syscall.EINTR:
+			n.mu.Unlock()
+			continue
+		case errno != 0:
+			n.poll = true
+		default:
+			n.dirty[n.share] = true
+			n.mu.Unlock()
+			continue
+		}
+		n.mu.Unlock()
+		return
+	}
+}
+
+// read collects events until close.
+func (n *nativeWatcher) read() {
+	buf := make([]byte, 64*1024)
+	for {
+		c, err := n.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= c; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + int(ev.Len)
+			n.event(int(ev.Wd), ev.Mask, strings.TrimRight(string(buf[start:off]), "\x00"))
+		}
+	}
+}
+
+func (n *nativeWatcher) event(wd int, mask uint32, name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		n.overflow = true
+		return
+	}
+	dir, ok := n.dirs[wd]
+	if !ok {
+		return
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.dirs, wd)
+		return
+	}
+	path := dir
+	if name != "" {
+		path = filepath.Join(dir, name)
+	}
+	if mask&^(syscall.IN_OPEN|syscall.IN_ACCESS|syscall.IN_ISDIR) == 0 {
+		/* accesses change nothing, directories opened are mostly walks */
+		if n.access != nil && mask&syscall.IN_ISDIR == 0 && name != "" {
+			if mask&syscall.IN_OPEN != 0 {
+				n.access.add(path, FileOpen, time.Now())
+			}
+			if mask&syscall.IN_ACCESS != 0 {
+				n.access.add(path, FileAccess, time.Now())
+			}
+		}
+		return
+	}
+	n.dirty[path] = true
+}
+
+func (n *nativeWatcher) close() error {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	return n.file.Close()
+}
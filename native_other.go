@@ -0,0 +1,38 @@
+//go:build !linux && !windows && !(darwin && cgo)
+// +build !linux,!windows
+// +build !darwin !cgo
+
+package fsmonitor
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// nativeWatcher isn't available yet, kqueue is to be supported.
+type nativeWatcher struct{}
+
+func newNativeWatcher() (*nativeWatcher, error) {
+	return nil, fmt.Errorf("Native events are not supported on %s, use the \"path\" Watcher", runtime.GOOS)
+}
+
+// watchAccess does nothing, access events are only told on Linux, see WithAccessEvents.
+func (n *nativeWatcher) watchAccess(a *accessLog) {}
+
+func (n *nativeWatcher) add(dir string) error {
+	return nil
+}
+
+func (n *nativeWatcher) drain() ([]string, bool) {
+	return nil, false
+}
+
+func (n *nativeWatcher) polling() bool {
+	return false
+}
+
+func (n *nativeWatcher) read() {}
+
+func (n *nativeWatcher) close() error {
+	return nil
+}
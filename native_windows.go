@@ -0,0 +1,186 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	native_notify_filter = syscall.FILE_NOTIFY_CHANGE_FILE_NAME | syscall.FILE_NOTIFY_CHANGE_DIR_NAME |
+		syscall.FILE_NOTIFY_CHANGE_ATTRIBUTES | syscall.FILE_NOTIFY_CHANGE_SIZE |
+		syscall.FILE_NOTIFY_CHANGE_LAST_WRITE | syscall.FILE_NOTIFY_CHANGE_CREATION
+	/* largest buffer SMB shares accept */
+	native_buffer_size = 64 * 1024
+	/* changes didn't fit the buffer and must be enumerated */
+	native_error_notify_enum_dir = syscall.Errno(1022)
+)
+
+// nativeWatcher collects paths changed according to ReadDirectoryChangesW, re-checked by the "native" Watcher
+// on every tick. A directory is watched with its whole subtree, so only the watched path is added.
+type nativeWatcher struct {
+	port syscall.Handle
+
+	mu sync.Mutex
+	/* watched directories by completion key */
+	dirs  map[uint32]*nativeDir
+	next  uint32
+	dirty map[string]bool
+	/* events were dropped as the buffer overflowed */
+	overflow bool
+	closed   bool
+}
+
+// nativeDir is a watched directory with its pending read, kept alive until the read completes.
+type nativeDir struct {
+	ov     syscall.Overlapped
+	handle syscall.Handle
+	path   string
+	buf    []byte
+}
+
+func newNativeWatcher() (*nativeWatcher, error) {
+	port, err := syscall.CreateIoCompletionPort(syscall.InvalidHandle, 0, 0, 1)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateIoCompletionPort", err)
+	}
+	return &nativeWatcher{
+		port:  port,
+		dirs:  make(map[uint32]*nativeDir),
+		dirty: make(map[string]bool),
+	}, nil
+}
+
+// watchAccess does nothing, access events are only told on Linux, see WithAccessEvents.
+func (n *nativeWatcher) watchAccess(a *accessLog) {}
+
+// add watches dir with its subtree, unless under a directory watched already.
+func (n *nativeWatcher) add(dir string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, d := range n.dirs {
+		if within(dir, d.path) {
+			return nil
+		}
+	}
+
+	name, err := syscall.UTF16PtrFromString(extendedPath(dir))
+	if err != nil {
+		return err
+	}
+	h, err := syscall.CreateFile(name, syscall.FILE_LIST_DIRECTORY,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE, nil,
+		syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS|syscall.FILE_FLAG_OVERLAPPED, 0)
+	if err != nil {
+		return os.NewSyscallError("CreateFile", err)
+	}
+	/* key 0 is posted by close */
+	n.next++
+	if _, err := syscall.CreateIoCompletionPort(h, n.port, n.next, 0); err != nil {
+		syscall.CloseHandle(h)
+		return os.NewSyscallError("CreateIoCompletionPort", err)
+	}
+	d := &nativeDir{handle: h, path: dir, buf: make([]byte, native_buffer_size)}
+	if err := d.watch(); err != nil {
+		syscall.CloseHandle(h)
+		return err
+	}
+	n.dirs[n.next] = d
+	return nil
+}
+
+// watch starts reading changes of the directory, completed through the port.
+func (d *nativeDir) watch() error {
+	d.ov = syscall.Overlapped{}
+	err := syscall.ReadDirectoryChanges(d.handle, &d.buf[0], uint32(len(d.buf)), true, native_notify_filter, nil, &d.ov, 0)
+	if err != nil {
+		return os.NewSyscallError("ReadDirectoryChanges", err)
+	}
+	return nil
+}
+
+// drain returns paths changed since previous drain, and whether events were lost meanwhile.
+func (n *nativeWatcher) drain() ([]string, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	paths := make([]string, 0, len(n.dirty))
+	for path := range n.dirty {
+		paths = append(paths, path)
+	}
+	overflow := n.overflow
+	n.dirty, n.overflow = make(map[string]bool), false
+	return paths, overflow
+}
+
+// polling reports whether the tree is walked every scan as events can't be watched, never with ReadDirectoryChangesW.
+func (n *nativeWatcher) polling() bool {
+	return false
+}
+
+// read collects completed reads until close, once every read pending was cancelled.
+func (n *nativeWatcher) read() {
+	defer syscall.CloseHandle(n.port)
+	for {
+		var qty, key uint32
+		var ov *syscall.Overlapped
+		err := syscall.GetQueuedCompletionStatus(n.port, &qty, &key, &ov, syscall.INFINITE)
+		if !n.completed(key, qty, err) {
+			return
+		}
+	}
+}
+
+// completed collects the changes read for key and reads again, reporting whether reads are still pending.
+func (n *nativeWatcher) completed(key, qty uint32, err error) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	d, ok := n.dirs[key]
+	if !ok {
+		return !n.closed || len(n.dirs) > 0
+	}
+	switch {
+	case n.closed:
+	case err == native_error_notify_enum_dir || err == nil && qty == 0:
+		n.overflow = true
+	case err != nil:
+		/* e.g. the directory was removed, walking again finds what's left */
+		n.overflow = true
+	default:
+		for off := uint32(0); ; {
+			info := (*syscall.FileNotifyInformation)(unsafe.Pointer(&d.buf[off]))
+			name := (*[native_buffer_size / 2]uint16)(unsafe.Pointer(&info.FileName))[: info.FileNameLength/2 : info.FileNameLength/2]
+			n.dirty[filepath.Join(d.path, syscall.UTF16ToString(name))] = true
+			if info.NextEntryOffset == 0 {
+				break
+			}
+			off += info.NextEntryOffset
+		}
+	}
+	if n.closed || err != nil && err != native_error_notify_enum_dir || d.watch() != nil {
+		delete(n.dirs, key)
+		syscall.CloseHandle(d.handle)
+		if !n.closed {
+			n.overflow = true
+		}
+	}
+	return !n.closed || len(n.dirs) > 0
+}
+
+// close cancels pending reads, their buffers are released once read returns.
+func (n *nativeWatcher) close() error {
+	n.mu.Lock()
+	n.closed = true
+	for _, d := range n.dirs {
+		syscall.CancelIoEx(d.handle, nil)
+	}
+	n.mu.Unlock()
+	/* wakes read up if nothing was pending */
+	return syscall.PostQueuedCompletionStatus(n.port, 0, 0, nil)
+}
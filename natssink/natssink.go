@@ -0,0 +1,201 @@
+// Package natssink publishes notices to NATS subjects as a fsmonitor.Sink, optionally to JetStream:
+//
+//	sink, err := natssink.New(natssink.Config{URL: nats.DefaultURL, Subject: "fsmonitor.{event}.{root}"})
+//	...
+//	monitor.AttachSink(sink)
+//
+// Messages carry the notice encoded by fsmonitor.MarshalNotice as JSON data, and its ID, if identified
+// (see fsmonitor.WithIDs), in an "Fsmonitor-Id" header, which JetStream also deduplicates redelivered notices by.
+package natssink
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/nats-io/nats.go"
+)
+
+// Logger reports failures of asynchronous publishing, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[NATS] ", log.LstdFlags)
+
+// Config of a Sink, Subject is required.
+type Config struct {
+	// Servers to connect to, comma separated, nats.DefaultURL by default
+	URL string
+	// Template of the subject of every notice: {event} is replaced by its event name, e.g. FileCreate,
+	// {root} by the watched path it's from, e.g. srv_data for /srv/data, {watcher} and {shard} by those labels,
+	// "_" for labels missing, see fsmonitor.NoticeLabels
+	Subject string
+	// Enables TLS, e.g. with client certificates, plaintext without
+	TLS *tls.Config
+	// Publishes to a JetStream stream capturing the subjects, waiting for the stream to acknowledge every message
+	JetStream bool
+	// Publish returns once the message is sent instead of acknowledged, failures are logged, only with JetStream
+	Async bool
+	// Attempts to resend a message while no stream responds, 2 by default, only with JetStream
+	Retries int
+	// Delay waiting for an acknowledgment, 5 seconds by default, only with JetStream
+	Timeout time.Duration
+	// Further options of the connection, e.g. nats.UserCredentials, overridden by the settings above
+	Options []nats.Option
+	Logger  *log.Logger
+}
+
+// Sink implements fsmonitor.Sink by a NATS connection.
+type Sink struct {
+	subject string
+	logger  *log.Logger
+	async   bool
+	pubOpts []nats.PubOpt
+
+	conn *nats.Conn
+	js   nats.JetStreamContext
+	/* acknowledgments awaited in async mode */
+	acks sync.WaitGroup
+}
+
+var _ fsmonitor.Sink = (*Sink)(nil)
+
+// New connects to c.URL, failing if none of its servers is reachable or, with JetStream, JetStream isn't enabled.
+func New(c Config) (*Sink, error) {
+	if c.Subject == "" {
+		return nil, fmt.Errorf("NATS subject must be given")
+	}
+	if strings.ContainsAny(c.Subject, " \t\r\n") {
+		return nil, fmt.Errorf("NATS subject %q must not contain whitespace", c.Subject)
+	}
+	if c.URL == "" {
+		c.URL = nats.DefaultURL
+	}
+	if c.Retries <= 0 {
+		c.Retries = 2
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 5 * time.Second
+	}
+
+	s := &Sink{subject: c.Subject, logger: c.Logger, async: c.JetStream && c.Async}
+	if s.logger == nil {
+		s.logger = Logger
+	}
+	options := append([]nats.Option{nats.Name("fsmonitor")}, c.Options...)
+	if c.TLS != nil {
+		options = append(options, nats.Secure(c.TLS))
+	}
+	options = append(options, nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+		s.logger.Printf("NATS connection failed: %v", err)
+	}))
+
+	var err error
+	if s.conn, err = nats.Connect(c.URL, options...); err != nil {
+		return nil, fmt.Errorf("Failed to connect to NATS: %v", err)
+	}
+	if !c.JetStream {
+		return s, nil
+	}
+	if s.js, err = s.conn.JetStream(nats.MaxWait(c.Timeout)); err != nil {
+		s.conn.Close()
+		return nil, fmt.Errorf("Failed to start JetStream: %v", err)
+	}
+	s.pubOpts = []nats.PubOpt{nats.RetryAttempts(c.Retries), nats.AckWait(c.Timeout)}
+	return s, nil
+}
+
+// Publish sends n to its subject, waiting for acknowledgment by the stream with JetStream unless in async mode.
+func (s *Sink) Publish(n fsmonitor.Notice) error {
+	msg, err := s.message(n)
+	if err != nil {
+		return err
+	}
+	if s.js == nil {
+		return s.conn.PublishMsg(msg)
+	}
+	opts := s.pubOpts
+	if id := msg.Header.Get("Fsmonitor-Id"); id != "" {
+		opts = append(opts[:len(opts):len(opts)], nats.MsgId(id))
+	}
+	if !s.async {
+		_, err := s.js.PublishMsg(msg, opts...)
+		return err
+	}
+
+	ack, err := s.js.PublishMsgAsync(msg, opts...)
+	if err != nil {
+		return err
+	}
+	s.acks.Add(1)
+	go func() {
+		defer s.acks.Done()
+		select {
+		case <-ack.Ok():
+		case err := <-ack.Err():
+			s.logger.Printf("Failed to publish to %s: %v", msg.Subject, err)
+		}
+	}()
+	return nil
+}
+
+// message encodes n as message to its subject.
+func (s *Sink) message(n fsmonitor.Notice) (*nats.Msg, error) {
+	data, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+	}
+	msg := nats.NewMsg(Subject(s.subject, n))
+	msg.Data = data
+	var i fsmonitor.IdentifiedNotice
+	if fsmonitor.NoticeAs(n, &i) {
+		msg.Header.Set("Fsmonitor-Id", i.ID())
+	}
+	return msg, nil
+}
+
+// Subject returns template with {event} and labels replaced for n, see Config.Subject.
+func Subject(template string, n fsmonitor.Notice) string {
+	event := n.Type().String()
+	if i := strings.LastIndexByte(event, '.'); i >= 0 {
+		event = event[i+1:]
+	}
+	labels := fsmonitor.NoticeLabels(n)
+	return strings.NewReplacer("{event}", token(event), "{root}", token(labels.Root), "{watcher}", token(labels.Watcher),
+		"{shard}", token(labels.Shard)).Replace(template)
+}
+
+// token returns s as a single token of subjects, all but letters, digits, - and _ replaced by _.
+func token(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, s)
+	if t := strings.Trim(s, "_"); t != "" {
+		return t
+	}
+	return "_"
+}
+
+// Close waits for messages to be acknowledged in async mode, then flushes and closes the connection.
+func (s *Sink) Close() error {
+	if s.conn.IsClosed() {
+		return nil
+	}
+	if s.async {
+		select {
+		case <-s.js.PublishAsyncComplete():
+			s.acks.Wait()
+		case <-time.After(30 * time.Second):
+			s.logger.Printf("NATS acknowledgments pending after 30s, %d messages", s.js.PublishAsyncPending())
+		}
+	}
+	err := s.conn.Flush()
+	s.conn.Close()
+	return err
+}
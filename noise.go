@@ -0,0 +1,292 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	/* distinct paths and directories counted, further ones only count in the total and in known noise */
+	noise_paths_max = 100000
+	/* share of notices making a directory or file a hot spot worth excluding, once enough were seen */
+	noise_share   = 0.2
+	noise_minimum = 100
+	/* paths listed by NoiseReport.Top */
+	noise_top = 20
+)
+
+// noiseSource is a kind of path known to change often without anybody caring.
+type noiseSource struct {
+	pattern string
+	reason  string
+	/* matched by directories the noticed file is in */
+	dir bool
+	re  *regexp.Regexp
+}
+
+var noiseSources = compileNoise([]noiseSource{
+	{pattern: "glob:.git", reason: "Git metadata", dir: true},
+	{pattern: "glob:.svn", reason: "Subversion metadata", dir: true},
+	{pattern: "glob:.hg", reason: "Mercurial metadata", dir: true},
+	{pattern: "glob:node_modules", reason: "npm dependencies", dir: true},
+	{pattern: "glob:__pycache__", reason: "Python bytecode cache", dir: true},
+	{pattern: "glob:.cache", reason: "application caches", dir: true},
+	{pattern: "glob:.idea", reason: "JetBrains IDE state", dir: true},
+	{pattern: "glob:*.sw[a-p]", reason: "Vim swap files"},
+	{pattern: "glob:.#*", reason: "Emacs lock files"},
+	{pattern: "glob:*~", reason: "editor backups"},
+	{pattern: "glob:~$*", reason: "Microsoft Office owner files"},
+	{pattern: "glob:*.tmp", reason: "temporary files"},
+	{pattern: "glob:*.part", reason: "partial downloads"},
+	{pattern: "glob:*.crdownload", reason: "partial downloads"},
+	{pattern: "glob:*.pyc", reason: "Python bytecode"},
+	{pattern: "glob:.DS_Store", reason: "macOS Finder metadata"},
+	{pattern: "glob:Thumbs.db", reason: "Windows thumbnail caches"},
+})
+
+func compileNoise(sources []noiseSource) []noiseSource {
+	for i := range sources {
+		re, err := CompilePattern(sources[i].pattern)
+		if err != nil {
+			panic(err)
+		}
+		sources[i].re = re
+	}
+	return sources
+}
+
+// matches reports whether the file at path is of the noise source.
+func (src *noiseSource) matches(path string) bool {
+	if !src.dir {
+		return src.re.MatchString(path)
+	}
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if src.re.MatchString(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithNoiseAnalysis makes the Monitor count which paths generate the most notices, suggesting exclude patterns
+// for known noise (e.g. .git, Vim swap files, Office owner files) and hot spots, see Monitor.Noise.
+func WithNoiseAnalysis() Option {
+	return func(o *options) error {
+		o.noise = true
+		return nil
+	}
+}
+
+// NoiseReport tells the paths generating the most notices from Start to End, and exclude patterns to silence them.
+type NoiseReport struct {
+	Start   time.Time
+	End     time.Time
+	Notices uint64
+	// Paths by notices, most first
+	Top []PathNoise
+	// By notices silenced, most first, each a pattern for WithExcludes
+	Suggestions []Suggestion
+}
+
+// PathNoise counts notices of a path.
+type PathNoise struct {
+	Path    string
+	Notices uint64
+}
+
+// Suggestion is an exclude pattern silencing Notices of the report, for the reason told.
+type Suggestion struct {
+	Pattern string
+	Notices uint64
+	Reason  string
+}
+
+// NoiseAnalyzer counts notices by path for a NoiseReport, e.g. fed from Notices() of a Monitor, see WithNoiseAnalysis.
+// Safe for concurrent use.
+type NoiseAnalyzer struct {
+	/* directories at and above roots are never suggested */
+	roots []string
+
+	mu      sync.Mutex
+	start   time.Time
+	total   uint64
+	paths   map[string]uint64
+	dirs    map[string]uint64
+	sources []uint64
+}
+
+// NewNoiseAnalyzer returns an analyzer of notices of files under roots, only directories within them are
+// suggested as hot spots; any directory without roots.
+func NewNoiseAnalyzer(roots ...string) *NoiseAnalyzer {
+	a := &NoiseAnalyzer{}
+	for _, root := range roots {
+		a.roots = append(a.roots, filepath.Clean(root))
+	}
+	a.Reset()
+	return a
+}
+
+// Reset forgets what was counted, starting a new period.
+func (a *NoiseAnalyzer) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reset()
+}
+
+// reset starts a new period, must hold a.mu.
+func (a *NoiseAnalyzer) reset() {
+	a.start = time.Now()
+	a.total = 0
+	a.paths = make(map[string]uint64)
+	a.dirs = make(map[string]uint64)
+	a.sources = make([]uint64, len(noiseSources))
+}
+
+// Add counts n, errors and alerts not about a changed file aren't counted.
+func (a *NoiseAnalyzer) Add(n Notice) {
+	if n.Type()&(FileError|LatencyViolation) != 0 || n.Name() == "" {
+		return
+	}
+	path := n.Name()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.total++
+	for i := range noiseSources {
+		if noiseSources[i].matches(path) {
+			a.sources[i]++
+		}
+	}
+	if _, ok := a.paths[path]; ok || len(a.paths) < noise_paths_max {
+		a.paths[path]++
+	}
+	for dir := filepath.Dir(path); a.within(dir); dir = filepath.Dir(dir) {
+		if _, ok := a.dirs[dir]; ok || len(a.dirs) < noise_paths_max {
+			a.dirs[dir]++
+		}
+	}
+}
+
+// within reports whether dir is below any of the roots, any directory but the file system root without roots.
+func (a *NoiseAnalyzer) within(dir string) bool {
+	if dir == filepath.Dir(dir) {
+		return false
+	}
+	for _, root := range a.roots {
+		rel, err := filepath.Rel(root, dir)
+		if err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return len(a.roots) == 0
+}
+
+// Report returns what was counted since created or reset, listing at most 20 paths in Top.
+// Known noise is suggested once noticed at all. Directories and files are suggested as hot spots once they
+// account for 20% of at least 100 notices, the deepest directory carrying most of them, unless known noise.
+func (a *NoiseAnalyzer) Report() *NoiseReport {
+	return a.report(false)
+}
+
+// report returns what was counted, then resets if reset.
+func (a *NoiseAnalyzer) report(reset bool) *NoiseReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if reset {
+		defer a.reset()
+	}
+
+	r := &NoiseReport{Start: a.start, End: time.Now(), Notices: a.total}
+	for path, count := range a.paths {
+		r.Top = append(r.Top, PathNoise{Path: path, Notices: count})
+	}
+	sort.Slice(r.Top, func(i, j int) bool {
+		if r.Top[i].Notices != r.Top[j].Notices {
+			return r.Top[i].Notices > r.Top[j].Notices
+		}
+		return r.Top[i].Path < r.Top[j].Path
+	})
+	if len(r.Top) > noise_top {
+		r.Top = r.Top[:noise_top]
+	}
+
+	for i, count := range a.sources {
+		if count > 0 {
+			r.Suggestions = append(r.Suggestions, Suggestion{
+				Pattern: noiseSources[i].pattern,
+				Notices: count,
+				Reason:  noiseSources[i].reason,
+			})
+		}
+	}
+	if a.total >= noise_minimum {
+		hot := uint64(noise_share * float64(a.total))
+		for dir, count := range a.dirs {
+			if count >= hot && !known(dir, true) && !a.narrower(dir, count) {
+				r.Suggestions = append(r.Suggestions, Suggestion{
+					Pattern: exactPattern(dir),
+					Notices: count,
+					Reason:  fmt.Sprintf("directory with %.0f%% of notices", 100*float64(count)/float64(a.total)),
+				})
+			}
+		}
+		for path, count := range a.paths {
+			if count >= hot && !known(path, false) {
+				r.Suggestions = append(r.Suggestions, Suggestion{
+					Pattern: exactPattern(path),
+					Notices: count,
+					Reason:  fmt.Sprintf("file with %.0f%% of notices", 100*float64(count)/float64(a.total)),
+				})
+			}
+		}
+	}
+	sort.Slice(r.Suggestions, func(i, j int) bool {
+		if r.Suggestions[i].Notices != r.Suggestions[j].Notices {
+			return r.Suggestions[i].Notices > r.Suggestions[j].Notices
+		}
+		return r.Suggestions[i].Pattern < r.Suggestions[j].Pattern
+	})
+	return r
+}
+
+// known reports whether known noise covers path, a directory if dir.
+func known(path string, dir bool) bool {
+	for i := range noiseSources {
+		src := &noiseSources[i]
+		if src.matches(path) || dir && src.dir && src.re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// narrower reports whether a sub-directory or file of dir carries 90% of its count notices.
+func (a *NoiseAnalyzer) narrower(dir string, count uint64) bool {
+	for _, counts := range []map[string]uint64{a.dirs, a.paths} {
+		for sub, c := range counts {
+			if c >= count*9/10 && filepath.Dir(sub) == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// exactPattern returns the pattern matching path only.
+func exactPattern(path string) string {
+	return "^" + regexp.QuoteMeta(path) + "$"
+}
+
+// Noise returns what the Monitor counted since start or the last reset, resetting if reset,
+// see WithNoiseAnalysis.
+func (m *Monitor) Noise(reset bool) (*NoiseReport, error) {
+	if m.noise == nil {
+		return nil, fmt.Errorf("Noise analysis is not enabled, see WithNoiseAnalysis")
+	}
+	return m.noise.report(reset), nil
+}
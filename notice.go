@@ -14,27 +14,134 @@ const (
 	FileCreate Event = 0x01 << iota
 	FileUpdate
 	FileRemove
+	/* same file moved within a scan, or across scans given WithMoves, see RenameInfo */
 	FileRename
+	/* only delivered when asked for, see ErrorNotice */
+	FileError
+	/* mount point given by WithMountPoint appeared or disappeared */
+	VolumeMounted
+	VolumeUnmounted
+	/* detection latency missed the SLO given by WithSLO, see LatencyAlert */
+	LatencyViolation
+	/* keys of structured files, see ContentWatcher */
+	KeyAdded
+	KeyChanged
+	KeyRemoved
+	/* certificate expires soon, see CertificateWatcher */
+	CertificateExpiring
+	/* symlink points somewhere else, see SymlinkInfo */
+	SymlinkRetargeted
+	/* secondary streams of a file changed, see WithStreams */
+	StreamChanged
+	/* file removed in one scan reappeared in a later one, see MoveWatcher */
+	MoveDetected
+	/* directories created, removed and moved, only with WithDirEvents */
+	DirCreate
+	DirRemove
+	DirRename
+	/* symlink can't be followed, only with WithFollowSymlinks(true), see SymlinkInfo */
+	SymlinkBroken
+	/* mode or owner of a file changed, see AttribInfo */
+	FileAttrib
+	/* file unchanged across scans after changing, see WithSettle */
+	FileSettled
+	/* file known to a Watcher, only listed by Monitor.Backfill */
+	FileExisting
+	/* change held back while the file is locked, see WithLockWait */
+	FileLocked
+	/* scans started failing or succeed again, see DegradedNotice */
+	MonitorDegraded
+	MonitorRecovered
+	/* first scan of a watched path completed, see WithInitialScan */
+	InitialScanDone
+	/* directory grew past its quota or dropped back within, see QuotaNotice */
+	QuotaExceeded
+	QuotaRecovered
+	/* files opened and read, see WithAccessEvents */
+	FileOpen
+	FileAccess
 )
 
 // String implements fmt.Stringer.
 func (e Event) String() string {
 	var s []string
-	for _, strmap := range []map[Event]string{eventName} {
-		for ev, str := range strmap {
-			if e&ev == ev {
-				s = append(s, str)
-			}
+	/* in bit order, so the same events always print the same */
+	for ev := Event(1); ev != 0 && ev <= e; ev <<= 1 {
+		if str, ok := eventName[ev]; ok && e&ev == ev {
+			s = append(s, str)
 		}
 	}
 	return strings.Join(s, "|")
 }
 
+// ParseEvent converts the output of Event.String() back into an Event.
+func ParseEvent(s string) (Event, error) {
+	var e Event
+	for _, name := range strings.Split(s, "|") {
+		found := false
+		for ev, str := range eventName {
+			if str == name {
+				e, found = e|ev, true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("Event name not recognized: %q", name)
+		}
+	}
+	return e, nil
+}
+
+// MarshalText implements encoding.TextMarshaler, events serialize as their names.
+func (e Event) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (e *Event) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*e = 0
+		return nil
+	}
+	ev, err := ParseEvent(string(text))
+	if err != nil {
+		return err
+	}
+	*e = ev
+	return nil
+}
+
 var eventName = map[Event]string{
 	FileCreate: "notice.FileCreate",
 	FileRemove: "notice.FileRemove",
 	FileUpdate: "notice.FileUpdate",
 	FileRename: "notice.FileRename",
+	FileError:  "notice.FileError",
+	VolumeMounted:   "notice.VolumeMounted",
+	VolumeUnmounted: "notice.VolumeUnmounted",
+	LatencyViolation: "notice.LatencyViolation",
+	KeyAdded:   "notice.KeyAdded",
+	KeyChanged: "notice.KeyChanged",
+	KeyRemoved: "notice.KeyRemoved",
+	CertificateExpiring: "notice.CertificateExpiring",
+	SymlinkRetargeted: "notice.SymlinkRetargeted",
+	StreamChanged: "notice.StreamChanged",
+	MoveDetected: "notice.MoveDetected",
+	DirCreate: "notice.DirCreate",
+	DirRemove: "notice.DirRemove",
+	DirRename: "notice.DirRename",
+	SymlinkBroken: "notice.SymlinkBroken",
+	FileAttrib: "notice.FileAttrib",
+	FileSettled: "notice.FileSettled",
+	FileExisting: "notice.FileExisting",
+	FileLocked: "notice.FileLocked",
+	MonitorDegraded: "notice.MonitorDegraded",
+	MonitorRecovered: "notice.MonitorRecovered",
+	InitialScanDone: "notice.InitialScanDone",
+	QuotaExceeded: "notice.QuotaExceeded",
+	QuotaRecovered: "notice.QuotaRecovered",
+	FileOpen: "notice.FileOpen",
+	FileAccess: "notice.FileAccess",
 }
 
 
@@ -46,23 +153,63 @@ type Notice interface {
 	// Timestamp when created
 	Time() time.Time
 	Type() Event
+	// Untyped details, e.g. an os.FileInfo, see InfoOf
 	More() interface{}
 	fmt.Stringer
 }
 
 
+// Phase tells a change apart from its confirmation in two-phase mode, see WithConfirmation.
+type Phase int
+
+const (
+	// Sent once, without confirmation
+	Immediate Phase = iota
+	// Sent as soon as discovered, may still be reverted or changed again
+	Pending
+	// Sent after the change persisted across the next scan
+	Confirmed
+)
+
+var phaseName = map[Phase]string{
+	Immediate: "immediate",
+	Pending:   "pending",
+	Confirmed: "confirmed",
+}
+
+// String implements fmt.Stringer.
+func (p Phase) String() string {
+	return phaseName[p]
+}
+
+// PhasedNotice is implemented by notices of builtin Watchers, telling their Phase.
+type PhasedNotice interface {
+	Notice
+	Phase() Phase
+}
+
 // Implements Notice, uses file name as Notice.Name
 type fileSystemNotice struct {
 	path      string
 	event     Event
 	fileinfo  os.FileInfo
 	timestamp time.Time
+	phase     Phase
+	/* see LabeledNotice */
+	labels    Labels
 }
 
 func (f *fileSystemNotice) String() string{
+	if f.phase != Immediate {
+		return fmt.Sprintf("{%v : %v : %v}", f.path, f.event, f.phase)
+	}
 	return fmt.Sprintf("{%v : %v}",f.path, f.event)
 }
 
+func (f *fileSystemNotice) Phase() Phase {
+	return f.phase
+}
+
 func (f *fileSystemNotice) Name() string {
 	return f.path
 }
@@ -75,6 +222,43 @@ func (f *fileSystemNotice) More() interface{} {
 	return f.fileinfo
 }
 
+func (f *fileSystemNotice) Info() NoticeInfo {
+	return moreInfo(f.fileinfo)
+}
+
 func (f *fileSystemNotice) Time() time.Time {
 	return f.timestamp
 }
+
+// ErrorNotice implements Notice, carries a scan error in the notice stream.
+// Uses watched address as Notice.Name and the error as Notice.More.
+type ErrorNotice struct {
+	Address string
+	Err     error
+
+	timestamp time.Time
+}
+
+func (e *ErrorNotice) String() string {
+	return fmt.Sprintf("{%v : %v : %v}", e.Address, FileError, e.Err)
+}
+
+func (e *ErrorNotice) Name() string {
+	return e.Address
+}
+
+func (e *ErrorNotice) Type() Event {
+	return FileError
+}
+
+func (e *ErrorNotice) More() interface{} {
+	return e.Err
+}
+
+func (e *ErrorNotice) Info() NoticeInfo {
+	return NoticeInfo{}
+}
+
+func (e *ErrorNotice) Time() time.Time {
+	return e.timestamp
+}
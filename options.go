@@ -0,0 +1,188 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Option configures the Monitor and its builtin Watchers, see New.
+type Option func(*options) error
+
+// options collects the configuration applied by every Option.
+type options struct {
+	address    string
+	roots      []string
+	perRoot    map[string]rootFilter
+	multi      bool
+	ids        IDGenerator
+	schedule   *Schedule
+	adaptive   adaptive
+	patterns   []string
+	excludes   []string
+	ignoreFile string
+	gitAware   bool
+	gitEnrich  bool
+	maxDepth   int
+	maxSize    int64
+	modWithin  time.Duration
+	watcher    interface{}
+	buffer     int
+	outBuffer  int
+	overflow   Overflow
+	logger     *log.Logger
+	fieldLog   FieldLogger
+	hdlWorkers int
+	hdlTimeout time.Duration
+	statRate   *rateLimit
+	sumRate    *rateLimit
+	clock      Clock
+	ackWait    time.Duration
+	ordered    bool
+
+	profile    Profile
+	mountpoint string
+	filters    FilterSet
+	twoPhase   bool
+	slo        SLO
+	shards     Coordinator
+	subtrees   *SubtreeScans
+	streams    bool
+	dirs       bool
+	swaps      bool
+	usage      bool
+	quotas     []Quota
+	follow     bool
+	settle     int
+	locks      bool
+	access     Event
+	accessWin  time.Duration
+	noise      bool
+	maxAge     time.Duration
+	dropStale  bool
+	procRoot   string
+	reconcile  time.Duration
+	workers    int
+	states     func() (StateStore, error)
+	snapshots  SnapshotStore
+	journal    Journal
+	tracer     Tracer
+	backoff    Backoff
+	initial    InitialScan
+	scanDone   bool
+	faults     FaultInjector
+	debounce   time.Duration
+	moveWait   time.Duration
+	moveBy     MoveKey
+	rules      []Rule
+}
+
+// WithPath sets the path watched by builtin Watchers, see NewMonitor.
+func WithPath(path string) Option {
+	return func(o *options) error {
+		o.address = path
+		return nil
+	}
+}
+
+// WithPatterns adds patterns of file names noticed by builtin Watchers, all files are noticed without patterns.
+// Patterns are regular expressions, or globs prefixed by "glob:", see CompilePattern.
+func WithPatterns(pattern ...string) Option {
+	return func(o *options) error {
+		o.patterns = append(o.patterns, pattern...)
+		return nil
+	}
+}
+
+// WithWatcher sets the Watcher of the Monitor, either a Watcher or the name of a builtin one, "path" by default.
+func WithWatcher(watcher interface{}) Option {
+	return func(o *options) error {
+		switch watcher.(type) {
+		case string, Watcher:
+		default:
+			return fmt.Errorf("Watcher type not recognized! %T", watcher)
+		}
+		o.watcher = watcher
+		return nil
+	}
+}
+
+// WithBufferSize sets how many notices discovered by the Watcher are buffered before it blocks.
+func WithBufferSize(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("Buffer size must be positive")
+		}
+		o.buffer = n
+		return nil
+	}
+}
+
+// WithNoticesBuffer sets how many notices Notices() buffers, unbuffered by default, so delivering a notice blocks
+// until consumed. Consumers falling behind hold up scanning once the buffer of WithBufferSize is full as well,
+// Stats().Blocked tells for how long, unless WithOverflow gives another policy.
+func WithNoticesBuffer(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("Buffer size must not be negative")
+		}
+		o.outBuffer = n
+		return nil
+	}
+}
+
+// WithLogger makes the Monitor and builtin Watchers log to l instead of the package Logger.
+func WithLogger(l *log.Logger) Option {
+	return func(o *options) error {
+		if l == nil {
+			return fmt.Errorf("Logger must not be nil")
+		}
+		o.logger = l
+		return nil
+	}
+}
+
+// WithProfile tunes the builtin "path" Watcher for the watched file system, e.g. WithProfile(fsmonitor.NFS).
+func WithProfile(p Profile) Option {
+	return func(o *options) error {
+		if p.Tolerance < 0 || p.Timeout < 0 {
+			return fmt.Errorf("Profile tolerance and timeout must not be negative")
+		}
+		o.profile = p
+		return nil
+	}
+}
+
+// WithMountPoint makes the builtin "path" Watcher check the volume mounted at path (e.g. a removable drive)
+// before every scan. Scans are suspended while it's unmounted, VolumeMounted/VolumeUnmounted notices are sent instead.
+func WithMountPoint(path string) Option {
+	return func(o *options) error {
+		if path == "" {
+			return fmt.Errorf("Mount point must not be empty")
+		}
+		o.mountpoint = path
+		return nil
+	}
+}
+
+// WithReconciliation sets how often the "hybrid" Watcher walks the whole address,
+// noticing changes its native events missed, every 5 minutes by default.
+func WithReconciliation(interval time.Duration) Option {
+	return func(o *options) error {
+		if interval <= 0 {
+			return fmt.Errorf("Reconciliation interval must be positive")
+		}
+		o.reconcile = interval
+		return nil
+	}
+}
+
+// WithConfirmation enables two-phase notices for the builtin "path" Watcher: every change is sent
+// as Pending when discovered, then once more as Confirmed if the next scan finds it unchanged,
+// i.e. not reverted and the file stable. See PhasedNotice.
+func WithConfirmation() Option {
+	return func(o *options) error {
+		o.twoPhase = true
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+package fsmonitor
+
+import (
+	"hash/fnv"
+	"os"
+	"time"
+)
+
+const (
+	/* paths whose last notice is kept at most, forgotten all at once beyond */
+	order_paths_limit = 1 << 16
+	/* events of notices told apart by their metadata */
+	order_events = FileCreate | FileUpdate | FileRemove | FileRename | FileAttrib
+)
+
+// WithOrdering guarantees notices of a path are handled in order of delivery and drops duplicates: a notice of a
+// file of the same path, event, size, modification time, change time, checksum and ETag as the one delivered last
+// for the path, e.g. sent again by another Watcher of a CompositeWatcher, is counted in Stats.Duplicates instead.
+// Notices without modification time, e.g. of HTTP resources without Last-Modified, are never duplicates. Handlers
+// registered by Handle are called with the notices of a path one at a time, by the same worker of the pool, unless
+// one times out.
+func WithOrdering() Option {
+	return func(o *options) error {
+		o.ordered = true
+		return nil
+	}
+}
+
+// orderer keeps what was delivered last for every path, see WithOrdering.
+type orderer struct {
+	last map[string]noticeKey
+}
+
+// noticeKey tells notices of a path apart.
+type noticeKey struct {
+	event   Event
+	size    int64
+	modTime time.Time
+	/* tell apart changes keeping size and modification time, where known */
+	changeTime time.Time
+	checksum   string
+	etag       string
+}
+
+// keyOf returns the key of n, false if nothing tells changes of its file apart.
+func keyOf(n Notice) (noticeKey, bool) {
+	info := InfoOf(n)
+	if info.ModTime.IsZero() {
+		return noticeKey{}, false
+	}
+	key := noticeKey{event: n.Type(), size: info.Size, modTime: info.ModTime, checksum: info.Checksum}
+	switch more := n.More().(type) {
+	case *ResourceInfo:
+		key.etag = more.ETag
+	case os.FileInfo:
+		key.changeTime, _ = changeTime(more)
+	}
+	return key, true
+}
+
+// same reports whether k and other are keys of the same notice.
+func (k noticeKey) same(other noticeKey) bool {
+	return k.event == other.event && k.size == other.size && k.modTime.Equal(other.modTime) &&
+		k.changeTime.Equal(other.changeTime) && k.checksum == other.checksum && k.etag == other.etag
+}
+
+func newOrderer() *orderer {
+	return &orderer{last: make(map[string]noticeKey)}
+}
+
+// duplicate reports whether n repeats the notice delivered last for its path, remembering it otherwise.
+func (o *orderer) duplicate(n Notice) bool {
+	if n.Type()&order_events == 0 {
+		return false
+	}
+	key, ok := keyOf(n)
+	if !ok {
+		delete(o.last, n.Name())
+		return false
+	}
+	if last, ok := o.last[n.Name()]; ok && last.same(key) {
+		return true
+	}
+	if len(o.last) >= order_paths_limit {
+		o.last = make(map[string]noticeKey)
+	}
+	o.last[n.Name()] = key
+	return false
+}
+
+// worker returns which of workers handles notices of path.
+func worker(path string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(path))
+	return int(h.Sum32() % uint32(workers))
+}
+
+// duplicated counts a duplicate notice dropped.
+func (m *Monitor) duplicated() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Duplicates++
+}
@@ -0,0 +1,97 @@
+// Package oteltracer traces the scans of a Monitor by OpenTelemetry as a fsmonitor.Tracer:
+//
+//	tracer := oteltracer.New(oteltracer.Config{Attributes: []attribute.KeyValue{attribute.String("fsmonitor.path", path)}})
+//	monitor, err := fsmonitor.NewMonitor(fsmonitor.WithPath(path), fsmonitor.WithTracer(tracer))
+//
+// Every scan is a span named "fsmonitor.scan", of the files visited and tracked and the notices discovered as
+// attributes, failed scans of status Error recording their error. Notices carry the context of the span (see
+// fsmonitor.TracedNotice), encoded by fsmonitor.MarshalNotice as W3C trace context and sent as Kafka headers by
+// kafkasink, so consumers continue the trace by Extract when processing or forwarding them.
+package oteltracer
+
+import (
+	"context"
+
+	"github.com/Fiery/fsmonitor"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+/* name of the tracer, the instrumented package */
+const instrumentation_name = "github.com/Fiery/fsmonitor"
+
+// Config of a Tracer, all optional.
+type Config struct {
+	// Provider of the tracer, the global one of otel.GetTracerProvider by default
+	TracerProvider trace.TracerProvider
+	// Encodes the trace context of notices, W3C trace context by default
+	Propagator propagation.TextMapPropagator
+	// Attributes of every span, e.g. the path watched
+	Attributes []attribute.KeyValue
+}
+
+// Tracer implements fsmonitor.Tracer by OpenTelemetry.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	attributes []attribute.KeyValue
+}
+
+var _ fsmonitor.Tracer = (*Tracer)(nil)
+
+// New returns a Tracer of c, for fsmonitor.WithTracer.
+func New(c Config) *Tracer {
+	if c.TracerProvider == nil {
+		c.TracerProvider = otel.GetTracerProvider()
+	}
+	if c.Propagator == nil {
+		c.Propagator = propagation.TraceContext{}
+	}
+	return &Tracer{
+		tracer:     c.TracerProvider.Tracer(instrumentation_name),
+		propagator: c.Propagator,
+		attributes: c.Attributes,
+	}
+}
+
+// StartScan starts the span of a scan, a child of the span of ctx if any.
+func (t *Tracer) StartScan(ctx context.Context) context.Context {
+	ctx, _ = t.tracer.Start(ctx, "fsmonitor.scan", trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(t.attributes...))
+	return ctx
+}
+
+// EndScan ends the span of the scan of ctx.
+func (t *Tracer) EndScan(ctx context.Context, s fsmonitor.ScanTrace) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.Int64("fsmonitor.scan", int64(s.Scan)),
+		attribute.Int("fsmonitor.notices", s.Notices),
+		attribute.Int("fsmonitor.files.visited", s.Visited),
+		attribute.Int("fsmonitor.files.tracked", s.Tracked),
+	)
+	if s.Err != nil {
+		span.RecordError(s.Err)
+		span.SetStatus(codes.Error, s.Err.Error())
+	}
+	span.End()
+}
+
+// Inject returns the trace context of ctx encoded by the propagator.
+func (t *Tracer) Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+// Extract returns ctx carrying the trace context of n, e.g. of a notice decoded by fsmonitor.UnmarshalNotice, to
+// start spans of processing it as children of the scan discovering it. Returns ctx itself unless n is traced.
+func (t *Tracer) Extract(ctx context.Context, n fsmonitor.Notice) context.Context {
+	var traced fsmonitor.TracedNotice
+	if !fsmonitor.NoticeAs(n, &traced) {
+		return ctx
+	}
+	return t.propagator.Extract(ctx, propagation.MapCarrier(traced.Trace()))
+}
@@ -0,0 +1,241 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// Overflow is what delivering a notice through Notices() does once its buffer is full, see WithOverflow.
+type Overflow int
+
+const (
+	// Waits until a notice is consumed, holding up scanning
+	OverflowBlock Overflow = iota
+	// Drops the oldest buffered notice for the new one, counted in Stats.Dropped
+	OverflowDropOldest
+	// Drops the new notice, counted in Stats.Dropped
+	OverflowDropNewest
+	// Appends notices to a temporary file until consumers catch up, counted in Stats.Spilled
+	OverflowSpill
+)
+
+var overflowName = map[Overflow]string{
+	OverflowBlock:      "block",
+	OverflowDropOldest: "drop-oldest",
+	OverflowDropNewest: "drop-newest",
+	OverflowSpill:      "spill",
+}
+
+func (o Overflow) String() string {
+	if name, ok := overflowName[o]; ok {
+		return name
+	}
+	return fmt.Sprintf("overflow(%d)", int(o))
+}
+
+// ParseOverflow returns the Overflow by name: "block", "drop-oldest", "drop-newest" or "spill".
+func ParseOverflow(name string) (Overflow, error) {
+	for o, n := range overflowName {
+		if n == name {
+			return o, nil
+		}
+	}
+	return 0, fmt.Errorf("Overflow policy not recognized: %q", name)
+}
+
+// WithOverflow sets what delivering a notice through Notices() does once its buffer is full, blocking by default.
+// Other policies buffer the notices of WithNoticesBuffer, 1000 unless given, so bursts don't hold up scanning.
+// Notices spilled to disk are decoded by UnmarshalNotice when sent, keeping only what MarshalNotice encodes.
+// Batches() are delivered as before.
+func WithOverflow(policy Overflow) Option {
+	return func(o *options) error {
+		if _, ok := overflowName[policy]; !ok {
+			return fmt.Errorf("Overflow policy not recognized: %v", policy)
+		}
+		o.overflow = policy
+		return nil
+	}
+}
+
+// offer delivers n through Notices() by the overflow policy, s spills it unless nil.
+func (m *Monitor) offer(n Notice, s *spill) {
+	switch m.overflow {
+	case OverflowDropNewest:
+		select {
+		case m.notices <- n:
+		default:
+			m.dropped(1)
+		}
+		return
+	case OverflowDropOldest:
+		for {
+			select {
+			case m.notices <- n:
+				return
+			default:
+			}
+			select {
+			case <-m.notices:
+				m.dropped(1)
+			default:
+			}
+		}
+	case OverflowSpill:
+		/* spilled notices go first, so order is kept */
+		if s.pending() == 0 {
+			select {
+			case m.notices <- n:
+				return
+			default:
+			}
+		}
+		err := s.push(n)
+		if err == nil {
+			return
+		}
+		m.logger.warn("Failed to spill notice, blocking instead", "path", n.Name(), "event", n.Type(), "error", err)
+	}
+	start := time.Now()
+	select {
+	case m.notices <- n:
+		m.blocked(time.Since(start))
+	case <-m.halt:
+		m.dropped(1)
+	}
+}
+
+// spill queues notices in a temporary file while Notices() is full, sending them in order once consumed.
+type spill struct {
+	m *Monitor
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	/* appended to and read from, created by the first push */
+	w, r   *os.File
+	reader *bufio.Reader
+	/* notices pushed and not sent yet */
+	queued int
+	closed bool
+	done   chan struct{}
+}
+
+func newSpill(m *Monitor) *spill {
+	s := &spill{m: m, done: make(chan struct{})}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *spill) pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queued
+}
+
+// push appends n to the file, sent once the notices pushed before are.
+func (s *spill) push(n Notice) error {
+	data, err := MarshalNotice(n)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.w == nil {
+		if err := s.create(); err != nil {
+			return err
+		}
+	}
+	if _, err := s.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.queued++
+	s.cond.Signal()
+
+	s.m.mu.Lock()
+	s.m.stats.Spilled++
+	s.m.mu.Unlock()
+	return nil
+}
+
+// create creates the file and starts sending what's pushed to it.
+func (s *spill) create() error {
+	f, err := ioutil.TempFile("", "fsmonitor-spill")
+	if err != nil {
+		return err
+	}
+	r, err := os.Open(f.Name())
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	s.w, s.r, s.reader = f, r, bufio.NewReader(r)
+	s.m.goroutines.run("spill", s.send)
+	return nil
+}
+
+// send sends pushed notices through Notices() until closed and all were sent.
+func (s *spill) send() {
+	defer close(s.done)
+	for {
+		s.mu.Lock()
+		for s.queued == 0 && !s.closed {
+			s.cond.Wait()
+		}
+		if s.queued == 0 {
+			s.mu.Unlock()
+			return
+		}
+		/* pushed lines are whole */
+		line, err := s.reader.ReadBytes('\n')
+		s.mu.Unlock()
+
+		var n Notice
+		if err == nil {
+			n, err = UnmarshalNotice(line)
+		}
+		if err != nil {
+			s.m.logger.error("Failed to read spilled notice", "error", err)
+			s.m.dropped(1)
+		} else {
+			start := time.Now()
+			select {
+			case s.m.notices <- n:
+				s.m.blocked(time.Since(start))
+			case <-s.m.halt:
+				s.m.dropped(1)
+			}
+		}
+
+		s.mu.Lock()
+		if s.queued--; s.queued == 0 {
+			/* all sent, the file starts over, written from its start again as it isn't opened for appending */
+			if err := s.w.Truncate(0); err == nil {
+				s.w.Seek(0, io.SeekStart)
+				s.r.Seek(0, io.SeekStart)
+				s.reader.Reset(s.r)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// close waits until all pushed notices were sent, or dropped by Close giving up, then removes the file.
+func (s *spill) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Signal()
+	started := s.w != nil
+	s.mu.Unlock()
+	if !started {
+		return
+	}
+	<-s.done
+	s.w.Close()
+	s.r.Close()
+	os.Remove(s.w.Name())
+}
@@ -0,0 +1,71 @@
+package fsmonitor_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// TestSpillBursts spills a burst of notices, drains them and spills another, expecting every notice of both.
+func TestSpillBursts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fsmonitor-spill-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithPath(dir), fsmonitor.WithOverflow(fsmonitor.OverflowSpill), fsmonitor.WithNoticesBuffer(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileCreate)
+	defer m.Stop()
+
+	/* files written before the first scan are baselined */
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().LastScan.IsZero() {
+		if time.Now().After(deadline) {
+			t.Fatal("No scan completed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	const burst = 20
+	for b := 0; b < 2; b++ {
+		spilled := m.Stats().Spilled
+		for i := 0; i < burst; i++ {
+			if err := ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("%d-%02d.txt", b, i)), []byte("a"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		deadline = time.Now().Add(5 * time.Second)
+		for m.Stats().Spilled == spilled {
+			if time.Now().After(deadline) {
+				t.Fatalf("Burst %d wasn't spilled", b)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		names := make(map[string]bool)
+		for len(names) < burst {
+			select {
+			case n := <-m.Notices():
+				names[filepath.Base(n.Name())] = true
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%d of %d notices of burst %d delivered", len(names), burst, b)
+			}
+		}
+		for i := 0; i < burst; i++ {
+			if name := fmt.Sprintf("%d-%02d.txt", b, i); !names[name] {
+				t.Errorf("Notice of %s of burst %d lost", name, b)
+			}
+		}
+	}
+	if d := m.Stats().Dropped; d != 0 {
+		t.Errorf("%d notices dropped", d)
+	}
+}
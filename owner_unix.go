@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package fsmonitor
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the user and group owning the file of info if the platform reports them.
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	switch st := info.Sys().(type) {
+	case *syscall.Stat_t:
+		return int(st.Uid), int(st.Gid), true
+	case *stateRecord:
+		return st.owner()
+	}
+	return -1, -1, false
+}
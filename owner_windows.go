@@ -0,0 +1,14 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"os"
+)
+
+// owner returns the user and group owning the file of info if the platform reports them.
+// Ownership of Windows files is a security descriptor, not reported by os.Lstat.
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	return -1, -1, false
+}
@@ -0,0 +1,150 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WithScanConcurrency makes the builtin "path" Watcher read directories and stat their files by n workers concurrently,
+// e.g. to scan millions of files on NFS where every operation waits on the server. Files are diffed one at a time as before,
+// so notices are the same, only sent in a different order. At most n directory listings are held at once.
+func WithScanConcurrency(n int) Option {
+	return func(o *options) error {
+		if n <= 0 {
+			return fmt.Errorf("Scan concurrency must be positive")
+		}
+		o.workers = n
+		return nil
+	}
+}
+
+// walkedDir is a directory read by a worker of walkParallel.
+type walkedDir struct {
+	path string
+	info os.FileInfo
+	/* failure to read the directory */
+	err     error
+	entries []walkedFile
+	/* directories walked into, itself included, when following symlinks */
+	parents []string
+}
+
+// walkedFile is an entry of a walkedDir, stated by the worker.
+type walkedFile struct {
+	path string
+	info os.FileInfo
+	err  error
+}
+
+// walkParallel behaves as walk, but directories are read and their entries stated by workers concurrently.
+// fn is only called by the calling goroutine, for a directory before its entries, in no particular order otherwise.
+// A directory failing to be read is passed to fn once more with the error.
+func (p *Profile) walkParallel(root string, workers int, fn filepath.WalkFunc) error {
+	info, err := p.lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		info = p.followed(root, info, nil)
+		err = fn(root, info, nil)
+	}
+	if err != nil || !info.IsDir() {
+		if err == filepath.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	jobs := make(chan walkedDir)
+	results := make(chan walkedDir)
+	quit := make(chan struct{})
+	defer close(quit)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for {
+				select {
+				case d := <-jobs:
+					p.readDir(&d)
+					select {
+					case results <- d:
+					case <-quit:
+						return
+					}
+				case <-quit:
+					return
+				}
+			}
+		}()
+	}
+
+	/* directories are walked depth first, so pending ones don't pile up */
+	pending := []walkedDir{{path: root, info: info, parents: p.parents(nil, root, info)}}
+	busy := 0
+	for len(pending) > 0 || busy > 0 {
+		var next chan<- walkedDir
+		var d walkedDir
+		if len(pending) > 0 {
+			next, d = jobs, pending[len(pending)-1]
+		}
+		select {
+		case next <- d:
+			pending = pending[:len(pending)-1]
+			busy++
+		case d := <-results:
+			busy--
+			dirs, err := p.visit(d, fn)
+			if err != nil {
+				return err
+			}
+			pending = append(pending, dirs...)
+		}
+	}
+	return nil
+}
+
+// readDir lists d and states its entries.
+func (p *Profile) readDir(d *walkedDir) {
+	names, err := p.readDirNames(d.path)
+	if err != nil {
+		d.err = err
+		return
+	}
+	d.entries = make([]walkedFile, 0, len(names))
+	for _, name := range names {
+		file := filepath.Join(d.path, name)
+		info, err := p.lstat(file)
+		if err == nil {
+			info = p.followed(file, info, d.parents)
+		}
+		d.entries = append(d.entries, walkedFile{path: file, info: info, err: err})
+	}
+}
+
+// visit passes the entries of d to fn, returning the directories among them to walk.
+func (p *Profile) visit(d walkedDir, fn filepath.WalkFunc) ([]walkedDir, error) {
+	if d.err != nil {
+		if err := fn(d.path, d.info, d.err); err != nil && err != filepath.SkipDir {
+			return nil, err
+		}
+		return nil, nil
+	}
+
+	var dirs []walkedDir
+	for _, e := range d.entries {
+		err := fn(e.path, e.info, e.err)
+		if err == filepath.SkipDir {
+			if e.err != nil || e.info.IsDir() {
+				continue
+			}
+			/* skips the rest of the directory, as filepath.Walk does */
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e.err == nil && e.info.IsDir() {
+			dirs = append(dirs, walkedDir{path: e.path, info: e.info, parents: p.parents(d.parents, e.path, e.info)})
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,75 @@
+package fsmonitor
+
+import (
+	"time"
+)
+
+// PauseMode is what happens to changes made while the Monitor is paused, see Monitor.Pause.
+type PauseMode int
+
+const (
+	// The first scan after resuming sends what changed meanwhile, one notice per file however often it changed
+	CoalesceChanges PauseMode = iota
+	// The first scan after resuming baselines what changed meanwhile without notices
+	DiscardChanges
+)
+
+// pause is the state of a paused Monitor.
+type pause struct {
+	paused bool
+	mode   PauseMode
+	/* resumed by the first tick after, unless zero */
+	until time.Time
+	/* notices of the next scan are dropped */
+	discard bool
+}
+
+// Pause suspends scanning from the next tick on, keeping the state of Watchers, e.g. while deploying thousands of
+// files, until Resume is called. A scan in progress completes, Rescan still works. Pausing again changes the mode.
+func (m *Monitor) Pause(mode PauseMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pause = pause{paused: true, mode: mode}
+}
+
+// PauseFor behaves as Pause, resuming by itself after d.
+func (m *Monitor) PauseFor(d time.Duration, mode PauseMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pause = pause{paused: true, mode: mode, until: m.now().Add(d)}
+}
+
+// Resume resumes scanning from the next tick on, the first scan coalescing or discarding what changed meanwhile.
+func (m *Monitor) Resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.resume()
+}
+
+func (m *Monitor) resume() {
+	if m.pause.paused {
+		m.pause = pause{discard: m.pause.mode == DiscardChanges}
+	}
+}
+
+// Paused reports whether scanning is paused.
+func (m *Monitor) Paused() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pause.paused
+}
+
+// scanning reports whether a tick scans at now, and whether notices of the scan are discarded, resuming once due.
+func (m *Monitor) scanning(now time.Time) (scan bool, discard bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pause.paused && !m.pause.until.IsZero() && !now.Before(m.pause.until) {
+		m.resume()
+	}
+	if m.pause.paused {
+		return false, false
+	}
+	discard = m.pause.discard
+	m.pause.discard = false
+	return true, discard
+}
@@ -0,0 +1,267 @@
+package fsmonitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dpkg_status = "/var/lib/dpkg/status"
+	dpkg_info   = "/var/lib/dpkg/info"
+)
+
+// Package identifies an installed OS package.
+type Package struct {
+	// "dpkg" or "rpm"
+	Manager string
+	Name    string
+	Version string
+}
+
+func (p *Package) String() string {
+	return fmt.Sprintf("%s %s (%s)", p.Name, p.Version, p.Manager)
+}
+
+// PackageNotice is implemented by notices checked against the package database, see PackageWatcher.
+type PackageNotice interface {
+	Notice
+	// Package owning the path, nil if none does
+	Package() *Package
+	// Whether the change is explained by the package manager: the file content is what the
+	// owning package installed, or a removed file is no longer owned after a package change.
+	Explained() bool
+}
+
+// packageNotice implements PackageNotice by wrapping the discovered Notice.
+type packageNotice struct {
+	Notice
+	pkg       *Package
+	explained bool
+}
+
+func (p *packageNotice) Unwrap() Notice {
+	return p.Notice
+}
+
+func (p *packageNotice) Package() *Package {
+	return p.pkg
+}
+
+func (p *packageNotice) Explained() bool {
+	return p.explained
+}
+
+func (p *packageNotice) String() string {
+	if p.explained && p.pkg != nil {
+		return fmt.Sprintf("%v explained by %v", p.Notice, p.pkg)
+	} else if p.explained {
+		return fmt.Sprintf("%v explained by package removal", p.Notice)
+	}
+	return fmt.Sprintf("%v unexplained", p.Notice)
+}
+
+// PackageWatcher wraps a Watcher, checking every changed path against the dpkg or rpm database.
+// All notices are delivered implementing PackageNotice, so routine OS updates can be told apart
+// from unexplained changes.
+func PackageWatcher(w Watcher) (Watcher, error) {
+	var db packageDB
+	if _, err := os.Stat(dpkg_status); err == nil {
+		db = &dpkgDB{}
+	} else if path, err := exec.LookPath("rpm"); err == nil {
+		db = &rpmDB{rpm: path}
+	} else {
+		return nil, fmt.Errorf("Neither dpkg nor rpm package database found")
+	}
+
+	return Decorate(w, func(n Notice) Notice {
+		pkg, explained, err := db.explain(n.Name(), n.Type() == FileRemove)
+		if err != nil {
+			Logger.Printf("Failed to check %s against package database: %v", n.Name(), err)
+		}
+		return &packageNotice{Notice: n, pkg: pkg, explained: explained}
+	}), nil
+}
+
+// packageDB looks up owners of paths and verifies their content.
+type packageDB interface {
+	explain(path string, removed bool) (*Package, bool, error)
+}
+
+// dpkgDB reads the dpkg database directly, reloading it whenever the status file changes.
+type dpkgDB struct {
+	mu       sync.Mutex
+	loaded   time.Time
+	files    map[string]dpkgFile
+	previous map[string]dpkgFile
+}
+
+type dpkgFile struct {
+	pkg *Package
+	md5 string
+}
+
+func (d *dpkgDB) explain(path string, removed bool) (*Package, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.reload(); err != nil {
+		return nil, false, err
+	}
+
+	f, owned := d.lookup(d.files, path)
+	if removed {
+		/* dropped by the last package change */
+		_, before := d.lookup(d.previous, path)
+		return f.pkg, !owned && before, nil
+	}
+	if !owned {
+		return nil, false, nil
+	}
+	if f.md5 == "" {
+		/* conffiles and others without recorded checksum */
+		return f.pkg, false, nil
+	}
+	sum, err := md5File(path)
+	if err != nil {
+		return f.pkg, false, err
+	}
+	return f.pkg, sum == f.md5, nil
+}
+
+// lookup also tries the pre-usrmerge spelling, packages may still list /bin/ls for /usr/bin/ls.
+func (d *dpkgDB) lookup(files map[string]dpkgFile, path string) (dpkgFile, bool) {
+	f, ok := files[path]
+	if !ok && strings.HasPrefix(path, "/usr/") {
+		f, ok = files[strings.TrimPrefix(path, "/usr")]
+	}
+	return f, ok
+}
+
+// reload parses installed packages from the status file and their file checksums from md5sums lists.
+func (d *dpkgDB) reload() error {
+	info, err := os.Stat(dpkg_status)
+	if err != nil {
+		return err
+	}
+	if d.files != nil && !info.ModTime().After(d.loaded) {
+		return nil
+	}
+
+	data, err := os.ReadFile(dpkg_status)
+	if err != nil {
+		return err
+	}
+	installed := make(map[string]*Package)
+	for _, stanza := range bytes.Split(data, []byte("\n\n")) {
+		fields := make(map[string]string)
+		for _, line := range strings.Split(string(stanza), "\n") {
+			if kv := strings.SplitN(line, ": ", 2); len(kv) == 2 && !strings.HasPrefix(line, " ") {
+				fields[kv[0]] = kv[1]
+			}
+		}
+		if fields["Package"] == "" || !strings.HasSuffix(fields["Status"], " installed") {
+			continue
+		}
+		pkg := &Package{Manager: "dpkg", Name: fields["Package"], Version: fields["Version"]}
+		installed[pkg.Name] = pkg
+		if arch := fields["Architecture"]; arch != "" {
+			installed[pkg.Name+":"+arch] = pkg
+		}
+	}
+
+	files := make(map[string]dpkgFile)
+	lists, _ := filepath.Glob(filepath.Join(dpkg_info, "*.list"))
+	for _, list := range lists {
+		name := strings.TrimSuffix(filepath.Base(list), ".list")
+		pkg, ok := installed[name]
+		if !ok {
+			continue
+		}
+		sums := readMD5Sums(strings.TrimSuffix(list, ".list") + ".md5sums")
+		lines, err := os.ReadFile(list)
+		if err != nil {
+			continue
+		}
+		for _, file := range strings.Split(string(lines), "\n") {
+			if file != "" && file != "/." {
+				files[file] = dpkgFile{pkg: pkg, md5: sums[file]}
+			}
+		}
+	}
+
+	d.previous, d.files, d.loaded = d.files, files, info.ModTime()
+	return nil
+}
+
+// readMD5Sums parses "<md5>  <path relative to />" lines.
+func readMD5Sums(file string) map[string]string {
+	sums := make(map[string]string)
+	f, err := os.Open(file)
+	if err != nil {
+		return sums
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.SplitN(scanner.Text(), "  ", 2); len(fields) == 2 {
+			sums["/"+fields[1]] = fields[0]
+		}
+	}
+	return sums
+}
+
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rpmDB queries the rpm binary, as its database format varies across distributions.
+type rpmDB struct {
+	rpm string
+}
+
+func (r *rpmDB) explain(path string, removed bool) (*Package, bool, error) {
+	out, err := exec.Command(r.rpm, "-qf", "--queryformat", "%{NAME}\t%{VERSION}-%{RELEASE}\n", path).Output()
+	if err != nil {
+		/* not owned by any package, a removal may have been done by the package manager */
+		return nil, removed, nil
+	}
+	fields := strings.SplitN(strings.SplitN(string(out), "\n", 2)[0], "\t", 2)
+	if len(fields) != 2 {
+		return nil, false, fmt.Errorf("Unexpected rpm output %q", out)
+	}
+	pkg := &Package{Manager: "rpm", Name: fields[0], Version: fields[1]}
+	if removed {
+		return pkg, false, nil
+	}
+
+	/* rpm -V lists only files failing verification, e.g. "S.5....T.  c /etc/foo.conf" */
+	out, _ = exec.Command(r.rpm, "-V", pkg.Name).Output()
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasSuffix(line, " "+path) {
+			flags := strings.Fields(line)[0]
+			return pkg, !strings.ContainsAny(flags, "S5") && flags != "missing", nil
+		}
+	}
+	return pkg, true, nil
+}
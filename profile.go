@@ -0,0 +1,212 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Profile defines how the builtin "path" Watcher compares and accesses files.
+type Profile struct {
+	// Consider change time (where available) besides modification time and size
+	ChangeTime bool
+	// Time differences up to Tolerance are not considered a change
+	Tolerance time.Duration
+	// Timeout of every file system operation, 0 means no timeout
+	Timeout time.Duration
+	// Stat a missing file once more before noticing its removal
+	ConfirmRemove bool
+
+	/* injected into every operation, see WithFaults */
+	faults FaultInjector
+	/* symlinks are walked as what they point to, see WithFollowSymlinks */
+	follow bool
+	/* operations and bytes digested are paced, see WithStatRate and WithChecksumRate */
+	statRate, sumRate *rateLimit
+}
+
+var (
+	// Local compares modification time and size as reported by the local file system.
+	Local = Profile{}
+
+	// NFS works around attribute caching and transient listing failures of NFS mounts:
+	// change time and size based comparison with a tolerance window, per-operation timeouts
+	// so a hung server fails the scan instead of blocking it, and confirmed removals.
+	NFS = Profile{
+		ChangeTime:    true,
+		Tolerance:     time.Second,
+		Timeout:       30 * time.Second,
+		ConfirmRemove: true,
+	}
+)
+
+// changed reports whether info differs from oldinfo under this Profile.
+func (p *Profile) changed(oldinfo, info os.FileInfo) bool {
+	if oldinfo.Size() != info.Size() {
+		return true
+	}
+	if info.ModTime().Sub(oldinfo.ModTime()) > p.Tolerance {
+		return true
+	}
+	if p.ChangeTime {
+		oldc, ok1 := changeTime(oldinfo)
+		newc, ok2 := changeTime(info)
+		if ok1 && ok2 && newc.Sub(oldc) > p.Tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// removed reports whether a file missing from the scan is to be noticed as removed.
+func (p *Profile) removed(file string) bool {
+	if !p.ConfirmRemove {
+		return true
+	}
+	_, err := p.lstat(file)
+	return os.IsNotExist(err)
+}
+
+// walk behaves as filepath.Walk, but limits every file system operation to Timeout.
+func (p *Profile) walk(root string, fn filepath.WalkFunc) error {
+	if p.Timeout == 0 && p.faults == nil && !p.follow && p.statRate == nil {
+		return filepath.Walk(root, fn)
+	}
+	info, err := p.lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		info = p.followed(root, info, nil)
+		err = p.walkDir(root, info, fn, p.parents(nil, root, info))
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks path below parents, the directories walked into so far when following symlinks.
+func (p *Profile) walkDir(path string, info os.FileInfo, fn filepath.WalkFunc, parents []string) error {
+	if !info.IsDir() {
+		return fn(path, info, nil)
+	}
+
+	names, err := p.readDirNames(path)
+	err1 := fn(path, info, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+
+	for _, name := range names {
+		file := filepath.Join(path, name)
+		fileInfo, err := p.lstat(file)
+		if err != nil {
+			if err := fn(file, fileInfo, err); err != nil && err != filepath.SkipDir {
+				return err
+			}
+		} else {
+			fileInfo = p.followed(file, fileInfo, parents)
+			err = p.walkDir(file, fileInfo, fn, p.parents(parents, file, fileInfo))
+			if err != nil {
+				if !fileInfo.IsDir() || err != filepath.SkipDir {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// lstat runs os.Lstat limited to Timeout.
+func (p *Profile) lstat(path string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := p.timed(path, func() (err error) {
+		if err := p.fault("lstat", path); err != nil {
+			return err
+		}
+		info, err = os.Lstat(path)
+		return
+	})
+	return info, err
+}
+
+// stat runs os.Stat limited to Timeout.
+func (p *Profile) stat(path string) (os.FileInfo, error) {
+	var info os.FileInfo
+	err := p.timed(path, func() (err error) {
+		if err := p.fault("stat", path); err != nil {
+			return err
+		}
+		info, err = os.Stat(path)
+		return
+	})
+	return info, err
+}
+
+// readlink runs os.Readlink limited to Timeout.
+func (p *Profile) readlink(path string) (string, error) {
+	var target string
+	err := p.timed(path, func() (err error) {
+		if err := p.fault("readlink", path); err != nil {
+			return err
+		}
+		target, err = os.Readlink(path)
+		return
+	})
+	return target, err
+}
+
+// streams digests secondary streams of path limited to Timeout.
+func (p *Profile) streams(path string) (map[string]string, error) {
+	var sums map[string]string
+	err := p.timed(path, func() (err error) {
+		if err := p.fault("streams", path); err != nil {
+			return err
+		}
+		sums, err = streams(path, func(n int) { p.sumRate.wait(int64(n)) })
+		return
+	})
+	return sums, err
+}
+
+// readDirNames lists and sorts directory entries limited to Timeout.
+func (p *Profile) readDirNames(dir string) ([]string, error) {
+	var names []string
+	err := p.timed(dir, func() error {
+		if err := p.fault("readdir", dir); err != nil {
+			return err
+		}
+		f, err := os.Open(dir)
+		if err != nil {
+			return err
+		}
+		names, err = f.Readdirnames(-1)
+		f.Close()
+		if p.faults != nil {
+			names = p.faults.Listing(dir, names)
+		}
+		sort.Strings(names)
+		return err
+	})
+	return names, err
+}
+
+// timed runs op once paced by WithStatRate, giving up after Timeout. A hung operation keeps its goroutine until it returns.
+func (p *Profile) timed(path string, op func() error) error {
+	p.statRate.wait(1)
+	if p.Timeout == 0 {
+		return op()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- op()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(p.Timeout):
+		return &os.PathError{Op: "stat", Path: path, Err: fmt.Errorf("timed out after %v", p.Timeout)}
+	}
+}
@@ -0,0 +1,120 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// MarshalNoticeProto encodes any Notice as MarshalNotice does, in the protobuf format of notice.proto.
+func MarshalNoticeProto(n Notice) ([]byte, error) {
+	r := record(n, AllFields)
+	buf := protoVarint(nil, 1, uint64(r.Version))
+	buf = protoString(buf, 2, r.ID)
+	buf = protoString(buf, 3, r.Path)
+	buf = protoString(buf, 4, r.Event)
+	if r.Timestamp != nil && !r.Timestamp.IsZero() {
+		/* written even if 0, the epoch is a timestamp too */
+		buf = appendUvarint(buf, 5<<3|proto_varint)
+		buf = appendUvarint(buf, uint64(r.Timestamp.UnixNano()))
+	}
+	if r.ModTime != nil {
+		buf = protoVarint(buf, 6, uint64(r.Size))
+		buf = protoVarint(buf, 7, uint64(r.Mode))
+		/* written even if 0, its presence tells metadata is */
+		buf = appendUvarint(buf, 8<<3|proto_varint)
+		buf = appendUvarint(buf, uint64(r.ModTime.UnixNano()))
+		buf = protoString(buf, 9, r.Checksum)
+	}
+	if r.Labels != nil {
+		var l []byte
+		l = protoString(l, 1, r.Labels.Root)
+		l = protoString(l, 2, r.Labels.Watcher)
+		l = protoString(l, 3, r.Labels.Shard)
+		l = protoString(l, 4, r.Labels.Source)
+		buf = protoString(buf, 10, string(l))
+	}
+	/* map entries of key 1 and value 2, in order of keys so encoding is deterministic */
+	keys := make([]string, 0, len(r.Trace))
+	for key := range r.Trace {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var e []byte
+		e = protoString(e, 1, key)
+		e = protoString(e, 2, r.Trace[key])
+		buf = protoString(buf, 11, string(e))
+	}
+	return buf, nil
+}
+
+// UnmarshalNoticeProto decodes a Notice encoded by MarshalNoticeProto, of any known schema version.
+func UnmarshalNoticeProto(data []byte) (Notice, error) {
+	var r noticeRecord
+	err := protoFields(data, func(field uint64, varint uint64, bytes []byte) error {
+		switch field {
+		case 1:
+			r.Version = int(varint)
+		case 2:
+			r.ID = string(bytes)
+		case 3:
+			r.Path = string(bytes)
+		case 4:
+			r.Event = string(bytes)
+		case 5:
+			t := time.Unix(0, int64(varint))
+			r.Timestamp = &t
+		case 6:
+			r.Size = int64(varint)
+		case 7:
+			r.Mode = os.FileMode(varint)
+		case 8:
+			t := time.Unix(0, int64(varint))
+			r.ModTime = &t
+		case 9:
+			r.Checksum = string(bytes)
+		case 10:
+			r.Labels = &Labels{}
+			return protoFields(bytes, func(field uint64, _ uint64, bytes []byte) error {
+				switch field {
+				case 1:
+					r.Labels.Root = string(bytes)
+				case 2:
+					r.Labels.Watcher = string(bytes)
+				case 3:
+					r.Labels.Shard = string(bytes)
+				case 4:
+					r.Labels.Source = string(bytes)
+				}
+				return nil
+			})
+		case 11:
+			var key, value string
+			err := protoFields(bytes, func(field uint64, _ uint64, bytes []byte) error {
+				switch field {
+				case 1:
+					key = string(bytes)
+				case 2:
+					value = string(bytes)
+				}
+				return nil
+			})
+			if r.Trace == nil {
+				r.Trace = make(map[string]string)
+			}
+			r.Trace[key] = value
+			return err
+		}
+		/* unknown fields are of newer encoders */
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Malformed notice record: %v", err)
+	}
+	if r.Version > SchemaVersion {
+		return nil, fmt.Errorf("Notice schema version %d is newer than supported version %d", r.Version, SchemaVersion)
+	}
+	return r.notice()
+}
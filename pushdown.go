@@ -0,0 +1,71 @@
+package fsmonitor
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Pushdown is the part of the filters of a Monitor that Watchers can evaluate at the source, see Pushdowner.
+type Pushdown struct {
+	// Event types delivered, all without any
+	Events Event
+	// Names must start with it, e.g. /data/incoming/, all names without
+	Prefix string
+	// Created and updated files must be at least MinSize and at most MaxSize bytes, unbounded if 0
+	MinSize int64
+	MaxSize int64
+}
+
+// Pushdowner is implemented by Watchers evaluating filters at the source, e.g. by walking only directories
+// under the prefix, instead of sending notices the Monitor discards. The Monitor pushes its filters down when
+// started, and still drops notices not passing them, so Watchers may evaluate them partially.
+type Pushdowner interface {
+	// Applies p from the next check on.
+	PushDown(p Pushdown)
+}
+
+// matches reports whether n passes the filters.
+func (p *Pushdown) matches(n Notice) bool {
+	if p.Events != 0 && n.Type()&p.Events == 0 {
+		return false
+	}
+	if !strings.HasPrefix(n.Name(), p.Prefix) {
+		return false
+	}
+	if info, ok := changedInfo(n); ok {
+		if info.Size() < p.MinSize || p.MaxSize > 0 && info.Size() > p.MaxSize {
+			return false
+		}
+	}
+	return true
+}
+
+// walks reports whether dir may hold names starting with the prefix.
+func (p *Pushdown) walks(dir string) bool {
+	sep := string(filepath.Separator)
+	return strings.HasPrefix(dir, p.Prefix) || strings.HasPrefix(p.Prefix, strings.TrimSuffix(dir, sep)+sep)
+}
+
+// PushDown makes scans walk only directories which may hold names of the prefix, and send only notices passing p.
+func (s *pathScanner) PushDown(p Pushdown) {
+	s.pushdown = p
+}
+
+// PushDown relays to the wrapped Watcher, decorating doesn't change which paths are noticed.
+func (d *decoratedWatcher) PushDown(p Pushdown) {
+	if pd, ok := d.watcher.(Pushdowner); ok {
+		pd.PushDown(p)
+	}
+}
+
+// PushDown relays to the Watchers of every path, and those added later.
+func (m *multiWatcher) PushDown(p Pushdown) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pushdown = p
+	for _, r := range m.roots {
+		if pd, ok := r.watcher.(Pushdowner); ok {
+			pd.PushDown(p)
+		}
+	}
+}
@@ -0,0 +1,714 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryResult is the table answering a query, see Monitor.Query.
+type QueryResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Query is a parsed SQL query of the inventory, see ParseQuery.
+type Query struct {
+	/* columns selected, or aggregates of all rows */
+	columns   []string
+	aggregate []aggregate
+	where     expr
+	order     []ordering
+	limit     int
+}
+
+// queryColumns are the columns of the files table, by the value of a file.
+var queryColumns = map[string]func(path string, info os.FileInfo) interface{}{
+	"path":  func(path string, _ os.FileInfo) interface{} { return path },
+	"name":  func(path string, _ os.FileInfo) interface{} { return filepath.Base(path) },
+	"dir":   func(path string, _ os.FileInfo) interface{} { return filepath.Dir(path) },
+	"ext":   func(path string, _ os.FileInfo) interface{} { return filepath.Ext(path) },
+	"size":  func(_ string, info os.FileInfo) interface{} { return info.Size() },
+	"mode":  func(_ string, info os.FileInfo) interface{} { return info.Mode().String() },
+	"mtime": func(_ string, info os.FileInfo) interface{} { return info.ModTime() },
+}
+
+// queryColumnOrder is the order of columns selected by *.
+var queryColumnOrder = []string{"path", "name", "dir", "ext", "size", "mode", "mtime"}
+
+// Query answers a SQL query of the files the Watcher knows of as of the last check, e.g.
+// SELECT path, size FROM files WHERE path LIKE '/etc/%' AND mtime > '2024-01-01' ORDER BY size DESC LIMIT 10.
+// See ParseQuery for the SQL understood. Watcher must implement Inventorier.
+func (m *Monitor) Query(sql string) (*QueryResult, error) {
+	q, err := ParseQuery(sql)
+	if err != nil {
+		return nil, err
+	}
+	inv, ok := m.watcher.(Inventorier)
+	if !ok {
+		return nil, fmt.Errorf("Watcher %T doesn't support inventory", m.watcher)
+	}
+	notices, err := inv.Inventory("")
+	if err != nil {
+		return nil, err
+	}
+	return q.Run(notices)
+}
+
+// ParseQuery parses a SELECT of the table files, one row per file of columns path, name, dir, ext, size, mode
+// (e.g. -rw-r--r--) and mtime:
+//
+//	SELECT * | column, ... | COUNT(*), SUM(column), MIN(column), MAX(column), ...
+//	FROM files [WHERE condition] [ORDER BY column [ASC|DESC], ...] [LIMIT n]
+//
+// Conditions compare columns and literals by =, !=, <>, <, <=, >, >=, [NOT] LIKE with % and _ wildcards,
+// case-sensitive as paths are, combined by AND, OR, NOT and parentheses. Strings are quoted by ', mtime is compared
+// to RFC 3339 times, dates as 2006-01-02, or seconds since Unix epoch. Keywords are case-insensitive.
+func ParseQuery(sql string) (*Query, error) {
+	tokens, err := tokenize(sql)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	q, err := p.query()
+	if err != nil {
+		return nil, fmt.Errorf("Malformed query: %v", err)
+	}
+	return q, nil
+}
+
+// Run answers the query of the files of notices, e.g. of an inventory.
+func (q *Query) Run(notices []Notice) (*QueryResult, error) {
+	type row struct {
+		path string
+		info os.FileInfo
+	}
+	var rows []row
+	for _, n := range notices {
+		info, ok := n.More().(os.FileInfo)
+		if !ok || info == nil {
+			continue
+		}
+		r := row{n.Name(), info}
+		if q.where != nil {
+			v, err := q.where.eval(func(col string) interface{} { return queryColumns[col](r.path, r.info) })
+			if err != nil {
+				return nil, err
+			}
+			if v != true {
+				continue
+			}
+		}
+		rows = append(rows, r)
+	}
+
+	if len(q.aggregate) > 0 {
+		result := &QueryResult{Rows: [][]interface{}{make([]interface{}, len(q.aggregate))}}
+		for i, a := range q.aggregate {
+			result.Columns = append(result.Columns, a.String())
+			var values []interface{}
+			for _, r := range rows {
+				if a.column == "" {
+					values = append(values, nil)
+				} else {
+					values = append(values, queryColumns[a.column](r.path, r.info))
+				}
+			}
+			v, err := a.eval(values)
+			if err != nil {
+				return nil, err
+			}
+			result.Rows[0][i] = v
+		}
+		return result, nil
+	}
+
+	var err error
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, o := range q.order {
+			c, e := compare(queryColumns[o.column](rows[i].path, rows[i].info), queryColumns[o.column](rows[j].path, rows[j].info))
+			if e != nil {
+				err = e
+			}
+			if c != 0 {
+				return c < 0 != o.desc
+			}
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if q.limit >= 0 && len(rows) > q.limit {
+		rows = rows[:q.limit]
+	}
+	result := &QueryResult{Columns: q.columns, Rows: make([][]interface{}, 0, len(rows))}
+	for _, r := range rows {
+		values := make([]interface{}, len(q.columns))
+		for i, col := range q.columns {
+			values[i] = queryColumns[col](r.path, r.info)
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	return result, nil
+}
+
+// ordering is a column of ORDER BY.
+type ordering struct {
+	column string
+	desc   bool
+}
+
+// aggregate is a function of all rows selected, of no column for COUNT(*).
+type aggregate struct {
+	function string
+	column   string
+}
+
+func (a aggregate) String() string {
+	if a.column == "" {
+		return a.function + "(*)"
+	}
+	return fmt.Sprintf("%s(%s)", a.function, a.column)
+}
+
+func (a aggregate) eval(values []interface{}) (interface{}, error) {
+	switch a.function {
+	case "count":
+		return int64(len(values)), nil
+	case "sum":
+		var sum int64
+		for _, v := range values {
+			i, ok := v.(int64)
+			if !ok {
+				return nil, fmt.Errorf("SUM of %s, which is not a number", a.column)
+			}
+			sum += i
+		}
+		return sum, nil
+	}
+	/* min and max */
+	var best interface{}
+	for _, v := range values {
+		if best == nil {
+			best = v
+			continue
+		}
+		c, err := compare(v, best)
+		if err != nil {
+			return nil, err
+		}
+		if c < 0 == (a.function == "min") && c != 0 {
+			best = v
+		}
+	}
+	return best, nil
+}
+
+// expr is a condition of WHERE or an operand of it.
+type expr interface {
+	eval(column func(string) interface{}) (interface{}, error)
+}
+
+type literal struct{ value interface{} }
+
+func (l literal) eval(func(string) interface{}) (interface{}, error) { return l.value, nil }
+
+type columnRef string
+
+func (c columnRef) eval(column func(string) interface{}) (interface{}, error) {
+	return column(string(c)), nil
+}
+
+type logical struct {
+	op          string
+	left, right expr
+}
+
+func (l *logical) eval(column func(string) interface{}) (interface{}, error) {
+	left, err := l.left.eval(column)
+	if err != nil {
+		return nil, err
+	}
+	if l.op == "not" {
+		return left != true, nil
+	}
+	/* short-circuited */
+	if l.op == "and" && left != true || l.op == "or" && left == true {
+		return left == true, nil
+	}
+	right, err := l.right.eval(column)
+	if err != nil {
+		return nil, err
+	}
+	return right == true, nil
+}
+
+type comparison struct {
+	op          string
+	left, right expr
+	/* LIKE pattern compiled once if literal */
+	like *regexp.Regexp
+}
+
+func (c *comparison) eval(column func(string) interface{}) (interface{}, error) {
+	left, err := c.left.eval(column)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.right.eval(column)
+	if err != nil {
+		return nil, err
+	}
+	if c.op == "like" || c.op == "not like" {
+		s, ok := left.(string)
+		if !ok {
+			return nil, fmt.Errorf("LIKE of %v, which is not a string", left)
+		}
+		re := c.like
+		if re == nil {
+			pattern, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("LIKE pattern %v is not a string", right)
+			}
+			re = likePattern(pattern)
+		}
+		return re.MatchString(s) == (c.op == "like"), nil
+	}
+	result, err := compare(left, right)
+	if err != nil {
+		return nil, err
+	}
+	switch c.op {
+	case "=":
+		return result == 0, nil
+	case "!=", "<>":
+		return result != 0, nil
+	case "<":
+		return result < 0, nil
+	case "<=":
+		return result <= 0, nil
+	case ">":
+		return result > 0, nil
+	}
+	return result >= 0, nil
+}
+
+// likePattern compiles a LIKE pattern into a regular expression matching whole strings.
+func likePattern(pattern string) *regexp.Regexp {
+	var re strings.Builder
+	re.WriteString("(?s)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			re.WriteString(".*")
+		case '_':
+			re.WriteString(".")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	re.WriteString("$")
+	return regexp.MustCompile(re.String())
+}
+
+// compare orders a and b, converting strings and numbers compared to times into times.
+func compare(a, b interface{}) (int, error) {
+	switch x := a.(type) {
+	case time.Time:
+		t, err := queryTime(b)
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case x.Before(t):
+			return -1, nil
+		case x.After(t):
+			return 1, nil
+		}
+		return 0, nil
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return compareFloat(float64(x), float64(y)), nil
+		case float64:
+			return compareFloat(float64(x), y), nil
+		case time.Time:
+			c, err := compare(b, a)
+			return -c, err
+		}
+	case float64:
+		switch y := b.(type) {
+		case int64:
+			return compareFloat(x, float64(y)), nil
+		case float64:
+			return compareFloat(x, y), nil
+		case time.Time:
+			c, err := compare(b, a)
+			return -c, err
+		}
+	case string:
+		switch y := b.(type) {
+		case string:
+			return strings.Compare(x, y), nil
+		case time.Time:
+			c, err := compare(b, a)
+			return -c, err
+		}
+	}
+	return 0, fmt.Errorf("Can't compare %v with %v", a, b)
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// queryTime converts a literal compared to mtime into a time.
+func queryTime(v interface{}) (time.Time, error) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, nil
+	case int64:
+		return time.Unix(x, 0), nil
+	case float64:
+		return time.Unix(0, int64(x*float64(time.Second))), nil
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+			return t, nil
+		}
+		if t, err := time.ParseInLocation("2006-01-02", x, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Time %v is not RFC 3339, a date or seconds since Unix epoch", v)
+}
+
+// token is a lexical token of a query: keywords and identifiers lowercased, strings unquoted.
+type token struct {
+	text   string
+	quoted bool
+}
+
+// tokenize splits sql into tokens.
+func tokenize(sql string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(sql); {
+		c := rune(sql[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '\'':
+			var s strings.Builder
+			j := i + 1
+			for {
+				if j >= len(sql) {
+					return nil, fmt.Errorf("Malformed query: unterminated string at %d", i)
+				}
+				if sql[j] == '\'' {
+					if j+1 < len(sql) && sql[j+1] == '\'' {
+						s.WriteByte('\'')
+						j += 2
+						continue
+					}
+					break
+				}
+				s.WriteByte(sql[j])
+				j++
+			}
+			tokens = append(tokens, token{text: s.String(), quoted: true})
+			i = j + 1
+		case c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c) || c == '.' || c == '-' && i+1 < len(sql) && (sql[i+1] >= '0' && sql[i+1] <= '9'):
+			j := i + 1
+			for j < len(sql) && (sql[j] == '_' || sql[j] == '.' || unicode.IsLetter(rune(sql[j])) || unicode.IsDigit(rune(sql[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{text: strings.ToLower(sql[i:j])})
+			i = j
+		default:
+			op := queryOperator(sql[i:])
+			if op == "" {
+				return nil, fmt.Errorf("Malformed query: unexpected %q at %d", c, i)
+			}
+			tokens = append(tokens, token{text: op})
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+// queryOperator returns the operator or punctuation s starts with, empty if none.
+func queryOperator(s string) string {
+	for _, op := range []string{"<=", ">=", "!=", "<>", "=", "<", ">", "(", ")", ",", "*", ";"} {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// queryParser parses tokens by recursive descent.
+type queryParser struct {
+	tokens []token
+	pos    int
+}
+
+// peek returns the next unquoted token, empty if quoted or none left.
+func (p *queryParser) peek() string {
+	if p.pos >= len(p.tokens) || p.tokens[p.pos].quoted {
+		return ""
+	}
+	return p.tokens[p.pos].text
+}
+
+// accept consumes the next tokens if they are words.
+func (p *queryParser) accept(words ...string) bool {
+	for i, w := range words {
+		if p.pos+i >= len(p.tokens) || p.tokens[p.pos+i].quoted || p.tokens[p.pos+i].text != w {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *queryParser) expect(word string) error {
+	if !p.accept(word) {
+		return fmt.Errorf("expected %s instead of %s", strings.ToUpper(word), p.describe())
+	}
+	return nil
+}
+
+// describe tells the next token for errors.
+func (p *queryParser) describe() string {
+	if p.pos >= len(p.tokens) {
+		return "end of query"
+	}
+	if p.tokens[p.pos].quoted {
+		return fmt.Sprintf("'%s'", p.tokens[p.pos].text)
+	}
+	return fmt.Sprintf("%q", p.tokens[p.pos].text)
+}
+
+func (p *queryParser) column() (string, error) {
+	col := p.peek()
+	if _, ok := queryColumns[col]; !ok {
+		return "", fmt.Errorf("column expected instead of %s, files has %s", p.describe(), strings.Join(queryColumnOrder, ", "))
+	}
+	p.pos++
+	return col, nil
+}
+
+func (p *queryParser) query() (*Query, error) {
+	q := &Query{limit: -1}
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	if err := p.selected(q); err != nil {
+		return nil, err
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("files"); err != nil {
+		return nil, err
+	}
+	if p.accept("where") {
+		where, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		q.where = where
+	}
+	if p.accept("order", "by") {
+		for {
+			col, err := p.column()
+			if err != nil {
+				return nil, err
+			}
+			o := ordering{column: col}
+			if p.accept("desc") {
+				o.desc = true
+			} else {
+				p.accept("asc")
+			}
+			q.order = append(q.order, o)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("limit") {
+		n, err := strconv.Atoi(p.peek())
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("LIMIT must be a number of rows instead of %s", p.describe())
+		}
+		p.pos++
+		q.limit = n
+	}
+	p.accept(";")
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.describe())
+	}
+	if len(q.aggregate) > 0 && len(q.order) > 0 {
+		return nil, fmt.Errorf("ORDER BY doesn't apply to aggregates")
+	}
+	return q, nil
+}
+
+// selected parses the columns or aggregates selected.
+func (p *queryParser) selected(q *Query) error {
+	if p.accept("*") {
+		q.columns = queryColumnOrder
+		return nil
+	}
+	for {
+		switch f := p.peek(); f {
+		case "count", "sum", "min", "max":
+			p.pos++
+			if err := p.expect("("); err != nil {
+				return err
+			}
+			a := aggregate{function: f}
+			if f != "count" || !p.accept("*") {
+				col, err := p.column()
+				if err != nil {
+					return err
+				}
+				a.column = col
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			q.aggregate = append(q.aggregate, a)
+		default:
+			col, err := p.column()
+			if err != nil {
+				return err
+			}
+			q.columns = append(q.columns, col)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if len(q.aggregate) > 0 && len(q.columns) > 0 {
+		return fmt.Errorf("columns can't be selected along with aggregates, there's no GROUP BY")
+	}
+	return nil
+}
+
+func (p *queryParser) or() (expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "or", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) and() (expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "and", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) not() (expr, error) {
+	if p.accept("not") {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &logical{op: "not", left: e}, nil
+	}
+	if p.accept("(") {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return e, p.expect(")")
+	}
+	return p.comparison()
+}
+
+func (p *queryParser) comparison() (expr, error) {
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	c := &comparison{left: left}
+	switch op := p.peek(); op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=", "like":
+		p.pos++
+		c.op = op
+	case "not":
+		if !p.accept("not", "like") {
+			return nil, fmt.Errorf("expected LIKE after NOT")
+		}
+		c.op = "not like"
+	default:
+		return nil, fmt.Errorf("comparison expected instead of %s", p.describe())
+	}
+	if c.right, err = p.operand(); err != nil {
+		return nil, err
+	}
+	if l, ok := c.right.(literal); ok && strings.HasSuffix(c.op, "like") {
+		pattern, ok := l.value.(string)
+		if !ok {
+			return nil, fmt.Errorf("LIKE pattern %v is not a string", l.value)
+		}
+		c.like = likePattern(pattern)
+	}
+	return c, nil
+}
+
+// operand parses a column, string or number.
+func (p *queryParser) operand() (expr, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("operand expected at end of query")
+	}
+	t := p.tokens[p.pos]
+	if t.quoted {
+		p.pos++
+		return literal{t.text}, nil
+	}
+	if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+		p.pos++
+		return literal{i}, nil
+	}
+	if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+		p.pos++
+		return literal{f}, nil
+	}
+	col, err := p.column()
+	if err != nil {
+		return nil, err
+	}
+	return columnRef(col), nil
+}
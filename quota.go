@@ -0,0 +1,212 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Usage is the size and count of files tracked under a directory, see WithDiskUsage.
+type Usage struct {
+	Size  int64
+	Files int
+}
+
+// Quota is a threshold of the usage of a directory, see WithDiskUsage.
+type Quota struct {
+	// Directory relative to the watched path unless absolute, the watched path itself if empty
+	Path string
+	// Limits in bytes and files, exceeded past either of them; not limited by one if zero
+	MaxSize  int64
+	MaxFiles int
+}
+
+func (q Quota) String() string {
+	switch {
+	case q.MaxFiles == 0:
+		return fmt.Sprintf("%d bytes", q.MaxSize)
+	case q.MaxSize == 0:
+		return fmt.Sprintf("%d files", q.MaxFiles)
+	}
+	return fmt.Sprintf("%d bytes or %d files", q.MaxSize, q.MaxFiles)
+}
+
+// exceeded reports whether u is past either limit of q.
+func (q Quota) exceeded(u Usage) bool {
+	return q.MaxSize > 0 && u.Size > q.MaxSize || q.MaxFiles > 0 && u.Files > q.MaxFiles
+}
+
+// WithDiskUsage makes the builtin "path" Watcher total the size and count of the files it tracks once every scan,
+// told by Stats.Usage per watched path, so capacity is watched without a second walk. Directories of quotas are
+// totalled too: a QuotaNotice is sent as QuotaExceeded once one grows past either limit of its quota, e.g. 10 GB
+// or 100k files, and as QuotaRecovered once it drops back within both, when asked for in Start. Only files watched
+// by patterns and excludes count, failed scans don't change the totals.
+func WithDiskUsage(quotas ...Quota) Option {
+	return func(o *options) error {
+		for _, q := range quotas {
+			if q.MaxSize < 0 || q.MaxFiles < 0 {
+				return fmt.Errorf("Quota limits of %q must not be negative", q.Path)
+			}
+			if q.MaxSize == 0 && q.MaxFiles == 0 {
+				return fmt.Errorf("Quota of %q must limit size or files", q.Path)
+			}
+		}
+		o.usage = true
+		o.quotas = append(o.quotas, quotas...)
+		return nil
+	}
+}
+
+// QuotaNotice is delivered when the usage of a directory crosses its quota, as QuotaExceeded when growing past
+// it and as QuotaRecovered when dropping back, only when asked for in Start. Uses the directory as Notice.Name.
+type QuotaNotice struct {
+	// Directory of the quota, and the quota with it resolved
+	Path  string
+	Quota Quota
+	// Usage by the scan crossing the quota
+	Usage Usage
+
+	event     Event
+	timestamp time.Time
+}
+
+func (q *QuotaNotice) String() string {
+	return fmt.Sprintf("{%v : %v : %d bytes in %d files, quota %v}", q.Path, q.event, q.Usage.Size, q.Usage.Files, q.Quota)
+}
+
+func (q *QuotaNotice) Name() string {
+	return q.Path
+}
+
+func (q *QuotaNotice) Type() Event {
+	return q.event
+}
+
+func (q *QuotaNotice) More() interface{} {
+	return q
+}
+
+func (q *QuotaNotice) Info() NoticeInfo {
+	return NoticeInfo{Size: q.Usage.Size}
+}
+
+func (q *QuotaNotice) Time() time.Time {
+	return q.timestamp
+}
+
+// diskUsage keeps the totals of a pathScanner and which of its quotas are exceeded.
+type diskUsage struct {
+	quotas   []Quota
+	exceeded []bool
+	/* totals of the watched address by the last scan succeeding */
+	total Usage
+}
+
+// newDiskUsage resolves quotas against address, keeping those of directories under it.
+func newDiskUsage(address string, quotas []Quota) *diskUsage {
+	u := &diskUsage{}
+	for _, q := range quotas {
+		if !filepath.IsAbs(q.Path) {
+			q.Path = filepath.Join(address, q.Path)
+		}
+		q.Path = canonicalAddress(q.Path)
+		if within(q.Path, address) {
+			u.quotas = append(u.quotas, q)
+		}
+	}
+	/* nested quotas are told from the outermost in */
+	sort.SliceStable(u.quotas, func(i, j int) bool { return u.quotas[i].Path < u.quotas[j].Path })
+	u.exceeded = make([]bool, len(u.quotas))
+	return u
+}
+
+// measure totals the files tracked once a scan succeeded, sending notices of quotas crossed.
+func (s *pathScanner) measure(changed chan<- Notice) {
+	if s.lastCheck == nil {
+		return
+	}
+	u := s.usage
+	var total Usage
+	totals := make([]Usage, len(u.quotas))
+	s.lastCheck.each(func(file string, info os.FileInfo) {
+		if info.IsDir() {
+			return
+		}
+		total.Size += info.Size()
+		total.Files++
+		for i, q := range u.quotas {
+			if within(file, q.Path) {
+				totals[i].Size += info.Size()
+				totals[i].Files++
+			}
+		}
+	})
+	u.total = total
+
+	now := time.Now()
+	for i, q := range u.quotas {
+		exceeded := q.exceeded(totals[i])
+		if exceeded == u.exceeded[i] {
+			continue
+		}
+		u.exceeded[i] = exceeded
+		event := QuotaRecovered
+		if exceeded {
+			event = QuotaExceeded
+		}
+		s.logger.info("Quota crossed", "path", q.Path, "event", event, "size", totals[i].Size, "files", totals[i].Files)
+		changed <- &QuotaNotice{Path: q.Path, Quota: q, Usage: totals[i], event: event, timestamp: now}
+	}
+}
+
+// DiskUsage tells the totals of the last scan succeeding.
+func (s *pathScanner) DiskUsage() map[string]Usage {
+	if s.usage == nil || s.lastCheck == nil {
+		return nil
+	}
+	return map[string]Usage{s.address: s.usage.total}
+}
+
+// DiskUsage relays to the wrapped Watcher.
+func (d *decoratedWatcher) DiskUsage() map[string]Usage {
+	if c, ok := d.watcher.(UsageCounter); ok {
+		return c.DiskUsage()
+	}
+	return nil
+}
+
+// DiskUsage merges the totals of the Watchers of every path.
+func (m *multiWatcher) DiskUsage() map[string]Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var usage map[string]Usage
+	for _, r := range m.roots {
+		if c, ok := r.watcher.(UsageCounter); ok {
+			usage = mergeUsage(usage, c.DiskUsage())
+		}
+	}
+	return usage
+}
+
+// DiskUsage merges the totals of sources telling theirs.
+func (c *compositeWatcher) DiskUsage() map[string]Usage {
+	var usage map[string]Usage
+	for _, s := range c.sources {
+		if uc, ok := s.watcher.(UsageCounter); ok {
+			usage = mergeUsage(usage, uc.DiskUsage())
+		}
+	}
+	return usage
+}
+
+func mergeUsage(usage, more map[string]Usage) map[string]Usage {
+	for path, u := range more {
+		if usage == nil {
+			usage = make(map[string]Usage)
+		}
+		usage[path] = u
+	}
+	return usage
+}
@@ -0,0 +1,146 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Config is what Monitor.UpdateConfig changes of a running Monitor.
+type Config struct {
+	// Patterns and excludes of the builtin Watchers, replacing those given before, all files are noticed without
+	// patterns; paths given patterns of their own by WithRoot keep them
+	Patterns []string
+	Excludes []string
+	// Between scans, the sleep given to Start is kept if 0
+	Interval time.Duration
+}
+
+// reconfigurer is implemented by Watchers swapping their filters between scans, see Monitor.UpdateConfig.
+type reconfigurer interface {
+	reconfigure(patterns, excludes []string) error
+}
+
+// UpdateConfig swaps patterns, excludes and the interval of the running Monitor from the next scan on, keeping
+// what its Watcher tracks: files watched only by the new filters are taken as they are without notices, files
+// no longer watched are dropped without notices, as if they were never watched. Patterns are swapped as a whole
+// once all compile, the Watcher must be builtin, possibly wrapped by Decorate. A new interval applies to the wait
+// for the next scan right away, unless backing off, and blocks until Start was called.
+func (m *Monitor) UpdateConfig(cfg Config) error {
+	if cfg.Interval < 0 {
+		return fmt.Errorf("Interval must not be negative")
+	}
+	if cfg.Interval > 0 && m.schedule != nil {
+		return fmt.Errorf("Interval must not be given along with a schedule")
+	}
+	r, ok := m.watcher.(reconfigurer)
+	if !ok {
+		return fmt.Errorf("Watcher %T doesn't support reconfiguring", m.watcher)
+	}
+	if err := (FilterSet{Patterns: cfg.Patterns, Excludes: cfg.Excludes}).Validate(); err != nil {
+		return err
+	}
+	if err := r.reconfigure(cfg.Patterns, cfg.Excludes); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.filters.Patterns = append([]string(nil), cfg.Patterns...)
+	m.filters.Excludes = append([]string(nil), cfg.Excludes...)
+	m.mu.Unlock()
+	m.logger.info("Config updated", "patterns", len(cfg.Patterns), "excludes", len(cfg.Excludes), "interval", cfg.Interval)
+
+	if cfg.Interval == 0 {
+		return nil
+	}
+	select {
+	case m.intervals <- cfg.Interval:
+		return nil
+	case <-m.stopped:
+		return fmt.Errorf("Monitor has been stopped")
+	}
+}
+
+// pathFilters are the patterns and excludes a pathScanner walked by.
+type pathFilters struct {
+	pattern []regexp.Regexp
+	exclude []regexp.Regexp
+}
+
+// watched reports whether file was walked into and matched by the filters.
+func (f *pathFilters) watched(file, address string) bool {
+	for dir := file; within(dir, address) && dir != address; dir = filepath.Dir(dir) {
+		for _, re := range f.exclude {
+			if re.FindStringIndex(dir) != nil {
+				return false
+			}
+		}
+	}
+	if len(f.pattern) == 0 {
+		return true
+	}
+	for _, re := range f.pattern {
+		if re.FindStringIndex(file) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reconfigure swaps the filters in between scans, the ones walked by last are kept until the next walk.
+func (s *pathScanner) reconfigure(patterns, excludes []string) error {
+	var filters pathFilters
+	for _, pat := range patterns {
+		exp, err := compilePatternAt(pat, s.address)
+		if err != nil {
+			return fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+		filters.pattern = append(filters.pattern, *exp)
+	}
+	for _, pat := range excludes {
+		exp, err := compilePatternAt(pat, s.address)
+		if err != nil {
+			return fmt.Errorf("Exclude pattern failed compilation, please check syntax! %v", err)
+		}
+		filters.exclude = append(filters.exclude, *exp)
+	}
+	s.serialized(func() {
+		if s.former == nil && s.lastCheck != nil {
+			s.former = &pathFilters{pattern: s.pattern, exclude: s.exclude}
+		}
+		s.pattern, s.exclude = filters.pattern, filters.exclude
+	})
+	return nil
+}
+
+// reconfigure swaps the filters of every path, those given patterns of their own by WithRoot keep them.
+func (m *multiWatcher) reconfigure(patterns, excludes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.roots {
+		rc, ok := r.watcher.(reconfigurer)
+		if !ok {
+			return fmt.Errorf("Watcher %T doesn't support reconfiguring", r.watcher)
+		}
+		own := patterns
+		if f, ok := m.opts.perRoot[r.address]; ok {
+			own = f.patterns
+		}
+		if err := rc.reconfigure(own, excludes); err != nil {
+			return err
+		}
+	}
+	/* paths added later are watched by them too */
+	m.opts.patterns, m.opts.excludes = patterns, excludes
+	m.opts.filters.Patterns, m.opts.filters.Excludes = nil, nil
+	return nil
+}
+
+// reconfigure relays the filters to the wrapped Watcher.
+func (d *decoratedWatcher) reconfigure(patterns, excludes []string) error {
+	r, ok := d.watcher.(reconfigurer)
+	if !ok {
+		return fmt.Errorf("Watcher %T doesn't support reconfiguring", d.watcher)
+	}
+	return r.reconfigure(patterns, excludes)
+}
@@ -0,0 +1,122 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+)
+
+// RenameInfo is the os.FileInfo of FileRename notices of the builtin "path" Watcher, returned by Notice.More.
+// Notice.Name is the new path. Renames are only paired if the Monitor delivers FileRename (DirRename for
+// directories), Monitors started for FileCreate and FileRemove only get those instead.
+type RenameInfo struct {
+	os.FileInfo
+	OldPath string
+	NewPath string
+}
+
+// renames pairs removed and created files of a walk into FileRename notices.
+type renames struct {
+	emit func(*fileSystemNotice)
+	/* FileRename pairs files, DirRename directories */
+	events  Event
+	created []*fileSystemNotice
+	removed []*fileSystemNotice
+}
+
+// newRenames returns renames pairing files if events, those delivered by the Monitor, hold FileRename, and
+// directories if they hold DirRename, both without any. Consumers of creates and removes only get those instead.
+func newRenames(events Event, emit func(*fileSystemNotice)) *renames {
+	if events == 0 {
+		events = FileRename | DirRename
+	}
+	return &renames{emit: emit, events: events & (FileRename | DirRename)}
+}
+
+// send holds back creates and removes until flush if paired, other notices pass through.
+func (r *renames) send(n *fileSystemNotice) {
+	switch n.event {
+	case FileCreate, DirCreate:
+		if r.pairs(n.event) {
+			r.created = append(r.created, n)
+			return
+		}
+	case FileRemove, DirRemove:
+		if r.pairs(n.event) {
+			r.removed = append(r.removed, n)
+			return
+		}
+	}
+	r.emit(n)
+}
+
+// pairs reports whether creates or removes of event are paired into renames.
+func (r *renames) pairs(event Event) bool {
+	if event == DirCreate || event == DirRemove {
+		return r.events&DirRename != 0
+	}
+	return r.events&FileRename != 0
+}
+
+// flush emits a FileRename (DirRename for directories) for every created file matching a removed one,
+// then remaining creates and removes.
+// Files match by size and modification time, and by device and inode where available, if unambiguous.
+// Files changed on the way are sent as created and removed.
+func (r *renames) flush() {
+	created, removed := r.created, r.removed
+	r.created, r.removed = nil, nil
+	if len(created) == 0 || len(removed) == 0 {
+		for _, n := range created {
+			r.emit(n)
+		}
+		for _, n := range removed {
+			r.emit(n)
+		}
+		return
+	}
+
+	candidates := make(map[string]*fileSystemNotice)
+	ambiguous := make(map[string]bool)
+	for _, n := range removed {
+		key := renameKey(n.fileinfo)
+		if _, ok := candidates[key]; ok {
+			ambiguous[key] = true
+		}
+		candidates[key] = n
+	}
+
+	paired := make(map[*fileSystemNotice]bool)
+	for _, n := range created {
+		key := renameKey(n.fileinfo)
+		old, ok := candidates[key]
+		if !ok || ambiguous[key] || paired[old] {
+			r.emit(n)
+			continue
+		}
+		paired[old] = true
+		event := FileRename
+		if n.event == DirCreate {
+			event = DirRename
+		}
+		r.emit(&fileSystemNotice{
+			path:      n.path,
+			fileinfo:  &RenameInfo{FileInfo: n.fileinfo, OldPath: old.path, NewPath: n.path},
+			timestamp: n.timestamp,
+			event:     event,
+		})
+	}
+	for _, n := range removed {
+		if !paired[n] {
+			r.emit(n)
+		}
+	}
+}
+
+// renameKey identifies an unchanged file across paths.
+func renameKey(info os.FileInfo) string {
+	/* inodes of removed files are reused right away, content must match too */
+	key := fmt.Sprintf("%v:%d:%d", info.Mode().Type(), info.Size(), info.ModTime().UnixNano())
+	if id, ok := fileID(info); ok {
+		key += ":" + id
+	}
+	return key
+}
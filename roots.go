@@ -0,0 +1,342 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WithPaths adds paths watched by builtin Watchers besides the one given by WithPath.
+// Every path is scanned by a Watcher of its own, concurrently, and their notices implement RootedNotice.
+// Paths can be added and removed later by Monitor.AddPath and Monitor.RemovePath, so none are required.
+func WithPaths(path ...string) Option {
+	return func(o *options) error {
+		for _, p := range path {
+			if p == "" {
+				return fmt.Errorf("Path to watch must not be empty")
+			}
+		}
+		o.roots = append(o.roots, path...)
+		o.multi = true
+		return nil
+	}
+}
+
+// WithRoot adds a path watched as WithPaths does, with filters of its own: only notices of events are delivered,
+// all of those given to Start without any, about files matching patterns, all files without any, instead of those given
+// by WithPatterns. E.g. WithRoot("/drop", FileCreate) and WithRoot("/etc", 0) in one Monitor started for all events.
+func WithRoot(path string, events Event, pattern ...string) Option {
+	return func(o *options) error {
+		if path == "" {
+			return fmt.Errorf("Path to watch must not be empty")
+		}
+		for _, pat := range pattern {
+			if _, err := CompilePattern(pat); err != nil {
+				return fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+			}
+		}
+		if o.perRoot == nil {
+			o.perRoot = make(map[string]rootFilter)
+		}
+		o.perRoot[canonicalAddress(path)] = rootFilter{events: events, patterns: pattern}
+		o.roots = append(o.roots, path)
+		o.multi = true
+		return nil
+	}
+}
+
+// rootFilter is the filters of a path given by WithRoot.
+type rootFilter struct {
+	events   Event
+	patterns []string
+}
+
+// AddPath starts watching path from the next scan on, noticing files matching patterns, all files without patterns.
+// Patterns of a FilterSet given by WithFilters apply too. Monitor must be created WithPaths.
+func (m *Monitor) AddPath(path string, patterns []string) error {
+	mw, ok := m.watcher.(*multiWatcher)
+	if !ok {
+		return fmt.Errorf("Monitor must be created WithPaths to add paths")
+	}
+	return mw.add(path, 0, patterns)
+}
+
+// RemovePath stops watching path from the next scan on, dropping what was known about its files without notices.
+// Monitor must be created WithPaths.
+func (m *Monitor) RemovePath(path string) error {
+	mw, ok := m.watcher.(*multiWatcher)
+	if !ok {
+		return fmt.Errorf("Monitor must be created WithPaths to remove paths")
+	}
+	return mw.remove(path)
+}
+
+// RootedNotice is implemented by notices of Monitors watching several paths, telling the watched path they're from.
+type RootedNotice interface {
+	Notice
+	Root() string
+}
+
+// rootNotice implements RootedNotice by wrapping the discovered Notice.
+type rootNotice struct {
+	Notice
+	root string
+}
+
+func (r *rootNotice) Unwrap() Notice {
+	return r.Notice
+}
+
+func (r *rootNotice) Root() string {
+	return r.root
+}
+
+func (r *rootNotice) Info() NoticeInfo {
+	i := InfoOf(r.Notice)
+	i.Root = r.root
+	return i
+}
+
+// watchedRoot is a Watcher of one of the paths of a multiWatcher.
+type watchedRoot struct {
+	address string
+	watcher Watcher
+
+	/* protocol of the Watcher once watching */
+	ncc    chan<- chan<- Notice
+	errors <-chan error
+}
+
+// scan runs one check of the root, sending its notices to changed.
+func (r *watchedRoot) scan(changed chan<- Notice) error {
+	r.ncc <- changed
+	err, ok := <-r.errors
+	if !ok {
+		return fmt.Errorf("Watcher of %s has stopped", r.address)
+	}
+	return err
+}
+
+// stop ends watching, discarding a check still running.
+func (r *watchedRoot) stop() {
+	close(r.ncc)
+	for range r.errors {
+	}
+}
+
+// multiWatcher implements Watcher by checking the Watchers of several paths concurrently, see WithPaths.
+type multiWatcher struct {
+	/* builtin Watcher created for every path */
+	name string
+	opts options
+
+	mu    sync.Mutex
+	roots []*watchedRoot
+	/* stopped by the Watch() goroutine before the next check */
+	removed []*watchedRoot
+	/* pushed down to the Watchers of paths added */
+	pushdown Pushdown
+}
+
+// newMultiWatcher creates the builtin Watcher of every path, tagging their notices by path.
+func newMultiWatcher(name string, roots []string, opts *options) (Watcher, error) {
+	m := &multiWatcher{name: name, opts: *opts}
+	for _, address := range roots {
+		f, ok := opts.perRoot[canonicalAddress(address)]
+		if !ok {
+			f.patterns = opts.patterns
+		}
+		if err := m.add(address, f.events, f.patterns); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// add creates the builtin Watcher of address, checked from the next check on, sending only notices of events if any.
+func (m *multiWatcher) add(address string, events Event, patterns []string) error {
+	if address == "" {
+		return fmt.Errorf("Path to watch must not be empty")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	canonical := canonicalAddress(address)
+	if m.find(canonical) >= 0 {
+		return fmt.Errorf("Path %s is watched already", address)
+	}
+	o := m.opts
+	o.address = address
+	o.patterns = patterns
+	w, err := newWatcher(m.name, &o)
+	if err != nil {
+		return err
+	}
+	r := rooted(canonical, w, events)
+	if pd, ok := r.watcher.(Pushdowner); ok {
+		pd.PushDown(m.pushdown)
+	}
+	m.roots = append(m.roots, r)
+	return nil
+}
+
+// remove drops the Watcher of address, stopped before the next check.
+func (m *multiWatcher) remove(address string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.find(canonicalAddress(address))
+	if i < 0 {
+		return fmt.Errorf("Path %s is not watched", address)
+	}
+	r := m.roots[i]
+	m.roots = append(m.roots[:i:i], m.roots[i+1:]...)
+	if r.ncc != nil {
+		m.removed = append(m.removed, r)
+	}
+	return nil
+}
+
+// find returns the index of the root watching address, -1 if none. Must be called holding mu.
+func (m *multiWatcher) find(address string) int {
+	for i, r := range m.roots {
+		if samePath(r.address, address) {
+			return i
+		}
+	}
+	return -1
+}
+
+// rooted tags notices of w by the path it watches, dropping those of other than events if any.
+func rooted(address string, w Watcher, events Event) *watchedRoot {
+	return &watchedRoot{
+		address: address,
+		watcher: Decorate(w, func(n Notice) Notice {
+			/* inventories aren't filtered by event types */
+			if events != 0 && n.Type()&(events|FileExisting) == 0 {
+				return nil
+			}
+			return &rootNotice{Notice: n, root: address}
+		}),
+	}
+}
+
+// Watch checks every path for every notice channel sent by Monitor, the error joins those of all paths.
+func (m *multiWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error) {
+		defer close(errors)
+		defer func() {
+			for _, r := range m.watching() {
+				r.stop()
+			}
+		}()
+
+		for changed := range ncc {
+			roots := m.watching()
+
+			var wg sync.WaitGroup
+			errs := make([]error, len(roots))
+			for i, r := range roots {
+				wg.Add(1)
+				go func(i int, r *watchedRoot) {
+					defer wg.Done()
+					errs[i] = r.scan(changed)
+				}(i, r)
+			}
+			wg.Wait()
+
+			failed := &scanErrors{roots: len(roots)}
+			for i, err := range errs {
+				if err != nil {
+					failed.errs = append(failed.errs, scanError(roots[i].address, err))
+				}
+			}
+			if len(failed.errs) > 0 {
+				errors <- failed
+				continue
+			}
+			errors <- nil
+		}
+	}(ncc, errors)
+	return ncc, errors
+}
+
+// watching returns the roots, starting to watch those not watching yet and stopping removed ones.
+func (m *multiWatcher) watching() []*watchedRoot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.removed {
+		r.stop()
+	}
+	m.removed = nil
+
+	for _, r := range m.roots {
+		if r.ncc == nil {
+			r.ncc, r.errors = r.watcher.Watch()
+		}
+	}
+	return append([]*watchedRoot(nil), m.roots...)
+}
+
+// root returns the root holding path, relative paths only resolve with a single root.
+func (m *multiWatcher) root(path string) (*watchedRoot, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.roots {
+		if within(canonicalAddress(path), r.address) || len(m.roots) == 1 {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("Path %s is outside of watched paths", path)
+}
+
+// Rescan relays a partial rescan to the Watcher of the path holding subpath, which must be absolute.
+func (m *multiWatcher) Rescan(subpath string, changed chan<- Notice) error {
+	r, err := m.root(subpath)
+	if err != nil {
+		return err
+	}
+	rs, ok := r.watcher.(Rescanner)
+	if !ok {
+		return fmt.Errorf("Watcher %T doesn't support partial rescan", r.watcher)
+	}
+	return rs.Rescan(subpath, changed)
+}
+
+// Preview collects notices previewed by the Watchers of all paths.
+func (m *multiWatcher) Preview() ([]Notice, error) {
+	m.mu.Lock()
+	roots := append([]*watchedRoot(nil), m.roots...)
+	m.mu.Unlock()
+
+	var notices []Notice
+	for _, r := range roots {
+		p, ok := r.watcher.(Previewer)
+		if !ok {
+			return nil, fmt.Errorf("Watcher %T doesn't support preview", r.watcher)
+		}
+		previewed, err := p.Preview()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", r.address, err)
+		}
+		notices = append(notices, previewed...)
+	}
+	return notices, nil
+}
+
+// Explain relays to the Watcher of the path holding path.
+func (m *multiWatcher) Explain(path string) *Explanation {
+	r, err := m.root(path)
+	if err != nil {
+		return &Explanation{Path: path, Reasons: []string{err.Error()}}
+	}
+	e, ok := r.watcher.(Explainer)
+	if !ok {
+		return &Explanation{Path: path, Reasons: []string{fmt.Sprintf("Watcher %T doesn't support explaining", r.watcher)}}
+	}
+	return e.Explain(path)
+}
@@ -0,0 +1,328 @@
+package fsmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Action is what a Rule does to the notices passing its condition.
+type Action string
+
+const (
+	// Drops the notice, later rules don't apply
+	ActionSuppress Action = "suppress"
+	// Adds the Tags of the rule to the notice
+	ActionTag Action = "tag"
+	// Raises the severity of the notice to the Severity of the rule
+	ActionEscalate Action = "escalate"
+	// Runs the Command of the rule in the background, see Rule.Command
+	ActionCommand Action = "command"
+	// Keeps 1 in Sample notices and drops the others, counted in Stats.Sampled, later rules don't apply to them
+	ActionSample Action = "sample"
+	// Publishes the notice to the Sink of the rule, see Rule.Sink
+	ActionRoute Action = "route"
+)
+
+// Severity ranks notices escalated by rules.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityCritical
+)
+
+var severityName = map[Severity]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityCritical: "critical",
+}
+
+func (s Severity) String() string {
+	if name, ok := severityName[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for sev, name := range severityName {
+		if name == string(text) {
+			*s = sev
+			return nil
+		}
+	}
+	return fmt.Errorf("Severity not recognized: %q", text)
+}
+
+// Rule applies its Action to notices of its event types about names matching its patterns, see WithRules.
+type Rule struct {
+	Name string `json:"name"`
+	// Event types the rule applies to, all without any
+	Events Event `json:"events,omitempty"`
+	// Names must match any of the patterns, regular expressions or globs (see CompilePattern), all names without patterns
+	Patterns []string `json:"patterns,omitempty"`
+	Action   Action   `json:"action"`
+	// Added by ActionTag
+	Tags []string `json:"tags,omitempty"`
+	// Raised to by ActionEscalate, notices raised to it by preceding rules are all kept by ActionSample
+	Severity Severity `json:"severity,omitempty"`
+	// Notices matching ActionSample out of which 1 is kept
+	Sample int `json:"sample,omitempty"`
+	// Program and arguments run by ActionCommand, given the notice as FSMONITOR_PATH and FSMONITOR_EVENT environment
+	Command []string `json:"command,omitempty"`
+	// Name of the Sink ActionRoute publishes to, see SinkName. Sinks routed to by any rule only publish the notices
+	// routed to them, others publish every notice
+	Sink string `json:"sink,omitempty"`
+}
+
+// ParseRules decodes and validates a JSON array of rules, e.g. read from a configuration file.
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("Malformed rules: %v", err)
+	}
+	if _, err := compileRules(rules); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// compiledRule is a Rule with its condition compiled.
+type compiledRule struct {
+	Rule
+	filter noticeFilter
+	/* notices matched by ActionSample so far */
+	matched uint64
+}
+
+// compileRules validates rules and compiles their conditions.
+func compileRules(rules []Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for i, r := range rules {
+		switch r.Action {
+		case ActionSuppress, ActionTag, ActionEscalate:
+		case ActionCommand:
+			if len(r.Command) == 0 {
+				return nil, fmt.Errorf("Rule %d %q must give the command to run", i, r.Name)
+			}
+		case ActionSample:
+			if r.Sample <= 0 {
+				return nil, fmt.Errorf("Rule %d %q must give the notices to keep 1 out of", i, r.Name)
+			}
+		case ActionRoute:
+			if r.Sink == "" {
+				return nil, fmt.Errorf("Rule %d %q must give the sink to route to", i, r.Name)
+			}
+		default:
+			return nil, fmt.Errorf("Rule %d %q has action not recognized: %q", i, r.Name, r.Action)
+		}
+		f, err := newNoticeFilter(r.Events, r.Patterns)
+		if err != nil {
+			return nil, fmt.Errorf("Rule %d %q: %v", i, r.Name, err)
+		}
+		compiled = append(compiled, compiledRule{Rule: r, filter: f})
+	}
+	return compiled, nil
+}
+
+// WithRules applies rules in order to every notice delivered after maintenance windows, see Monitor.SetRules.
+func WithRules(rules ...Rule) Option {
+	return func(o *options) error {
+		if _, err := compileRules(rules); err != nil {
+			return err
+		}
+		o.rules = append(o.rules, rules...)
+		return nil
+	}
+}
+
+// SetRules replaces the rules of the Monitor from the next notice on, e.g. once their configuration file changed.
+func (m *Monitor) SetRules(rules []Rule) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.rules = compiled
+	m.mu.Unlock()
+	return nil
+}
+
+// RuledNotice is implemented by notices tagged or escalated by rules.
+type RuledNotice interface {
+	Notice
+	Tags() []string
+	Severity() Severity
+	// Names of the rules applied
+	Rules() []string
+}
+
+// ruledNotice implements RuledNotice by wrapping the discovered Notice.
+type ruledNotice struct {
+	Notice
+	tags     []string
+	severity Severity
+	rules    []string
+	/* names of the sinks routed to, see ActionRoute */
+	sinks []string
+}
+
+func (r *ruledNotice) Unwrap() Notice {
+	return r.Notice
+}
+
+func (r *ruledNotice) Tags() []string {
+	return r.tags
+}
+
+func (r *ruledNotice) Severity() Severity {
+	return r.severity
+}
+
+func (r *ruledNotice) Rules() []string {
+	return r.rules
+}
+
+func (r *ruledNotice) routes() []string {
+	return r.sinks
+}
+
+func (r *ruledNotice) String() string {
+	return fmt.Sprintf("%v %v [%s]", r.Notice, r.severity, strings.Join(r.tags, ","))
+}
+
+// rule applies the rules to n, nil if suppressed or given nil.
+func (m *Monitor) rule(n Notice) Notice {
+	return m.applyRules(n, nil)
+}
+
+// applyRules applies the rules to n, only reporting to t what commands and samples would do if given.
+func (m *Monitor) applyRules(n Notice, t *Trace) Notice {
+	if n == nil {
+		return nil
+	}
+	m.mu.Lock()
+	rules := m.rules
+	m.mu.Unlock()
+
+	var ruled *ruledNotice
+	for i := range rules {
+		r := &rules[i]
+		if !r.filter.matches(n) {
+			continue
+		}
+		if t != nil {
+			t.Rules = append(t.Rules, r.Name)
+		}
+		switch r.Action {
+		case ActionSuppress:
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("suppressed by rule %q", r.Name))
+				return nil
+			}
+			m.logger.debug("Notice suppressed by rule", "rule", r.Name, "path", n.Name(), "event", n.Type())
+			return nil
+		case ActionCommand:
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("runs %v by rule %q", r.Command, r.Name))
+				continue
+			}
+			m.command(r, n)
+			continue
+		case ActionSample:
+			if r.Severity > SeverityInfo && ruled != nil && ruled.severity >= r.Severity {
+				continue
+			}
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("kept 1 in %d by rule %q", r.Sample, r.Name))
+				continue
+			}
+			if r.matched++; (r.matched-1)%uint64(r.Sample) == 0 {
+				continue
+			}
+			m.mu.Lock()
+			if m.stats.Sampled == nil {
+				m.stats.Sampled = make(map[string]uint64)
+			}
+			m.stats.Sampled[r.Name]++
+			m.mu.Unlock()
+			return nil
+		}
+		if ruled == nil {
+			ruled = &ruledNotice{Notice: n}
+		}
+		ruled.rules = append(ruled.rules, r.Name)
+		if r.Action == ActionTag {
+			ruled.tags = append(ruled.tags, r.Tags...)
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("tagged %v by rule %q", r.Tags, r.Name))
+			}
+		} else if r.Action == ActionRoute {
+			ruled.sinks = append(ruled.sinks, r.Sink)
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("routed to sink %q by rule %q", r.Sink, r.Name))
+			}
+		} else if r.Severity > ruled.severity {
+			ruled.severity = r.Severity
+			if t != nil {
+				t.Reasons = append(t.Reasons, fmt.Sprintf("escalated to %v by rule %q", r.Severity, r.Name))
+			}
+		}
+	}
+	if ruled == nil {
+		return n
+	}
+	return ruled
+}
+
+// routedNotice is implemented by notices routed to sinks by rules.
+type routedNotice interface {
+	Notice
+	routes() []string
+}
+
+// routed reports whether the Sink attached by name publishes n: those routed to by any rule only publish the
+// notices routed to them, others all.
+func (m *Monitor) routed(n Notice, name string) bool {
+	var r routedNotice
+	if NoticeAs(n, &r) {
+		for _, sink := range r.routes() {
+			if sink == name {
+				return true
+			}
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.rules {
+		if m.rules[i].Action == ActionRoute && m.rules[i].Sink == name {
+			return false
+		}
+	}
+	return true
+}
+
+// command runs the command of r for n without waiting for it, logging its failure.
+func (m *Monitor) command(r *compiledRule, n Notice) {
+	cmd := exec.Command(r.Command[0], r.Command[1:]...)
+	cmd.Env = append(os.Environ(), "FSMONITOR_PATH="+n.Name(), "FSMONITOR_EVENT="+n.Type().String())
+	if err := cmd.Start(); err != nil {
+		m.logger.error("Rule failed to run command", "rule", r.Name, "command", r.Command, "path", n.Name(), "event", n.Type(), "error", err)
+		return
+	}
+	m.goroutines.run("rule command", func() {
+		if err := cmd.Wait(); err != nil {
+			m.logger.error("Rule command failed", "rule", r.Name, "command", r.Command, "path", n.Name(), "event", n.Type(), "error", err)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package s3watcher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+const (
+	/* long polling of the queue, the most SQS allows */
+	receive_wait     = 20
+	receive_messages = 10
+	/* pause receiving after failures, doubled for every further one in a row up to a minute */
+	receive_backoff     = time.Second
+	receive_max_backoff = time.Minute
+)
+
+// objectEvent is an S3 Event Notification of an object created or removed, see Config.Queue.
+type objectEvent struct {
+	info      *ObjectInfo
+	removed   bool
+	sequencer string
+	received  time.Time
+}
+
+// eventMessage is the body of S3 Event Notifications, or of SNS notifications carrying them as Message.
+type eventMessage struct {
+	Records []struct {
+		EventName string    `json:"eventName"`
+		EventTime time.Time `json:"eventTime"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key       string `json:"key"`
+				Size      int64  `json:"size"`
+				ETag      string `json:"eTag"`
+				Sequencer string `json:"sequencer"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+	Type    string `json:"Type"`
+	Message string `json:"Message"`
+}
+
+// parseEvents returns the events of objects created or removed told by body, received at received. Other events,
+// e.g. the test event sent once notifications are configured, are skipped.
+func parseEvents(body string, received time.Time) ([]objectEvent, error) {
+	var msg eventMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, fmt.Errorf("Event notification is malformed: %v", err)
+	}
+	if msg.Type == "Notification" && msg.Message != "" {
+		return parseEvents(msg.Message, received)
+	}
+
+	var events []objectEvent
+	for _, r := range msg.Records {
+		/* keys are URL encoded, spaces by "+" */
+		key, err := url.QueryUnescape(r.S3.Object.Key)
+		if err != nil {
+			return events, fmt.Errorf("Key %q of event notification is malformed: %v", r.S3.Object.Key, err)
+		}
+		e := objectEvent{
+			info: &ObjectInfo{
+				Bucket:        r.S3.Bucket.Name,
+				Key:           key,
+				ETag:          r.S3.Object.ETag,
+				ContentLength: r.S3.Object.Size,
+				LastModified:  r.EventTime,
+			},
+			sequencer: r.S3.Object.Sequencer,
+			received:  received,
+		}
+		/* listings quote ETags, events don't */
+		if e.info.ETag != "" && !strings.HasPrefix(e.info.ETag, `"`) {
+			e.info.ETag = `"` + e.info.ETag + `"`
+		}
+		switch {
+		case strings.HasPrefix(r.EventName, "ObjectCreated:"):
+		case strings.HasPrefix(r.EventName, "ObjectRemoved:"):
+			e.removed = true
+		default:
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// receive receives event notifications from the queue into pending until ctx is done, deleting messages once taken.
+// Events lost in between, e.g. by crashing, are caught by the next listing.
+func (w *Watcher) receive(ctx context.Context) {
+	failures := 0
+	for ctx.Err() == nil {
+		out, err := w.config.Queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(w.config.QueueURL),
+			MaxNumberOfMessages: receive_messages,
+			WaitTimeSeconds:     receive_wait,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			failures++
+			backoff := receive_backoff << uint(failures-1)
+			if backoff > receive_max_backoff || backoff <= 0 {
+				backoff = receive_max_backoff
+			}
+			w.config.Logger.Printf("Failed to receive event notifications from %s, retrying in %v! %v", w.config.QueueURL, backoff, err)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		failures = 0
+
+		received := time.Now()
+		for _, m := range out.Messages {
+			events, err := parseEvents(aws.ToString(m.Body), received)
+			if err != nil {
+				w.config.Logger.Printf("Skipping message %s! %v", aws.ToString(m.MessageId), err)
+			}
+			w.mu.Lock()
+			w.pending = append(w.pending, events...)
+			w.mu.Unlock()
+			if _, err := w.config.Queue.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(w.config.QueueURL),
+				ReceiptHandle: m.ReceiptHandle,
+			}); err != nil && ctx.Err() == nil {
+				w.config.Logger.Printf("Failed to delete message %s! %v", aws.ToString(m.MessageId), err)
+			}
+		}
+	}
+}
+
+// take returns the events pending received since since, dropping all pending.
+func (w *Watcher) take(since time.Time) []objectEvent {
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	events := pending[:0]
+	for _, e := range pending {
+		if !e.received.Before(since) {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+// apply applies events to lastCheck in order, emitting notices of what they changed. Events of other buckets, keys
+// not watched, or older than one applied to their key already are skipped, as are those telling what's known.
+func (w *Watcher) apply(events []objectEvent, emit func(fsmonitor.Notice)) {
+	for _, e := range events {
+		key := e.info.Key
+		if e.info.Bucket != w.config.Bucket || !strings.HasPrefix(key, w.config.Prefix) || strings.HasSuffix(key, "/") || !w.matches(e.info.Name()) {
+			continue
+		}
+		if last, ok := w.sequencers[key]; ok && !after(e.sequencer, last) {
+			continue
+		}
+		w.sequencers[key] = e.sequencer
+
+		old, existed := w.lastCheck[key]
+		switch {
+		case e.removed && existed:
+			delete(w.lastCheck, key)
+			emit(fsmonitor.NewNotice(old.Name(), fsmonitor.FileRemove, old))
+		case e.removed:
+		case !existed:
+			w.lastCheck[key] = e.info
+			emit(fsmonitor.NewNotice(e.info.Name(), fsmonitor.FileCreate, e.info))
+		case e.info.changed(old):
+			w.lastCheck[key] = e.info
+			emit(fsmonitor.NewNotice(e.info.Name(), fsmonitor.FileUpdate, e.info))
+		}
+	}
+}
+
+// after reports whether sequencer a is of an event after that of b, comparing them as S3 documents: the shorter
+// right-padded by zeros. Events without a sequencer are taken as after.
+func after(a, b string) bool {
+	if a == "" || b == "" {
+		return true
+	}
+	for len(a) < len(b) {
+		a += "0"
+	}
+	for len(b) < len(a) {
+		b += "0"
+	}
+	return strings.ToUpper(a) > strings.ToUpper(b)
+}
@@ -0,0 +1,364 @@
+// Package s3watcher watches the objects of an Amazon S3 bucket, or of an S3 compatible object store, as a
+// fsmonitor.Watcher, the way directories are watched:
+//
+//	w, err := s3watcher.New(s3watcher.Config{Client: s3.NewFromConfig(cfg), Bucket: "data", Prefix: "incoming/"}, nil)
+//	...
+//	monitor, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w))
+//
+// Every scan lists the objects below Prefix, sending FileCreate for objects appearing, FileUpdate for those whose ETag
+// or size changed and FileRemove for those gone, named by their s3://bucket/key URLs. The first scan baselines.
+//
+// Buckets of millions of objects are listed in part given a Marker, an object writers rewrite once they changed the
+// prefix holding it, e.g. the "_SUCCESS" of Spark jobs or a manifest: prefixes holding an unchanged marker reuse
+// their listing of the previous scan, told by a HEAD request instead of listing them.
+//
+// Given a Queue, the S3 Event Notifications of the bucket are received from SQS as they come and sent by the next
+// scan without listing, deduplicated by their sequencers and against what's known, while listing reconciles every
+// Reconciliation, catching changes events missed, e.g. deletes while the queue was unreachable.
+package s3watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+/* default of Config.Reconciliation */
+const reconcile_interval = 5 * time.Minute
+
+// Logger reports failures receiving event notifications and what reconciling found, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[S3] ", log.LstdFlags)
+
+// Client lists the objects of a bucket and heads markers, as *s3.Client does.
+type Client interface {
+	s3.ListObjectsV2APIClient
+	s3.HeadObjectAPIClient
+}
+
+// Config of a Watcher, Client and Bucket are required.
+type Config struct {
+	Client Client
+	Bucket string
+	// Objects watched have keys starting with Prefix, e.g. "incoming/", all of the bucket without
+	Prefix string
+	// Name of the list marker, e.g. "_SUCCESS", every prefix is listed every scan without. Prefixes are walked by "/"
+	// then, those holding the marker listed again only once its ETag changed.
+	Marker string
+	// Receives the S3 Event Notifications of the bucket from the SQS queue at QueueURL, sent to it directly or through
+	// SNS, every scan lists the bucket without
+	Queue    QueueClient
+	QueueURL string
+	// Scans list the bucket that often given a Queue, 5 minutes by default
+	Reconciliation time.Duration
+	Logger         *log.Logger
+}
+
+// QueueClient receives and deletes the messages of an SQS queue, as *sqs.Client does.
+type QueueClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+}
+
+// ObjectInfo is the os.FileInfo of objects, returned by Notice.More.
+type ObjectInfo struct {
+	Bucket        string
+	Key           string
+	ETag          string
+	ContentLength int64
+	LastModified  time.Time
+}
+
+// Name returns the s3://bucket/key URL of the object, which its notices are named by.
+func (o *ObjectInfo) Name() string       { return "s3://" + o.Bucket + "/" + o.Key }
+func (o *ObjectInfo) Size() int64        { return o.ContentLength }
+func (o *ObjectInfo) Mode() os.FileMode  { return 0444 }
+func (o *ObjectInfo) ModTime() time.Time { return o.LastModified }
+func (o *ObjectInfo) IsDir() bool        { return false }
+func (o *ObjectInfo) Sys() interface{}   { return nil }
+
+// changed reports whether the object differs from old by ETag or size.
+func (o *ObjectInfo) changed(old *ObjectInfo) bool {
+	return o.ETag != old.ETag || o.ContentLength != old.ContentLength
+}
+
+// Watcher implements fsmonitor.Watcher by listing the objects of a bucket.
+type Watcher struct {
+	fsmonitor.Watcher
+	config  Config
+	pattern []*regexp.Regexp
+	/* objects found by the last scan by key, nil until the first baselines */
+	lastCheck map[string]*ObjectInfo
+	/* listings of the last scan by the prefixes holding the marker, see Config.Marker */
+	listings map[string]*listing
+
+	/* start of the last listing, see Config.Reconciliation */
+	reconciled time.Time
+	/* sequencer of the last event applied by key, since the last listing */
+	sequencers map[string]string
+	/* events received, not applied yet */
+	mu      sync.Mutex
+	pending []objectEvent
+}
+
+// listing is what a prefix holding the marker held when listed.
+type listing struct {
+	marker  string
+	objects []*ObjectInfo
+}
+
+var _ fsmonitor.Watcher = (*Watcher)(nil)
+
+// New returns a Watcher listing the objects of c.Bucket below c.Prefix whose URLs match any of pattern, all without
+// patterns, see fsmonitor.CompilePattern. Failing listings fail the scan, keeping what was known.
+func New(c Config, pattern []string) (*Watcher, error) {
+	if c.Client == nil || c.Bucket == "" {
+		return nil, fmt.Errorf("S3 client and bucket must be given")
+	}
+	if c.Queue != nil && c.QueueURL == "" {
+		return nil, fmt.Errorf("SQS queue URL must be given along with the queue client")
+	}
+	if c.Reconciliation <= 0 {
+		c.Reconciliation = reconcile_interval
+	}
+	if c.Logger == nil {
+		c.Logger = Logger
+	}
+	w := &Watcher{config: c, sequencers: make(map[string]string)}
+	for _, pat := range pattern {
+		re, err := fsmonitor.CompilePattern(pat)
+		if err != nil {
+			return nil, fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+		w.pattern = append(w.pattern, re)
+	}
+	/* a Scanner is given, which is all that can fail */
+	w.Watcher, _ = fsmonitor.ScannerWatcher(fsmonitor.ScanFunc(w.scan))
+	return w, nil
+}
+
+// Watch receives event notifications from the queue while the Monitor runs, given Config.Queue.
+func (w *Watcher) Watch() (chan<- chan<- fsmonitor.Notice, <-chan error) {
+	ncc, scanned := w.Watcher.Watch()
+	if w.config.Queue == nil {
+		return ncc, scanned
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		w.receive(ctx)
+	}()
+
+	errors := make(chan error)
+	go func() {
+		defer close(errors)
+		defer func() {
+			cancel()
+			<-received
+		}()
+		for err := range scanned {
+			errors <- err
+		}
+	}()
+	return ncc, errors
+}
+
+// scan lists the objects and diffs them against lastCheck, the first scan baselines. Given a queue, scans between
+// listings apply the events received instead.
+func (w *Watcher) scan(ctx context.Context, emit func(fsmonitor.Notice)) error {
+	if w.config.Queue != nil && w.lastCheck != nil && time.Since(w.reconciled) < w.config.Reconciliation {
+		w.apply(w.take(time.Time{}), emit)
+		return nil
+	}
+
+	start := time.Now()
+	current := make(map[string]*ObjectInfo, len(w.lastCheck))
+	var err error
+	if w.config.Marker == "" {
+		err = w.list(ctx, w.config.Prefix, current)
+	} else {
+		listings := make(map[string]*listing, len(w.listings))
+		var objects []*ObjectInfo
+		if objects, err = w.walk(ctx, w.config.Prefix, listings); err == nil {
+			for _, info := range objects {
+				current[info.Key] = info
+			}
+			w.listings = listings
+		}
+	}
+	if err != nil {
+		/* events keep coming while listing fails */
+		if w.config.Queue != nil && w.lastCheck != nil {
+			w.apply(w.take(time.Time{}), emit)
+		}
+		return err
+	}
+
+	if w.lastCheck != nil {
+		missed := w.diff(current, emit)
+		if w.config.Queue != nil && missed > 0 {
+			w.config.Logger.Printf("Listing s3://%s/%s found %d changes missed by events", w.config.Bucket, w.config.Prefix, missed)
+		}
+	}
+	w.lastCheck = current
+	if w.config.Queue != nil {
+		w.reconciled = start
+		w.sequencers = make(map[string]string)
+		/* the listing tells what events received before it did */
+		w.apply(w.take(start), emit)
+	}
+	return nil
+}
+
+// walk returns the objects below prefix matching the patterns, listing prefixes by "/" unless they hold a marker
+// unchanged since the last scan, whose listing of then is reused. Prefixes holding the marker are kept in listings.
+func (w *Watcher) walk(ctx context.Context, prefix string, listings map[string]*listing) ([]*ObjectInfo, error) {
+	/* headed before listing, so changes made meanwhile are listed by the next scan */
+	marker, err := w.marker(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if last, ok := w.listings[prefix]; ok && marker != "" && last.marker == marker {
+		listings[prefix] = last
+		return last.objects, nil
+	}
+
+	var objects []*ObjectInfo
+	pages := s3.NewListObjectsV2Paginator(w.config.Client, &s3.ListObjectsV2Input{
+		Bucket:    aws.String(w.config.Bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("Listing of s3://%s/%s failed: %v", w.config.Bucket, prefix, err)
+		}
+		for _, o := range page.Contents {
+			if info := w.object(o); info != nil {
+				objects = append(objects, info)
+			}
+		}
+		for _, p := range page.CommonPrefixes {
+			below, err := w.walk(ctx, aws.ToString(p.Prefix), listings)
+			if err != nil {
+				return nil, err
+			}
+			objects = append(objects, below...)
+		}
+	}
+	if marker != "" {
+		listings[prefix] = &listing{marker: marker, objects: objects}
+	}
+	return objects, nil
+}
+
+// marker returns the ETag of the marker held by prefix, empty if it holds none.
+func (w *Watcher) marker(ctx context.Context, prefix string) (string, error) {
+	head, err := w.config.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(w.config.Bucket),
+		Key:    aws.String(prefix + w.config.Marker),
+	})
+	var missing *types.NotFound
+	switch {
+	case errors.As(err, &missing):
+		return "", nil
+	case err != nil:
+		return "", fmt.Errorf("Request of s3://%s/%s%s failed: %v", w.config.Bucket, prefix, w.config.Marker, err)
+	}
+	return aws.ToString(head.ETag), nil
+}
+
+// list lists the objects below prefix matching the patterns into found.
+func (w *Watcher) list(ctx context.Context, prefix string, found map[string]*ObjectInfo) error {
+	pages := s3.NewListObjectsV2Paginator(w.config.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(w.config.Bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("Listing of s3://%s/%s failed: %v", w.config.Bucket, prefix, err)
+		}
+		for _, o := range page.Contents {
+			if info := w.object(o); info != nil {
+				found[info.Key] = info
+			}
+		}
+	}
+	return nil
+}
+
+// object returns the ObjectInfo of o listed, nil unless it matches the patterns.
+func (w *Watcher) object(o types.Object) *ObjectInfo {
+	info := &ObjectInfo{
+		Bucket:        w.config.Bucket,
+		Key:           aws.ToString(o.Key),
+		ETag:          aws.ToString(o.ETag),
+		ContentLength: aws.ToInt64(o.Size),
+		LastModified:  aws.ToTime(o.LastModified),
+	}
+	/* folders created by consoles are empty objects named by a trailing slash */
+	if strings.HasSuffix(info.Key, "/") || !w.matches(info.Name()) {
+		return nil
+	}
+	return info
+}
+
+// matches reports whether name matches any of the patterns, true without patterns.
+func (w *Watcher) matches(name string) bool {
+	for _, re := range w.pattern {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return len(w.pattern) == 0
+}
+
+// diff emits notices of objects changed in current since lastCheck, in order of their keys, returning how many.
+func (w *Watcher) diff(current map[string]*ObjectInfo, emit func(fsmonitor.Notice)) int {
+	keys := make([]string, 0, len(current)+len(w.lastCheck))
+	for key := range current {
+		keys = append(keys, key)
+	}
+	for key := range w.lastCheck {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	emitted := 0
+	for _, key := range keys {
+		info, ok := current[key]
+		old, existed := w.lastCheck[key]
+		var event fsmonitor.Event
+		switch {
+		case !ok:
+			info, event = old, fsmonitor.FileRemove
+		case !existed:
+			event = fsmonitor.FileCreate
+		case info.changed(old):
+			event = fsmonitor.FileUpdate
+		default:
+			continue
+		}
+		emit(fsmonitor.NewNotice(info.Name(), event, info))
+		emitted++
+	}
+	return emitted
+}
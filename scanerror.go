@@ -0,0 +1,92 @@
+package fsmonitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ScanError is a failure of a Watcher to scan a watched path, sent by Monitor.Errors, e.g. as the path was
+// removed or became unreadable, so callers can alert or re-provision instead of silently losing coverage.
+type ScanError struct {
+	// Watched path of the Watcher failing
+	Root string
+	// Path failing under Root, Root itself if it can't be accessed or the failure isn't of a path
+	Path string
+	Err  error
+}
+
+func (e *ScanError) Error() string {
+	if msg := e.Err.Error(); strings.Contains(msg, e.Path) {
+		return msg
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// scanError types err of scanning root, nil if nil.
+func scanError(root string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *ScanError
+	if errors.As(err, &se) {
+		return err
+	}
+	e := &ScanError{Root: root, Path: root, Err: err}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		e.Path = pe.Path
+	}
+	return e
+}
+
+// scanErrors are the failures of the paths of a multiWatcher in a scan, sent separately by Monitor.Errors.
+type scanErrors struct {
+	errs  []error
+	roots int
+	/* of the sources of a CompositeWatcher, failing alone without pausing the others */
+	isolated bool
+}
+
+func (e *scanErrors) Error() string {
+	failed := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		failed[i] = err.Error()
+	}
+	of := "paths"
+	if e.isolated {
+		of = "sources"
+	}
+	return fmt.Sprintf("Failed to scan %d of %d %s! %s", len(e.errs), e.roots, of, strings.Join(failed, "; "))
+}
+
+// isolated reports whether err is the failure of only some sources of a CompositeWatcher, not pausing scans.
+func isolated(err error) bool {
+	e, ok := err.(*scanErrors)
+	return ok && e.isolated && len(e.errs) < e.roots
+}
+
+// Errors returns the failures of scans as they occur, as *ScanError telling the path failing, while scans go on
+// after a break. Failures are dropped while 100 are buffered, the channel closes along with Notices().
+func (m *Monitor) Errors() <-chan error {
+	return m.errs
+}
+
+// failed sends the failures of err to Errors() unless their buffer is full.
+func (m *Monitor) failed(err error) {
+	errs := []error{err}
+	if e, ok := err.(*scanErrors); ok {
+		errs = e.errs
+	}
+	for _, err := range errs {
+		select {
+		case m.errs <- scanError(m.address, err):
+		default:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package fsmonitor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Scanner is implemented by custom Watchers telling only what changed, see ScannerWatcher.
+type Scanner interface {
+	// Scan checks the watched resource once, passing notices of changes since the previous call to emit,
+	// which must not be called once Scan returned. ctx is done once the Monitor stops, cutting the scan short.
+	Scan(ctx context.Context, emit func(Notice)) error
+}
+
+// ScanFunc adapts a function to Scanner.
+type ScanFunc func(ctx context.Context, emit func(Notice)) error
+
+func (f ScanFunc) Scan(ctx context.Context, emit func(Notice)) error {
+	return f(ctx, emit)
+}
+
+// ScannerWatcher returns a Watcher calling s for every scan of the Monitor it's given to by WithWatcher,
+// implementing the protocol of Watch so custom Watchers need only diff what they watch. Scans are called one
+// at a time from one goroutine, errors and panics fail the scan and are sent by Monitor.Errors.
+func ScannerWatcher(s Scanner) (Watcher, error) {
+	if s == nil {
+		return nil, fmt.Errorf("Scanner must not be nil")
+	}
+	return &scannerWatcher{scanner: s}, nil
+}
+
+// NewNotice returns a notice of event about path noticed now, for Scanners to emit. info is returned by More and
+// told by Info, it may be nil, e.g. for removed files.
+func NewNotice(path string, event Event, info os.FileInfo) Notice {
+	return &fileSystemNotice{path: path, event: event, fileinfo: info, timestamp: time.Now()}
+}
+
+// scannerWatcher implements Watcher by calling a Scanner.
+type scannerWatcher struct {
+	scanner Scanner
+}
+
+// Watch calls the Scanner for every notice channel sent by Monitor, until closed.
+func (w *scannerWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	/* ncc closes while scanning, which is cut short then */
+	scans := make(chan chan<- Notice)
+	go func(ncc <-chan chan<- Notice) {
+		defer close(scans)
+		defer cancel()
+		for changed := range ncc {
+			scans <- changed
+		}
+	}(ncc)
+
+	go func(errors chan<- error) {
+		defer close(errors)
+		for changed := range scans {
+			errors <- w.scan(ctx, changed)
+		}
+	}(errors)
+	return ncc, errors
+}
+
+// scan runs one scan, failing it if the Scanner panics.
+func (w *scannerWatcher) scan(ctx context.Context, changed chan<- Notice) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Scanner panicked: %v", r)
+		}
+	}()
+	return w.scanner.Scan(ctx, func(n Notice) {
+		if n != nil {
+			changed <- n
+		}
+	})
+}
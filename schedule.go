@@ -0,0 +1,196 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression of minute, hour, day of month, month and day of week,
+// e.g. "*/5 8-18 * * MON-FRI" for every 5 minutes during business hours. See WithSchedule.
+type Schedule struct {
+	expr string
+	/* bit i set when value i matches */
+	minute, hour, dom, month, dow uint64
+	/* day of month and day of week restricted, either matches as cron does */
+	domRestricted, dowRestricted bool
+
+	location *time.Location
+}
+
+var (
+	monthNames = map[string]int{"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12}
+	dayNames = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+)
+
+// ParseSchedule parses a cron expression of five fields, each *, a value, a range a-b, optionally
+// stepped by /n, or a comma separated list of them. Months and days of week may be given by names,
+// Sunday is 0 or 7. Times are of the local time zone.
+func ParseSchedule(expr string) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Schedule %q must have 5 fields: minute hour day-of-month month day-of-week", expr)
+	}
+	s := &Schedule{
+		expr:          expr,
+		domRestricted: fields[2] != "*",
+		dowRestricted: fields[4] != "*",
+		location:      time.Local,
+	}
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, monthNames); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, dayNames); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+// parseCronField returns the bits of values matching field within min and max.
+func parseCronField(field string, min, max int, names map[string]int) (uint64, error) {
+	value := func(s string) (int, error) {
+		if v, ok := names[strings.ToUpper(s)]; ok {
+			return v, nil
+		}
+		v, err := strconv.Atoi(s)
+		if err != nil || v < min || v > max {
+			return 0, fmt.Errorf("Schedule field %q has value %q out of %d-%d", field, s, min, max)
+		}
+		return v, nil
+	}
+
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("Schedule field %q has invalid step %q", field, part[i+1:])
+			}
+			rng, step = part[:i], n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if lo, err = value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("Schedule field %q has empty range %q", field, rng)
+			}
+		default:
+			v, err := value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (s *Schedule) String() string {
+	return s.expr
+}
+
+// Next returns the first scheduled minute after t, zero if none within 5 years (e.g. "0 0 30 2 *").
+// Wall clock times skipped by a DST change are skipped, repeated ones are scheduled once.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.In(s.location)
+	next := s.after(t, time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute()+1, 0, 0, s.location))
+	limit := t.AddDate(5, 0, 0)
+
+	for next.Before(limit) {
+		y, mo, d := next.Date()
+		switch {
+		case s.month&(1<<uint(mo)) == 0:
+			next = time.Date(y, mo+1, 1, 0, 0, 0, 0, s.location)
+		case !s.day(next):
+			next = time.Date(y, mo, d+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(next.Hour())) == 0:
+			next = s.after(next, time.Date(y, mo, d, next.Hour()+1, 0, 0, 0, s.location))
+		case s.minute&(1<<uint(next.Minute())) == 0:
+			next = s.after(next, time.Date(y, mo, d, next.Hour(), next.Minute()+1, 0, 0, s.location))
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// day reports whether the day of t matches day of month or day of week.
+func (s *Schedule) day(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// after returns next, or a minute past t when wall clock normalization went backwards, e.g. within a repeated hour.
+func (s *Schedule) after(t, next time.Time) time.Time {
+	if !next.After(t) {
+		return t.Add(time.Minute).Truncate(time.Minute)
+	}
+	return next
+}
+
+// WithSchedule makes the Monitor scan at the minutes of a cron expression instead of every sleep given to Start,
+// e.g. WithSchedule("*/5 8-18 * * MON-FRI") to scan only during business hours. See ParseSchedule.
+func WithSchedule(expr string) Option {
+	return func(o *options) error {
+		s, err := ParseSchedule(expr)
+		if err != nil {
+			return err
+		}
+		o.schedule = s
+		return nil
+	}
+}
+
+// tick returns the channel of the next scan, by the schedule if any, otherwise every sleep.
+func (m *Monitor) tick(sleep time.Duration) <-chan time.Time {
+	if m.schedule == nil {
+		if m.adaptive.enabled() || m.clock != nil {
+			/* the next interval differs, or is told by the Clock */
+			return m.after(sleep)
+		}
+		return time.Tick(sleep)
+	}
+	now := m.now()
+	next := m.schedule.Next(now)
+	if next.IsZero() {
+		m.logger.warn("Schedule has no scan within 5 years", "schedule", m.schedule)
+		return nil
+	}
+	return m.after(next.Sub(now))
+}
@@ -0,0 +1,219 @@
+package fsmonitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the Notice wire format produced by MarshalNotice.
+// Version 0 refers to the unversioned records sent by the kafka example
+// ({"path", "event"} log entries and raw path messages keyed by event).
+const SchemaVersion = 1
+
+// Fields selects what MarshalNoticeFields encodes besides version, ID and path,
+// so high-volume consumers don't pay for data they ignore.
+type Fields uint
+
+const (
+	FieldEvent Fields = 1 << iota
+	FieldTimestamp
+	// Size, mode and modification time of files
+	FieldMetadata
+
+	AllFields = FieldEvent | FieldTimestamp | FieldMetadata
+)
+
+var fieldName = map[string]Fields{
+	"event":     FieldEvent,
+	"timestamp": FieldTimestamp,
+	"metadata":  FieldMetadata,
+	"all":       AllFields,
+}
+
+// ParseFields converts comma separated field names, e.g. "event,timestamp", into Fields.
+func ParseFields(s string) (Fields, error) {
+	var f Fields
+	for _, name := range strings.Split(s, ",") {
+		field, ok := fieldName[strings.TrimSpace(name)]
+		if !ok {
+			return 0, fmt.Errorf("Field name not recognized: %q", name)
+		}
+		f |= field
+	}
+	return f, nil
+}
+
+// noticeRecord is the versioned wire format of a Notice.
+type noticeRecord struct {
+	Version   int         `json:"version"`
+	ID        string      `json:"id,omitempty"`
+	Path      string      `json:"path"`
+	Event     string      `json:"event,omitempty"`
+	Timestamp *time.Time  `json:"timestamp,omitempty"`
+	Size      int64       `json:"size,omitempty"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+	ModTime   *time.Time  `json:"modtime,omitempty"`
+	Checksum  string      `json:"checksum,omitempty"`
+	Labels    *Labels     `json:"labels,omitempty"`
+	/* path a file had before renamed, see RenameInfo */
+	OldPath string `json:"oldpath,omitempty"`
+	/* trace context of the scan, see TracedNotice */
+	Trace map[string]string `json:"trace,omitempty"`
+}
+
+// Checksummer is implemented by the More() of notices knowing a checksum of the file content, e.g. "sha256:<hex>",
+// encoded by MarshalNotice.
+type Checksummer interface {
+	Checksum() string
+}
+
+// MarshalNotice encodes any Notice into the current schema version.
+// File metadata is included when More() returns an os.FileInfo, its checksum when it implements Checksummer,
+// the ID when the notice implements IdentifiedNotice, the labels telling its source when any, see NoticeLabels,
+// and the old path of renames, decoded as RenameInfo.
+// Notices delivered by builtin Watchers implement json.Marshaler by it, MarshalNoticeProto encodes the same as protobuf.
+func MarshalNotice(n Notice) ([]byte, error) {
+	return MarshalNoticeFields(n, AllFields)
+}
+
+// MarshalNoticeFields behaves as MarshalNotice, encoding only the given fields besides version, ID and path.
+// Decoded notices lack the others, e.g. have no event without FieldEvent.
+func MarshalNoticeFields(n Notice, fields Fields) ([]byte, error) {
+	r := record(n, fields)
+	return json.Marshal(&r)
+}
+
+// record converts n into the wire format, with the given fields.
+func record(n Notice, fields Fields) noticeRecord {
+	r := noticeRecord{
+		Version: SchemaVersion,
+		Path:    n.Name(),
+	}
+	var i IdentifiedNotice
+	if NoticeAs(n, &i) {
+		r.ID = i.ID()
+	}
+	if l := NoticeLabels(n); l != (Labels{}) {
+		r.Labels = &l
+	}
+	var t TracedNotice
+	if NoticeAs(n, &t) && len(t.Trace()) > 0 {
+		r.Trace = t.Trace()
+	}
+	if fields&FieldEvent != 0 {
+		r.Event = n.Type().String()
+	}
+	if fields&FieldTimestamp != 0 {
+		timestamp := n.Time()
+		r.Timestamp = &timestamp
+	}
+	if info, ok := n.More().(os.FileInfo); ok && info != nil && fields&FieldMetadata != 0 {
+		mtime := info.ModTime()
+		r.Size, r.Mode, r.ModTime = info.Size(), info.Mode(), &mtime
+	}
+	if c, ok := n.More().(Checksummer); ok && c != nil && fields&FieldMetadata != 0 {
+		r.Checksum = c.Checksum()
+	}
+	if ri, ok := n.More().(*RenameInfo); ok && ri != nil {
+		r.OldPath = ri.OldPath
+	}
+	return r
+}
+
+func (f *fileSystemNotice) MarshalJSON() ([]byte, error) {
+	return MarshalNotice(f)
+}
+
+/* wrappers of delivered notices encode as well, with the ID and root they add */
+
+func (i *identifiedNotice) MarshalJSON() ([]byte, error) {
+	return MarshalNotice(i)
+}
+
+func (r *rootNotice) MarshalJSON() ([]byte, error) {
+	return MarshalNotice(r)
+}
+
+// UnmarshalNotice decodes a Notice encoded in any known schema version.
+func UnmarshalNotice(data []byte) (Notice, error) {
+	var r noticeRecord
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("Malformed notice record: %v", err)
+	}
+	if r.Version > SchemaVersion {
+		return nil, fmt.Errorf("Notice schema version %d is newer than supported version %d", r.Version, SchemaVersion)
+	}
+	return r.notice()
+}
+
+// UnmarshalMessage decodes a keyed message (e.g. from Kafka) into a Notice.
+// Besides encoded records, it accepts version 0 messages keyed by event name with the raw path as value.
+func UnmarshalMessage(key, value []byte) (Notice, error) {
+	if len(value) > 0 && value[0] == '{' {
+		return UnmarshalNotice(value)
+	}
+	return (&noticeRecord{Path: string(value), Event: string(key)}).notice()
+}
+
+// notice converts the decoded record, older versions lacking fields get zero values.
+func (r *noticeRecord) notice() (Notice, error) {
+	if r.Path == "" {
+		return nil, fmt.Errorf("Notice record of version %d has no path", r.Version)
+	}
+	var e Event
+	if err := e.UnmarshalText([]byte(r.Event)); err != nil {
+		return nil, err
+	}
+	n := &fileSystemNotice{
+		path:  r.Path,
+		event: e,
+	}
+	if r.Labels != nil {
+		n.labels = *r.Labels
+	}
+	if r.Timestamp != nil {
+		n.timestamp = *r.Timestamp
+	}
+	if r.ModTime != nil {
+		n.fileinfo = &recordInfo{
+			name:     filepath.Base(r.Path),
+			size:     r.Size,
+			mode:     r.Mode,
+			modTime:  *r.ModTime,
+			checksum: r.Checksum,
+		}
+		if r.OldPath != "" {
+			n.fileinfo = &RenameInfo{FileInfo: n.fileinfo, OldPath: r.OldPath, NewPath: r.Path}
+		}
+	}
+	var decoded Notice = n
+	if len(r.Trace) > 0 {
+		decoded = &tracedNotice{Notice: decoded, ctx: context.Background(), trace: r.Trace}
+	}
+	if r.ID != "" {
+		return &identifiedNotice{Notice: decoded, id: r.ID}, nil
+	}
+	return decoded, nil
+}
+
+// recordInfo implements os.FileInfo for decoded notices.
+type recordInfo struct {
+	name     string
+	size     int64
+	mode     os.FileMode
+	modTime  time.Time
+	checksum string
+}
+
+func (i *recordInfo) Name() string       { return i.name }
+func (i *recordInfo) Size() int64        { return i.size }
+func (i *recordInfo) Mode() os.FileMode  { return i.mode }
+func (i *recordInfo) ModTime() time.Time { return i.modTime }
+func (i *recordInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *recordInfo) Sys() interface{}   { return nil }
+func (i *recordInfo) Checksum() string   { return i.checksum }
@@ -0,0 +1,57 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithSettle makes the builtin "path" Watcher send FileSettled for every created, updated or renamed file once its
+// size and modification time stayed the same across the given number of consecutive scans after the change,
+// e.g. for pipelines to pick up uploaded files only when they're completely written. Files present at the first
+// scan count as settled.
+func WithSettle(scans int) Option {
+	return func(o *options) error {
+		if scans <= 0 {
+			return fmt.Errorf("Scans to settle must be positive")
+		}
+		o.settle = scans
+		return nil
+	}
+}
+
+// unsettle records the change of n, for its file to settle from the next scan on.
+func (s *pathScanner) unsettle(n *fileSystemNotice) {
+	switch n.event {
+	case FileCreate, FileUpdate, FileRename:
+		if s.unsettled == nil {
+			s.unsettled = make(map[string]int)
+		}
+		s.unsettled[n.path] = 0
+	case FileRemove:
+		delete(s.unsettled, n.path)
+	}
+}
+
+// settled sends FileSettled for files unchanged across enough scans since their last change, once a scan completed.
+func (s *pathScanner) settled(changed chan<- Notice) {
+	for file, scans := range s.unsettled {
+		info, ok := s.tracked(file)
+		if !ok {
+			delete(s.unsettled, file)
+			continue
+		}
+		/* the scan of the change counts as first */
+		if scans < s.settle {
+			s.unsettled[file] = scans + 1
+			continue
+		}
+		delete(s.unsettled, file)
+		changed <- &fileSystemNotice{
+			path:      file,
+			fileinfo:  info,
+			timestamp: time.Now(),
+			event:     FileSettled,
+			labels:    s.labels(file),
+		}
+	}
+}
@@ -0,0 +1,365 @@
+// Package sftpwatcher watches remote directory trees over SFTP as a fsmonitor.Watcher, e.g. for paths reachable only
+// by SSH:
+//
+//	w, err := sftpwatcher.New(sftpwatcher.Config{Addr: "host:22", User: "fsmon", Key: key, KnownHosts: "/root/.ssh/known_hosts", Root: "/srv/data"}, nil)
+//	...
+//	monitor, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w))
+//
+// Remote trees are walked by fsmonitor.FSWatcher, so notices are those of local trees: slash-separated names relative
+// to Root, diffed by size and modification time, creates and removes of the same file sent as renames if the Monitor
+// delivers FileRename. Patterns and fsmonitor.WithExcludes, WithInitialScan and WithMaxDepth apply as they do there.
+package sftpwatcher
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Logger reports connections lost and regained, unless Config gives one.
+var Logger = log.New(ioutil.Discard, "[SFTP] ", log.LstdFlags)
+
+// Config of a Watcher, Addr, User, an auth and a host key check are required.
+type Config struct {
+	// Address of the SSH server, port 22 unless given
+	Addr string
+	User string
+	// Password auth unless empty
+	Password string
+	// PEM encoded private key auth unless empty, decrypted by Passphrase if encrypted
+	Key        []byte
+	Passphrase string
+	// Further auth methods, e.g. ssh-agent by agent.NewClient(conn).Signers
+	Auth []ssh.AuthMethod
+	// Checks the host key of the server, by the known_hosts file KnownHosts unless given
+	HostKeyCallback ssh.HostKeyCallback
+	KnownHosts      string
+	// Remote directory to watch, the login directory unless given
+	Root string
+	// Timeout of connecting, 30 seconds by default
+	Timeout time.Duration
+	// Pause reconnecting after the connection failed, 1 second by default, doubled for every further failure in a
+	// row up to MaxBackoff, 1 minute by default
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Shares the connection with other Watchers of the same Addr and User, bounding calls at once and keeping it
+	// alive, instead of a connection of the Watcher's own. Backoff and MaxBackoff are those of the pool then, which
+	// is closed by its owner rather than along with the Monitor
+	Pool   *fsmonitor.ConnPool
+	Logger *log.Logger
+}
+
+// Watcher implements fsmonitor.Watcher by walking a remote tree over SFTP.
+type Watcher struct {
+	fsmonitor.Watcher
+	fs *remoteFS
+}
+
+var _ fsmonitor.Watcher = (*Watcher)(nil)
+
+// New connects to c.Addr, failing if it's unreachable or auth fails, and returns a Watcher walking c.Root for
+// files matching pattern, see fsmonitor.FSWatcher. Once the connection is lost, scans fail with an error telling so,
+// keeping what was known until the root can be walked again: reconnecting is tried by the next scan, pausing by
+// backoff after failures, and directories failing as the connection is lost mid-scan keep the files known under them.
+// The connection is closed once the Monitor stops.
+func New(c Config, pattern []string, opt ...fsmonitor.Option) (*Watcher, error) {
+	if c.Addr == "" || c.User == "" {
+		return nil, fmt.Errorf("SFTP address and user must be given")
+	}
+	if _, _, err := net.SplitHostPort(c.Addr); err != nil {
+		c.Addr = net.JoinHostPort(c.Addr, "22")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30 * time.Second
+	}
+	if c.Backoff <= 0 {
+		c.Backoff = time.Second
+	}
+	if c.MaxBackoff < c.Backoff {
+		c.MaxBackoff = time.Minute
+	}
+	if c.Logger == nil {
+		c.Logger = Logger
+	}
+
+	auth := append([]ssh.AuthMethod(nil), c.Auth...)
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+	if len(c.Key) > 0 {
+		var signer ssh.Signer
+		var err error
+		if c.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(c.Key, []byte(c.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(c.Key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SFTP private key is malformed: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(auth) == 0 {
+		return nil, fmt.Errorf("SFTP password, key or auth methods must be given")
+	}
+	hostKey := c.HostKeyCallback
+	if hostKey == nil {
+		if c.KnownHosts == "" {
+			return nil, fmt.Errorf("SFTP host key callback or known hosts file must be given")
+		}
+		var err error
+		if hostKey, err = knownhosts.New(c.KnownHosts); err != nil {
+			return nil, fmt.Errorf("Failed to read known hosts: %v", err)
+		}
+	}
+
+	f := &remoteFS{
+		config: c,
+		ssh:    &ssh.ClientConfig{User: c.User, Auth: auth, HostKeyCallback: hostKey, Timeout: c.Timeout},
+	}
+	if err := f.do(func(*sftp.Client) error { return nil }); err != nil {
+		return nil, err
+	}
+	w, err := fsmonitor.FSWatcher(f, pattern, opt...)
+	if err != nil {
+		f.close()
+		return nil, err
+	}
+	return &Watcher{Watcher: w, fs: f}, nil
+}
+
+// PushDown relays to the walking Watcher, so renames are paired only if the Monitor delivers them.
+func (w *Watcher) PushDown(p fsmonitor.Pushdown) {
+	if pd, ok := w.Watcher.(fsmonitor.Pushdowner); ok {
+		pd.PushDown(p)
+	}
+}
+
+// Watch walks the remote tree every scan, closing the connection once the Monitor stops.
+func (w *Watcher) Watch() (chan<- chan<- fsmonitor.Notice, <-chan error) {
+	ncc, scanned := w.Watcher.Watch()
+	errors := make(chan error)
+	go func() {
+		defer close(errors)
+		defer w.fs.close()
+		for err := range scanned {
+			errors <- err
+		}
+	}()
+	return ncc, errors
+}
+
+// remoteFS implements fs.FS, fs.ReadDirFS and fs.StatFS by an SFTP client, reconnecting once the connection is lost.
+type remoteFS struct {
+	config Config
+	ssh    *ssh.ClientConfig
+
+	mu   sync.Mutex
+	conn *ssh.Client
+	sftp *sftp.Client
+	/* connecting failed that many times in a row, last by err, not tried again before retry */
+	failures int
+	err      error
+	retry    time.Time
+}
+
+// client returns the client connected, connecting unless paused by backoff.
+func (f *remoteFS) client() (*sftp.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sftp != nil {
+		return f.sftp, nil
+	}
+	if now := time.Now(); now.Before(f.retry) {
+		return nil, fmt.Errorf("SFTP %s is disconnected, reconnecting in %v: %v", f.config.Addr, f.retry.Sub(now).Round(time.Second), f.err)
+	}
+
+	conn, client, err := f.dial()
+	if err != nil {
+		f.failures++
+		f.err = err
+		backoff := f.config.Backoff << uint(f.failures-1)
+		if backoff > f.config.MaxBackoff || backoff <= 0 {
+			backoff = f.config.MaxBackoff
+		}
+		f.retry = time.Now().Add(backoff)
+		return nil, fmt.Errorf("Failed to connect to SFTP %s: %v", f.config.Addr, err)
+	}
+	if f.failures > 0 {
+		f.config.Logger.Printf("Reconnected to %s after %d failures", f.config.Addr, f.failures)
+	}
+	f.conn, f.sftp, f.failures, f.err = conn, client, 0, nil
+	return client, nil
+}
+
+// dial connects a new client.
+func (f *remoteFS) dial() (*ssh.Client, *sftp.Client, error) {
+	conn, err := ssh.Dial("tcp", f.config.Addr, f.ssh)
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, client, nil
+}
+
+// do calls fn with the client connected, from the pool if given, dropping the connection if fn fails telling it's
+// lost, so the next call reconnects.
+func (f *remoteFS) do(fn func(client *sftp.Client) error) error {
+	if f.config.Pool == nil {
+		client, err := f.client()
+		if err != nil {
+			return err
+		}
+		return f.failed(client, fn(client))
+	}
+
+	key := fmt.Sprintf("sftp://%s@%s", f.config.User, f.config.Addr)
+	conn, release, err := f.config.Pool.Get(key, func() (fsmonitor.PooledConn, error) {
+		conn, client, err := f.dial()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to SFTP %s: %v", f.config.Addr, err)
+		}
+		return &pooledClient{conn: conn, sftp: client}, nil
+	})
+	if err != nil {
+		return err
+	}
+	err = fn(conn.(*pooledClient).sftp)
+	if lost(err) {
+		f.config.Logger.Printf("Connection to %s lost: %v", f.config.Addr, err)
+	}
+	release(lost(err))
+	return err
+}
+
+// lost reports whether err tells the connection is lost, rather than a failure of the call.
+func lost(err error) bool {
+	var status *sftp.StatusError
+	return err != nil && !errors.As(err, &status) && !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrPermission)
+}
+
+// failed drops the connection of client if err tells it's lost, so the next call reconnects, returning err.
+func (f *remoteFS) failed(client *sftp.Client, err error) error {
+	if !lost(err) {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sftp == client {
+		f.config.Logger.Printf("Connection to %s lost: %v", f.config.Addr, err)
+		f.disconnect()
+	}
+	return err
+}
+
+// pooledClient implements fsmonitor.PooledConn by an SFTP client.
+type pooledClient struct {
+	conn *ssh.Client
+	sftp *sftp.Client
+}
+
+func (c *pooledClient) Check() error {
+	_, err := c.sftp.Getwd()
+	return err
+}
+
+func (c *pooledClient) Close() error {
+	c.sftp.Close()
+	return c.conn.Close()
+}
+
+// close closes the connection, those of the pool are closed by its owner.
+func (f *remoteFS) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sftp != nil {
+		f.disconnect()
+	}
+}
+
+// disconnect closes the connection, called holding f.mu.
+func (f *remoteFS) disconnect() {
+	f.sftp.Close()
+	f.conn.Close()
+	f.sftp, f.conn = nil, nil
+}
+
+// remote returns the remote path of name, failing unless a valid fs.FS name.
+func (f *remoteFS) remote(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if f.config.Root == "" {
+		return name, nil
+	}
+	return path.Join(f.config.Root, name), nil
+}
+
+func (f *remoteFS) Open(name string) (fs.File, error) {
+	remote, err := f.remote("open", name)
+	if err != nil {
+		return nil, err
+	}
+	var file *sftp.File
+	err = f.do(func(client *sftp.Client) (err error) {
+		file, err = client.Open(remote)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *remoteFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	remote, err := f.remote("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	err = f.do(func(client *sftp.Client) (err error) {
+		infos, err = client.ReadDir(remote)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (f *remoteFS) Stat(name string) (fs.FileInfo, error) {
+	remote, err := f.remote("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	var info fs.FileInfo
+	err = f.do(func(client *sftp.Client) (err error) {
+		info, err = client.Stat(remote)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
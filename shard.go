@@ -0,0 +1,108 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+)
+
+// Coordinator assigns shards of the tree watched by the builtin "path" Watcher to cooperating processes,
+// each scanning and noticing only its own shards, see WithShards. Shards are the top-level entries
+// under the watched address.
+type Coordinator interface {
+	// Refresh updates the membership before every scan, members joining or leaving rebalance shards
+	Refresh() error
+	// Owns reports whether this process scans shard
+	Owns(shard string) bool
+}
+
+// WithShards makes the builtin "path" Watcher scan only the shards c assigns to this process.
+// Files of shards taken over from another process are baselined without notices,
+// files of shards handed over are dropped without notices.
+func WithShards(c Coordinator) Option {
+	return func(o *options) error {
+		if c == nil {
+			return fmt.Errorf("Coordinator must not be nil")
+		}
+		o.shards = c
+		return nil
+	}
+}
+
+// Rendezvous assigns every shard to the member with the highest hash of member and shard,
+// so only shards of members joining or leaving move. Members lists the live processes,
+// e.g. kept in Redis or etcd by every process renewing a key of its own; self is always included.
+func Rendezvous(self string, members func() ([]string, error)) Coordinator {
+	return &rendezvous{self: self, members: members, current: []string{self}}
+}
+
+// rendezvous implements Coordinator by highest random weight hashing.
+type rendezvous struct {
+	self    string
+	members func() ([]string, error)
+	current []string
+}
+
+func (r *rendezvous) Refresh() error {
+	members, err := r.members()
+	if err != nil {
+		return fmt.Errorf("Failed to list members sharing the scan: %v", err)
+	}
+	r.current = append([]string{r.self}, members...)
+	return nil
+}
+
+func (r *rendezvous) Owns(shard string) bool {
+	var best string
+	var weight uint64
+	for _, m := range r.current {
+		h := fnv.New64a()
+		h.Write([]byte(m))
+		h.Write([]byte{0})
+		h.Write([]byte(shard))
+		/* ties broken by name, so every member agrees */
+		if w := mix(h.Sum64()); best == "" || w > weight || w == weight && m < best {
+			best, weight = m, w
+		}
+	}
+	return best == r.self
+}
+
+// mix spreads FNV hashes of names differing in few bytes, by the finalizer of splitmix64.
+func mix(h uint64) uint64 {
+	h = (h ^ h>>30) * 0xbf58476d1ce4e5b9
+	h = (h ^ h>>27) * 0x94d049bb133111eb
+	return h ^ h>>31
+}
+
+// shard returns the top-level entry under the watched address holding file, empty for the address itself.
+func (s *pathScanner) shard(file string) string {
+	rel, err := filepath.Rel(s.address, file)
+	if err != nil || rel == "." {
+		return ""
+	}
+	return strings.SplitN(rel, string(filepath.Separator), 2)[0]
+}
+
+// ownership decides once per walk whether shards are owned, and whether they were just taken over.
+// Decisions are kept in decided, committed to owned by regular scans and rescans but not by previews.
+func (s *pathScanner) ownership() func(file string) (owned, joined bool) {
+	s.decided = nil
+	if s.shards == nil {
+		return func(string) (bool, bool) { return true, false }
+	}
+	s.decided = make(map[string]bool)
+	return func(file string) (bool, bool) {
+		shard := s.shard(file)
+		if shard == "" {
+			return true, false
+		}
+		owned, ok := s.decided[shard]
+		if !ok {
+			owned = s.shards.Owns(shard)
+			s.decided[shard] = owned
+		}
+		return owned, owned && s.owned != nil && !s.owned[shard]
+	}
+}
@@ -0,0 +1,183 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SIEMFormat identifies record formats of security information and event management systems, see FormatNotice.
+type SIEMFormat int
+
+const (
+	// ArcSight Common Event Format, also read by Splunk (CIM) and most others
+	CEF SIEMFormat = iota
+	// IBM QRadar Log Event Extended Format 1.0, tab delimited
+	LEEF
+)
+
+var siemFormatName = map[SIEMFormat]string{
+	CEF:  "cef",
+	LEEF: "leef",
+}
+
+// String implements fmt.Stringer.
+func (f SIEMFormat) String() string {
+	return siemFormatName[f]
+}
+
+// ParseSIEMFormat converts the output of SIEMFormat.String() back into a SIEMFormat.
+func ParseSIEMFormat(s string) (SIEMFormat, error) {
+	for f, name := range siemFormatName {
+		if name == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("SIEM format not recognized: %q", s)
+}
+
+const (
+	siem_vendor  = "Fiery"
+	siem_product = "fsmonitor"
+	/* layout of devTime, devTimeFormat tells it in Java notation */
+	leef_time        = "Jan 02 2006 15:04:05.000 MST"
+	leef_time_format = "MMM dd yyyy HH:mm:ss.SSS z"
+)
+
+var siemHost struct {
+	once sync.Once
+	name string
+}
+
+// siemField is a field of a record by its name in the CEF dictionary and the LEEF one,
+// skipped where the value is empty, and in LEEF records without LEEF name, e.g. labels of custom CEF fields.
+type siemField struct {
+	cef, leef, value string
+}
+
+// FormatNotice encodes n as one record of format, without trailing newline, e.g. to append to a file or syslog
+// forwarded to a SIEM, which can then ingest file integrity events without custom field mappings.
+// Records tell the host, event, path, file metadata, the old path of renames and moves, the ID given by WithIDs,
+// the actor attributed by AuditWatcher, and the severity and tags given by rules (see WithRules).
+func FormatNotice(n Notice, format SIEMFormat) string {
+	event := strings.TrimPrefix(n.Type().String(), "notice.")
+	severity := siemSeverity(n)
+	fields := siemFields(n)
+
+	var b strings.Builder
+	switch format {
+	case LEEF:
+		fmt.Fprintf(&b, "LEEF:1.0|%s|%s|%d|%s|", siem_vendor, siem_product, SchemaVersion, leefEscape(event, true))
+		fmt.Fprintf(&b, "cat=%s\tsev=%d\tdevTime=%s\tdevTimeFormat=%s",
+			leefEscape(event, false), severity, n.Time().Format(leef_time), leef_time_format)
+		for _, f := range fields {
+			if f.value != "" && f.leef != "" {
+				fmt.Fprintf(&b, "\t%s=%s", f.leef, leefEscape(f.value, false))
+			}
+		}
+	default:
+		fmt.Fprintf(&b, "CEF:0|%s|%s|%d|%s|%s|%d|", siem_vendor, siem_product, SchemaVersion,
+			cefEscape(n.Type().String(), true), cefEscape(event, true), severity)
+		fmt.Fprintf(&b, "rt=%d", n.Time().UnixNano()/1e6)
+		for _, f := range fields {
+			if f.value != "" {
+				fmt.Fprintf(&b, " %s=%s", f.cef, cefEscape(f.value, false))
+			}
+		}
+	}
+	return b.String()
+}
+
+// siemFields returns the fields of n besides event, severity and time.
+func siemFields(n Notice) []siemField {
+	siemHost.once.Do(func() {
+		siemHost.name, _ = os.Hostname()
+	})
+	fields := []siemField{
+		{"dvchost", "identHostName", siemHost.name},
+		{"filePath", "filePath", n.Name()},
+		{"fname", "fileName", filepath.Base(n.Name())},
+	}
+	if info, ok := n.More().(os.FileInfo); ok && info != nil {
+		fields = append(fields,
+			siemField{"fsize", "fileSize", strconv.FormatInt(info.Size(), 10)},
+			siemField{"filePermission", "filePermission", info.Mode().String()},
+			siemField{"fileModificationTime", "fileModificationTime", strconv.FormatInt(info.ModTime().UnixNano()/1e6, 10)},
+		)
+	}
+	var oldPath string
+	switch more := n.More().(type) {
+	case *RenameInfo:
+		oldPath = more.OldPath
+	case *MoveInfo:
+		oldPath = more.OldPath
+	}
+	if oldPath != "" {
+		fields = append(fields,
+			siemField{"oldFilePath", "oldFilePath", oldPath},
+			siemField{"oldFileName", "oldFileName", filepath.Base(oldPath)},
+		)
+	}
+	var i IdentifiedNotice
+	if NoticeAs(n, &i) {
+		fields = append(fields, siemField{"externalId", "externalId", i.ID()})
+	}
+	var a ActorNotice
+	if NoticeAs(n, &a) && a.Actor() != nil {
+		actor := a.Actor()
+		fields = append(fields,
+			siemField{"suid", "accountId", strconv.Itoa(actor.UID)},
+			siemField{"spid", "pid", strconv.Itoa(actor.PID)},
+			siemField{"sproc", "process", actor.Exe},
+		)
+	}
+	var ruled RuledNotice
+	if NoticeAs(n, &ruled) && len(ruled.Tags()) > 0 {
+		fields = append(fields,
+			siemField{"cs1Label", "", "tags"},
+			siemField{"cs1", "tags", strings.Join(ruled.Tags(), ",")},
+		)
+	}
+	var r RootedNotice
+	if NoticeAs(n, &r) {
+		fields = append(fields,
+			siemField{"cs2Label", "", "root"},
+			siemField{"cs2", "root", r.Root()},
+		)
+	}
+	return fields
+}
+
+// siemSeverity ranks n from 0 to 10 by the severity given by rules.
+func siemSeverity(n Notice) int {
+	var r RuledNotice
+	if !NoticeAs(n, &r) {
+		return 3
+	}
+	switch r.Severity() {
+	case SeverityWarning:
+		return 6
+	case SeverityCritical:
+		return 9
+	}
+	return 3
+}
+
+// cefEscape escapes s as a CEF header field or extension value.
+func cefEscape(s string, header bool) string {
+	if header {
+		return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+	}
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+// leefEscape escapes s as a LEEF header field or attribute value.
+func leefEscape(s string, header bool) string {
+	if header {
+		return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\n", " ", "\r", " ").Replace(s)
+	}
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
@@ -0,0 +1,228 @@
+package fsmonitor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Sink publishes notices to a destination, e.g. a message broker, see Monitor.AttachSink.
+type Sink interface {
+	// Publish delivers n, errors are logged, calls are serialized per attached Sink
+	Publish(n Notice) error
+	// Close flushes notices published and releases the destination, called once the Monitor stopped
+	Close() error
+}
+
+// SinkOption configures a Sink attached by Monitor.AttachSink.
+type SinkOption func(*sinkOptions) error
+
+type sinkOptions struct {
+	name     string
+	overflow Overflow
+	buffer   int
+}
+
+// SinkName names the Sink in Stats.Sinks, "sink-1", "sink-2" and so on in order of attaching unless given.
+func SinkName(name string) SinkOption {
+	return func(o *sinkOptions) error {
+		if name == "" {
+			return fmt.Errorf("Sink name must not be empty")
+		}
+		o.name = name
+		return nil
+	}
+}
+
+// SinkOverflow sets what publishing a notice to the Sink does once its buffer (see SinkBuffer) is full. OverflowBlock,
+// the default, holds up delivery until the Sink catches up, so no notice is lost but other subscribers and sinks
+// wait for it and eventually scanning does (see WithOverflow), until Close gives up. OverflowDropNewest and
+// OverflowDropOldest drop notices instead, so a slow Sink doesn't hold up others. OverflowSpill isn't supported.
+func SinkOverflow(policy Overflow) SinkOption {
+	return func(o *sinkOptions) error {
+		switch policy {
+		case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+			o.overflow = policy
+			return nil
+		case OverflowSpill:
+			return fmt.Errorf("Overflow policy %v is not supported by sinks", policy)
+		}
+		return fmt.Errorf("Overflow policy not recognized: %v", policy)
+	}
+}
+
+// SinkBuffer sets how many notices are buffered for the Sink, 1000 by default.
+func SinkBuffer(n int) SinkOption {
+	return func(o *sinkOptions) error {
+		if n <= 0 {
+			return fmt.Errorf("Sink buffer must be positive")
+		}
+		o.buffer = n
+		return nil
+	}
+}
+
+// SinkStats tells how an attached Sink keeps up, see Stats.Sinks.
+type SinkStats struct {
+	// Notices buffered for the Sink, not published yet
+	Queued int
+	// Notices published, and those failing publishing
+	Published uint64
+	Failed    uint64
+	// Notices dropped while the Sink fell behind, see SinkOverflow
+	Dropped uint64
+	// Seconds from the time of notices to publishing them completed
+	Latency Histogram
+	// Age of the notice being published, 0 while the Sink is idle
+	Oldest time.Duration
+}
+
+// attachedSink is a Sink publishing a subscription, see AttachSink.
+type attachedSink struct {
+	name   string
+	sink   Sink
+	sub    *subscription
+	cancel func()
+	/* closed once the Sink closed */
+	done chan struct{}
+
+	mu    sync.Mutex
+	stats SinkStats
+	/* time of the notice being published, zero while idle */
+	publishing time.Time
+}
+
+// AttachSink publishes every notice delivered by Start to s, from a goroutine of its own. Sinks are subscriptions
+// (see Subscribe), so Notices() must not be consumed by anything else once attaching. A Sink falling behind by more
+// than its buffer holds up delivery, unless SinkOverflow drops notices. Notices older than the max age given by
+// WithMaxAge are dropped or tagged. A Sink named by rules of ActionRoute only publishes the notices routed to it.
+// Failures to publish are logged, retrying is up to the Sink. Once Notices() closes the Sink is closed, Stop waits
+// for that. How the Sink keeps up is told by Stats.Sinks under its name (see SinkName), by
+// which CloseSink closes it while the Monitor runs.
+func (m *Monitor) AttachSink(s Sink, opt ...SinkOption) error {
+	opts := sinkOptions{overflow: OverflowBlock}
+	for _, o := range opt {
+		if err := o(&opts); err != nil {
+			return err
+		}
+	}
+
+	/* a filter without patterns can't fail */
+	sub, cancel, _ := m.subscribe(Filter{Buffer: opts.buffer}, opts.overflow)
+	m.mu.Lock()
+	for i := len(m.attached) + 1; opts.name == ""; i++ {
+		if name := fmt.Sprintf("sink-%d", i); m.attachedSink(name) == nil {
+			opts.name = name
+		}
+	}
+	if m.attachedSink(opts.name) != nil {
+		m.mu.Unlock()
+		cancel()
+		return fmt.Errorf("Sink %q is attached already", opts.name)
+	}
+	a := &attachedSink{
+		name:   opts.name,
+		sink:   s,
+		sub:    sub,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		/* 1ms up to about 9 minutes */
+		stats: SinkStats{Latency: newHistogram(0.001, 2, 20)},
+	}
+	m.attached = append(m.attached, a)
+	m.mu.Unlock()
+
+	m.sinks.Add(1)
+	m.goroutines.run("sink", func() {
+		defer m.sinks.Done()
+		defer close(a.done)
+		for n := range sub.notices {
+			if !m.routed(n, a.name) {
+				continue
+			}
+			if n = m.aged(n, time.Now()); n == nil {
+				continue
+			}
+			a.publish(n, m.logger)
+		}
+		if err := s.Close(); err != nil {
+			m.logger.error("Sink failed closing", "sink", a.name, "error", err)
+		}
+	})
+	return nil
+}
+
+// CloseSink closes the Sink attached by name while the Monitor keeps running: notices are no longer published to it,
+// those buffered already are before the Sink is closed. Waits for that until ctx is done, leaving the Sink to finish
+// on its own then. The name is free to attach another Sink by once closed.
+func (m *Monitor) CloseSink(ctx context.Context, name string) error {
+	m.mu.Lock()
+	a := m.attachedSink(name)
+	m.mu.Unlock()
+	if a == nil {
+		return fmt.Errorf("Sink %q is not attached", name)
+	}
+
+	a.cancel()
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, attached := range m.attached {
+		if attached == a {
+			m.attached = append(m.attached[:i:i], m.attached[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// attachedSink returns the Sink attached by name, nil if none is, called holding m.mu.
+func (m *Monitor) attachedSink(name string) *attachedSink {
+	for _, a := range m.attached {
+		if a.name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// publish publishes n, counting it in the stats of the Sink.
+func (a *attachedSink) publish(n Notice, logger logSink) {
+	a.mu.Lock()
+	a.publishing = n.Time()
+	a.mu.Unlock()
+
+	err := a.sink.Publish(n)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.publishing = time.Time{}
+	if err != nil {
+		a.stats.Failed++
+		logger.error("Sink failed publishing", "sink", a.name, "path", n.Name(), "event", n.Type(), "error", err)
+		return
+	}
+	a.stats.Published++
+	if !n.Time().IsZero() {
+		a.stats.Latency.observe(time.Since(n.Time()).Seconds())
+	}
+}
+
+// snapshot returns the stats of the Sink by now.
+func (a *attachedSink) snapshot(now time.Time) SinkStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.stats
+	s.Latency = s.Latency.clone()
+	s.Queued = len(a.sub.notices)
+	s.Dropped = a.sub.dropped()
+	if !a.publishing.IsZero() {
+		s.Oldest = now.Sub(a.publishing)
+	}
+	return s
+}
@@ -0,0 +1,108 @@
+package fsmonitor_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+// slowSink takes a while publishing every notice, recording their names.
+type slowSink struct {
+	mu    sync.Mutex
+	names map[string]bool
+}
+
+func (s *slowSink) Publish(n fsmonitor.Notice) error {
+	time.Sleep(time.Millisecond)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names[n.Name()] = true
+	return nil
+}
+
+func (s *slowSink) Close() error {
+	return nil
+}
+
+func (s *slowSink) published() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.names)
+}
+
+// TestSinkOverflowBlocks attaches a slow Sink of a buffer of 1, expecting it to get every notice as it blocks by
+// default.
+func TestSinkOverflowBlocks(t *testing.T) {
+	files := fstest.MapFS{}
+	for i := 0; i < 50; i++ {
+		files[fmt.Sprintf("%02d.txt", i)] = &fstest.MapFile{Data: []byte("a")}
+	}
+	w, err := fsmonitor.FSWatcher(files, nil, fsmonitor.WithInitialScan(fsmonitor.EmitExisting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AttachSink(&slowSink{}, fsmonitor.SinkOverflow(fsmonitor.OverflowSpill)); err == nil {
+		t.Fatal("OverflowSpill accepted by SinkOverflow")
+	}
+	sink := &slowSink{names: make(map[string]bool)}
+	if err := m.AttachSink(sink, fsmonitor.SinkName("slow"), fsmonitor.SinkBuffer(1)); err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileCreate)
+	defer m.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.published() < len(files) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d notices published", sink.published(), len(files))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s := m.Stats().Sinks["slow"]; s.Dropped != 0 {
+		t.Errorf("Blocking Sink dropped %d notices", s.Dropped)
+	}
+}
+
+func TestSinkRoutes(t *testing.T) {
+	files := fstest.MapFS{
+		"a.txt": &fstest.MapFile{Data: []byte("a")},
+		"b.log": &fstest.MapFile{Data: []byte("b")},
+	}
+	w, err := fsmonitor.FSWatcher(files, nil, fsmonitor.WithInitialScan(fsmonitor.EmitExisting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w),
+		fsmonitor.WithRules(fsmonitor.Rule{Name: "logs", Patterns: []string{`\.log$`}, Action: fsmonitor.ActionRoute, Sink: "logs"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, all := &slowSink{names: make(map[string]bool)}, &slowSink{names: make(map[string]bool)}
+	if err := m.AttachSink(logs, fsmonitor.SinkName("logs")); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AttachSink(all, fsmonitor.SinkName("all")); err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileCreate)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for all.published() < len(files) {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d notices published", all.published(), len(files))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	m.Stop()
+	if logs.published() != 1 || !logs.names["b.log"] {
+		t.Errorf("Sink routed to published %v", logs.names)
+	}
+}
@@ -0,0 +1,97 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// SLO is an objective for detection latency relative to the scan interval,
+// e.g. SLO{Quantile: 0.95, Intervals: 2} for 95% of changes noticed within 2 intervals.
+type SLO struct {
+	Quantile  float64
+	Intervals float64
+}
+
+func (s SLO) String() string {
+	return fmt.Sprintf("%g%% within %g intervals", s.Quantile*100, s.Intervals)
+}
+
+// WithSLO tracks detection latency (from modification time of created and updated files to delivery)
+// against s. Every scan whose notices miss it counts in Stats.SLOViolations and sends a LatencyAlert,
+// when asked for in Start.
+func WithSLO(s SLO) Option {
+	return func(o *options) error {
+		if s.Quantile <= 0 || s.Quantile > 1 {
+			return fmt.Errorf("SLO quantile must be within (0, 1]")
+		}
+		if s.Intervals <= 0 {
+			return fmt.Errorf("SLO intervals must be positive")
+		}
+		o.slo = s
+		return nil
+	}
+}
+
+// LatencyAlert implements Notice, tells the scanner is falling behind its configured interval.
+// Uses watched address as Notice.Name and itself as Notice.More.
+type LatencyAlert struct {
+	Address string
+	SLO     SLO
+	// Latency allowed by the SLO for the interval given to Start
+	Target time.Duration
+	// Changes noticed since previous scan, and the part of them within Target
+	Total    uint64
+	Attained float64
+
+	timestamp time.Time
+}
+
+func (a *LatencyAlert) String() string {
+	return fmt.Sprintf("{%v : %v : %.1f%% of %d within %v, objective %v}", a.Address, LatencyViolation, a.Attained*100, a.Total, a.Target, a.SLO)
+}
+
+func (a *LatencyAlert) Name() string {
+	return a.Address
+}
+
+func (a *LatencyAlert) Type() Event {
+	return LatencyViolation
+}
+
+func (a *LatencyAlert) More() interface{} {
+	return a
+}
+
+func (a *LatencyAlert) Info() NoticeInfo {
+	return NoticeInfo{}
+}
+
+func (a *LatencyAlert) Time() time.Time {
+	return a.timestamp
+}
+
+// evaluate checks latencies recorded since previous scan against the SLO, returning an alert on violation.
+// Notices of a scan still buffered when it completes count toward the next one.
+func (m *Monitor) evaluate() *LatencyAlert {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total, met := m.sloTotal, m.sloMet
+	m.sloTotal, m.sloMet = 0, 0
+	if m.slo.Quantile == 0 || total == 0 {
+		return nil
+	}
+	attained := float64(met) / float64(total)
+	if attained >= m.slo.Quantile {
+		return nil
+	}
+	m.stats.SLOViolations++
+	return &LatencyAlert{
+		Address:   m.address,
+		SLO:       m.slo,
+		Target:    m.sloTarget,
+		Total:     total,
+		Attained:  attained,
+		timestamp: time.Now(),
+	}
+}
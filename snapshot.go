@@ -0,0 +1,209 @@
+package fsmonitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SnapshotStore keeps the state of files the builtin "path" Watcher diffs scans against, see WithSnapshots.
+type SnapshotStore interface {
+	// Load returns the files saved for the watched address, nil if none were saved
+	Load(address string) ([]FileState, error)
+	// Save replaces the files saved for the watched address
+	Save(address string, files []FileState) error
+}
+
+// FileState is the state of a file as of the last scan, as saved by a SnapshotStore.
+type FileState struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"modtime"`
+	// Device and inode on Unix, so renames are told after restarts too
+	ID string `json:"id,omitempty"`
+	// Target of symlinks, see SymlinkInfo
+	Target string `json:"target,omitempty"`
+	Broken bool   `json:"broken,omitempty"`
+	// Digests of secondary streams, see StreamInfo
+	Streams map[string]string `json:"streams,omitempty"`
+	// Inode change time and owner, -1 where the platform doesn't tell, kept by a StateStore but not in snapshots
+	ChangeTime time.Time `json:"-"`
+	UID        int       `json:"-"`
+	GID        int       `json:"-"`
+}
+
+// WithSnapshots makes the builtin "path" Watcher save the state of files to store after scans changing it,
+// and load it before its first scan, which then notices what changed while not watching instead of baselining.
+func WithSnapshots(store SnapshotStore) Option {
+	return func(o *options) error {
+		if store == nil {
+			return fmt.Errorf("SnapshotStore must not be nil")
+		}
+		o.snapshots = store
+		return nil
+	}
+}
+
+// DirSnapshots returns a SnapshotStore keeping a file of line-delimited FileState records
+// for every watched address in dir, replaced atomically on every save.
+func DirSnapshots(dir string) SnapshotStore {
+	return DirSnapshotsCodec(dir, JSONSnapshots)
+}
+
+// DirSnapshotsCodec behaves as DirSnapshots, encoding files by codec, e.g. CBORSnapshots or ProtoSnapshots for
+// compact snapshots of millions of files. Snapshots saved by another builtin codec are loaded too, so switching
+// codecs keeps the state, and removed once saved by codec.
+func DirSnapshotsCodec(dir string, codec SnapshotCodec) SnapshotStore {
+	return &dirSnapshots{dir: dir, codec: codec}
+}
+
+// dirSnapshots implements SnapshotStore by files in a directory.
+type dirSnapshots struct {
+	dir   string
+	codec SnapshotCodec
+}
+
+// file returns the snapshot file of address encoded by codec, JSON ones are named as before codecs.
+func (d *dirSnapshots) file(address string, codec SnapshotCodec) string {
+	sum := sha256.Sum256([]byte(address))
+	name := hex.EncodeToString(sum[:8]) + ".snapshot"
+	if codec.String() != JSONSnapshots.String() {
+		name += "." + codec.String()
+	}
+	return filepath.Join(d.dir, name)
+}
+
+func (d *dirSnapshots) Load(address string) ([]FileState, error) {
+	for _, codec := range append([]SnapshotCodec{d.codec}, snapshotCodecs...) {
+		f, err := os.Open(d.file(address, codec))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		files, err := codec.Decode(f)
+		if err != nil {
+			return nil, fmt.Errorf("Malformed snapshot of %s: %v", address, err)
+		}
+		return files, nil
+	}
+	return nil, nil
+}
+
+func (d *dirSnapshots) Save(address string, files []FileState) error {
+	if err := os.MkdirAll(d.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(d.dir, ".snapshot")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := d.codec.Encode(tmp, files); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), d.file(address, d.codec)); err != nil {
+		return err
+	}
+	for _, codec := range snapshotCodecs {
+		if codec.String() != d.codec.String() {
+			os.Remove(d.file(address, codec))
+		}
+	}
+	return nil
+}
+
+// fileState converts the info of file kept in lastCheck.
+func fileState(file string, info os.FileInfo) FileState {
+	state := FileState{Path: file, Size: info.Size(), Mode: info.Mode(), ModTime: info.ModTime()}
+	state.ID, _ = fileID(info)
+	state.ChangeTime, _ = changeTime(info)
+	state.UID, state.GID, _ = owner(info)
+	switch i := info.(type) {
+	case *SymlinkInfo:
+		state.Target, state.Broken = i.Target, i.Broken
+	case *StreamInfo:
+		state.Streams = i.Streams
+	}
+	return state
+}
+
+// info converts the state back into what walks keep in lastCheck.
+func (f *FileState) info() os.FileInfo {
+	var info os.FileInfo = &snapshotInfo{
+		recordInfo: recordInfo{
+			name:    filepath.Base(f.Path),
+			size:    f.Size,
+			mode:    f.Mode,
+			modTime: f.ModTime,
+		},
+		id: snapshotID(f.ID),
+	}
+	switch {
+	case f.Target != "":
+		return &SymlinkInfo{FileInfo: info, Target: f.Target, Broken: f.Broken}
+	case f.Streams != nil:
+		return &StreamInfo{FileInfo: info, Streams: f.Streams}
+	}
+	return info
+}
+
+// snapshotInfo implements os.FileInfo for restored files, Sys returns the snapshotID.
+type snapshotInfo struct {
+	recordInfo
+	id snapshotID
+}
+
+// snapshotID is the file ID of a restored file, see fileID.
+type snapshotID string
+
+func (i *snapshotInfo) Sys() interface{} { return i.id }
+
+// restore loads lastCheck from the SnapshotStore, reporting whether any was saved.
+func (s *pathScanner) restore() bool {
+	if s.snapshots == nil {
+		return false
+	}
+	files, err := s.snapshots.Load(s.address)
+	if err != nil {
+		s.logger.error("Failed to load snapshot, baselining instead", "error", err)
+		return false
+	}
+	if files == nil {
+		return false
+	}
+	s.lastCheck = s.newStates()
+	for i := range files {
+		s.lastCheck.put(files[i].Path, files[i].info())
+	}
+	s.logger.info("Restored files from snapshot", "files", len(files))
+	return true
+}
+
+// persist saves lastCheck to the SnapshotStore.
+func (s *pathScanner) persist() {
+	if s.snapshots == nil || s.lastCheck == nil {
+		return
+	}
+	files := make([]FileState, 0, s.lastCheck.len())
+	s.lastCheck.each(func(file string, info os.FileInfo) {
+		files = append(files, fileState(file, info))
+	})
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	if err := s.snapshots.Save(s.address, files); err != nil {
+		s.logger.error("Failed to save snapshot", "error", err)
+	}
+}
@@ -0,0 +1,231 @@
+package fsmonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	/* paths of the collector, see SplunkSink */
+	splunk_event_path = "/services/collector/event"
+	splunk_ack_path   = "/services/collector/ack"
+	/* interval polling acknowledgments */
+	splunk_ack_poll = time.Second
+)
+
+// Splunk configures a Sink sending notices to a Splunk HTTP Event Collector, only URL and Token are required,
+// see SplunkSink.
+type Splunk struct {
+	// Base URL of the collector, e.g. https://splunk:8088
+	URL string
+	// Token of the collector, sent as "Authorization: Splunk <token>"
+	Token string
+	// Metadata of events, those of the token unless given, the host name unless Host is given
+	Index      string
+	Sourcetype string
+	Source     string
+	Host       string
+	// Channel of indexer acknowledgment, a GUID: given, requests count as sent once acknowledged by the indexers,
+	// which must be enabled for the token
+	Channel string
+	// Wait for an acknowledgment before resending the request, 1 minute by default
+	AckTimeout time.Duration
+	// Events per request, 100 by default
+	Batch int
+	// Notices queued for sending, 1000 by default, Publish fails once full
+	Queue int
+	// Attempts to resend a request after failing, 5 by default
+	Retries int
+	// Delay before the first retry, doubled for every further one, 1 second by default
+	Backoff time.Duration
+	// Timeout of a request, 10 seconds by default, unless Client is given
+	Timeout time.Duration
+	Client  *http.Client
+	Logger  *log.Logger
+	// Writes structured records instead of Logger, see WithFieldLogger
+	FieldLogger FieldLogger
+}
+
+// splunkSink implements Sink by sending events from a queue.
+type splunkSink struct {
+	Splunk
+	*sendQueue
+}
+
+// hecEvent is an event of the collector, with the notice encoded by MarshalNotice as event.
+type hecEvent struct {
+	Time       float64         `json:"time,omitempty"`
+	Host       string          `json:"host,omitempty"`
+	Source     string          `json:"source,omitempty"`
+	Sourcetype string          `json:"sourcetype,omitempty"`
+	Index      string          `json:"index,omitempty"`
+	Event      json.RawMessage `json:"event"`
+}
+
+// SplunkSink returns a Sink sending every notice as event to a Splunk HTTP Event Collector, encoded by
+// MarshalNotice and timed by the notice. Notices are queued and sent by a goroutine of the Sink in batches of those
+// waiting. Requests failing by network errors, timeouts, 408, 429 or 5xx responses, e.g. while the collector is
+// busy, are retried with exponential backoff, others are dropped and logged, as is what still fails after all
+// retries. Given a Channel, the acknowledgments of requests are polled until indexed, resending requests not
+// acknowledged within AckTimeout, so events may be indexed more than once but are not lost to the indexers failing.
+// Close sends what is queued before returning.
+func SplunkSink(s Splunk) (Sink, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Splunk URL %q is malformed: %v", s.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Splunk URL %q must be of http or https scheme", s.URL)
+	}
+	if s.Token == "" {
+		return nil, fmt.Errorf("Splunk token must be given")
+	}
+	s.URL = strings.TrimSuffix(s.URL, "/")
+	if s.Host == "" {
+		s.Host, _ = os.Hostname()
+	}
+	if s.AckTimeout <= 0 {
+		s.AckTimeout = time.Minute
+	}
+	if s.Batch <= 0 {
+		s.Batch = 100
+	}
+	if s.Queue <= 0 {
+		s.Queue = notice_buffer_length
+	}
+	if s.Retries <= 0 {
+		s.Retries = 5
+	}
+	if s.Backoff <= 0 {
+		s.Backoff = time.Second
+	}
+	if s.Timeout <= 0 {
+		s.Timeout = 10 * time.Second
+	}
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: s.Timeout}
+	}
+
+	sink := &splunkSink{Splunk: s}
+	sink.sendQueue = newSendQueue("Splunk", s.Queue, s.Batch, func(batch []Notice) {
+		if err := sink.post(batch); err != nil {
+			sink.logger().error("Splunk HEC failed, notices dropped", "url", s.URL, "dropped", len(batch), "error", err)
+		}
+	})
+	return sink, nil
+}
+
+// post sends batch, retrying with backoff until sent, and acknowledged given a channel.
+func (s *splunkSink) post(batch []Notice) error {
+	body, err := s.body(batch)
+	if err != nil {
+		return err
+	}
+	return retried(s.Retries, s.Backoff, func() (bool, error) {
+		var resp struct {
+			AckID *int64 `json:"ackId"`
+		}
+		if retry, err := s.request(splunk_event_path, body, &resp); err != nil || s.Channel == "" {
+			return retry, err
+		}
+		if resp.AckID == nil {
+			return false, fmt.Errorf("Splunk HEC %s returned no ack ID, indexer acknowledgment is disabled for the token", s.URL)
+		}
+		return s.acknowledged(*resp.AckID)
+	}, func(retry time.Duration, err error) {
+		s.logger().warn("Splunk HEC failed, retrying", "url", s.URL, "retry", retry, "error", err)
+	})
+}
+
+// acknowledged polls the acknowledgment of the request of id until indexed, failing to be retried once AckTimeout
+// passed.
+func (s *splunkSink) acknowledged(id int64) (bool, error) {
+	body := []byte(fmt.Sprintf(`{"acks":[%d]}`, id))
+	deadline := time.Now().Add(s.AckTimeout)
+	for {
+		var resp struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		retry, err := s.request(splunk_ack_path, body, &resp)
+		switch {
+		case err != nil && !retry:
+			return false, err
+		case err == nil && resp.Acks[strconv.FormatInt(id, 10)]:
+			return false, nil
+		case time.Now().After(deadline):
+			return true, fmt.Errorf("Splunk HEC %s didn't acknowledge request %d within %v", s.URL, id, s.AckTimeout)
+		}
+		time.Sleep(splunk_ack_poll)
+	}
+}
+
+// body encodes batch as events, concatenated as the collector takes them.
+func (s *splunkSink) body(batch []Notice) ([]byte, error) {
+	var b bytes.Buffer
+	for _, n := range batch {
+		data, err := MarshalNotice(n)
+		if err != nil {
+			return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+		}
+		e := hecEvent{Host: s.Host, Source: s.Source, Sourcetype: s.Sourcetype, Index: s.Index, Event: data}
+		if t := n.Time(); !t.IsZero() {
+			e.Time = float64(t.UnixNano()) / float64(time.Second)
+		}
+		event, err := json.Marshal(e)
+		if err != nil {
+			return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+		}
+		b.Write(event)
+	}
+	return b.Bytes(), nil
+}
+
+// request POSTs body to path of the collector once, decoding the response into v, reporting whether a failure is
+// worth retrying.
+func (s *splunkSink) request(path string, body []byte, v interface{}) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.Token)
+	req.Header.Set("Content-Type", "application/json")
+	if s.Channel != "" {
+		req.Header.Set("X-Splunk-Request-Channel", s.Channel)
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return true, err
+	}
+
+	switch {
+	case resp.StatusCode < 300:
+		if err := json.Unmarshal(data, v); err != nil {
+			return false, fmt.Errorf("Splunk HEC %s responded malformed: %v", s.URL, err)
+		}
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("Splunk HEC %s responded %s: %s", s.URL, resp.Status, bytes.TrimSpace(data))
+	}
+	return false, fmt.Errorf("Splunk HEC %s responded %s: %s", s.URL, resp.Status, bytes.TrimSpace(data))
+}
+
+// logger returns what the sink logs through.
+func (s *splunkSink) logger() logSink {
+	return newLogSink(s.Logger, s.FieldLogger)
+}
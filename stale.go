@@ -0,0 +1,86 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithMaxAge bounds the time from detection (Notice.Time) to delivery, e.g. for consumers where acting on old
+// information is worse than not acting at all, after a long sink outage held notices back. Older notices are dropped
+// if drop, otherwise delivered as StaleNotice; either way they count in Stats().Stale. Ages are checked when the
+// Monitor delivers to Notices() and when attached sinks pick notices up (see AttachSink), consumers of Notices()
+// and subscriptions falling behind themselves can compare Time().
+func WithMaxAge(age time.Duration, drop bool) Option {
+	return func(o *options) error {
+		if age <= 0 {
+			return fmt.Errorf("Max age of notices must be positive")
+		}
+		o.maxAge = age
+		o.dropStale = drop
+		return nil
+	}
+}
+
+// StaleNotice is implemented by notices delivered later than the max age given by WithMaxAge.
+type StaleNotice interface {
+	Notice
+	// Time from detection to delivery
+	Age() time.Duration
+}
+
+// staleNotice implements StaleNotice by wrapping the delivered Notice.
+type staleNotice struct {
+	Notice
+	age time.Duration
+}
+
+func (s *staleNotice) Unwrap() Notice {
+	return s.Notice
+}
+
+func (s *staleNotice) Age() time.Duration {
+	return s.age
+}
+
+func (s *staleNotice) String() string {
+	return fmt.Sprintf("%v stale by %v", s.Notice, s.age)
+}
+
+// identifiedStaleNotice keeps the ID of a stale IdentifiedNotice, so sinks can still deduplicate by it.
+type identifiedStaleNotice struct {
+	staleNotice
+	id string
+}
+
+func (i *identifiedStaleNotice) ID() string {
+	return i.id
+}
+
+// aged checks n against the max age at now, returning it as is, tagged as StaleNotice, or nil if dropped.
+func (m *Monitor) aged(n Notice, now time.Time) Notice {
+	if m.maxAge <= 0 {
+		return n
+	}
+	age := now.Sub(n.Time())
+	if age <= m.maxAge {
+		return n
+	}
+	var stale StaleNotice
+	if NoticeAs(n, &stale) {
+		/* tagged already on delivery, picked up by a sink */
+		return n
+	}
+
+	m.mu.Lock()
+	m.stats.Stale++
+	m.mu.Unlock()
+	if m.dropStale {
+		m.logger.debug("Notice dropped as stale", "age", age, "path", n.Name(), "event", n.Type())
+		return nil
+	}
+	var i IdentifiedNotice
+	if NoticeAs(n, &i) {
+		return &identifiedStaleNotice{staleNotice: staleNotice{Notice: n, age: age}, id: i.ID()}
+	}
+	return &staleNotice{Notice: n, age: age}
+}
@@ -0,0 +1,342 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StateStore keeps the state of files the builtin "path" Watcher diffs every scan against, see WithStateStore.
+// Only the Watcher goroutine calls it, fn given to Range may call other StateStores opened by the same function.
+type StateStore interface {
+	// Get returns the state of path as of the last check
+	Get(path string) (FileState, bool)
+	// Put records the state of a file, replacing what was recorded for its path
+	Put(state FileState) error
+	Delete(path string) error
+	// Range calls fn with every state recorded until fn returns false
+	Range(fn func(FileState) bool) error
+	Len() int
+	// Close releases the store once replaced by the states of a later scan
+	Close() error
+}
+
+// WithStateStore makes the builtin "path" Watcher keep the state of files in stores opened by open instead of its
+// compact table in memory, e.g. buckets of a BoltDB file so multi-million-file trees are tracked in bounded memory.
+// Every scan records what it finds in a new store, replacing the previous one once done. Stores failing to open
+// fall back to the table in memory, failing to record is logged.
+func WithStateStore(open func() (StateStore, error)) Option {
+	return func(o *options) error {
+		if open == nil {
+			return fmt.Errorf("StateStore opener must not be nil")
+		}
+		o.states = open
+		return nil
+	}
+}
+
+// fileStates is what the "path" Watcher keeps of files between scans, keyed by canonical path.
+type fileStates interface {
+	get(path string) (os.FileInfo, bool)
+	has(path string) bool
+	put(path string, info os.FileInfo)
+	remove(path string)
+	each(fn func(path string, info os.FileInfo))
+	len() int
+	close()
+}
+
+// newStates returns empty states, in a StateStore given WithStateStore.
+func (s *pathScanner) newStates() fileStates {
+	if s.states != nil {
+		store, err := s.states()
+		if err == nil {
+			return &storedStates{store: store, logger: s.logger}
+		}
+		s.logger.error("Failed to open state store, keeping states in memory", "error", err)
+	}
+	return &compactStates{dirs: make(map[string]map[string]stateRecord)}
+}
+
+// tracked returns the info of file as of the last check.
+func (s *pathScanner) tracked(file string) (os.FileInfo, bool) {
+	if s.lastCheck == nil {
+		return nil, false
+	}
+	return s.lastCheck.get(file)
+}
+
+// replace makes states the last check, releasing the previous one.
+func (s *pathScanner) replace(states fileStates) {
+	if s.lastCheck != nil && s.lastCheck != states {
+		s.lastCheck.close()
+	}
+	s.lastCheck = states
+}
+
+// compactStates keeps fixed-width records by directory and name, so files share the path of their directory.
+type compactStates struct {
+	dirs map[string]map[string]stateRecord
+	n    int
+}
+
+// stateRecord is what's kept of a file, fields the platform doesn't tell are zero.
+type stateRecord struct {
+	size    int64
+	modTime int64
+	/* inode change time, see Profile.ChangeTime */
+	cTime    int64
+	dev, ino uint64
+	mode     os.FileMode
+	uid, gid uint32
+	owned    bool
+	hasID    bool
+	/* of symlinks and files with streams only */
+	extra *stateExtra
+}
+
+// stateExtra is what's rarely kept of a file.
+type stateExtra struct {
+	/* file ID not of the form dev:ino, e.g. restored from a snapshot of another platform */
+	id      string
+	target  string
+	broken  bool
+	streams map[string]string
+}
+
+// newStateRecord returns the record of info.
+func newStateRecord(info os.FileInfo) stateRecord {
+	switch i := info.(type) {
+	case *stateInfo:
+		return i.stateRecord
+	case *SymlinkInfo:
+		r := newStateRecord(i.FileInfo)
+		r.extra = &stateExtra{id: r.extra.otherID(), target: i.Target, broken: i.Broken}
+		return r
+	case *StreamInfo:
+		r := newStateRecord(i.FileInfo)
+		r.extra = &stateExtra{id: r.extra.otherID(), streams: i.Streams}
+		return r
+	}
+
+	r := stateRecord{size: info.Size(), modTime: info.ModTime().UnixNano(), mode: info.Mode()}
+	if ctime, ok := changeTime(info); ok {
+		r.cTime = ctime.UnixNano()
+	}
+	if uid, gid, ok := owner(info); ok {
+		r.uid, r.gid, r.owned = uint32(uid), uint32(gid), true
+	}
+	if id, ok := fileID(info); ok {
+		r.setID(id)
+	}
+	return r
+}
+
+// otherID returns the file ID kept aside, if any.
+func (e *stateExtra) otherID() string {
+	if e == nil {
+		return ""
+	}
+	return e.id
+}
+
+// setID keeps id as device and inode, or aside if of another form.
+func (r *stateRecord) setID(id string) {
+	if i := strings.IndexByte(id, ':'); i > 0 {
+		dev, err1 := strconv.ParseUint(id[:i], 10, 64)
+		ino, err2 := strconv.ParseUint(id[i+1:], 10, 64)
+		if err1 == nil && err2 == nil {
+			r.dev, r.ino, r.hasID = dev, ino, true
+			return
+		}
+	}
+	if r.extra == nil {
+		r.extra = &stateExtra{}
+	}
+	r.extra.id = id
+}
+
+// id returns the file ID as told by fileID.
+func (r *stateRecord) id() (string, bool) {
+	if r.hasID {
+		return strconv.FormatUint(r.dev, 10) + ":" + strconv.FormatUint(r.ino, 10), true
+	}
+	if r.extra != nil && r.extra.id != "" {
+		return r.extra.id, true
+	}
+	return "", false
+}
+
+// changeTime returns the inode change time as told by changeTime.
+func (r *stateRecord) changeTime() (time.Time, bool) {
+	if r.cTime == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, r.cTime), true
+}
+
+// owner returns user and group as told by owner.
+func (r *stateRecord) owner() (uid, gid int, ok bool) {
+	if !r.owned {
+		return -1, -1, false
+	}
+	return int(r.uid), int(r.gid), true
+}
+
+// info returns the os.FileInfo of the record, as kept by walks.
+func (r stateRecord) info(name string) os.FileInfo {
+	var info os.FileInfo = &stateInfo{name: name, stateRecord: r}
+	if r.extra != nil {
+		switch {
+		case r.extra.target != "":
+			return &SymlinkInfo{FileInfo: info, Target: r.extra.target, Broken: r.extra.broken}
+		case r.extra.streams != nil:
+			return &StreamInfo{FileInfo: info, Streams: r.extra.streams}
+		}
+	}
+	return info
+}
+
+// stateInfo implements os.FileInfo for kept files, Sys returns the *stateRecord told by fileID, changeTime and owner.
+type stateInfo struct {
+	name string
+	stateRecord
+}
+
+func (i *stateInfo) Name() string       { return i.name }
+func (i *stateInfo) Size() int64        { return i.size }
+func (i *stateInfo) Mode() os.FileMode  { return i.mode }
+func (i *stateInfo) ModTime() time.Time { return time.Unix(0, i.modTime) }
+func (i *stateInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *stateInfo) Sys() interface{}   { return &i.stateRecord }
+
+func (c *compactStates) get(path string) (os.FileInfo, bool) {
+	dir, name := filepath.Split(path)
+	r, ok := c.dirs[dir][name]
+	if !ok {
+		return nil, false
+	}
+	return r.info(name), true
+}
+
+func (c *compactStates) has(path string) bool {
+	dir, name := filepath.Split(path)
+	_, ok := c.dirs[dir][name]
+	return ok
+}
+
+func (c *compactStates) put(path string, info os.FileInfo) {
+	dir, name := filepath.Split(path)
+	files, ok := c.dirs[dir]
+	if !ok {
+		files = make(map[string]stateRecord)
+		/* keys are cloned, not to keep the whole path alive */
+		c.dirs[strings.Clone(dir)] = files
+	}
+	if _, ok := files[name]; !ok {
+		c.n++
+	}
+	files[strings.Clone(name)] = newStateRecord(info)
+}
+
+func (c *compactStates) remove(path string) {
+	dir, name := filepath.Split(path)
+	files := c.dirs[dir]
+	if _, ok := files[name]; !ok {
+		return
+	}
+	delete(files, name)
+	if len(files) == 0 {
+		delete(c.dirs, dir)
+	}
+	c.n--
+}
+
+func (c *compactStates) each(fn func(path string, info os.FileInfo)) {
+	for dir, files := range c.dirs {
+		for name, r := range files {
+			fn(dir+name, r.info(name))
+		}
+	}
+}
+
+func (c *compactStates) len() int {
+	return c.n
+}
+
+func (c *compactStates) close() {}
+
+// storedStates keeps states in a StateStore.
+type storedStates struct {
+	store  StateStore
+	logger logSink
+}
+
+func (s *storedStates) get(path string) (os.FileInfo, bool) {
+	state, ok := s.store.Get(path)
+	if !ok {
+		return nil, false
+	}
+	return state.record().info(filepath.Base(path)), true
+}
+
+func (s *storedStates) has(path string) bool {
+	_, ok := s.store.Get(path)
+	return ok
+}
+
+func (s *storedStates) put(path string, info os.FileInfo) {
+	if err := s.store.Put(fileState(path, info)); err != nil {
+		s.logger.error("Failed to record state", "path", path, "error", err)
+	}
+}
+
+func (s *storedStates) remove(path string) {
+	if err := s.store.Delete(path); err != nil {
+		s.logger.error("Failed to forget state", "path", path, "error", err)
+	}
+}
+
+func (s *storedStates) each(fn func(path string, info os.FileInfo)) {
+	err := s.store.Range(func(state FileState) bool {
+		fn(state.Path, state.record().info(filepath.Base(state.Path)))
+		return true
+	})
+	if err != nil {
+		s.logger.error("Failed to read states", "error", err)
+	}
+}
+
+func (s *storedStates) len() int {
+	return s.store.Len()
+}
+
+func (s *storedStates) close() {
+	if err := s.store.Close(); err != nil {
+		s.logger.error("Failed to close state store", "error", err)
+	}
+}
+
+// record converts the state as recorded by a StateStore.
+func (f *FileState) record() stateRecord {
+	r := stateRecord{size: f.Size, modTime: f.ModTime.UnixNano(), mode: f.Mode}
+	if !f.ChangeTime.IsZero() {
+		r.cTime = f.ChangeTime.UnixNano()
+	}
+	if f.UID >= 0 && f.GID >= 0 {
+		r.uid, r.gid, r.owned = uint32(f.UID), uint32(f.GID), true
+	}
+	if f.ID != "" {
+		r.setID(f.ID)
+	}
+	if f.Target != "" || f.Streams != nil {
+		if r.extra == nil {
+			r.extra = &stateExtra{}
+		}
+		r.extra.target, r.extra.broken, r.extra.streams = f.Target, f.Broken, f.Streams
+	}
+	return r
+}
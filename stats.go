@@ -0,0 +1,458 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Histogram counts observations in exponential buckets, bucket i counting values up to Start*Factor^i.
+type Histogram struct {
+	Start  float64
+	Factor float64
+	// Per bucket, the last one counts values above every bound
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// newHistogram creates a Histogram of n bounded buckets.
+func newHistogram(start, factor float64, n int) Histogram {
+	return Histogram{Start: start, Factor: factor, Counts: make([]uint64, n+1)}
+}
+
+// Bound returns the upper bound of bucket i, +Inf for the last one.
+func (h *Histogram) Bound(i int) float64 {
+	if i >= len(h.Counts)-1 {
+		return math.Inf(1)
+	}
+	return h.Start * math.Pow(h.Factor, float64(i))
+}
+
+// Quantile returns the upper bound of the bucket holding the q-th observation, 0 without observations.
+func (h *Histogram) Quantile(q float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := uint64(math.Ceil(q * float64(h.Count)))
+	var seen uint64
+	for i, c := range h.Counts {
+		if seen += c; seen >= rank {
+			return h.Bound(i)
+		}
+	}
+	return math.Inf(1)
+}
+
+func (h *Histogram) observe(v float64) {
+	i := 0
+	for i < len(h.Counts)-1 && v > h.Bound(i) {
+		i++
+	}
+	h.Counts[i]++
+	h.Count++
+	h.Sum += v
+}
+
+func (h Histogram) clone() Histogram {
+	h.Counts = append([]uint64(nil), h.Counts...)
+	return h
+}
+
+// Stats collects distributions of delivered notices, see Monitor.Stats.
+type Stats struct {
+	// Notices delivered through Notices()
+	Notices uint64
+	// Size in bytes of created and updated files
+	FileSize Histogram
+	// Seconds from modification time of created and updated files to delivery of their notices,
+	// within the scan interval as long as scanning keeps up
+	Latency Histogram
+	// Scans whose notices missed the SLO given by WithSLO, see LatencyAlert
+	SLOViolations uint64
+	// Notices older than the max age given by WithMaxAge, dropped or tagged as StaleNotice
+	Stale uint64
+	// Notices dropped by rules of ActionSample, by rule name
+	Sampled map[string]uint64
+	// Notices dropped by subscribers falling behind, by the overflow policy, and those left buffered on Stop
+	Dropped uint64
+	// Notices spilled to disk while Notices() was full, see OverflowSpill
+	Spilled uint64
+	// Notices repeating the last one of their path, dropped by WithOrdering
+	Duplicates uint64
+	// Seconds delivering a notice through Notices(), or a batch through Batches(), blocked until consumed
+	Blocked Histogram
+	// Interval until the next scan, adapted to change activity by WithAdaptiveInterval, 0 by WithSchedule
+	Interval time.Duration
+	// Start and duration of the last scan completed, zero before the first one
+	LastScan     time.Time
+	ScanDuration time.Duration
+	// Failed scans in a row, 0 once one succeeds
+	Failures int
+	// Files and directories visited by the last scan and files tracked since, told by a ScanCounter
+	Visited, Tracked int
+	// Size and count of files tracked by every watched path by the last scan succeeding, told by a UsageCounter,
+	// see WithDiskUsage
+	Usage map[string]Usage
+	// Notices delivered by type
+	Events map[Event]uint64
+	// How attached sinks keep up, by name, see AttachSink
+	Sinks map[string]SinkStats
+}
+
+// ScanCounter is implemented by Watchers able to tell how many files their scans visit, see Stats.
+type ScanCounter interface {
+	// Returns the files and directories visited by the last scan and the files tracked since,
+	// called once the scan completed
+	ScanCounts() (visited, tracked int)
+}
+
+// UsageCounter is implemented by Watchers totalling the files they track, see Stats.
+type UsageCounter interface {
+	// Returns the usage of every watched path, called once a scan completed
+	DiskUsage() map[string]Usage
+}
+
+func newStats() Stats {
+	return Stats{
+		/* 1KiB up to 4GiB */
+		FileSize: newHistogram(1024, 4, 12),
+		/* 100ms up to about 55 minutes */
+		Latency: newHistogram(0.1, 2, 16),
+		/* 1ms up to about 33 seconds */
+		Blocked: newHistogram(0.001, 2, 16),
+	}
+}
+
+// record observes a notice about to be delivered.
+func (s *Stats) record(n Notice, now time.Time) {
+	s.Notices++
+	if s.Events == nil {
+		s.Events = make(map[Event]uint64)
+	}
+	s.Events[n.Type()]++
+	info, ok := changedInfo(n)
+	if !ok {
+		return
+	}
+	s.FileSize.observe(float64(info.Size()))
+	if latency, ok := detectionLatency(info, now); ok {
+		s.Latency.observe(latency.Seconds())
+	}
+}
+
+// changedInfo returns the info of created and updated files.
+func changedInfo(n Notice) (os.FileInfo, bool) {
+	if n.Type()&(FileCreate|FileUpdate) == 0 {
+		return nil, false
+	}
+	info, ok := n.More().(os.FileInfo)
+	return info, ok && info != nil
+}
+
+// detectionLatency is the time from modification of the file to now.
+func detectionLatency(info os.FileInfo, now time.Time) (time.Duration, bool) {
+	latency := now.Sub(info.ModTime())
+	/* clocks of remote file systems may run ahead */
+	return latency, latency >= 0
+}
+
+// WritePrometheus writes the stats in Prometheus text exposition format, e.g. to serve /metrics.
+func (s Stats) WritePrometheus(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_notices_total Notices delivered.\n# TYPE fsmonitor_notices_total counter\nfsmonitor_notices_total %d\n", s.Notices); err != nil {
+		return err
+	}
+	if err := writeHistogram(w, "fsmonitor_file_size_bytes", "Size of created and updated files.", &s.FileSize); err != nil {
+		return err
+	}
+	if err := writeHistogram(w, "fsmonitor_detection_latency_seconds", "Time from modification to delivery of notices.", &s.Latency); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_slo_violations_total Scans missing the detection latency SLO.\n# TYPE fsmonitor_slo_violations_total counter\nfsmonitor_slo_violations_total %d\n", s.SLOViolations); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_stale_total Notices older than the max age when delivered.\n# TYPE fsmonitor_stale_total counter\nfsmonitor_stale_total %d\n", s.Stale); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_dropped_total Notices dropped by subscribers falling behind, the overflow policy or on stop.\n# TYPE fsmonitor_dropped_total counter\nfsmonitor_dropped_total %d\n", s.Dropped); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_spilled_total Notices spilled to disk while Notices() was full.\n# TYPE fsmonitor_spilled_total counter\nfsmonitor_spilled_total %d\n", s.Spilled); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_duplicates_total Notices repeating the last one of their path, dropped.\n# TYPE fsmonitor_duplicates_total counter\nfsmonitor_duplicates_total %d\n", s.Duplicates); err != nil {
+		return err
+	}
+	if err := writeHistogram(w, "fsmonitor_blocked_seconds", "Time delivering notices blocked until consumed.", &s.Blocked); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_scan_interval_seconds Interval until the next scan.\n# TYPE fsmonitor_scan_interval_seconds gauge\nfsmonitor_scan_interval_seconds %v\n", s.Interval.Seconds()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_scan_duration_seconds Duration of the last scan.\n# TYPE fsmonitor_scan_duration_seconds gauge\nfsmonitor_scan_duration_seconds %v\n", s.ScanDuration.Seconds()); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_scan_failures Failed scans in a row.\n# TYPE fsmonitor_scan_failures gauge\nfsmonitor_scan_failures %d\n", s.Failures); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_visited_files Files and directories visited by the last scan.\n# TYPE fsmonitor_visited_files gauge\nfsmonitor_visited_files %d\n", s.Visited); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_tracked_files Files tracked since the last scan.\n# TYPE fsmonitor_tracked_files gauge\nfsmonitor_tracked_files %d\n", s.Tracked); err != nil {
+		return err
+	}
+	if len(s.Events) > 0 {
+		if _, err := fmt.Fprintf(w, "# HELP fsmonitor_events_total Notices delivered by type.\n# TYPE fsmonitor_events_total counter\n"); err != nil {
+			return err
+		}
+		events := make([]Event, 0, len(s.Events))
+		for event := range s.Events {
+			events = append(events, event)
+		}
+		sort.Slice(events, func(i, j int) bool { return events[i] < events[j] })
+		for _, event := range events {
+			if _, err := fmt.Fprintf(w, "fsmonitor_events_total{event=%q} %d\n", event, s.Events[event]); err != nil {
+				return err
+			}
+		}
+	}
+	if len(s.Usage) > 0 {
+		paths := make([]string, 0, len(s.Usage))
+		for path := range s.Usage {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		if _, err := fmt.Fprintf(w, "# HELP fsmonitor_usage_bytes Size of files tracked by watched path.\n# TYPE fsmonitor_usage_bytes gauge\n"); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if _, err := fmt.Fprintf(w, "fsmonitor_usage_bytes{path=%q} %d\n", path, s.Usage[path].Size); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "# HELP fsmonitor_usage_files Files tracked by watched path.\n# TYPE fsmonitor_usage_files gauge\n"); err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if _, err := fmt.Fprintf(w, "fsmonitor_usage_files{path=%q} %d\n", path, s.Usage[path].Files); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeSinks(w, s.Sinks); err != nil {
+		return err
+	}
+	if len(s.Sampled) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "# HELP fsmonitor_sampled_total Notices dropped by sample rules.\n# TYPE fsmonitor_sampled_total counter\n"); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(s.Sampled))
+	for name := range s.Sampled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "fsmonitor_sampled_total{rule=%q} %d\n", name, s.Sampled[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHistogram(w io.Writer, name, help string, h *Histogram) error {
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name); err != nil {
+		return err
+	}
+	return writeBuckets(w, name, "", h)
+}
+
+// writeBuckets writes the samples of h, labels prefixing those of buckets unless empty, e.g. `sink="kafka",`.
+func writeBuckets(w io.Writer, name, labels string, h *Histogram) error {
+	/* buckets are cumulative in exposition format */
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		le := "+Inf"
+		if b := h.Bound(i); !math.IsInf(b, 1) {
+			le = fmt.Sprint(b)
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket{%sle=%q} %d\n", name, labels, le, cumulative); err != nil {
+			return err
+		}
+	}
+	series := ""
+	if labels != "" {
+		series = "{" + strings.TrimSuffix(labels, ",") + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s_sum%s %v\n%s_count%s %d\n", name, series, h.Sum, name, series, h.Count)
+	return err
+}
+
+// writeSinks writes the stats of every sink labelled by its name.
+func writeSinks(w io.Writer, sinks map[string]SinkStats) error {
+	if len(sinks) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(sinks))
+	for name := range sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, metric := range []struct {
+		name, help, kind string
+		value            func(SinkStats) interface{}
+	}{
+		{"fsmonitor_sink_queued", "Notices buffered for a sink, not published yet.", "gauge", func(s SinkStats) interface{} { return s.Queued }},
+		{"fsmonitor_sink_published_total", "Notices published by a sink.", "counter", func(s SinkStats) interface{} { return s.Published }},
+		{"fsmonitor_sink_failed_total", "Notices a sink failed publishing.", "counter", func(s SinkStats) interface{} { return s.Failed }},
+		{"fsmonitor_sink_dropped_total", "Notices dropped while a sink fell behind.", "counter", func(s SinkStats) interface{} { return s.Dropped }},
+		{"fsmonitor_sink_oldest_unsent_seconds", "Age of the notice a sink is publishing.", "gauge", func(s SinkStats) interface{} { return s.Oldest.Seconds() }},
+	} {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if _, err := fmt.Fprintf(w, "%s{sink=%q} %v\n", metric.name, name, metric.value(sinks[name])); err != nil {
+				return err
+			}
+		}
+	}
+	const latency = "fsmonitor_sink_latency_seconds"
+	if _, err := fmt.Fprintf(w, "# HELP %s Time from notices to a sink publishing them.\n# TYPE %s histogram\n", latency, latency); err != nil {
+		return err
+	}
+	for _, name := range names {
+		h := sinks[name].Latency
+		if err := writeBuckets(w, latency, fmt.Sprintf("sink=%q,", name), &h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stats returns a snapshot of distributions of notices delivered so far, to quantify detection latency
+// and tune the scan interval. Stats.WritePrometheus exports them as Prometheus histograms.
+func (m *Monitor) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats
+	s.FileSize = s.FileSize.clone()
+	s.Latency = s.Latency.clone()
+	s.Blocked = s.Blocked.clone()
+	if s.Sampled != nil {
+		s.Sampled = make(map[string]uint64, len(m.stats.Sampled))
+		for name, count := range m.stats.Sampled {
+			s.Sampled[name] = count
+		}
+	}
+	if s.Events != nil {
+		s.Events = make(map[Event]uint64, len(m.stats.Events))
+		for event, count := range m.stats.Events {
+			s.Events[event] = count
+		}
+	}
+	if s.Usage != nil {
+		s.Usage = mergeUsage(nil, m.stats.Usage)
+	}
+	now := time.Now()
+	for _, a := range m.attached {
+		if s.Sinks == nil {
+			s.Sinks = make(map[string]SinkStats, len(m.attached))
+		}
+		s.Sinks[a.name] = a.snapshot(now)
+	}
+	return s
+}
+
+// Healthy reports whether a scan completed and the last one succeeded, e.g. for readiness endpoints.
+// Paused Monitors stay healthy, a scan hanging on an unresponsive volume shows by Stats().LastScan growing old.
+func (m *Monitor) Healthy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !m.stats.LastScan.IsZero() && m.stats.Failures == 0
+}
+
+// scanned records a scan started at start completing, failures being the failed scans in a row since.
+func (m *Monitor) scanned(start time.Time, failures int) {
+	visited, tracked := 0, 0
+	if c, ok := m.watcher.(ScanCounter); ok {
+		visited, tracked = c.ScanCounts()
+	}
+	var usage map[string]Usage
+	if c, ok := m.watcher.(UsageCounter); ok {
+		usage = c.DiskUsage()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.LastScan, m.stats.ScanDuration = start, time.Since(start)
+	m.stats.Failures = failures
+	m.stats.Visited, m.stats.Tracked = visited, tracked
+	m.stats.Usage = usage
+}
+
+// ScanCounts tells the counts of the last scan.
+func (s *pathScanner) ScanCounts() (visited, tracked int) {
+	return s.counts[0], s.counts[1]
+}
+
+// ScanCounts relays to the wrapped Watcher.
+func (d *decoratedWatcher) ScanCounts() (visited, tracked int) {
+	if c, ok := d.watcher.(ScanCounter); ok {
+		return c.ScanCounts()
+	}
+	return 0, 0
+}
+
+// ScanCounts sums the counts of the Watchers of every path.
+func (m *multiWatcher) ScanCounts() (visited, tracked int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.roots {
+		if c, ok := r.watcher.(ScanCounter); ok {
+			v, t := c.ScanCounts()
+			visited, tracked = visited+v, tracked+t
+		}
+	}
+	return visited, tracked
+}
+
+// record observes n in the stats of the Monitor.
+func (m *Monitor) record(n Notice) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.stats.record(n, now)
+	if m.noise != nil {
+		m.noise.Add(n)
+	}
+
+	if info, ok := changedInfo(n); ok && m.slo.Quantile > 0 {
+		if latency, ok := detectionLatency(info, now); ok {
+			m.sloTotal++
+			if latency <= m.sloTarget {
+				m.sloMet++
+			}
+		}
+	}
+}
+
+// blocked observes d spent delivering to a consumer.
+func (m *Monitor) blocked(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Blocked.observe(d.Seconds())
+}
+
+// dropped counts count notices dropped.
+func (m *Monitor) dropped(count uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats.Dropped += count
+}
@@ -0,0 +1,63 @@
+package fsmonitor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sort"
+)
+
+// StreamInfo is the os.FileInfo of files having secondary streams, found by the builtin "path" Watcher
+// with WithStreams, returned by Notice.More.
+type StreamInfo struct {
+	os.FileInfo
+	// SHA-256 of every secondary stream by name: alternate data streams on Windows,
+	// the resource fork on macOS, extended attributes on Linux
+	Streams map[string]string
+	// Names of streams added, changed or removed, by a StreamChanged notice
+	Changed []string
+}
+
+// WithStreams makes the builtin "path" Watcher enumerate and diff secondary streams of files,
+// sending StreamChanged notices when they change even if the main stream didn't, e.g. a payload hidden in an ADS.
+func WithStreams() Option {
+	return func(o *options) error {
+		o.streams = true
+		return nil
+	}
+}
+
+// streamsChanged returns info with names of changed streams, if streams differ between infos.
+func streamsChanged(oldinfo, info os.FileInfo) *StreamInfo {
+	var old, cur map[string]string
+	if si, ok := oldinfo.(*StreamInfo); ok {
+		old = si.Streams
+	}
+	si, ok := info.(*StreamInfo)
+	if ok {
+		cur = si.Streams
+	}
+
+	var changed []string
+	for name, sum := range cur {
+		if old[name] != sum {
+			changed = append(changed, name)
+		}
+	}
+	for name := range old {
+		if _, ok := cur[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	return &StreamInfo{FileInfo: info, Streams: cur, Changed: changed}
+}
+
+// digest returns the hex SHA-256 of data.
+func digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,22 @@
+//go:build darwin
+// +build darwin
+
+package fsmonitor
+
+import (
+	"io/ioutil"
+	"os"
+)
+
+// streams digests the resource fork of path, named "rsrc", telling read the bytes read.
+func streams(path string, read func(n int)) (map[string]string, error) {
+	content, err := ioutil.ReadFile(path + "/..namedfork/rsrc")
+	if err != nil || len(content) == 0 {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return nil, err
+	}
+	read(len(content))
+	return map[string]string{"rsrc": digest(content)}, nil
+}
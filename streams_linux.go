@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package fsmonitor
+
+import (
+	"bytes"
+	"syscall"
+)
+
+// streams digests extended attributes of path, telling read the bytes read.
+func streams(path string, read func(n int)) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		if err == syscall.ENOTSUP {
+			err = nil
+		}
+		return nil, err
+	}
+	names := make([]byte, size)
+	if size, err = syscall.Listxattr(path, names); err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string)
+	for _, name := range bytes.Split(names[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		attr := string(name)
+		n, err := syscall.Getxattr(path, attr, nil)
+		if err != nil {
+			/* removed meanwhile */
+			continue
+		}
+		value := make([]byte, n)
+		if n, err = syscall.Getxattr(path, attr, value); err != nil {
+			continue
+		}
+		read(n)
+		sums[attr] = digest(value[:n])
+	}
+	return sums, nil
+}
@@ -0,0 +1,9 @@
+//go:build !darwin && !linux && !windows
+// +build !darwin,!linux,!windows
+
+package fsmonitor
+
+// streams isn't supported, files have no secondary streams.
+func streams(path string, read func(n int)) (map[string]string, error) {
+	return nil, nil
+}
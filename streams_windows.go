@@ -0,0 +1,58 @@
+//go:build windows
+// +build windows
+
+package fsmonitor
+
+import (
+	"io/ioutil"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	procFindFirstStreamW = syscall.NewLazyDLL("kernel32.dll").NewProc("FindFirstStreamW")
+	procFindNextStreamW  = syscall.NewLazyDLL("kernel32.dll").NewProc("FindNextStreamW")
+)
+
+// win32FindStreamData is WIN32_FIND_STREAM_DATA.
+type win32FindStreamData struct {
+	StreamSize int64
+	StreamName [syscall.MAX_PATH + 36]uint16
+}
+
+// streams digests alternate data streams of path, e.g. :Zone.Identifier:$DATA, telling read the bytes read.
+func streams(path string, read func(n int)) (map[string]string, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var data win32FindStreamData
+	/* FindStreamInfoStandard */
+	h, _, err := procFindFirstStreamW.Call(uintptr(unsafe.Pointer(p)), 0, uintptr(unsafe.Pointer(&data)), 0)
+	if syscall.Handle(h) == syscall.InvalidHandle {
+		if err == syscall.ERROR_HANDLE_EOF {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer syscall.FindClose(syscall.Handle(h))
+
+	sums := make(map[string]string)
+	for {
+		name := syscall.UTF16ToString(data.StreamName[:])
+		/* main stream is compared by the regular scan */
+		if name != "::$DATA" {
+			if content, err := ioutil.ReadFile(path + strings.TrimSuffix(name, ":$DATA")); err == nil {
+				read(len(content))
+				sums[name] = digest(content)
+			}
+		}
+		if ok, _, err := procFindNextStreamW.Call(h, uintptr(unsafe.Pointer(&data))); ok == 0 {
+			if err == syscall.ERROR_HANDLE_EOF {
+				return sums, nil
+			}
+			return sums, err
+		}
+	}
+}
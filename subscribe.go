@@ -0,0 +1,209 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// Filter selects the notices of a subscription, see Monitor.Subscribe.
+type Filter struct {
+	// Event types delivered, all of those delivered by Start without any
+	Events Event
+	// Names must match any of the patterns, regular expressions or globs (see CompilePattern), all names without patterns
+	Patterns []string
+	// Notices buffered for the subscriber, 1000 by default
+	Buffer int
+}
+
+// noticeFilter selects notices by event types and name patterns, all of either when none are given.
+type noticeFilter struct {
+	events  Event
+	pattern []*regexp.Regexp
+}
+
+// newNoticeFilter compiles patterns, see CompilePattern.
+func newNoticeFilter(events Event, patterns []string) (noticeFilter, error) {
+	f := noticeFilter{events: events}
+	for _, pat := range patterns {
+		re, err := CompilePattern(pat)
+		if err != nil {
+			return f, fmt.Errorf("Pattern string failed compilation, please check syntax! %v", err)
+		}
+		f.pattern = append(f.pattern, re)
+	}
+	return f, nil
+}
+
+// matches reports whether n passes the filter.
+func (f *noticeFilter) matches(n Notice) bool {
+	if f.events != 0 && n.Type()&f.events == 0 {
+		return false
+	}
+	for _, re := range f.pattern {
+		if re.MatchString(n.Name()) {
+			return true
+		}
+	}
+	return len(f.pattern) == 0
+}
+
+// subscription is a consumer fanned out to by Monitor.
+type subscription struct {
+	noticeFilter
+	notices chan Notice
+	/* what sending does once the buffer is full */
+	overflow Overflow
+	/* closed by close, releasing a send blocked by OverflowBlock */
+	quit chan struct{}
+
+	/* guards sending against closing by cancel */
+	mu     sync.Mutex
+	closed bool
+	/* a send blocked by OverflowBlock, which close waits for before closing notices */
+	blocked sync.WaitGroup
+	/* notices dropped while the buffer was full */
+	drops uint64
+}
+
+// Subscribe adds a consumer of the notices delivered by Start, receiving those passing filter.
+// Notices are fanned out from Notices() in place of the caller, so Notices() must not be consumed by anything else
+// once subscribing. Every subscriber has a buffer of its own, a subscriber falling behind by more loses notices
+// without holding up others. The channel closes when cancelled, or after the buffered notices once Notices() closes.
+func (m *Monitor) Subscribe(filter Filter) (<-chan Notice, func(), error) {
+	s, cancel, err := m.subscribe(filter, OverflowDropNewest)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.notices, cancel, nil
+}
+
+// subscribe adds a subscription sending by overflow once its buffer is full, see Subscribe.
+func (m *Monitor) subscribe(filter Filter, overflow Overflow) (*subscription, func(), error) {
+	nf, err := newNoticeFilter(filter.Events, filter.Patterns)
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &subscription{noticeFilter: nf, overflow: overflow, quit: make(chan struct{})}
+	buffer := filter.Buffer
+	if buffer <= 0 {
+		buffer = notice_buffer_length
+	}
+	s.notices = make(chan Notice, buffer)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch {
+	case m.fannedOut:
+		/* Notices() closed already */
+		close(s.notices)
+		return s, func() {}, nil
+	case m.subs == nil:
+		m.subs = make(map[*subscription]struct{})
+		m.goroutines.run("subscriptions", m.fanOut)
+	}
+	m.subs[s] = struct{}{}
+
+	cancel := func() {
+		m.mu.Lock()
+		delete(m.subs, s)
+		m.mu.Unlock()
+		s.close()
+	}
+	return s, cancel, nil
+}
+
+// fanOut delivers Notices() to every subscription until it closes.
+func (m *Monitor) fanOut() {
+	for n := range m.notices {
+		m.mu.Lock()
+		subs := make([]*subscription, 0, len(m.subs))
+		for s := range m.subs {
+			subs = append(subs, s)
+		}
+		m.mu.Unlock()
+
+		for _, s := range subs {
+			if s.matches(n) && !s.send(n, m.halt) {
+				m.logger.warn("Subscriber falling behind, notice dropped", "path", n.Name(), "event", n.Type())
+				m.dropped(1)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.fannedOut = true
+	subs := m.subs
+	m.subs = nil
+	m.mu.Unlock()
+	for s := range subs {
+		s.close()
+	}
+}
+
+// send buffers n, reporting whether it did without dropping a notice. Once the buffer is full, OverflowBlock waits
+// for room until halt closes, OverflowDropOldest drops the oldest notice buffered for n, others drop n. Cancelled
+// subscriptions drop it silently.
+func (s *subscription) send(n Notice, halt <-chan struct{}) bool {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return true
+	}
+	select {
+	case s.notices <- n:
+		s.mu.Unlock()
+		return true
+	default:
+	}
+
+	switch s.overflow {
+	case OverflowBlock:
+		/* waits without holding mu, so cancelling releases it */
+		s.blocked.Add(1)
+		s.mu.Unlock()
+		defer s.blocked.Done()
+		select {
+		case s.notices <- n:
+			return true
+		case <-s.quit:
+			return true
+		case <-halt:
+		}
+		s.mu.Lock()
+		s.drops++
+		s.mu.Unlock()
+		return false
+	case OverflowDropOldest:
+		/* fanOut is the only sender, so there's room once one is taken */
+		select {
+		case <-s.notices:
+		default:
+		}
+		s.notices <- n
+	}
+	s.drops++
+	s.mu.Unlock()
+	return false
+}
+
+// dropped returns the notices dropped while the buffer was full.
+func (s *subscription) dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.drops
+}
+
+// close closes the channel of the subscription once, after a send blocked by OverflowBlock returned.
+func (s *subscription) close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.quit)
+	s.mu.Unlock()
+	s.blocked.Wait()
+	close(s.notices)
+}
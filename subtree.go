@@ -0,0 +1,126 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// SubtreeScans spreads walks of the builtin "path" Watcher over the subtrees of the watched address, the
+// top-level directories under it, each walked on a schedule of its own, see WithSubtreeScans.
+type SubtreeScans struct {
+	// Subtrees walked by a scan at most, besides new ones; all that are due if zero
+	PerScan int
+	// Walks the subtrees walked longest ago first instead of in turns by name
+	Stalest bool
+	// Intervals subtrees are walked at most as often as, by glob of their names, e.g. "archive*" for a cold NFS
+	// directory; the longest of patterns matching applies, subtrees matching none are due every scan
+	Intervals map[string]time.Duration
+}
+
+// WithSubtreeScans makes the builtin "path" Watcher walk only the subtrees due once the first scan walked the
+// whole tree, so a slow subtree delays notices of its own files only instead of those of all, e.g. hot directories
+// next to a cold archive. Subtrees not walked keep their state until their turn, files at the top level and new
+// subtrees are walked every scan. Native events, see "native" and "hybrid" in New, are not spread.
+func WithSubtreeScans(c SubtreeScans) Option {
+	return func(o *options) error {
+		if c.PerScan < 0 {
+			return fmt.Errorf("Subtrees per scan must not be negative")
+		}
+		for pattern, every := range c.Intervals {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("Subtree pattern failed compilation, please check syntax! %v", err)
+			}
+			if every <= 0 {
+				return fmt.Errorf("Subtree interval of %s must be positive", pattern)
+			}
+		}
+		o.subtrees = &c
+		return nil
+	}
+}
+
+// subtrees keeps when the subtrees of the watched address were walked.
+type subtrees struct {
+	conf   SubtreeScans
+	walked map[string]time.Time
+	/* last subtree walked in turn */
+	cursor string
+}
+
+// subtreePlan tells which known subtrees a walk of the address visits, and what it found.
+type subtreePlan struct {
+	due    map[string]bool
+	cursor string
+	/* subtrees walked and deferred by the walk */
+	visited  []string
+	deferred map[string]bool
+}
+
+func newSubtrees(conf SubtreeScans) *subtrees {
+	return &subtrees{conf: conf, walked: make(map[string]time.Time)}
+}
+
+// interval returns how often subtree is walked at most.
+func (t *subtrees) interval(subtree string) time.Duration {
+	var every time.Duration
+	for pattern, d := range t.conf.Intervals {
+		if ok, _ := filepath.Match(pattern, subtree); ok && d > every {
+			every = d
+		}
+	}
+	return every
+}
+
+// plan picks the known subtrees walked at now.
+func (t *subtrees) plan(now time.Time) *subtreePlan {
+	p := &subtreePlan{due: make(map[string]bool), cursor: t.cursor, deferred: make(map[string]bool)}
+	var names []string
+	for name, walked := range t.walked {
+		p.due[name] = false
+		if now.Sub(walked) >= t.interval(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if t.conf.Stalest {
+		sort.SliceStable(names, func(i, j int) bool { return t.walked[names[i]].Before(t.walked[names[j]]) })
+	} else {
+		/* in turns, from the one after the last walked */
+		i := sort.SearchStrings(names, t.cursor)
+		if i < len(names) && names[i] == t.cursor {
+			i++
+		}
+		names = append(names[i:], names[:i]...)
+	}
+	if t.conf.PerScan > 0 && len(names) > t.conf.PerScan {
+		names = names[:t.conf.PerScan]
+	}
+	for _, name := range names {
+		p.due[name] = true
+		if !t.conf.Stalest {
+			p.cursor = name
+		}
+	}
+	return p
+}
+
+// walks reports whether the subtree is walked, new ones are, others are deferred.
+func (p *subtreePlan) walks(subtree string) bool {
+	due, known := p.due[subtree]
+	return due || !known
+}
+
+// commit records the subtrees walked at now, forgetting those gone.
+func (t *subtrees) commit(p *subtreePlan, now time.Time) {
+	for name := range t.walked {
+		if !p.deferred[name] {
+			delete(t.walked, name)
+		}
+	}
+	for _, name := range p.visited {
+		t.walked[name] = now
+	}
+	t.cursor = p.cursor
+}
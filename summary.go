@@ -0,0 +1,95 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Summary counts the notices of a period by the directory of their files, see Monitor.Summaries.
+type Summary struct {
+	Start time.Time
+	End   time.Time
+	// By parent directory of the files noticed
+	Dirs map[string]*DirSummary
+}
+
+// DirSummary counts the changes of files directly within a directory.
+type DirSummary struct {
+	Creates uint64
+	Updates uint64
+	Removes uint64
+	Renames uint64
+	// Sum of sizes of created and updated files
+	Bytes int64
+}
+
+func (s *Summary) String() string {
+	return fmt.Sprintf("{%v - %v : %d directories}", s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339), len(s.Dirs))
+}
+
+// Summaries counts notices per directory and delivers the counts every period, e.g. for dashboards and capacity
+// reports not interested in single files, consuming Notices() in place of the caller. Periods without notices
+// deliver an empty Summary. The channel closes after Notices() closes, delivering the last period in progress.
+func (m *Monitor) Summaries(period time.Duration) <-chan *Summary {
+	return Summarize(m.Notices(), period)
+}
+
+// Summarize summarizes any notice stream, see Monitor.Summaries.
+func Summarize(notices <-chan Notice, period time.Duration) <-chan *Summary {
+	summaries := make(chan *Summary)
+
+	go func() {
+		defer close(summaries)
+
+		current := &Summary{Start: time.Now(), Dirs: make(map[string]*DirSummary)}
+		tick := time.NewTicker(period)
+		defer tick.Stop()
+
+		for {
+			select {
+			case n, ok := <-notices:
+				if !ok {
+					if len(current.Dirs) > 0 {
+						current.End = time.Now()
+						summaries <- current
+					}
+					return
+				}
+				current.add(n)
+			case now := <-tick.C:
+				current.End = now
+				summaries <- current
+				current = &Summary{Start: now, Dirs: make(map[string]*DirSummary)}
+			}
+		}
+	}()
+
+	return summaries
+}
+
+// add counts n in the summary of its directory, notices of other event types are not counted.
+func (s *Summary) add(n Notice) {
+	if n.Type()&(FileCreate|FileUpdate|FileRemove|FileRename) == 0 {
+		return
+	}
+	dir := filepath.Dir(n.Name())
+	d, ok := s.Dirs[dir]
+	if !ok {
+		d = &DirSummary{}
+		s.Dirs[dir] = d
+	}
+	switch n.Type() {
+	case FileCreate:
+		d.Creates++
+	case FileUpdate:
+		d.Updates++
+	case FileRemove:
+		d.Removes++
+	case FileRename:
+		d.Renames++
+	}
+	if info, ok := changedInfo(n); ok {
+		d.Bytes += info.Size()
+	}
+}
@@ -0,0 +1,57 @@
+package fsmonitor
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// WithAtomicSwaps makes the builtin "path" Watcher aware of directories updated by atomic symlink swaps, as
+// Kubernetes mounts ConfigMaps and Secrets: files are symlinks through "..data", itself a symlink flipped to a new
+// timestamped directory such as "..2024_01_01_00_00_00.123" on every update. Entries named starting with ".." are
+// not walked, symlinks leading through them are noticed by the file they resolve to, so a flip is noticed as one
+// FileUpdate per file swapped instead of creates and removes of timestamped directories, or nothing at all.
+func WithAtomicSwaps() Option {
+	return func(o *options) error {
+		o.swaps = true
+		return nil
+	}
+}
+
+// swapEntry reports whether file is an entry of the atomic swap itself, e.g. ..data or a timestamped directory.
+func swapEntry(file string) bool {
+	name := filepath.Base(file)
+	return len(name) > 2 && strings.HasPrefix(name, "..")
+}
+
+// swapTarget reports whether a symlink target leads through an entry of an atomic swap, e.g. ..data/config.yaml.
+func swapTarget(target string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(target), "/") {
+		if swapEntry(elem) {
+			return true
+		}
+	}
+	return false
+}
+
+// swapped returns the info of the file the symlink at file leads to if it leads through an atomic swap.
+func (s *pathScanner) swapped(file string, link *SymlinkInfo) *SymlinkInfo {
+	if !swapTarget(link.Target) {
+		return link
+	}
+	resolved, err := s.profile.stat(file)
+	if err != nil || resolved.IsDir() {
+		return link
+	}
+	return &SymlinkInfo{FileInfo: resolved, Target: link.Target}
+}
+
+// flipped reports whether the file a swapped symlink resolves to was replaced, e.g. by the same content.
+func flipped(oldinfo, info os.FileInfo) bool {
+	if _, ok := info.(*SymlinkInfo); !ok || !info.Mode().IsRegular() {
+		return false
+	}
+	oldID, ok1 := fileID(oldinfo)
+	newID, ok2 := fileID(info)
+	return ok1 && ok2 && oldID != newID
+}
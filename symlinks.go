@@ -0,0 +1,76 @@
+package fsmonitor
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WithFollowSymlinks makes the builtin "path" Watcher follow symlinks if follow is true, as find -L does:
+// linked files are noticed by the size and modification time of their targets, and linked directories are walked,
+// their files noticed under the path of the link. A link leading back to a directory it's found in is not followed,
+// so cycles are walked once. A link that can't be followed is noticed as a symlink, SymlinkBroken is sent when it's
+// created broken or breaks, and SymlinkInfo.Broken tells it. By default symlinks are not followed, as by filepath.Walk.
+func WithFollowSymlinks(follow bool) Option {
+	return func(o *options) error {
+		o.follow = follow
+		return nil
+	}
+}
+
+// followed returns the info of what the symlink at path points to when following symlinks, info otherwise,
+// or if it can't be followed or points to any of the parents, i.e. following it would walk in circles.
+func (p *Profile) followed(path string, info os.FileInfo, parents []string) os.FileInfo {
+	if !p.follow || info.Mode()&os.ModeSymlink == 0 {
+		return info
+	}
+	target, err := p.stat(path)
+	if err != nil {
+		return info
+	}
+	if target.IsDir() {
+		key := dirKey(path, target)
+		for _, parent := range parents {
+			if parent == key {
+				return info
+			}
+		}
+	}
+	return target
+}
+
+// parents returns the directories walked into once walking into the one at path, when following symlinks.
+func (p *Profile) parents(parents []string, path string, info os.FileInfo) []string {
+	if !p.follow || !info.IsDir() {
+		return parents
+	}
+	return append(append([]string(nil), parents...), dirKey(path, info))
+}
+
+// dirKey identifies the directory at path regardless of links leading to it, by device and inode where available.
+func dirKey(path string, info os.FileInfo) string {
+	if id, ok := fileID(info); ok {
+		return id
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
+
+// broken reports whether the symlink at path can't be followed, only told when following symlinks.
+func (p *Profile) broken(path string) bool {
+	if !p.follow {
+		return false
+	}
+	_, err := p.stat(path)
+	return err != nil
+}
+
+// breaks reports whether link was found broken, having been fine as oldinfo, or not there at all if nil.
+func breaks(oldinfo os.FileInfo, link *SymlinkInfo) bool {
+	if !link.Broken {
+		return false
+	}
+	oldlink, ok := oldinfo.(*SymlinkInfo)
+	return !ok || !oldlink.Broken
+}
@@ -0,0 +1,66 @@
+package fsmonitor
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// WithStatRate limits file system operations of the builtin "path" Watcher to perSecond, paced evenly, e.g. so
+// walks of an NFS or SMB mount are a steady background load on the filer instead of bursts tripping its alerts.
+// Every stat, directory listing and symlink read counts, the Watchers of every path given WithPaths share the limit.
+// Scans take at least the files walked divided by perSecond, the interval had better be longer.
+func WithStatRate(perSecond int) Option {
+	return func(o *options) error {
+		if perSecond <= 0 {
+			return fmt.Errorf("Stat rate must be positive")
+		}
+		o.statRate = newRateLimit(float64(perSecond))
+		return nil
+	}
+}
+
+// WithChecksumRate limits the bytes the builtin "path" Watcher reads per second digesting content, paced evenly,
+// i.e. secondary streams given WithStreams. The Watchers of every path given WithPaths share the limit.
+func WithChecksumRate(bytesPerSecond int64) Option {
+	return func(o *options) error {
+		if bytesPerSecond <= 0 {
+			return fmt.Errorf("Checksum rate must be positive")
+		}
+		o.sumRate = newRateLimit(float64(bytesPerSecond))
+		return nil
+	}
+}
+
+// rateLimit paces units, e.g. operations or bytes, to a rate per second without bursts. Nil doesn't limit.
+type rateLimit struct {
+	rate float64
+
+	mu sync.Mutex
+	/* when units taken so far are due */
+	next time.Time
+}
+
+func newRateLimit(rate float64) *rateLimit {
+	return &rateLimit{rate: rate}
+}
+
+// wait takes n units, sleeping until the units taken before are due.
+func (r *rateLimit) wait(n int64) {
+	if r == nil || n <= 0 {
+		return
+	}
+	r.mu.Lock()
+	now := time.Now()
+	if r.next.Before(now) {
+		/* idle time doesn't save up for a burst */
+		r.next = now
+	}
+	due := r.next
+	r.next = r.next.Add(time.Duration(float64(n) / r.rate * float64(time.Second)))
+	r.mu.Unlock()
+
+	if d := due.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,114 @@
+package fsmonitor
+
+import (
+	"context"
+	"fmt"
+)
+
+// Tracer traces scans and the notices they discover, e.g. by OpenTelemetry as package otel does, see WithTracer.
+type Tracer interface {
+	// StartScan is called as a scan starts, with the context of StartContext, returning the context of the scan,
+	// e.g. carrying its span, which the notices it discovers carry
+	StartScan(ctx context.Context) context.Context
+	// EndScan is called once the scan of ctx completed
+	EndScan(ctx context.Context, s ScanTrace)
+	// Inject returns the trace context of ctx as text, e.g. W3C "traceparent" and "tracestate", encoded with notices
+	Inject(ctx context.Context) map[string]string
+}
+
+// ScanTrace tells what a scan did, see Tracer.
+type ScanTrace struct {
+	// Number of the scan since Start, from 1
+	Scan uint64
+	// Notices discovered by the scan
+	Notices int
+	// Files and directories visited by the scan and files tracked since, told by a ScanCounter
+	Visited int
+	Tracked int
+	// Failure of the scan, nil if it succeeded
+	Err error
+}
+
+// TracedNotice is implemented by the notices discovered by scans of Monitors given WithTracer, and those decoded
+// from them, so consumers continue the trace of the scan, e.g. when forwarding them.
+type TracedNotice interface {
+	Notice
+	// Context of the scan discovering the notice, the background of decoded notices
+	Context() context.Context
+	// Trace context of the scan as text, see Tracer.Inject, encoded by MarshalNotice as "trace"
+	Trace() map[string]string
+}
+
+// WithTracer traces every scan by t, which the notices it discovers carry the context and trace of, see
+// TracedNotice. Notices of partial rescans between scans aren't traced.
+func WithTracer(t Tracer) Option {
+	return func(o *options) error {
+		if t == nil {
+			return fmt.Errorf("Tracer must not be nil")
+		}
+		o.tracer = t
+		return nil
+	}
+}
+
+// tracedNotice implements TracedNotice by wrapping a Notice.
+type tracedNotice struct {
+	Notice
+	ctx   context.Context
+	trace map[string]string
+}
+
+func (t *tracedNotice) Unwrap() Notice {
+	return t.Notice
+}
+
+func (t *tracedNotice) Context() context.Context {
+	return t.ctx
+}
+
+func (t *tracedNotice) Trace() map[string]string {
+	return t.trace
+}
+
+func (t *tracedNotice) MarshalJSON() ([]byte, error) {
+	return MarshalNotice(t)
+}
+
+// scanTrace traces a running scan, see WithTracer.
+type scanTrace struct {
+	ctx     context.Context
+	trace   map[string]string
+	scan    uint64
+	notices int
+}
+
+// startScan starts tracing scan number scan, nil without a Tracer.
+func (m *Monitor) startScan(ctx context.Context, scan uint64) *scanTrace {
+	if m.tracer == nil {
+		return nil
+	}
+	s := &scanTrace{ctx: m.tracer.StartScan(ctx), scan: scan}
+	s.trace = m.tracer.Inject(s.ctx)
+	return s
+}
+
+// traced returns n carrying the trace of s, n itself if s is nil.
+func (s *scanTrace) traced(n Notice) Notice {
+	if s == nil {
+		return n
+	}
+	s.notices++
+	return &tracedNotice{Notice: n, ctx: s.ctx, trace: s.trace}
+}
+
+// endScan ends tracing s, failed by err unless nil.
+func (m *Monitor) endScan(s *scanTrace, err error) {
+	if s == nil {
+		return
+	}
+	t := ScanTrace{Scan: s.scan, Notices: s.notices, Err: err}
+	if c, ok := m.watcher.(ScanCounter); ok {
+		t.Visited, t.Tracked = c.ScanCounts()
+	}
+	m.tracer.EndScan(s.ctx, t)
+}
@@ -0,0 +1,93 @@
+package fsmonitor_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/Fiery/fsmonitor"
+)
+
+type scanKey struct{}
+
+// scanTracer numbers scans by their context, recording those ended.
+type scanTracer struct {
+	mu     sync.Mutex
+	scans  uint64
+	traces []fsmonitor.ScanTrace
+}
+
+func (t *scanTracer) StartScan(ctx context.Context) context.Context {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scans++
+	return context.WithValue(ctx, scanKey{}, t.scans)
+}
+
+func (t *scanTracer) EndScan(ctx context.Context, s fsmonitor.ScanTrace) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.traces = append(t.traces, s)
+}
+
+func (t *scanTracer) Inject(ctx context.Context) map[string]string {
+	return map[string]string{"scan": fmt.Sprint(ctx.Value(scanKey{}))}
+}
+
+func TestTracerScans(t *testing.T) {
+	w, err := fsmonitor.FSWatcher(fstest.MapFS{"a.txt": {Data: []byte("a")}, "b.txt": {Data: []byte("b")}}, nil, fsmonitor.WithInitialScan(fsmonitor.EmitExisting))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := &scanTracer{}
+	m, err := fsmonitor.NewMonitor(fsmonitor.WithWatcher(w), fsmonitor.WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	go m.Start(10*time.Millisecond, fsmonitor.FileCreate)
+	defer m.Stop()
+
+	for i := 0; i < 2; i++ {
+		var n fsmonitor.Notice
+		select {
+		case n = <-m.Notices():
+		case <-time.After(5 * time.Second):
+			t.Fatal("No notice delivered")
+		}
+		var traced fsmonitor.TracedNotice
+		if !fsmonitor.NoticeAs(n, &traced) || traced.Context().Value(scanKey{}) != uint64(1) {
+			t.Fatalf("Notice %v isn't traced by the first scan", n)
+		}
+		data, err := fsmonitor.MarshalNotice(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, err := fsmonitor.UnmarshalNotice(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !fsmonitor.NoticeAs(d, &traced) || traced.Trace()["scan"] != "1" {
+			t.Fatalf("Trace of %v lost by encoding %s", n, data)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tracer.mu.Lock()
+		traces := append([]fsmonitor.ScanTrace(nil), tracer.traces...)
+		tracer.mu.Unlock()
+		if len(traces) > 0 {
+			if traces[0].Scan != 1 || traces[0].Notices < 2 || traces[0].Err != nil {
+				t.Fatalf("First scan traced as %+v", traces[0])
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("No scan ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,22 @@
+// +build !windows
+
+package fsmonitor
+
+import (
+	"path/filepath"
+)
+
+// canonicalAddress normalizes the representation of a watched path.
+func canonicalAddress(address string) string {
+	return filepath.Clean(address)
+}
+
+// resolveAddress maps a canonical path onto where it can currently be accessed.
+func resolveAddress(address string) (string, error) {
+	return address, nil
+}
+
+// samePath reports whether a and b are canonical spellings of the same path.
+func samePath(a, b string) bool {
+	return a == b
+}
@@ -0,0 +1,120 @@
+// +build windows
+
+package fsmonitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var procGetVolumePathNamesForVolumeNameW = syscall.NewLazyDLL("kernel32.dll").NewProc("GetVolumePathNamesForVolumeNameW")
+
+// canonicalAddress normalizes the representation of a watched path, so notices and state
+// don't depend on how it was spelled:
+// \\?\C:\dir and c:\dir become C:\dir, \\?\UNC\host\share becomes \\host\share, short 8.3 names of existing
+// files such as PROGRA~1 are expanded, volume GUID paths are kept as stable \\?\Volume{guid}\dir regardless of drive letter.
+func canonicalAddress(address string) string {
+	lower := strings.ToLower(address)
+	switch {
+	case strings.HasPrefix(lower, `\\?\volume{`):
+		if end := strings.IndexByte(address, '}'); end > 0 {
+			return `\\?\Volume{` + strings.ToLower(address[len(`\\?\volume{`):end]) + `}` + filepath.Clean(`\`+address[end+1:])
+		}
+	case strings.HasPrefix(lower, `\\?\unc\`):
+		address = `\\` + address[len(`\\?\unc\`):]
+	case strings.HasPrefix(lower, `\\?\`) && len(address) > 5 && address[5] == ':':
+		address = address[len(`\\?\`):]
+	}
+	address = filepath.Clean(address)
+	if len(address) > 1 && address[1] == ':' {
+		address = strings.ToUpper(address[:1]) + address[1:]
+	}
+	if strings.ContainsRune(address, '~') {
+		address = longPathName(address)
+	}
+	return address
+}
+
+// longPathName expands short 8.3 names in path, which is returned as is unless it exists.
+func longPathName(path string) string {
+	name, err := syscall.UTF16PtrFromString(extendedPath(path))
+	if err != nil {
+		return path
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		n, err := syscall.GetLongPathName(name, &buf[0], uint32(len(buf)))
+		if err != nil || n == 0 {
+			return path
+		}
+		if n <= uint32(len(buf)) {
+			/* spelled as given, without the prefix extending it */
+			long := syscall.UTF16ToString(buf[:n])
+			if strings.HasPrefix(long, `\\?\UNC\`) {
+				return `\\` + long[len(`\\?\UNC\`):]
+			}
+			return strings.TrimPrefix(long, `\\?\`)
+		}
+		buf = make([]uint16, n)
+	}
+}
+
+// extendedPath prefixes absolute paths by \\?\, \\?\UNC\ for shares, so they can be longer than MAX_PATH
+// regardless of how the OS handles long paths. Relative and prefixed paths are returned as is.
+func extendedPath(path string) string {
+	switch {
+	case strings.HasPrefix(path, `\\?\`):
+		return path
+	case strings.HasPrefix(path, `\\`):
+		return `\\?\UNC\` + path[len(`\\`):]
+	case len(path) > 2 && path[1] == ':' && path[2] == '\\':
+		return `\\?\` + path
+	}
+	return path
+}
+
+// samePath reports whether a and b are canonical spellings of the same path, case-insensitively.
+func samePath(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// resolveAddress maps a canonical volume GUID path onto where the volume is currently mounted,
+// falling back to the GUID path itself when the volume has no mount point. Absolute paths are extended,
+// so files deeper than MAX_PATH under them are accessible, on shares too.
+func resolveAddress(address string) (string, error) {
+	if !strings.HasPrefix(address, `\\?\Volume{`) {
+		return extendedPath(address), nil
+	}
+	end := strings.IndexByte(address, '}')
+	volume, rest := address[:end+1]+`\`, strings.TrimPrefix(address[end+1:], `\`)
+
+	name, err := syscall.UTF16PtrFromString(volume)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, syscall.MAX_PATH)
+	for {
+		var length uint32
+		r, _, e := procGetVolumePathNamesForVolumeNameW.Call(
+			uintptr(unsafe.Pointer(name)),
+			uintptr(unsafe.Pointer(&buf[0])),
+			uintptr(len(buf)),
+			uintptr(unsafe.Pointer(&length)))
+		if r != 0 {
+			break
+		}
+		if e != syscall.ERROR_MORE_DATA {
+			return "", fmt.Errorf("Failed to resolve volume %s: %v", volume, e)
+		}
+		buf = make([]uint16, length)
+	}
+
+	/* first of the null separated mount points, e.g. E:\ */
+	if mount := syscall.UTF16ToString(buf); mount != "" {
+		return extendedPath(filepath.Join(mount, rest)), nil
+	}
+	return address, nil
+}
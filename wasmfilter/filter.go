@@ -0,0 +1,167 @@
+// Package wasmfilter loads filter and enrichment logic for notices from WASM modules, run by the wazero runtime,
+// so custom per-site logic can be added without recompilation and without Go plugins.
+//
+// Modules exchange notices encoded by fsmonitor.MarshalNotice and must export:
+//
+//	alloc(size i32) i32            reserves size bytes of module memory for the input record
+//	filter(ptr i32, len i32) i64   decides on the record at ptr, returns 0 to drop the notice,
+//	                               or ptr<<32 | len of the record to send, which may be enriched
+//
+// and optionally free(ptr i32, len i32) to release buffers once read.
+// WASI is provided, e.g. for modules built by TinyGo or GOOS=wasip1 with -buildmode=c-shared.
+package wasmfilter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// Filter runs one WASM module on every notice, calls are serialized as module instances aren't reentrant.
+type Filter struct {
+	name    string
+	runtime wazero.Runtime
+	module  api.Module
+
+	alloc  api.Function
+	filter api.Function
+	free   api.Function
+
+	mu sync.Mutex
+}
+
+// Open loads the WASM module at path, see Load.
+func Open(ctx context.Context, path string) (*Filter, error) {
+	wasm, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(ctx, path, wasm)
+}
+
+// Load compiles and instantiates the WASM module, checking it exports the functions required.
+// Name identifies the module in errors and logs.
+func Load(ctx context.Context, name string, wasm []byte) (*Filter, error) {
+	r := wazero.NewRuntime(ctx)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("Filter %v failed to provide WASI: %v", name, err)
+	}
+
+	/* modules built as reactors initialize in _initialize instead of _start */
+	config := wazero.NewModuleConfig().WithName(name).WithStartFunctions("_initialize")
+	mod, err := r.InstantiateWithConfig(ctx, wasm, config)
+	if err != nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("Filter %v failed to instantiate: %v", name, err)
+	}
+
+	f := &Filter{
+		name:    name,
+		runtime: r,
+		module:  mod,
+		alloc:   mod.ExportedFunction("alloc"),
+		filter:  mod.ExportedFunction("filter"),
+		free:    mod.ExportedFunction("free"),
+	}
+	if f.alloc == nil || f.filter == nil || mod.Memory() == nil {
+		r.Close(ctx)
+		return nil, fmt.Errorf("Filter %v must export memory, alloc and filter", name)
+	}
+	return f, nil
+}
+
+// Name returns the name the Filter was loaded by.
+func (f *Filter) Name() string {
+	return f.name
+}
+
+// Apply passes n through the module, returning the notice to send or nil to drop it.
+// Notices are sent unchanged if the module fails, so faulty site logic can't lose changes.
+func (f *Filter) Apply(n fsmonitor.Notice) fsmonitor.Notice {
+	out, err := f.call(context.Background(), n)
+	if err != nil {
+		fsmonitor.Logger.Printf("Filter %v failed, notice sent unchanged: %v", f.name, err)
+		return n
+	}
+	return out
+}
+
+// call encodes n into module memory, runs filter and decodes the record returned.
+func (f *Filter) call(ctx context.Context, n fsmonitor.Notice) (fsmonitor.Notice, error) {
+	in, err := fsmonitor.MarshalNotice(n)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	res, err := f.alloc.Call(ctx, uint64(len(in)))
+	if err != nil {
+		return nil, err
+	}
+	ptr := uint32(res[0])
+	if !f.module.Memory().Write(ptr, in) {
+		return nil, fmt.Errorf("alloc returned %d bytes out of memory at %#x", len(in), ptr)
+	}
+
+	res, err = f.filter.Call(ctx, uint64(ptr), uint64(len(in)))
+	f.release(ctx, ptr, uint32(len(in)))
+	if err != nil {
+		return nil, err
+	}
+	if res[0] == 0 {
+		return nil, nil
+	}
+
+	outPtr, outLen := uint32(res[0]>>32), uint32(res[0])
+	view, ok := f.module.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("filter returned %d bytes out of memory at %#x", outLen, outPtr)
+	}
+	out := append([]byte(nil), view...)
+	if outPtr != ptr {
+		f.release(ctx, outPtr, outLen)
+	}
+
+	/* keep original notice, with types wrapping it, unless enriched */
+	if bytes.Equal(out, in) {
+		return n, nil
+	}
+	return fsmonitor.UnmarshalNotice(out)
+}
+
+// release frees a buffer if the module manages its memory by free.
+func (f *Filter) release(ctx context.Context, ptr, size uint32) {
+	if f.free != nil {
+		if _, err := f.free.Call(ctx, uint64(ptr), uint64(size)); err != nil {
+			fsmonitor.Logger.Printf("Filter %v failed to free buffer: %v", f.name, err)
+		}
+	}
+}
+
+// Close releases the module and its runtime.
+func (f *Filter) Close(ctx context.Context) error {
+	return f.runtime.Close(ctx)
+}
+
+// Chain applies filters in order, stopping at the first dropping the notice.
+// The result is meant for fsmonitor.Decorate, e.g. fsmonitor.Decorate(w, wasmfilter.Chain(filters...)).
+func Chain(filters ...*Filter) func(fsmonitor.Notice) fsmonitor.Notice {
+	return func(n fsmonitor.Notice) fsmonitor.Notice {
+		for _, f := range filters {
+			if n = f.Apply(n); n == nil {
+				return nil
+			}
+		}
+		return n
+	}
+}
@@ -1,11 +1,13 @@
 package fsmonitor
 
 import (
+	"fmt"
 	"time"
 
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
 // Watcher abstracts logics of discovering changes within the given file system.
@@ -20,18 +22,128 @@ type Watcher interface{
 }
 
 
+// Rescanner is implemented by Watchers able to re-check only part of the watched resource on demand.
+type Rescanner interface{
+	// Re-walks the sub-resource and reconciles it against the last check,
+	// sending discovered changes to the given Notice channel.
+	// Returns after the partial check is complete.
+	Rescan(subpath string, changed chan<- Notice) error
+}
+
 // pathScanner implements Watcher based on filepath.Walk.
 type pathScanner struct{
 	address string
 	pattern []regexp.Regexp
-	lastCheck map[string]os.FileInfo
+	lastCheck fileStates
+	/* opens stores lastCheck is kept in, see WithStateStore */
+	states func() (StateStore, error)
+	/* lastCheck restored and saved across restarts, see WithSnapshots */
+	snapshots SnapshotStore
+	profile Profile
+	/* workers reading directories, see WithScanConcurrency */
+	concurrency int
+
+	/* skipped paths, see WithExcludes and WithIgnoreFile */
+	exclude []regexp.Regexp
+	/* filters until swapped by UpdateConfig, kept until the next walk */
+	former *pathFilters
+	ignoreFile string
+	ignore []ignoreRule
+	/* checkouts are pruned as git does, see WithGitAware */
+	git *gitAware
+
+	/* skipped files, see WithMaxDepth, WithMaxFileSize and WithModifiedWithin */
+	maxDepth int
+	maxSize int64
+	modWithin time.Duration
+
+	/* scans are suspended while volume at mountpoint is unmounted */
+	mountpoint string
+	unmounted bool
+
+	/* changes sent as Pending by last scan, see WithConfirmation */
+	twoPhase bool
+	pending map[string]*fileSystemNotice
+
+	/* scans since files changed, FileSettled once unchanged across settle scans, see WithSettle */
+	settle int
+	unsettled map[string]int
+
+	/* notices held back while their files are locked, see WithLockWait */
+	locks bool
+	held map[string]*fileSystemNotice
+
+	/* changed paths are told by OS events instead of walking, see "native" in New */
+	native *nativeWatcher
+	/* files opened and read according to native events, see WithAccessEvents */
+	access *accessLog
+	/* walks reconciling what native events missed, see "hybrid" in New */
+	reconcile  time.Duration
+	reconciled time.Time
+
+	/* filters of the Monitor evaluated while scanning, see Pushdowner */
+	pushdown Pushdown
+
+	/* address is watched within the root of another process, see WithProcessRoot */
+	procRoot string
+
+	/* files found by the first scan are sent as created, and InitialScanDone follows it, see WithInitialScan */
+	initial InitialScan
+	scanDone bool
+	/* lastCheck was restored from a snapshot instead of baselined, see WithSnapshots */
+	resumed bool
 
+	/* secondary streams are diffed, see WithStreams */
+	streams bool
+	/* directories are diffed too, see WithDirEvents */
+	dirs bool
+	/* symlinks through atomic swaps are resolved, see WithAtomicSwaps */
+	swaps bool
+
+	/* shards scanned by this process, see WithShards */
+	shards Coordinator
+	owned map[string]bool
+	decided map[string]bool
+
+	/* subtrees walked on schedules of their own, and those of the last walk, see WithSubtreeScans */
+	subtrees *subtrees
+	planned *subtreePlan
+
+	/* files tracked are totalled and checked against quotas, see WithDiskUsage */
+	usage *diskUsage
+
+	/* entries visited by walks, and counts of the last scan, see ScanCounter */
+	walked int
+	counts [2]int
+	/* scans so far, told by log records */
+	scans uint64
+
+	/* name of the builtin Watcher, see Labels */
+	kind string
+	logger logSink
+
+	/* partial rescans and previews are serialized with regular scans in the Watch() goroutine */
+	calls chan func()
+	quit chan struct{}
+}
+
+// Previewer is implemented by Watchers able to check for changes without updating their state.
+type Previewer interface{
+	// Returns notices the next check would send, doesn't send them.
+	Preview() ([]Notice, error)
+}
+
+// rescanRequest carries a partial rescan to Monitor.
+type rescanRequest struct{
+	subpath string
+	done chan error
 }
 
 // Watch traverses the given directory and sub-directories and sends changes since last check.
 // Note: no need to use mutex is because the design is to 
 // run Watch() every time.Tick duration AFTER every execution of Watch()
 // means Watch() must finishes in order to trigger next time.Tick()
+// Partial rescans are handled by the same goroutine in between regular scans.
 func (s *pathScanner) Watch() (chan<- chan<- Notice, <-chan error) {
 
 	/* nested channel to coordinate Monitor and Watcher during termination
@@ -43,6 +155,9 @@ func (s *pathScanner) Watch() (chan<- chan<- Notice, <-chan error) {
 	ncc := make(chan chan<- Notice)
 	errors := make(chan error)
 
+	s.calls = make(chan func())
+	s.quit = make(chan struct{})
+
 	/* Will return when ncc is closed by Monitor, and every scan is guaranteed to be complete scan
 	 * as filepath.Walk is blocking operation, and close of Notice channel depends on 
 	 * close of error channel from this goroutine. Monitor will choose to ignore notices
@@ -53,76 +168,82 @@ func (s *pathScanner) Watch() (chan<- chan<- Notice, <-chan error) {
 	go func(ncc <-chan chan<- Notice, errors chan<- error){
 		/* close here so to release termination handling in Watch() */
 		defer close(errors)
+		/* release pending Rescan() and Preview() calls */
+		defer close(s.quit)
 
-		for changed:= range ncc{
-			Logger.Printf("Scanning kicked off!")
-			visited := make(map[string]os.FileInfo)
-			created := 0
+		if s.native != nil {
+			/* closing interrupts read, which returns before the Watcher goroutine does */
+			read := make(chan struct{})
+			go func() {
+				defer close(read)
+				s.native.read()
+			}()
+			defer func() {
+				s.native.close()
+				<-read
+			}()
+		}
 
-			err := filepath.Walk(s.address, func(file string, info os.FileInfo, err error) error {
-				if info.IsDir() {
-					return err
+		for {
+			select {
+			case changed, ok := <-ncc:
+				if !ok {
+					return
+				}
+				if !s.mounted(changed) {
+					s.logger.warn("Scanning suspended, volume is unmounted", "mountpoint", s.mountpoint)
+					errors <- nil
+					continue
 				}
 
-				matched := false || len(s.pattern) == 0
-				for _, re := range s.pattern {
-					if re.FindStringIndex(file) != nil {
-						matched = true
-						break
+				if s.shards != nil {
+					if err := s.shards.Refresh(); err != nil {
+						errors <- scanError(s.address, err)
+						continue
 					}
 				}
-				if !matched {
-					return err
-				}
 
-				if oldinfo, ok := s.lastCheck[file]; ok {
-					if info.ModTime().After(oldinfo.ModTime()) {
-						changed <- &fileSystemNotice{
-							path:      file,
-							fileinfo:  info,
-							timestamp: time.Now(),
-							event:     FileUpdate,
-						}
-					} else if oldinfo.Size() != info.Size() {
-						changed <- &fileSystemNotice{
-							path:      file,
-							fileinfo:  info,
-							timestamp: time.Now(),
-							event:     FileUpdate,
+				s.scans++
+				s.logger.debug("Scanning kicked off", "scan", s.scans)
+
+				/* changes pending since previous scan are confirmed unless changed again */
+				previous := s.pending
+				s.pending = nil
+
+				initial := s.lastCheck == nil
+				err := s.scan(s.sender(changed))
+				s.confirm(previous, changed)
+				s.settled(changed)
+				if s.locks {
+					s.released(s.sender(changed))
+				}
+				if s.access != nil {
+					s.accessed(func(n *fileSystemNotice) {
+						n.labels = s.labels(n.path)
+						if s.pushdown.matches(n) {
+							changed <- n
 						}
-					}
-				} else if s.lastCheck != nil {
+					})
+				}
+				if s.usage != nil && err == nil {
+					s.measure(changed)
+				}
 
+				if initial && s.lastCheck != nil && s.scanDone && !s.resumed {
 					changed <- &fileSystemNotice{
-						path:      file,
-						fileinfo:  info,
+						path:      s.address,
 						timestamp: time.Now(),
-						event:     FileCreate,
+						event:     InitialScanDone,
+						labels:    s.labels(s.address),
 					}
-					created += 1
 				}
-				visited[file] = info
 
-				return err
-			})
-			if s.lastCheck != nil && len(s.lastCheck) > (len(visited)-created) {
-				for file, info := range s.lastCheck {
-					if _, ok := visited[file]; !ok {
-						changed <- &fileSystemNotice{
-							path:      file,
-							fileinfo:  info,
-							timestamp: time.Now(),
-							event:     FileRemove,
-						}
-					}
-				}
-			}
-
-			s.lastCheck = visited
-
-			Logger.Printf("Scanning finalized!")
+				s.logger.debug("Scanning finalized", "scan", s.scans)
 
-			errors <- err
+				errors <- scanError(s.address, err)
+			case call := <-s.calls:
+				call()
+			}
 		}
 	/* all passed channels will be implicitly converted to desired one */
 	}(ncc, errors)
@@ -130,6 +251,528 @@ func (s *pathScanner) Watch() (chan<- chan<- Notice, <-chan error) {
 	return ncc, errors
 }
 
+// Rescan re-walks the given sub-directory only, relative to the watched address unless absolute.
+func (s *pathScanner) Rescan(subpath string, changed chan<- Notice) error {
+	if s.calls == nil {
+		return fmt.Errorf("Scanner is not watching %s yet", s.address)
+	}
+	done := make(chan error, 1)
+	select {
+	case s.calls <- func() { done <- s.rescan(subpath, changed) }:
+		return <-done
+	case <-s.quit:
+		return fmt.Errorf("Scanner has stopped watching %s", s.address)
+	}
+}
+
+// Preview walks the watched directory and returns changes since last check, leaving lastCheck as is.
+func (s *pathScanner) Preview() (notices []Notice, err error) {
+	s.serialized(func() {
+		notices, err = s.preview()
+	})
+	return
+}
+
+// serialized runs fn in between scans of the Watch() goroutine, or in place when not watching.
+func (s *pathScanner) serialized(fn func()) {
+	if s.calls != nil {
+		done := make(chan struct{})
+		select {
+		case s.calls <- func() { fn(); close(done) }:
+			<-done
+			return
+		case <-s.quit:
+			/* stopped, nothing else touches the state */
+		}
+	}
+	fn()
+}
+
+// preview collects notices of a walk, must not run concurrently with scans.
+func (s *pathScanner) preview() ([]Notice, error) {
+	if s.mountpoint != "" {
+		if ok, _ := mounted(s.mountpoint); !ok {
+			return nil, fmt.Errorf("Volume at %s is unmounted", s.mountpoint)
+		}
+	}
+
+	var notices []Notice
+	visited, err := s.walk(s.address, func(n *fileSystemNotice) {
+		notices = append(notices, n)
+	})
+	if visited != nil {
+		visited.close()
+	}
+	return notices, err
+}
+
+// mounted checks the volume at mountpoint if any, sending notices when it's mounted or unmounted.
+// State is kept while unmounted, so the first scan after mounting reports changes made elsewhere.
+func (s *pathScanner) mounted(changed chan<- Notice) bool {
+	if s.mountpoint == "" {
+		return true
+	}
+	ok, err := mounted(s.mountpoint)
+	if err != nil {
+		/* let the scan surface the error */
+		return true
+	}
+	if ok == s.unmounted {
+		s.unmounted = !ok
+		event := VolumeMounted
+		if s.unmounted {
+			event = VolumeUnmounted
+		}
+		info, _ := os.Stat(s.mountpoint)
+		changed <- &fileSystemNotice{
+			path:      s.mountpoint,
+			fileinfo:  info,
+			timestamp: time.Now(),
+			event:     event,
+		}
+	}
+	return ok
+}
+
+// sender sends notices to changed, recording them as pending in two-phase mode.
+func (s *pathScanner) sender(changed chan<- Notice) func(*fileSystemNotice) {
+	return func(n *fileSystemNotice) {
+		n.labels = s.labels(n.path)
+		if s.locks && s.hold(n, changed) {
+			return
+		}
+		if s.settle > 0 {
+			s.unsettle(n)
+		}
+		if s.twoPhase {
+			n.phase = Pending
+			if s.pending == nil {
+				s.pending = make(map[string]*fileSystemNotice)
+			}
+			s.pending[n.path] = n
+		}
+		if !s.pushdown.matches(n) {
+			return
+		}
+		changed <- s.git.enriched(n)
+	}
+}
+
+// confirm sends Confirmed notices for previous pending changes not changed again by the latest scan.
+func (s *pathScanner) confirm(previous map[string]*fileSystemNotice, changed chan<- Notice) {
+	for file, n := range previous {
+		if _, again := s.pending[file]; again {
+			continue
+		}
+		confirmed := *n
+		confirmed.phase = Confirmed
+		confirmed.timestamp = time.Now()
+		if info, ok := s.tracked(file); ok {
+			confirmed.fileinfo = info
+		}
+		changed <- &confirmed
+	}
+}
+
+// scan walks the watched address, or re-checks only paths changed according to native events once baselined.
+func (s *pathScanner) scan(emit func(*fileSystemNotice)) error {
+	s.walked = 0
+	defer func() {
+		s.counts = [2]int{s.walked, 0}
+		if s.lastCheck != nil {
+			s.counts[1] = s.lastCheck.len()
+		}
+	}()
+
+	/* state saved by a previous process is diffed against, but native events were not watched meanwhile */
+	restored := s.lastCheck == nil && s.restore()
+	if restored {
+		s.resumed = true
+	}
+	if s.snapshots != nil {
+		changed := s.lastCheck == nil || restored
+		next := emit
+		emit = func(n *fileSystemNotice) {
+			changed = true
+			next(n)
+		}
+		defer func() {
+			if changed {
+				s.persist()
+			}
+		}()
+	}
+
+	if s.native != nil && !s.native.polling() {
+		paths, overflow := s.native.drain()
+		due := s.reconcile > 0 && time.Since(s.reconciled) >= s.reconcile
+		if s.lastCheck != nil && !restored && !overflow && !due && s.former == nil {
+			return s.changes(paths, emit)
+		}
+		if overflow {
+			s.logger.warn("Native events were lost, walking again", "scan", s.scans)
+		}
+		if s.lastCheck != nil && !restored {
+			/* changes found by the walk were missed by native events */
+			missed := 0
+			next := emit
+			emit = func(n *fileSystemNotice) {
+				missed++
+				next(n)
+			}
+			defer func() {
+				if missed > 0 {
+					s.logger.warn("Reconciliation found changes missed by native events", "scan", s.scans, "missed", missed)
+				}
+			}()
+		}
+		s.reconciled = time.Now()
+	}
+
+	s.planned = nil
+	visited, err := s.walk(s.address, emit)
+	s.replace(visited)
+	s.former = nil
+	if s.shards != nil {
+		s.owned = s.decided
+	}
+	if s.planned != nil {
+		s.subtrees.commit(s.planned, time.Now())
+		if len(s.planned.deferred) > 0 {
+			s.logger.debug("Subtrees deferred", "scan", s.scans, "deferred", len(s.planned.deferred))
+		}
+	}
+	return err
+}
+
+// rescan reconciles the subtree against lastCheck, must be called from the Watch() goroutine.
+func (s *pathScanner) rescan(subpath string, changed chan<- Notice) error {
+	root := subpath
+	if !filepath.IsAbs(root) {
+		root = filepath.Join(s.address, root)
+	}
+	root = canonicalAddress(root)
+	if !within(root, s.address) {
+		return fmt.Errorf("Path %s is outside of watched address %s", subpath, s.address)
+	}
+
+	if s.unmounted {
+		return fmt.Errorf("Volume at %s is unmounted", s.mountpoint)
+	}
+
+	/* nothing to reconcile against until the first regular scan baselines the state */
+	if s.lastCheck == nil {
+		return nil
+	}
+
+	s.logger.debug("Rescanning kicked off", "path", root)
+	visited, err := s.walk(root, s.sender(changed))
+	s.merge(root, visited)
+	s.persist()
+	s.logger.debug("Rescanning finalized", "path", root)
+
+	return err
+}
+
+// merge replaces the part of lastCheck under root by files visited by a partial walk.
+func (s *pathScanner) merge(root string, visited fileStates) {
+	var gone []string
+	s.lastCheck.each(func(file string, _ os.FileInfo) {
+		if within(file, root) && !visited.has(file) {
+			gone = append(gone, file)
+		}
+	})
+	for _, file := range gone {
+		s.lastCheck.remove(file)
+	}
+	visited.each(s.lastCheck.put)
+	visited.close()
+	for shard, owned := range s.decided {
+		s.owned[shard] = owned
+	}
+}
+
+// walk traverses root and emits changes against the part of lastCheck under root.
+// Returns the files visited under root, keyed by canonical path.
+func (s *pathScanner) walk(root string, emit func(*fileSystemNotice)) (fileStates, error) {
+	/* canonical root may be accessible under different path, e.g. volume GUID mounted on a drive letter */
+	resolved, err := s.resolve(root)
+	if err != nil {
+		/* keep state untouched until root can be accessed again */
+		if s.lastCheck == nil {
+			return nil, err
+		}
+		visited := s.newStates()
+		s.lastCheck.each(func(file string, info os.FileInfo) {
+			if within(file, root) {
+				visited.put(file, info)
+			}
+		})
+		return visited, err
+	}
+	visited := s.newStates()
+
+	s.planned = nil
+	if root == s.address {
+		s.loadIgnore()
+		if s.git != nil {
+			s.git.reset()
+		}
+		/* the whole tree is walked until baselined */
+		if s.subtrees != nil {
+			if s.lastCheck == nil {
+				s.planned = &subtreePlan{deferred: make(map[string]bool)}
+			} else {
+				s.planned = s.subtrees.plan(time.Now())
+			}
+		}
+	}
+	plan := s.planned
+
+	/* creates and removes of the same file are sent as renames once walked */
+	r := newRenames(s.pushdown.Events, emit)
+	emit = r.send
+	defer r.flush()
+
+	owns := s.ownership()
+	cutoff := time.Now().Add(-s.modWithin)
+	/* tracked files no longer watched by their size or age */
+	skipped := make(map[string]bool)
+	walk := s.profile.walk
+	if s.concurrency > 1 {
+		walk = func(root string, fn filepath.WalkFunc) error {
+			return s.profile.walkParallel(root, s.concurrency, fn)
+		}
+	}
+	err = walk(resolved, func(file string, info os.FileInfo, err error) error {
+		if info == nil {
+			return err
+		}
+		s.walked++
+		if info.Mode()&os.ModeSymlink != 0 {
+			if target, err := s.profile.readlink(file); err == nil {
+				link := &SymlinkInfo{FileInfo: info, Target: target, Broken: s.profile.broken(file)}
+				if s.swaps {
+					link = s.swapped(file, link)
+				}
+				info = link
+			}
+		} else if s.streams && info.Mode().IsRegular() {
+			if sums, err := s.profile.streams(file); err == nil && len(sums) > 0 {
+				info = &StreamInfo{FileInfo: info, Streams: sums}
+			}
+		}
+		path := file
+		if resolved != root {
+			file = root + file[len(resolved):]
+		}
+
+		if s.swaps && file != root && swapEntry(file) {
+			/* swapped through the symlinks leading to them */
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		owned, joined := owns(file)
+		if !owned {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() && file != root && !s.pushdown.walks(file) {
+			return filepath.SkipDir
+		}
+		if excluded, _ := s.excluded(file, info.IsDir()); excluded {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if file != root && s.beyond(file) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if plan != nil && info.IsDir() && file != root && filepath.Dir(file) == root {
+			/* deferred subtrees keep their state until due */
+			if name := filepath.Base(file); !plan.walks(name) {
+				plan.deferred[name] = true
+				return filepath.SkipDir
+			}
+			plan.visited = append(plan.visited, filepath.Base(file))
+		}
+		/* entries of directories at max depth would be beyond it */
+		leaf := info.IsDir() && s.maxDepth > 0 && s.depth(file) >= s.maxDepth
+		if s.native != nil && info.IsDir() && !leaf {
+			if err := s.native.add(path); err != nil {
+				s.logger.warn("Failed to watch for native events", "path", file, "error", err)
+			}
+		}
+		if info.IsDir() {
+			if s.dirs && file != s.address {
+				s.walkedDir(file, info, joined, emit)
+				visited.put(file, info)
+			}
+			if leaf {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !s.matches(file) || !strings.HasPrefix(file, s.pushdown.Prefix) {
+			return err
+		}
+		if s.limited(info, cutoff) != "" {
+			if _, ok := s.tracked(file); ok {
+				skipped[file] = true
+			}
+			return err
+		}
+
+		if joined {
+			/* taken over from another process, baseline without notices */
+		} else if _, ok := s.tracked(file); !ok && s.former != nil && !s.former.watched(file, s.address) {
+			/* watched since UpdateConfig, baseline without notices */
+		} else if oldinfo, ok := s.tracked(file); ok {
+			if link := retargeted(oldinfo, info); link != nil {
+				emit(&fileSystemNotice{
+					path:      file,
+					fileinfo:  link,
+					timestamp: time.Now(),
+					event:     SymlinkRetargeted,
+				})
+			} else if s.profile.changed(oldinfo, info) || s.swaps && flipped(oldinfo, info) {
+				emit(&fileSystemNotice{
+					path:      file,
+					fileinfo:  info,
+					timestamp: time.Now(),
+					event:     FileUpdate,
+				})
+			}
+			if ainfo := attribChanged(oldinfo, info); ainfo != nil {
+				emit(&fileSystemNotice{
+					path:      file,
+					fileinfo:  ainfo,
+					timestamp: time.Now(),
+					event:     FileAttrib,
+				})
+			}
+			if sinfo := streamsChanged(oldinfo, info); s.streams && sinfo != nil {
+				emit(&fileSystemNotice{
+					path:      file,
+					fileinfo:  sinfo,
+					timestamp: time.Now(),
+					event:     StreamChanged,
+				})
+			}
+		} else if s.lastCheck != nil || s.initial == EmitExisting {
+
+			emit(&fileSystemNotice{
+				path:      file,
+				fileinfo:  info,
+				timestamp: time.Now(),
+				event:     FileCreate,
+			})
+		}
+		if link, ok := info.(*SymlinkInfo); ok && !joined && s.lastCheck != nil {
+			if oldinfo, _ := s.tracked(file); breaks(oldinfo, link) {
+				emit(&fileSystemNotice{
+					path:      file,
+					fileinfo:  link,
+					timestamp: time.Now(),
+					event:     SymlinkBroken,
+				})
+			}
+		}
+		visited.put(file, info)
+
+		return err
+	})
+	if s.lastCheck == nil {
+		return visited, err
+	}
+	s.lastCheck.each(func(file string, info os.FileInfo) {
+		if !visited.has(file) && within(file, root) {
+			if plan != nil && plan.deferred[s.shard(file)] {
+				visited.put(file, info)
+				return
+			}
+			if owned, _ := owns(file); !owned {
+				/* handed over to another process */
+				return
+			}
+			excluded, _ := s.excludedPath(file)
+			if !excluded && info.IsDir() {
+				excluded, _ = s.excluded(file, true)
+			}
+			if excluded || skipped[file] || s.beyond(file) || !info.IsDir() && !s.matches(file) {
+				/* no longer watched */
+				return
+			}
+			if !s.profile.removed(resolved + strings.TrimPrefix(file, root)) {
+				/* still there, keep tracking it */
+				visited.put(file, info)
+				return
+			}
+			event := FileRemove
+			if info.IsDir() {
+				event = DirRemove
+			}
+			emit(&fileSystemNotice{
+				path:      file,
+				fileinfo:  info,
+				timestamp: time.Now(),
+				event:     event,
+			})
+		}
+	})
+
+	return visited, err
+}
+
+// SymlinkInfo is the os.FileInfo of symlinks found by the builtin "path" Watcher, returned by Notice.More.
+type SymlinkInfo struct {
+	os.FileInfo
+	Target string
+	// Target before a SymlinkRetargeted notice
+	Previous string
+	// Target can't be followed, only told by WithFollowSymlinks(true)
+	Broken bool
+}
+
+// retargeted returns info with the previous target if both infos are of symlinks pointing somewhere else.
+func retargeted(oldinfo, info os.FileInfo) *SymlinkInfo {
+	oldlink, ok1 := oldinfo.(*SymlinkInfo)
+	link, ok2 := info.(*SymlinkInfo)
+	if !ok1 || !ok2 || oldlink.Target == link.Target {
+		return nil
+	}
+	return &SymlinkInfo{FileInfo: link.FileInfo, Target: link.Target, Previous: oldlink.Target, Broken: link.Broken}
+}
+
+// matches reports whether file matches any of the patterns, all files match without patterns.
+func (s *pathScanner) matches(file string) bool {
+	matched := false || len(s.pattern) == 0
+	for _, re := range s.pattern {
+		if re.FindStringIndex(file) != nil {
+			matched = true
+			break
+		}
+	}
+	return matched
+}
+
+// within reports whether path is root itself or located under root.
+func within(path, root string) bool {
+	/* relative paths walked from current directory have no prefix */
+	if root == "." {
+		return !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+	}
+	return path == root || strings.HasPrefix(path, strings.TrimSuffix(root, string(filepath.Separator))+string(filepath.Separator))
+}
+
 // fileScanner implements Watcher by loading in a specifically formatted text as virtual file system.
 type fileScanner struct{
 	address string
@@ -142,3 +785,127 @@ type fileScanner struct{
 func (s *fileScanner) Watch() (ncc chan<- chan<- Notice, errors <-chan error) {
 	return
 }
+
+// Decorate wraps a Watcher so every Notice it discovers is passed through fn before reaching Monitor.
+// Returning nil from fn drops the Notice. Rescanner is supported if the wrapped Watcher supports it.
+func Decorate(w Watcher, fn func(Notice) Notice) Watcher {
+	return &decoratedWatcher{watcher: w, decorate: fn}
+}
+
+// decoratedWatcher implements Watcher by relaying the protocol of the wrapped Watcher.
+type decoratedWatcher struct{
+	watcher Watcher
+	decorate func(Notice) Notice
+	/* optionally sends further notices derived from every decorated one, not applied to previews */
+	derive func(Notice) []Notice
+	/* optionally sends further notices once every scan is relayed */
+	scanned func() []Notice
+}
+
+// send sends the decorated Notice followed by notices derived from it.
+func (d *decoratedWatcher) send(n Notice, changed chan<- Notice) {
+	if n = d.decorate(n); n == nil {
+		return
+	}
+	changed <- n
+	if d.derive != nil {
+		for _, dn := range d.derive(n) {
+			changed <- dn
+		}
+	}
+}
+
+// Watch hands a relay channel to the wrapped Watcher for every notice channel sent by Monitor.
+// The wrapped Watcher sends all notices of a scan before its error, so relaying stops on the error.
+func (d *decoratedWatcher) Watch() (chan<- chan<- Notice, <-chan error) {
+	ncc := make(chan chan<- Notice)
+	errors := make(chan error)
+
+	inner, innerErrors := d.watcher.Watch()
+
+	go func(ncc <-chan chan<- Notice, errors chan<- error){
+		defer close(errors)
+
+		for changed := range ncc {
+			relay := make(chan Notice)
+			inner <- relay
+
+			err, ok := d.relay(relay, changed, innerErrors)
+			if !ok {
+				return
+			}
+			if d.scanned != nil {
+				for _, n := range d.scanned() {
+					changed <- n
+				}
+			}
+			errors <- err
+		}
+		/* propagate termination and wait for the wrapped Watcher to return */
+		close(inner)
+		for range innerErrors {
+		}
+	}(ncc, errors)
+
+	return ncc, errors
+}
+
+// relay forwards decorated notices until the wrapped Watcher reports the end of scan.
+func (d *decoratedWatcher) relay(relay <-chan Notice, changed chan<- Notice, innerErrors <-chan error) (error, bool) {
+	for {
+		select {
+		case n := <-relay:
+			d.send(n, changed)
+		case err, ok := <-innerErrors:
+			return err, ok
+		}
+	}
+}
+
+// Preview decorates notices previewed by the wrapped Watcher.
+func (d *decoratedWatcher) Preview() ([]Notice, error) {
+	p, ok := d.watcher.(Previewer)
+	if !ok {
+		return nil, fmt.Errorf("Watcher %T doesn't support preview", d.watcher)
+	}
+
+	notices, err := p.Preview()
+	decorated := notices[:0]
+	for _, n := range notices {
+		if n = d.decorate(n); n != nil {
+			decorated = append(decorated, n)
+		}
+	}
+	return decorated, err
+}
+
+// Explain relays to the wrapped Watcher, decorating doesn't change which paths are noticed.
+func (d *decoratedWatcher) Explain(path string) *Explanation {
+	e, ok := d.watcher.(Explainer)
+	if !ok {
+		return &Explanation{Path: path, Reasons: []string{fmt.Sprintf("Watcher %T doesn't support explaining", d.watcher)}}
+	}
+	return e.Explain(path)
+}
+
+// Rescan relays a partial rescan of the wrapped Watcher.
+func (d *decoratedWatcher) Rescan(subpath string, changed chan<- Notice) error {
+	rs, ok := d.watcher.(Rescanner)
+	if !ok {
+		return fmt.Errorf("Watcher %T doesn't support partial rescan", d.watcher)
+	}
+
+	relay := make(chan Notice)
+	done := make(chan error, 1)
+	go func() {
+		done <- rs.Rescan(subpath, relay)
+	}()
+	for {
+		select {
+		case n := <-relay:
+			d.send(n, changed)
+		case err := <-done:
+			return err
+		}
+	}
+}
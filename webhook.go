@@ -0,0 +1,246 @@
+package fsmonitor
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Webhook configures a Sink POSTing notices to an HTTP endpoint, only URL is required, see WebhookSink.
+type Webhook struct {
+	URL string
+	// Signs bodies by HMAC-SHA256, sent hex encoded as "X-Fsmonitor-Signature: sha256=<digest>" without it unsigned
+	Secret string
+	// Notices per request, 1 by default: more POST a JSON array of the notices queued, up to Batch
+	Batch int
+	// Notices queued for sending, 1000 by default, Publish fails once full
+	Queue int
+	// Attempts to resend a request after failing, 5 by default
+	Retries int
+	// Delay before the first retry, doubled for every further one, 1 second by default
+	Backoff time.Duration
+	// Timeout of a request, 10 seconds by default, unless Client is given
+	Timeout time.Duration
+	Client  *http.Client
+	// Further headers of requests, e.g. Authorization
+	Header http.Header
+	Logger *log.Logger
+	// Writes structured records instead of Logger, see WithFieldLogger
+	FieldLogger FieldLogger
+}
+
+// webhookSink implements Sink by POSTing from a queue.
+type webhookSink struct {
+	Webhook
+	*sendQueue
+}
+
+// WebhookSink returns a Sink POSTing every notice, encoded by MarshalNotice, as JSON body to w.URL, e.g. to notify
+// a service when files change without a message broker. Notices are queued and sent by a goroutine of the Sink in
+// order. Requests failing by network errors, timeouts, 408, 429 or 5xx responses are retried with exponential
+// backoff, others are dropped and logged, as is what still fails after all retries. A single notice identified by
+// WithIDs is sent with its ID in an "X-Fsmonitor-Id" header, for the service to deduplicate retries by.
+// Close sends what is queued before returning.
+func WebhookSink(w Webhook) (Sink, error) {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return nil, fmt.Errorf("Webhook URL %q is malformed: %v", w.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Webhook URL %q must be of http or https scheme", w.URL)
+	}
+	if w.Batch <= 0 {
+		w.Batch = 1
+	}
+	if w.Queue <= 0 {
+		w.Queue = notice_buffer_length
+	}
+	if w.Retries <= 0 {
+		w.Retries = 5
+	}
+	if w.Backoff <= 0 {
+		w.Backoff = time.Second
+	}
+	if w.Timeout <= 0 {
+		w.Timeout = 10 * time.Second
+	}
+	if w.Client == nil {
+		w.Client = &http.Client{Timeout: w.Timeout}
+	}
+
+	s := &webhookSink{Webhook: w}
+	s.sendQueue = newSendQueue("Webhook", w.Queue, w.Batch, func(batch []Notice) {
+		if err := s.post(batch); err != nil {
+			s.logger().error("Webhook failed, notices dropped", "url", s.URL, "dropped", len(batch), "error", err)
+		}
+	})
+	return s, nil
+}
+
+// sendQueue queues notices published to a Sink for a goroutine sending them in order, e.g. by HTTP requests.
+type sendQueue struct {
+	/* name of the sink in errors */
+	name  string
+	batch int
+	send  func([]Notice)
+	queue chan Notice
+	done  chan struct{}
+
+	/* guards publishing against closing */
+	mu     sync.Mutex
+	closed bool
+}
+
+// newSendQueue starts sending batches of up to batch notices queued, by send.
+func newSendQueue(name string, size, batch int, send func([]Notice)) *sendQueue {
+	q := &sendQueue{name: name, batch: batch, send: send, queue: make(chan Notice, size), done: make(chan struct{})}
+	go q.run()
+	return q
+}
+
+// Publish queues n, failing if the queue is full.
+func (q *sendQueue) Publish(n Notice) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("%s sink is closed", q.name)
+	}
+	select {
+	case q.queue <- n:
+		return nil
+	default:
+		return fmt.Errorf("%s queue is full, %d notices waiting", q.name, cap(q.queue))
+	}
+}
+
+// Close waits for queued notices to be sent.
+func (q *sendQueue) Close() error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.mu.Unlock()
+	<-q.done
+	return nil
+}
+
+// run sends queued notices, batching those waiting already, until the queue closes.
+func (q *sendQueue) run() {
+	defer close(q.done)
+	for n := range q.queue {
+		batch := []Notice{n}
+	collect:
+		for len(batch) < q.batch {
+			select {
+			case n, ok := <-q.queue:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, n)
+			default:
+				break collect
+			}
+		}
+		q.send(batch)
+	}
+}
+
+// retried calls try until it succeeds, fails for good or after retries, pausing backoff doubled every time.
+// failed is told of every failure retried.
+func retried(retries int, backoff time.Duration, try func() (bool, error), failed func(retry time.Duration, err error)) error {
+	for attempt := 0; ; attempt++ {
+		retry, err := try()
+		if err == nil || !retry || attempt == retries {
+			return err
+		}
+		failed(backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends batch, retrying with backoff.
+func (s *webhookSink) post(batch []Notice) error {
+	body, err := s.body(batch)
+	if err != nil {
+		return err
+	}
+	return retried(s.Retries, s.Backoff, func() (bool, error) {
+		return s.request(batch, body)
+	}, func(retry time.Duration, err error) {
+		s.logger().warn("Webhook failed, retrying", "url", s.URL, "retry", retry, "error", err)
+	})
+}
+
+// body encodes batch, as an array unless batching one notice at a time.
+func (s *webhookSink) body(batch []Notice) ([]byte, error) {
+	var b bytes.Buffer
+	if s.Batch > 1 {
+		b.WriteByte('[')
+	}
+	for i, n := range batch {
+		data, err := MarshalNotice(n)
+		if err != nil {
+			return nil, fmt.Errorf("Notice %v failed encoding: %v", n, err)
+		}
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.Write(data)
+	}
+	if s.Batch > 1 {
+		b.WriteByte(']')
+	}
+	return b.Bytes(), nil
+}
+
+// request POSTs body once, reporting whether a failure is worth retrying.
+func (s *webhookSink) request(batch []Notice, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range s.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Fsmonitor-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	var i IdentifiedNotice
+	if len(batch) == 1 && NoticeAs(batch[0], &i) {
+		req.Header.Set("X-Fsmonitor-Id", i.ID())
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= 500:
+		return true, fmt.Errorf("Webhook %s responded %s", s.URL, resp.Status)
+	}
+	return false, fmt.Errorf("Webhook %s responded %s", s.URL, resp.Status)
+}
+
+// logger returns what the sink logs through.
+func (s *webhookSink) logger() logSink {
+	return newLogSink(s.Logger, s.FieldLogger)
+}
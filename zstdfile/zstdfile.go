@@ -0,0 +1,37 @@
+// Package zstdfile compresses the files of fsmonitor.FileJournal and fsmonitor.FileSink by zstd, given paths ending
+// in ".zst", once imported:
+//
+//	import _ "github.com/Fiery/fsmonitor/zstdfile"
+//	...
+//	journal := fsmonitor.FileJournal("/var/lib/fsmonitor/journal.zst")
+//
+// Every line is a zstd frame of its own, by github.com/klauspost/compress, so files are read by zstdcat and a frame
+// torn by a crash is cut off when reopened.
+package zstdfile
+
+import (
+	"io"
+
+	"github.com/Fiery/fsmonitor"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Extension of the paths of files compressed by zstd.
+const Extension = ".zst"
+
+func init() {
+	fsmonitor.RegisterCompression(fsmonitor.Compression{
+		Extension: Extension,
+		Magic:     []byte{0x28, 0xb5, 0x2f, 0xfd},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	})
+}